@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -10,15 +10,14 @@ import (
 	"fmt"
 	"log"
 
-	"github.com/markkurossi/mpc"
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/p2p"
 )
 
 func bmrMode(file string, params *utils.Params, player int) error {
-	fmt.Printf("semi-honest secure BMR protocol\n")
-	fmt.Printf("player: %d\n", player)
+	fmt.Fprintf(statusOut, "semi-honest secure BMR protocol\n")
+	fmt.Fprintf(statusOut, "player: %d\n", player)
 
 	circ, err := loadCircuit(file, params, nil)
 	if err != nil {
@@ -30,21 +29,23 @@ func bmrMode(file string, params *utils.Params, player int) error {
 			player, len(circ.Inputs))
 	}
 
-	input, err := circ.Inputs[player].Parse(inputFlag)
+	input, err := parseInput(circ.Inputs[player])
 	if err != nil {
 		return err
 	}
 
-	for idx, arg := range circ.Inputs {
-		if idx == player {
-			fmt.Printf(" + In%d: %s\n", idx, arg)
-		} else {
-			fmt.Printf(" - In%d: %s\n", idx, arg)
+	if !jsonOutput {
+		for idx, arg := range circ.Inputs {
+			if idx == player {
+				fmt.Printf(" + In%d: %s\n", idx, arg)
+			} else {
+				fmt.Printf(" - In%d: %s\n", idx, arg)
+			}
 		}
-	}
 
-	fmt.Printf(" - Out: %s\n", circ.Outputs)
-	fmt.Printf(" - In:  %s\n", inputFlag)
+		fmt.Printf(" - Out: %s\n", circ.Outputs)
+		fmt.Printf(" - In:  %s\n", inputFlag)
+	}
 
 	// Create network.
 	addr := makeAddr(player)
@@ -73,8 +74,7 @@ func bmrMode(file string, params *utils.Params, player int) error {
 		return err
 	}
 
-	mpc.PrintResults(result, circ.Outputs)
-	return nil
+	return printResults(result, circ.Outputs)
 }
 
 func makeAddr(player int) string {
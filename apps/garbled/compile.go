@@ -28,7 +28,7 @@ func compileFiles(files []string, params *utils.Params,
 
 	for _, file := range files {
 		if compile {
-			params.CircOut, err = makeOutput(file, circFormat)
+			params.CircOut, err = makeOutput(file, circSuffix(circFormat))
 			if err != nil {
 				return err
 			}
@@ -84,6 +84,18 @@ func compileFiles(files []string, params *utils.Params,
 	return nil
 }
 
+// circSuffix returns the output file suffix for the circuit format.
+func circSuffix(format string) string {
+	switch format {
+	case "bristol-fashion":
+		return "txt"
+	case "aiger":
+		return "aig"
+	default:
+		return format
+	}
+}
+
 func makeOutput(base, suffix string) (io.WriteCloser, error) {
 	var path string
 
@@ -1,7 +1,7 @@
 //
 // main.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,11 +9,12 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"math/big"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -29,8 +30,14 @@ import (
 )
 
 var (
-	port    = ":8080"
-	verbose = false
+	listenAddr = ":8080"
+	dialAddr   = ":8080"
+	tlsConfig  *tls.Config
+	verbose    = false
+	cncS       = 0
+	jsonInput  *mpc.JSONInput
+	jsonOutput           = false
+	statusOut  io.Writer = os.Stdout
 )
 
 type input []string
@@ -52,12 +59,61 @@ func init() {
 	flag.Var(&inputFlag, "i", "comma-separated list of circuit inputs")
 }
 
+// partyInputSizes returns the sizes of the party's input values.
+func partyInputSizes() ([]int, error) {
+	if jsonInput != nil {
+		return jsonInput.Sizes()
+	}
+	return circuit.InputSizes(inputFlag)
+}
+
+// parseInput parses the party's input value for the argument.
+func parseInput(arg circuit.IOArg) (*big.Int, error) {
+	if jsonInput != nil {
+		return jsonInput.Parse(arg)
+	}
+	return arg.Parse(inputFlag)
+}
+
+func printInputs(circ *circuit.Circuit, id int) {
+	if !jsonOutput {
+		circ.PrintInputs(id, inputFlag)
+	}
+}
+
+func printResults(result []*big.Int, outputs circuit.IO) error {
+	if !jsonOutput {
+		mpc.PrintResults(result, outputs)
+		return nil
+	}
+	data, err := mpc.ResultsJSON(result, outputs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
 func main() {
 	evaluator := flag.Bool("e", false, "evaluator / garbler mode")
 	stream := flag.Bool("stream", false, "streaming mode")
+	dual := flag.Bool("dual", false,
+		"dual execution mode, secure against a malicious garbler")
+	cnc := flag.Int("cut-and-choose", 0,
+		"cut-and-choose mode with `s` garbled circuits")
+	inputFile := flag.String("input-file", "",
+		"read circuit inputs from JSON `file`")
+	outputFormat := flag.String("output-format", "text",
+		"result output format: text, json")
+	offline := flag.String("offline", "",
+		"pre-garble the circuit into the pre-garbled `file`")
+	online := flag.String("online", "",
+		"run the online phase with the pre-garbled `file`")
+	programHash := flag.String("program-hash", "",
+		"expected program hash in streaming mode")
 	compile := flag.Bool("circ", false, "compile MPCL to circuit")
 	circFormat := flag.String("format", "mpclc",
-		"circuit format: mpclc, bristol")
+		"circuit format: mpclc, bristol, bristol-fashion, aiger, blif")
 	ssa := flag.Bool("ssa", false, "compile MPCL to SSA assembly")
 	dot := flag.Bool("dot", false, "create Graphviz DOT output")
 	svg := flag.Bool("svg", false, "create SVG output")
@@ -68,6 +124,16 @@ func main() {
 	memprofile := flag.String("memprofile", "",
 		"write memory profile to `file`")
 	bmr := flag.Int("bmr", -1, "semi-honest secure BMR protocol player number")
+	fListen := flag.String("listen", listenAddr,
+		"evaluator listen address")
+	fAddr := flag.String("addr", dialAddr, "garbler evaluator address")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate `file`")
+	tlsKey := flag.String("tls-key", "", "TLS private key `file`")
+	tlsPeerCert := flag.String("tls-peer-cert", "",
+		"pinned TLS certificate `file` of the peer")
+	otAlg := flag.String("ot", "co", "oblivious transfer algorithm: co, iknp, kos")
+	fScheme := flag.String("scheme", "halfgates",
+		"garbling `scheme`: halfgates, threehalves")
 	mpclcErrLoc := flag.Bool("mpclc-err-loc", false,
 		"print MPCLC error locations")
 	benchmarkCompile := flag.Bool("benchmark-compile", false,
@@ -77,6 +143,43 @@ func main() {
 	log.SetFlags(0)
 
 	verbose = *fVerbose
+	cncS = *cnc
+	listenAddr = *fListen
+	dialAddr = *fAddr
+
+	switch *outputFormat {
+	case "text":
+	case "json":
+		jsonOutput = true
+		statusOut = os.Stderr
+	default:
+		log.Fatalf("unknown output format '%s'", *outputFormat)
+	}
+	if len(*inputFile) > 0 {
+		if len(inputFlag) > 0 {
+			log.Fatal("-i and -input-file are mutually exclusive")
+		}
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jsonInput, err = mpc.ParseJSONInput(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %s", *inputFile, err)
+		}
+	}
+
+	if len(*tlsCert) > 0 || len(*tlsKey) > 0 || len(*tlsPeerCert) > 0 {
+		if len(*tlsCert) == 0 || len(*tlsKey) == 0 || len(*tlsPeerCert) == 0 {
+			log.Fatal("TLS requires -tls-cert, -tls-key, and -tls-peer-cert")
+		}
+		var err error
+		tlsConfig, err = p2p.NewTLSConfig(*tlsCert, *tlsKey, *tlsPeerCert)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	if len(*cpuprofile) > 0 {
 		f, err := os.Create(*cpuprofile)
@@ -98,9 +201,18 @@ func main() {
 	params.MPCLCErrorLoc = *mpclcErrLoc
 	params.BenchmarkCompile = *benchmarkCompile
 
+	scheme, err := circuit.ParseScheme(*fScheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	params.Scheme = scheme
+
 	if *optimize > 0 {
 		params.OptPruneGates = true
 	}
+	if *optimize > 1 {
+		params.OptRewriteCuts = true
+	}
 	if *ssa && !*compile {
 		params.NoCircCompile = true
 	}
@@ -115,13 +227,18 @@ func main() {
 		return
 	}
 
-	var err error
-
-	oti := ot.NewCO()
+	oti, err := newOT(*otAlg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	if *stream {
+		if jsonInput != nil || jsonOutput {
+			log.Fatal("streaming mode does not support JSON input and output")
+		}
 		if *evaluator {
-			err = streamEvaluatorMode(oti, inputFlag, len(*cpuprofile) > 0)
+			err = streamEvaluatorMode(params, oti, inputFlag, *programHash,
+				flag.Args(), len(*cpuprofile) > 0)
 		} else {
 			err = streamGarblerMode(params, oti, inputFlag, flag.Args())
 		}
@@ -145,16 +262,65 @@ func main() {
 		return
 	}
 
+	if *dual && cncS > 0 {
+		log.Fatal("-dual and -cut-and-choose are mutually exclusive")
+	}
+	if params.Scheme != circuit.HalfGates &&
+		(*dual || cncS > 0 || len(*offline) > 0 || len(*online) > 0) {
+		log.Fatalf("-scheme %s is not supported with -dual, "+
+			"-cut-and-choose, -offline, and -online", params.Scheme)
+	}
+
+	if len(*offline) > 0 || len(*online) > 0 {
+		if len(*offline) > 0 && len(*online) > 0 {
+			log.Fatal("-offline and -online are mutually exclusive")
+		}
+		if *dual || cncS > 0 {
+			log.Fatal("pre-garbled circuits support only the semi-honest " +
+				"garbler-evaluator protocol")
+		}
+		if len(*offline) > 0 {
+			err = offlineMode(file, params, *evaluator, *offline)
+		} else {
+			err = onlineMode(oti, file, params, *evaluator, *online)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var dualOT ot.OT
+	if *dual {
+		dualOT, err = newOT(*otAlg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if *evaluator {
-		err = evaluatorMode(oti, file, params, len(*cpuprofile) > 0)
+		err = evaluatorMode(oti, dualOT, file, params, len(*cpuprofile) > 0)
 	} else {
-		err = garblerMode(oti, file, params)
+		err = garblerMode(oti, dualOT, file, params)
 	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+func newOT(alg string) (ot.OT, error) {
+	switch alg {
+	case "co":
+		return ot.NewCO(), nil
+	case "iknp":
+		return ot.NewIKNP(ot.NewCO()), nil
+	case "kos":
+		return ot.NewKOS(ot.NewCO()), nil
+	default:
+		return nil, fmt.Errorf("unknown OT algorithm '%s'", alg)
+	}
+}
+
 func loadCircuit(file string, params *utils.Params, inputSizes [][]int) (
 	*circuit.Circuit, error) {
 
@@ -202,32 +368,30 @@ func memProfile(file string) {
 	}
 }
 
-func evaluatorMode(oti ot.OT, file string, params *utils.Params,
+func evaluatorMode(oti, dualOT ot.OT, file string, params *utils.Params,
 	once bool) error {
 
 	inputSizes := make([][]int, 2)
-	myInputSizes, err := circuit.InputSizes(inputFlag)
+	myInputSizes, err := partyInputSizes()
 	if err != nil {
 		return err
 	}
 	inputSizes[1] = myInputSizes
 
-	ln, err := net.Listen("tcp", port)
+	ln, err := listen()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Listening for connections at %s\n", port)
+	defer ln.Close()
 
 	var oPeerInputSizes []int
 	var circ *circuit.Circuit
 
 	for {
-		nc, err := ln.Accept()
+		nc, err := accept(ln)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("New connection from %s\n", nc.RemoteAddr())
-
 		conn := p2p.NewConn(nc)
 
 		err = conn.SendInputSizes(myInputSizes)
@@ -255,38 +419,50 @@ func evaluatorMode(oti ot.OT, file string, params *utils.Params,
 			}
 			oPeerInputSizes = peerInputSizes
 		}
-		circ.PrintInputs(circuit.IDEvaluator, inputFlag)
+		printInputs(circ, circuit.IDEvaluator)
 		if len(circ.Inputs) != 2 {
 			return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
 				len(circ.Inputs))
 		}
 
-		input, err := circ.Inputs[1].Parse(inputFlag)
+		input, err := parseInput(circ.Inputs[1])
 		if err != nil {
 			conn.Close()
 			return fmt.Errorf("%s: %v", file, err)
 		}
-		result, err := circuit.Evaluator(conn, oti, circ, input, verbose)
+		var result []*big.Int
+		if dualOT != nil {
+			result, err = circuit.DualExecution(conn, oti, dualOT, circ,
+				circuit.IDEvaluator, input, verbose)
+		} else if cncS > 0 {
+			result, err = circuit.CutAndChooseEvaluator(conn, oti, circ,
+				input, cncS, verbose)
+		} else {
+			result, err = circuit.Evaluator(conn, oti, circ, input,
+				params.Scheme, verbose)
+		}
 		conn.Close()
 		if err != nil && err != io.EOF {
 			return err
 		}
-		mpc.PrintResults(result, circ.Outputs)
+		if err := printResults(result, circ.Outputs); err != nil {
+			return err
+		}
 		if once {
 			return nil
 		}
 	}
 }
 
-func garblerMode(oti ot.OT, file string, params *utils.Params) error {
+func garblerMode(oti, dualOT ot.OT, file string, params *utils.Params) error {
 	inputSizes := make([][]int, 2)
-	myInputSizes, err := circuit.InputSizes(inputFlag)
+	myInputSizes, err := partyInputSizes()
 	if err != nil {
 		return err
 	}
 	inputSizes[0] = myInputSizes
 
-	nc, err := net.Dial("tcp", port)
+	nc, err := dial()
 	if err != nil {
 		return err
 	}
@@ -314,21 +490,29 @@ func garblerMode(oti ot.OT, file string, params *utils.Params) error {
 	if err != nil {
 		return err
 	}
-	circ.PrintInputs(circuit.IDGarbler, inputFlag)
+	printInputs(circ, circuit.IDGarbler)
 	if len(circ.Inputs) != 2 {
 		return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
 			len(circ.Inputs))
 	}
 
-	input, err := circ.Inputs[0].Parse(inputFlag)
+	input, err := parseInput(circ.Inputs[0])
 	if err != nil {
 		return fmt.Errorf("%s: %v", file, err)
 	}
-	result, err := circuit.Garbler(conn, oti, circ, input, verbose)
+	var result []*big.Int
+	if dualOT != nil {
+		result, err = circuit.DualExecution(conn, oti, dualOT, circ,
+			circuit.IDGarbler, input, verbose)
+	} else if cncS > 0 {
+		result, err = circuit.CutAndChooseGarbler(conn, oti, circ, input,
+			cncS, verbose)
+	} else {
+		result, err = circuit.Garbler(conn, oti, circ, input, params.Scheme,
+			verbose)
+	}
 	if err != nil {
 		return err
 	}
-	mpc.PrintResults(result, circ.Outputs)
-
-	return nil
+	return printResults(result, circ.Outputs)
 }
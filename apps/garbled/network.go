@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func listen() (net.Listener, error) {
+	ln, err := p2p.Listen(listenAddr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		fmt.Fprintf(statusOut, "Listening for TLS connections at %s\n", listenAddr)
+	} else {
+		fmt.Fprintf(statusOut, "Listening for connections at %s\n", listenAddr)
+	}
+	return ln, nil
+}
+
+// accept accepts the next peer connection. For TLS connections, the
+// function completes the TLS handshake and skips the peers that fail
+// the peer certificate verification.
+func accept(ln net.Listener) (net.Conn, error) {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(statusOut, "New connection from %s\n", nc.RemoteAddr())
+
+		tc, ok := nc.(*tls.Conn)
+		if !ok {
+			return nc, nil
+		}
+		if err := tc.Handshake(); err != nil {
+			fmt.Fprintf(statusOut, "TLS handshake with %s failed: %s\n",
+				nc.RemoteAddr(), err)
+			nc.Close()
+			continue
+		}
+		return nc, nil
+	}
+}
+
+func dial() (net.Conn, error) {
+	return p2p.Dial(dialAddr, tlsConfig)
+}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// offlineMode runs the offline phase. The garbler garbles the circuit,
+// saves the garbler state into the pre-garbled file, and ships the
+// garbled tables to the evaluator. The evaluator saves the garbled
+// tables into its pre-garbled file.
+func offlineMode(file string, params *utils.Params, evaluator bool,
+	pgcFile string) error {
+
+	circ, err := loadCircuit(file, params, nil)
+	if err != nil {
+		return err
+	}
+
+	var pre *circuit.PreGarbled
+	if evaluator {
+		ln, err := listen()
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+
+		nc, err := accept(ln)
+		if err != nil {
+			return err
+		}
+		conn := p2p.NewConn(nc)
+		pre, err = circuit.OfflineEvaluator(conn, circ)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		pre, err = circ.PreGarble()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(pgcFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = pre.Marshal(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(pgcFile)
+		return err
+	}
+	if evaluator {
+		return nil
+	}
+
+	nc, err := dial()
+	if err != nil {
+		return err
+	}
+	conn := p2p.NewConn(nc)
+	err = circuit.OfflineGarbler(conn, pre)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// onlineMode runs the online phase with the pre-garbled circuit. The
+// garbler removes its pre-garbled file after the online phase so that
+// the garbled circuit is not evaluated twice.
+func onlineMode(oti ot.OT, file string, params *utils.Params,
+	evaluator bool, pgcFile string) error {
+
+	circ, err := loadCircuit(file, params, nil)
+	if err != nil {
+		return err
+	}
+	if len(circ.Inputs) != 2 {
+		return fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
+			len(circ.Inputs))
+	}
+	f, err := os.Open(pgcFile)
+	if err != nil {
+		return err
+	}
+	pre, err := circuit.ParsePreGarbled(f, circ)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", pgcFile, err)
+	}
+	if pre.Evaluator() != evaluator {
+		return fmt.Errorf("%s: pre-garbled circuit is for the peer", pgcFile)
+	}
+
+	id := circuit.IDGarbler
+	if evaluator {
+		id = circuit.IDEvaluator
+	}
+	printInputs(circ, id)
+	input, err := parseInput(circ.Inputs[id])
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	var conn *p2p.Conn
+	if evaluator {
+		ln, err := listen()
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+
+		nc, err := accept(ln)
+		if err != nil {
+			return err
+		}
+		conn = p2p.NewConn(nc)
+	} else {
+		nc, err := dial()
+		if err != nil {
+			return err
+		}
+		conn = p2p.NewConn(nc)
+		defer os.Remove(pgcFile)
+	}
+	defer conn.Close()
+
+	var result []*big.Int
+	if evaluator {
+		result, err = circuit.OnlineEvaluator(conn, oti, circ, pre, input,
+			verbose)
+	} else {
+		result, err = circuit.OnlineGarbler(conn, oti, circ, pre, input,
+			verbose)
+	}
+	if err != nil {
+		return err
+	}
+	return printResults(result, circ.Outputs)
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,9 +7,10 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"net"
 	"strings"
 
 	"github.com/markkurossi/mpc"
@@ -20,25 +21,29 @@ import (
 	"github.com/markkurossi/mpc/p2p"
 )
 
-func streamEvaluatorMode(oti ot.OT, input input, once bool) error {
+func streamEvaluatorMode(params *utils.Params, oti ot.OT, input input,
+	programHash string, args []string, once bool) error {
+
 	inputSizes, err := circuit.InputSizes(input)
 	if err != nil {
 		return err
 	}
+	verifier, err := newStreamVerifier(params, inputSizes, programHash, args)
+	if err != nil {
+		return err
+	}
 
-	ln, err := net.Listen("tcp", port)
+	ln, err := listen()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Listening for connections at %s\n", port)
+	defer ln.Close()
 
 	for {
-		nc, err := ln.Accept()
+		nc, err := accept(ln)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("New connection from %s\n", nc.RemoteAddr())
-
 		conn := p2p.NewConn(nc)
 
 		err = conn.SendInputSizes(inputSizes)
@@ -52,8 +57,8 @@ func streamEvaluatorMode(oti ot.OT, input input, once bool) error {
 			return err
 		}
 
-		outputs, result, err := circuit.StreamEvaluator(conn, oti, input,
-			verbose)
+		outputs, result, err := circuit.StreamEvaluator(conn, oti,
+			params.Scheme, input, verifier, verbose)
 		conn.Close()
 
 		if err != nil && err != io.EOF {
@@ -67,6 +72,65 @@ func streamEvaluatorMode(oti ot.OT, input input, once bool) error {
 	}
 }
 
+// newStreamVerifier creates a verifier for the streamed program. The
+// expected program hash is either specified with the programHash or
+// computed by compiling the MPCL program from args.
+func newStreamVerifier(params *utils.Params, inputSizes []int,
+	programHash string, args []string) (circuit.StreamVerifier, error) {
+
+	var expected []byte
+	if len(programHash) > 0 {
+		var err error
+		expected, err = hex.DecodeString(programHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid program hash: %s", err)
+		}
+	}
+	if len(args) == 0 {
+		if expected == nil {
+			return nil, nil
+		}
+		return func(in1, in2 circuit.IOArg, outputs circuit.IO) (
+			[]byte, error) {
+			return expected, nil
+		}, nil
+	}
+	if len(args) != 1 || !strings.HasSuffix(args[0], ".mpcl") {
+		return nil, fmt.Errorf("streaming mode takes single MPCL file")
+	}
+	file := args[0]
+
+	return func(in1, in2 circuit.IOArg, outputs circuit.IO) ([]byte, error) {
+		// The garbler's input sizes come from its program arguments.
+		var peerSizes []int
+		if len(in1.Compound) > 0 {
+			for _, arg := range in1.Compound {
+				peerSizes = append(peerSizes, int(arg.Type.Bits))
+			}
+		} else {
+			peerSizes = append(peerSizes, int(in1.Type.Bits))
+		}
+		in, out, hash, err := compiler.New(params).StreamHashFile(file,
+			[][]int{peerSizes, inputSizes})
+		if err != nil {
+			return nil, err
+		}
+		if in[0].String() != in1.String() || in[1].String() != in2.String() {
+			return nil, fmt.Errorf("program inputs mismatch: got %s, "+
+				"expected %s", circuit.IO{in1, in2}, in)
+		}
+		if out.String() != outputs.String() {
+			return nil, fmt.Errorf("program outputs mismatch: got %s, "+
+				"expected %s", outputs, out)
+		}
+		if expected != nil && !bytes.Equal(hash, expected) {
+			return nil, fmt.Errorf("program hash %x does not match %x",
+				hash, expected)
+		}
+		return hash, nil
+	}, nil
+}
+
 func streamGarblerMode(params *utils.Params, oti ot.OT, input input,
 	args []string) error {
 
@@ -81,7 +145,7 @@ func streamGarblerMode(params *utils.Params, oti ot.OT, input input,
 	if len(args) != 1 || !strings.HasSuffix(args[0], ".mpcl") {
 		return fmt.Errorf("streaming mode takes single MPCL file")
 	}
-	nc, err := net.Dial("tcp", port)
+	nc, err := dial()
 	if err != nil {
 		return err
 	}
@@ -7,10 +7,12 @@
 package bmr
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/types"
 )
 
 func Test3Party(t *testing.T) {
@@ -18,7 +20,40 @@ func Test3Party(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not load circuit: %s", err)
 	}
+	players := play(t, circuit, true)
+	verifyTables(t, players)
+}
+
+func TestGates(t *testing.T) {
+	bit := types.Info{
+		Type:       types.TUint,
+		IsConcrete: true,
+		Bits:       1,
+	}
+	c := &circuit.Circuit{
+		NumGates: 5,
+		NumWires: 8,
+		Inputs: circuit.IO{
+			{Name: "a", Type: bit},
+			{Name: "b", Type: bit},
+			{Name: "c", Type: bit},
+		},
+		Outputs: circuit.IO{
+			{Type: bit},
+		},
+		Gates: []circuit.Gate{
+			{Input0: 0, Input1: 1, Output: 3, Op: circuit.XOR},
+			{Input0: 3, Output: 4, Op: circuit.INV},
+			{Input0: 4, Input1: 2, Output: 5, Op: circuit.OR},
+			{Input0: 5, Input1: 0, Output: 6, Op: circuit.XNOR},
+			{Input0: 6, Input1: 1, Output: 7, Op: circuit.AND},
+		},
+	}
+	players := play(t, c, false)
+	verifyTables(t, players)
+}
 
+func play(t *testing.T, circuit *circuit.Circuit, verbose bool) []*Player {
 	const n = 3
 	var players []*Player
 
@@ -45,14 +80,85 @@ func Test3Party(t *testing.T) {
 	}
 
 	// Start other peers.
+	errs := make(chan error)
 	for i := 1; i < n; i++ {
-		go players[i].Play()
+		go func(p *Player) {
+			errs <- p.Play()
+		}(players[i])
 	}
 
 	// Play player 0.
-	players[0].Verbose = true
-	err = players[0].Play()
+	players[0].Verbose = verbose
+	err := players[0].Play()
 	if err != nil {
 		t.Fatalf("Play: %v", err)
 	}
+	for i := 1; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Play: %v", err)
+		}
+	}
+	return players
+}
+
+// verifyTables verifies that the players' garbled tables decrypt to
+// the output wire labels of the gate functions.
+func verifyTables(t *testing.T, players []*Player) {
+	lambda := new(big.Int)
+	for _, p := range players {
+		lambda.Xor(lambda, p.lambda)
+	}
+	for _, p := range players {
+		if len(p.Tables()) != len(p.gates) {
+			t.Fatalf("player %d: got %d tables, expected %d",
+				p.id, len(p.Tables()), len(p.gates))
+		}
+	}
+	for g, gate := range players[0].gates {
+		lu := lambda.Bit(int(gate.Input0))
+		lv := lambda.Bit(int(gate.Input1))
+		lw := lambda.Bit(int(gate.Output))
+
+		for row := 0; row < 4; row++ {
+			a := uint(row>>1) & 1
+			b := uint(row) & 1
+
+			u := lu ^ a
+			v := lv ^ b
+			var w uint
+			if gate.Op == circuit.OR {
+				w = u | v
+			} else {
+				w = u & v
+			}
+			chi := w ^ lw
+
+			for j, pj := range players {
+				l := pj.Tables()[g][row][j]
+				for i, pi := range players {
+					if !pi.Tables()[g][row][j].Equal(pj.Tables()[g][row][j]) {
+						t.Errorf("gate %d row %d: players %d and %d "+
+							"have different tables", g, row, i, j)
+					}
+					ka := pi.wires[gate.Input0].L0
+					if a == 1 {
+						ka = pi.wires[gate.Input0].L1
+					}
+					kb := pi.wires[gate.Input1].L0
+					if b == 1 {
+						kb = pi.wires[gate.Input1].L1
+					}
+					l.Xor(prf(ka, kb, g, j))
+				}
+				expected := pj.wires[gate.Output].L0
+				if chi == 1 {
+					expected = pj.wires[gate.Output].L1
+				}
+				if !l.Equal(expected) {
+					t.Errorf("gate %d row %d: player %d key %v, expected %v",
+						g, row, j, l, expected)
+				}
+			}
+		}
+	}
 }
@@ -15,4 +15,6 @@ type Operand byte
 const (
 	OpInit Operand = iota
 	OpFx
+	OpFxk
+	OpGates
 )
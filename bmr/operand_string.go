@@ -10,11 +10,13 @@ func _() {
 	var x [1]struct{}
 	_ = x[OpInit-0]
 	_ = x[OpFx-1]
+	_ = x[OpFxk-2]
+	_ = x[OpGates-3]
 }
 
-const _Operand_name = "InitFx"
+const _Operand_name = "InitFxFxkGates"
 
-var _Operand_index = [...]uint8{0, 4, 6}
+var _Operand_index = [...]uint8{0, 4, 6, 9, 14}
 
 func (i Operand) String() string {
 	if i >= Operand(len(_Operand_index)-1) {
@@ -8,8 +8,9 @@ package bmr
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
-	"io"
 	"math/big"
 
 	"github.com/markkurossi/mpc/circuit"
@@ -26,51 +27,185 @@ const (
 // Player implements a multi-party player.
 type Player struct {
 	Verbose    bool
-	ot         ot.OT
 	id         int
 	numPlayers int
 	r          Label
 	peers      []*Peer
 	c          *circuit.Circuit
 	lambda     *big.Int
+	wires      []Wire
+	gates      []circuit.Gate
+	tables     []Table
 }
 
+// Table holds the garbled table of an AND or OR gate. The rows are
+// indexed by the masked input values 2a+b and each row holds the
+// encrypted output wire labels of all players.
+type Table [4][]Label
+
 // Peer contains information about a protocol peer.
 type Peer struct {
-	this *Player
-	id   int
-	conn ot.IO
-	ot   ot.OT
+	this     *Player
+	id       int
+	conn     ot.IO
+	sender   ot.OT
+	receiver ot.OT
 }
 
-func (peer *Peer) consumer() {
-	peer.this.Debugf("consumer for peer%s\n", superscript.Itoa(peer.id))
-	for {
-		v, err := peer.conn.ReceiveByte()
-		if err != nil {
-			if err != io.EOF {
-				fmt.Printf("consumer: %v\n", err)
+// leader tests if this player leads the protocol steps with the
+// peer. The player with the smaller ID sends first in each step.
+func (peer *Peer) leader() bool {
+	return peer.this.id < peer.id
+}
+
+// sync starts the protocol step op with the peer.
+func (peer *Peer) sync(op Operand) error {
+	if peer.leader() {
+		peer.this.Debugf("%s%s\n", op, superscript.Itoa(peer.id))
+		if err := peer.conn.SendByte(byte(op)); err != nil {
+			return err
+		}
+		return peer.conn.Flush()
+	}
+	v, err := peer.conn.ReceiveByte()
+	if err != nil {
+		return err
+	}
+	if Operand(v) != op {
+		return fmt.Errorf("protocol error: got %s, expected %s",
+			Operand(v), op)
+	}
+	return nil
+}
+
+// init initializes the oblivious transfers in both directions.
+func (peer *Peer) init() error {
+	if err := peer.sync(OpInit); err != nil {
+		return err
+	}
+	if peer.leader() {
+		if err := peer.sender.InitSender(peer.conn); err != nil {
+			return err
+		}
+		return peer.receiver.InitReceiver(peer.conn)
+	}
+	if err := peer.receiver.InitReceiver(peer.conn); err != nil {
+		return err
+	}
+	return peer.sender.InitSender(peer.conn)
+}
+
+// fx runs the secure multiplication Fx in both directions. The
+// function multiplies our a values with the peer's b values, and the
+// peer's a values with our b values. It returns our XOR shares of
+// the products.
+func (peer *Peer) fx(a, b []uint) ([]uint, error) {
+	if err := peer.sync(OpFx); err != nil {
+		return nil, err
+	}
+	result := make([]uint, len(a))
+	for i := range a {
+		var r, xb uint
+		var err error
+		if peer.leader() {
+			r, err = FxSend(peer.sender, a[i])
+			if err == nil {
+				xb, err = FxReceive(peer.receiver, b[i])
+			}
+		} else {
+			xb, err = FxReceive(peer.receiver, b[i])
+			if err == nil {
+				r, err = FxSend(peer.sender, a[i])
 			}
-			return
 		}
-		op := Operand(v)
-		peer.this.Debugf("%s\n", op)
-		switch op {
-		case OpInit:
-			err = peer.ot.InitReceiver(peer.conn)
-			if err != nil {
-				fmt.Printf("%s: %s\n", op, err)
-				return
+		if err != nil {
+			return nil, err
+		}
+		result[i] = r ^ xb
+	}
+	return result, nil
+}
+
+// fxk runs the secure multiplication Fxk in both directions. The
+// function multiplies our key offset with the peer's bits, and the
+// peer's key offset with our bits. It returns our random pads for
+// the products of our offset, and our XOR shares of the products of
+// the peer's offset.
+func (peer *Peer) fxk(bits []uint) (pads, shares []Label, err error) {
+	if err := peer.sync(OpFxk); err != nil {
+		return nil, nil, err
+	}
+	pads = make([]Label, len(bits))
+	shares = make([]Label, len(bits))
+	for i := range bits {
+		if peer.leader() {
+			pads[i], err = FxkSend(peer.sender, peer.this.r)
+			if err == nil {
+				shares[i], err = FxkReceive(peer.receiver, bits[i])
+			}
+		} else {
+			shares[i], err = FxkReceive(peer.receiver, bits[i])
+			if err == nil {
+				pads[i], err = FxkSend(peer.sender, peer.this.r)
 			}
 		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return pads, shares, nil
+}
+
+// exchange sends our labels to the peer and returns the peer's
+// labels.
+func (peer *Peer) exchange(labels []Label) ([]Label, error) {
+	if err := peer.sync(OpGates); err != nil {
+		return nil, err
+	}
+	if peer.leader() {
+		if err := peer.sendLabels(labels); err != nil {
+			return nil, err
+		}
+		return peer.receiveLabels(len(labels))
+	}
+	result, err := peer.receiveLabels(len(labels))
+	if err != nil {
+		return nil, err
+	}
+	return result, peer.sendLabels(labels)
+}
+
+func (peer *Peer) sendLabels(labels []Label) error {
+	data := make([]byte, 0, len(labels)*k/8)
+	for _, l := range labels {
+		data = append(data, l[:]...)
+	}
+	if err := peer.conn.SendData(data); err != nil {
+		return err
+	}
+	return peer.conn.Flush()
+}
+
+func (peer *Peer) receiveLabels(count int) ([]Label, error) {
+	data, err := peer.conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != count*k/8 {
+		return nil, fmt.Errorf("invalid labels: got %d bytes, expected %d",
+			len(data), count*k/8)
+	}
+	result := make([]Label, count)
+	for i := range result {
+		copy(result[i][:], data[i*k/8:])
 	}
+	return result, nil
 }
 
 // NewPlayer creates a new multi-party player.
 func NewPlayer(id, numPlayers int) (*Player, error) {
 	return &Player{
 		id:         id,
-		ot:         ot.NewCO(),
 		numPlayers: numPlayers,
 		peers:      make([]*Peer, numPlayers),
 	}, nil
@@ -103,34 +238,63 @@ func (p *Player) SetCircuit(c *circuit.Circuit) error {
 // AddPeer adds a peer.
 func (p *Player) AddPeer(idx int, peer ot.IO) {
 	p.peers[idx] = &Peer{
-		this: p,
-		id:   idx,
-		conn: peer,
-		ot:   ot.NewCO(),
+		this:     p,
+		id:       idx,
+		conn:     peer,
+		sender:   ot.NewCO(),
+		receiver: ot.NewCO(),
 	}
 }
 
-// Play runs the protocol with the peers.
-func (p *Player) Play() error {
-	// Init peers.
-	for _, peer := range p.peers {
-		if peer != nil {
-			// Start consumer.
-			go peer.consumer()
+// Tables returns the garbled tables of the circuit's AND and OR
+// gates in the circuit order. The tables are available after Play
+// has completed the offline phase.
+func (p *Player) Tables() []Table {
+	return p.tables
+}
 
-			// Init protocol.
-			err := peer.conn.SendByte(byte(OpInit))
-			if err != nil {
-				return err
-			}
-			err = p.ot.InitSender(peer.conn)
+// forPeers runs the function concurrently for all peers.
+func (p *Player) forPeers(f func(peer *Peer) error) error {
+	errs := make(chan error)
+	var count int
+	for _, peer := range p.peers {
+		if peer == nil {
+			continue
+		}
+		count++
+		go func(peer *Peer) {
+			err := f(peer)
 			if err != nil {
-				return err
+				err = fmt.Errorf("peer%s: %s", superscript.Itoa(peer.id), err)
 			}
+			errs <- err
+		}(peer)
+	}
+	var result error
+	for i := 0; i < count; i++ {
+		err := <-errs
+		if err != nil && result == nil {
+			result = err
 		}
 	}
+	return result
+}
 
-	err := p.offlinePhase()
+// Play runs the protocol with the peers.
+func (p *Player) Play() error {
+	if p.c == nil {
+		return fmt.Errorf("no circuit")
+	}
+
+	// Init peers.
+	err := p.forPeers(func(peer *Peer) error {
+		return peer.init()
+	})
+	if err != nil {
+		return err
+	}
+
+	err = p.offlinePhase()
 	if err != nil {
 		return err
 	}
@@ -163,7 +327,7 @@ func (p *Player) offlinePhase() error {
 	// bits initially for all wires but later reset the output bits of
 	// XOR gates.
 	p.lambda, err = rand.Int(rand.Reader,
-		big.NewInt(int64((1<<p.c.NumWires)-1)))
+		new(big.Int).Lsh(big.NewInt(1), uint(p.c.NumWires)))
 	if err != nil {
 		return err
 	}
@@ -201,33 +365,54 @@ func (p *Player) offlinePhase() error {
 	p.Debugf("%c%s:\t%v\n", symbols.Lambda, p.IDString(), p.lambda.Text(2))
 
 	// Step 3: patch output wires and permutation bits for XOR output
-	// wires.
+	// wires. The player 0 negates the permutation bits of the XNOR
+	// and INV output wires.
+	var negate uint
+	if p.id == 0 {
+		negate = 1
+	}
 	for i := 0; i < p.c.NumGates; i++ {
-		if p.c.Gates[i].Op != circuit.XOR {
-			continue
-		}
-		i0 := int(p.c.Gates[i].Input0)
-		i1 := int(p.c.Gates[i].Input1)
-		ow := int(p.c.Gates[i].Output)
+		gate := p.c.Gates[i]
+		i0 := int(gate.Input0)
+		i1 := int(gate.Input1)
+		ow := int(gate.Output)
+
+		switch gate.Op {
+		case circuit.XOR, circuit.XNOR:
+			// 3.a: set permutation bit: λ_w = λ_u ⊕ λ_v
 
-		// 3.a: set permutation bit: λ_w = λ_u ⊕ λ_v
+			li0 := p.lambda.Bit(i0)
+			li1 := p.lambda.Bit(i1)
+
+			lo := li0 ^ li1
+			if gate.Op == circuit.XNOR {
+				lo ^= negate
+			}
+			p.lambda.SetBit(p.lambda, ow, lo)
 
-		li0 := p.lambda.Bit(i0)
-		li1 := p.lambda.Bit(i1)
+			p.Debugf("%c[%d]: %v ^ %v = %v\n", symbols.Lambda, ow,
+				li0, li1, lo)
 
-		lo := li0 ^ li1
-		p.lambda.SetBit(p.lambda, ow, lo)
+			// 3.b: set garbled label on wire 0: k_{w,0} = k_{u,0} ⊕ k_{v,0}
+			wires[ow].L0 = wires[i0].L0
+			wires[ow].L0.Xor(wires[i1].L0)
 
-		p.Debugf("%c[%d]: %v ^ %v = %v\n", symbols.Lambda, ow, li0, li1, lo)
+			// 3.b: set garbled label on wire 1: k_{w,1} = k_{w,0} ⊕ R^i
+			wires[ow].L1 = wires[ow].L0
+			wires[ow].L1.Xor(p.r)
 
-		// 3.b: set garbled label on wire 0: k_{w,0} = k_{u,0} ⊕ k_{v,0}
-		wires[ow].L0 = wires[i0].L0
-		wires[ow].L0.Xor(wires[i1].L0)
+		case circuit.INV:
+			p.lambda.SetBit(p.lambda, ow, p.lambda.Bit(i0)^negate)
+			wires[ow] = wires[i0]
 
-		// 3.b: set garbled label on wire 1: k_{w,1} = k_{w,0} ⊕ R^i
-		wires[ow].L1 = wires[ow].L0
-		wires[ow].L1.Xor(p.r)
+		case circuit.AND, circuit.OR:
+			p.gates = append(p.gates, gate)
+
+		default:
+			return fmt.Errorf("invalid gate %s", gate.Op)
+		}
 	}
+	p.wires = wires
 
 	for i := 0; i < len(wires); i++ {
 		p.Debugf("W%d:\t%v\n", i, wires[i])
@@ -235,5 +420,163 @@ func (p *Player) offlinePhase() error {
 
 	p.Debugf("%c%s:\t%v\n", symbols.Lambda, p.IDString(), p.lambda.Text(2))
 
+	// Step 4: compute XOR shares of λ_uvw = λ_u·λ_v ⊕ λ_w for the AND
+	// and OR gates. The cross products of the players' λ_u and λ_v
+	// shares are computed with the secure multiplication Fx.
+	luvw := make([]uint, len(p.gates))
+	lu := make([]uint, len(p.gates))
+	lv := make([]uint, len(p.gates))
+	for g, gate := range p.gates {
+		lu[g] = p.lambda.Bit(int(gate.Input0))
+		lv[g] = p.lambda.Bit(int(gate.Input1))
+		luvw[g] = lu[g]&lv[g] ^ p.lambda.Bit(int(gate.Output))
+	}
+	products := make([][]uint, p.numPlayers)
+	err = p.forPeers(func(peer *Peer) error {
+		product, err := peer.fx(lv, lu)
+		products[peer.id] = product
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		for g := range product {
+			luvw[g] ^= product[g]
+		}
+	}
+
+	// Step 5: compute XOR shares of R^j multiplied by λ_uvw, λ_u,
+	// and λ_v for all players j with the secure multiplication Fxk.
+	bits := make([]uint, 0, len(p.gates)*3)
+	for g := range p.gates {
+		bits = append(bits, luvw[g], lu[g], lv[g])
+	}
+	pads := make([][]Label, p.numPlayers)
+	rShares := make([][]Label, p.numPlayers)
+	err = p.forPeers(func(peer *Peer) error {
+		pad, share, err := peer.fxk(bits)
+		pads[peer.id] = pad
+		rShares[peer.id] = share
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	our := make([]Label, len(bits))
+	for i, bit := range bits {
+		if bit == 1 {
+			our[i] = p.r
+		}
+		for _, pad := range pads {
+			if pad != nil {
+				our[i].Xor(pad[i])
+			}
+		}
+	}
+	rShares[p.id] = our
+
+	// Step 6: compute our shares of the garbled tables and open the
+	// tables with the peers.
+	shares := p.garble(rShares)
+
+	tables := make([][]Label, p.numPlayers)
+	err = p.forPeers(func(peer *Peer) error {
+		table, err := peer.exchange(shares)
+		tables[peer.id] = table
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		for i := range table {
+			shares[i].Xor(table[i])
+		}
+	}
+
+	p.tables = make([]Table, len(p.gates))
+	for g := range p.tables {
+		for row := 0; row < 4; row++ {
+			start := (g*4 + row) * p.numPlayers
+			p.tables[g][row] = shares[start : start+p.numPlayers]
+		}
+	}
+	for g, table := range p.tables {
+		p.Debugf("G%d:\t%v\n", g, table)
+	}
+
 	return nil
 }
+
+// garble computes our shares of the garbled table rows:
+//
+//	F(k^i_{u,a}, k^i_{v,b}, g|j) ⊕ k^j_{w,0} ⊕ χ_{a,b}·R^j
+//
+// where χ_{a,b} = f(λ_u ⊕ a, λ_v ⊕ b) ⊕ λ_w. The function returns
+// the rows of all gates, each row having the keys of all players j.
+func (p *Player) garble(rShares [][]Label) []Label {
+	var result []Label
+
+	for g, gate := range p.gates {
+		// The gate function as f(a,b) = ca·a ⊕ cb·b ⊕ a·b so χ_{a,b}
+		// = λ_uvw ⊕ (ca ⊕ b)·λ_u ⊕ (cb ⊕ a)·λ_v ⊕ f(a,b).
+		var ca, cb bool
+		if gate.Op == circuit.OR {
+			ca = true
+			cb = true
+		}
+		for row := 0; row < 4; row++ {
+			a := row&0x2 != 0
+			b := row&0x1 != 0
+
+			ka := p.wires[gate.Input0].L0
+			if a {
+				ka = p.wires[gate.Input0].L1
+			}
+			kb := p.wires[gate.Input1].L0
+			if b {
+				kb = p.wires[gate.Input1].L1
+			}
+			constant := (ca && a) != (cb && b) != (a && b)
+
+			for j := 0; j < p.numPlayers; j++ {
+				l := prf(ka, kb, g, j)
+
+				shares := rShares[j][g*3 : g*3+3]
+				l.Xor(shares[0])
+				if ca != b {
+					l.Xor(shares[1])
+				}
+				if cb != a {
+					l.Xor(shares[2])
+				}
+				if j == p.id {
+					l.Xor(p.wires[gate.Output].L0)
+					if constant {
+						l.Xor(p.r)
+					}
+				}
+				result = append(result, l)
+			}
+		}
+	}
+	return result
+}
+
+// prf implements the double-key pseudo-random function F_{ka,kb}(g|j)
+// for the player j's key of the gate g.
+func prf(ka, kb Label, g, j int) Label {
+	var buf [2*k/8 + 8]byte
+
+	copy(buf[0:], ka[:])
+	copy(buf[k/8:], kb[:])
+	binary.BigEndian.PutUint32(buf[2*k/8:], uint32(g))
+	binary.BigEndian.PutUint32(buf[2*k/8+4:], uint32(j))
+
+	sum := sha256.Sum256(buf[:])
+
+	var result Label
+	copy(result[:], sum[:])
+	return result
+}
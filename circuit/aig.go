@@ -0,0 +1,407 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// aig implements an and-inverter graph for the AIGER and BLIF
+// formats. The variable 0 is the constant false, the variables
+// 1...numInputs are the inputs, and the rest of the variables are AND
+// nodes. The literals are 2*variable+negation.
+type aig struct {
+	numInputs int
+	ands      [][2]uint32
+	hash      map[[2]uint32]uint32
+}
+
+func newAIG(numInputs int) *aig {
+	return &aig{
+		numInputs: numInputs,
+		hash:      make(map[[2]uint32]uint32),
+	}
+}
+
+// input returns the literal of the input.
+func (g *aig) input(idx int) uint32 {
+	return uint32(idx+1) << 1
+}
+
+// and returns the literal of AND(x, y).
+func (g *aig) and(x, y uint32) uint32 {
+	if x < y {
+		x, y = y, x
+	}
+	switch {
+	case y == 0:
+		return 0
+	case y == 1:
+		return x
+	case x == y:
+		return x
+	case x == y^1:
+		return 0
+	}
+	key := [2]uint32{x, y}
+	lit, ok := g.hash[key]
+	if !ok {
+		g.ands = append(g.ands, key)
+		lit = uint32(g.numInputs+len(g.ands)) << 1
+		g.hash[key] = lit
+	}
+	return lit
+}
+
+func (g *aig) or(x, y uint32) uint32 {
+	return g.and(x^1, y^1) ^ 1
+}
+
+func (g *aig) xor(x, y uint32) uint32 {
+	return g.or(g.and(x, y^1), g.and(x^1, y))
+}
+
+// node returns the AND node of the variable v.
+func (g *aig) node(v uint32) ([2]uint32, bool) {
+	if v <= uint32(g.numInputs) {
+		return [2]uint32{}, false
+	}
+	return g.ands[v-uint32(g.numInputs)-1], true
+}
+
+// xorPattern tests if the variable v implements XOR(p, q) as
+// AND(NOT(AND(p, q)), NOT(AND(NOT(p), NOT(q)))). If so, the function
+// returns the literals p and q.
+func (g *aig) xorPattern(v uint32) (uint32, uint32, bool) {
+	n, ok := g.node(v)
+	if !ok || n[0]&1 == 0 || n[1]&1 == 0 {
+		return 0, 0, false
+	}
+	x, ok := g.node(n[0] >> 1)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := g.node(n[1] >> 1)
+	if !ok {
+		return 0, 0, false
+	}
+	p, q := x[0], x[1]
+	if (y[0] == p^1 && y[1] == q^1) || (y[0] == q^1 && y[1] == p^1) {
+		return p, q, true
+	}
+	return 0, 0, false
+}
+
+// circuitAIG converts the circuit into an AIG. The function returns
+// the AIG and the literals of the circuit output bits.
+func circuitAIG(c *Circuit) (*aig, []uint32, error) {
+	numInputs := c.Inputs.Size()
+	g := newAIG(numInputs)
+
+	lits := make([]uint32, c.NumWires)
+	for i := 0; i < numInputs; i++ {
+		lits[i] = g.input(i)
+	}
+	for _, gate := range c.Gates {
+		var lit uint32
+		switch gate.Op {
+		case XOR:
+			lit = g.xor(lits[gate.Input0], lits[gate.Input1])
+		case XNOR:
+			lit = g.xor(lits[gate.Input0], lits[gate.Input1]) ^ 1
+		case AND:
+			lit = g.and(lits[gate.Input0], lits[gate.Input1])
+		case OR:
+			lit = g.or(lits[gate.Input0], lits[gate.Input1])
+		case INV:
+			lit = lits[gate.Input0] ^ 1
+		default:
+			return nil, nil, fmt.Errorf("unsupported gate type %s", gate.Op)
+		}
+		lits[gate.Output] = lit
+	}
+	return g, lits[c.NumWires-c.Outputs.Size():], nil
+}
+
+// circuit converts the AIG into a circuit with the output bits
+// results. The function recovers the XOR gates from their AND
+// implementations.
+func (g *aig) circuit(inputs, outputs IO, results []uint32) (
+	*Circuit, error) {
+
+	if inputs.Size() != g.numInputs {
+		return nil, fmt.Errorf("inputs %d do not match AIG inputs %d",
+			inputs.Size(), g.numInputs)
+	}
+	if outputs.Size() != len(results) {
+		return nil, fmt.Errorf("outputs %d do not match AIG outputs %d",
+			outputs.Size(), len(results))
+	}
+	if g.numInputs == 0 {
+		return nil, fmt.Errorf("no inputs defined")
+	}
+	conv := &aigConverter{
+		g:    g,
+		b:    newBuilder(g.numInputs),
+		lits: make(map[uint32]Wire),
+	}
+	var wires []Wire
+	for _, lit := range results {
+		w, err := conv.lit(lit)
+		if err != nil {
+			return nil, err
+		}
+		wires = append(wires, w)
+	}
+	return conv.b.circuit(inputs, outputs, wires), nil
+}
+
+type aigConverter struct {
+	g    *aig
+	b    *builder
+	lits map[uint32]Wire
+}
+
+func (conv *aigConverter) lit(l uint32) (Wire, error) {
+	v := l >> 1
+	neg := l & 1
+	if v == 0 {
+		return conv.b.constant(uint(neg)), nil
+	}
+	if w, ok := conv.lits[l]; ok {
+		return w, nil
+	}
+	if v > uint32(conv.g.numInputs+len(conv.g.ands)) {
+		return 0, fmt.Errorf("invalid literal %d", l)
+	}
+	var w Wire
+	if p, q, ok := conv.g.xorPattern(v); ok {
+		a, err := conv.lit(p &^ 1)
+		if err != nil {
+			return 0, err
+		}
+		b, err := conv.lit(q &^ 1)
+		if err != nil {
+			return 0, err
+		}
+		op := XOR
+		if (p^q^l)&1 == 1 {
+			op = XNOR
+		}
+		w = conv.b.gate(op, a, b)
+	} else if n, ok := conv.g.node(v); ok && neg == 1 && n[0]&n[1]&1 == 1 {
+		// NOT(AND(NOT(x), NOT(y))) = OR(x, y)
+		x, err := conv.lit(n[0] ^ 1)
+		if err != nil {
+			return 0, err
+		}
+		y, err := conv.lit(n[1] ^ 1)
+		if err != nil {
+			return 0, err
+		}
+		w = conv.b.gate(OR, x, y)
+	} else if neg == 1 {
+		x, err := conv.lit(l ^ 1)
+		if err != nil {
+			return 0, err
+		}
+		w = conv.b.gate(INV, x, 0)
+	} else if v <= uint32(conv.g.numInputs) {
+		w = Wire(v - 1)
+	} else {
+		n, _ := conv.g.node(v)
+		x, err := conv.lit(n[0])
+		if err != nil {
+			return 0, err
+		}
+		y, err := conv.lit(n[1])
+		if err != nil {
+			return 0, err
+		}
+		w = conv.b.gate(AND, x, y)
+	}
+	conv.lits[l] = w
+	return w, nil
+}
+
+// ioMetaPrefix prefixes the comment that stores the circuit input
+// and output arguments in the AIGER and BLIF files.
+const ioMetaPrefix = "mpc-io "
+
+// marshalIOMeta encodes the circuit inputs and outputs into a comment
+// string.
+func marshalIOMeta(inputs, outputs IO) (string, error) {
+	var buf bytes.Buffer
+
+	if err := binary.Write(&buf, bo, uint32(len(inputs))); err != nil {
+		return "", err
+	}
+	for _, arg := range inputs {
+		if err := marshalIOArg(&buf, arg); err != nil {
+			return "", err
+		}
+	}
+	if err := binary.Write(&buf, bo, uint32(len(outputs))); err != nil {
+		return "", err
+	}
+	for _, arg := range outputs {
+		if err := marshalIOArg(&buf, arg); err != nil {
+			return "", err
+		}
+		if err := buf.WriteByte(byte(arg.Owner)); err != nil {
+			return "", err
+		}
+	}
+	return ioMetaPrefix + hex.EncodeToString(buf.Bytes()), nil
+}
+
+// parseIOMeta decodes the circuit inputs and outputs from the comment
+// string.
+func parseIOMeta(comment string) (inputs, outputs IO, err error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(comment, ioMetaPrefix))
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	var count uint32
+	if err := binary.Read(r, bo, &count); err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i < int(count); i++ {
+		arg, err := parseIOArg(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs = append(inputs, arg)
+	}
+	if err := binary.Read(r, bo, &count); err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i < int(count); i++ {
+		arg, err := parseIOArg(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		owner, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		arg.Owner = Owner(owner)
+		if _, ok := ownerNames[arg.Owner]; !ok {
+			return nil, nil, fmt.Errorf("invalid output owner %s", arg.Owner)
+		}
+		outputs = append(outputs, arg)
+	}
+	return inputs, outputs, nil
+}
+
+// ioSymbols returns the names of the bits of the arguments io. The
+// bits are named as name[bit], and the arguments without a valid or
+// unique name are named by prefix and their index.
+func ioSymbols(io IO, prefix string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for idx, arg := range io {
+		name := arg.Name
+		if len(name) == 0 || seen[name] ||
+			strings.ContainsAny(name, " \t\r\n#\\") {
+			name = fmt.Sprintf("%s%d", prefix, idx+1)
+		}
+		seen[name] = true
+		for bit := 0; bit < int(arg.Type.Bits); bit++ {
+			result = append(result, fmt.Sprintf("%s[%d]", name, bit))
+		}
+	}
+	return result
+}
+
+var reSymbolBit = regexp.MustCompilePOSIX(`^(.*)\[([0-9]+)\]$`)
+
+// ioFromSymbols creates count bits of unsigned arguments from the
+// bit names. The consecutive bits name[0], name[1], ... form one
+// argument. If the names are not known, the function returns one
+// argument named by prefix.
+func ioFromSymbols(names []string, prefix string, count int) IO {
+	arg := func(name string, bits int) IOArg {
+		return IOArg{
+			Name: name,
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(bits),
+			},
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	if len(names) != count {
+		return IO{arg(fmt.Sprintf("%s1", prefix), count)}
+	}
+	for _, name := range names {
+		if len(name) == 0 {
+			return IO{arg(fmt.Sprintf("%s1", prefix), count)}
+		}
+	}
+
+	var result IO
+	for _, name := range names {
+		m := reSymbolBit.FindStringSubmatch(name)
+		if m == nil {
+			result = append(result, arg(name, 1))
+			continue
+		}
+		bit, err := strconv.Atoi(m[2])
+		if err != nil {
+			result = append(result, arg(name, 1))
+			continue
+		}
+		if bit > 0 && len(result) > 0 {
+			last := &result[len(result)-1]
+			if last.Name == m[1] && int(last.Type.Bits) == bit {
+				last.Type.Bits++
+				continue
+			}
+		}
+		if bit == 0 {
+			result = append(result, arg(m[1], 1))
+		} else {
+			result = append(result, arg(name, 1))
+		}
+	}
+	return result
+}
+
+// externalIO resolves the circuit inputs and outputs of the AIGER
+// and BLIF files. The IO metadata comment is used if it matches the
+// circuit size, otherwise the arguments are created from the input
+// and output names.
+func externalIO(meta string, inNames, outNames []string, numInputs,
+	numOutputs int) (IO, IO, error) {
+
+	if len(meta) > 0 {
+		inputs, outputs, err := parseIOMeta(meta)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid IO metadata: %s", err)
+		}
+		if inputs.Size() == numInputs && outputs.Size() == numOutputs {
+			return inputs, outputs, nil
+		}
+	}
+	return ioFromSymbols(inNames, "NI", numInputs),
+		ioFromSymbols(outNames, "NO", numOutputs), nil
+}
@@ -0,0 +1,186 @@
+//
+// aig_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func testRoundTrip(t *testing.T, file string, inputs []*big.Int,
+	marshal func(c *Circuit, buf *bytes.Buffer) error,
+	parse func(buf *bytes.Buffer) (*Circuit, error)) {
+
+	circ, err := Parse(file)
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := marshal(circ, &buf); err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	parsed, err := parse(&buf)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	if parsed.Inputs.String() != circ.Inputs.String() ||
+		parsed.Outputs.String() != circ.Outputs.String() {
+		t.Errorf("IO mismatch: %v -> %v, expected %v -> %v",
+			parsed.Inputs, parsed.Outputs, circ.Inputs, circ.Outputs)
+	}
+	if circ.Stats[XOR]+circ.Stats[XNOR] > 0 &&
+		parsed.Stats[XOR]+parsed.Stats[XNOR] == 0 {
+		t.Errorf("XOR gates not recovered: %v", parsed.Stats)
+	}
+	if parsed.Stats[AND]+parsed.Stats[OR] > circ.Stats[AND]+circ.Stats[OR] {
+		t.Errorf("non-XOR gates increased: %v, expected %v",
+			parsed.Stats, circ.Stats)
+	}
+
+	expected, err := circ.Compute(inputs)
+	if err != nil {
+		t.Fatalf("Compute failed: %s", err)
+	}
+	result, err := parsed.Compute(inputs)
+	if err != nil {
+		t.Fatalf("Compute failed: %s", err)
+	}
+	for idx := range expected {
+		if expected[idx].Cmp(result[idx]) != 0 {
+			t.Errorf("output %d: got %v, expected %v", idx, result[idx],
+				expected[idx])
+		}
+	}
+}
+
+var roundTripTests = []struct {
+	file   string
+	inputs []*big.Int
+}{
+	{
+		file:   "testdata/2party.mpclc",
+		inputs: []*big.Int{big.NewInt(0xdeadbeef), big.NewInt(0x12345678)},
+	},
+	{
+		file:   "testdata/3party.mpclc",
+		inputs: []*big.Int{big.NewInt(3), big.NewInt(200), big.NewInt(77)},
+	},
+}
+
+func TestAIGER(t *testing.T) {
+	for _, test := range roundTripTests {
+		testRoundTrip(t, test.file, test.inputs,
+			func(c *Circuit, buf *bytes.Buffer) error {
+				return c.MarshalAIGER(buf)
+			},
+			func(buf *bytes.Buffer) (*Circuit, error) {
+				return ParseAIGER(buf)
+			})
+	}
+}
+
+func TestBLIF(t *testing.T) {
+	for _, test := range roundTripTests {
+		testRoundTrip(t, test.file, test.inputs,
+			func(c *Circuit, buf *bytes.Buffer) error {
+				return c.MarshalBLIF(buf)
+			},
+			func(buf *bytes.Buffer) (*Circuit, error) {
+				return ParseBLIF(buf)
+			})
+	}
+}
+
+// AIGER circuit y[0] = a[0] AND NOT a[1], y[1] = NOT a[0].
+var aigerData = "aig 3 2 0 2 1\n6\n3\n\x01\x03i0 a[0]\ni1 a[1]\no0 y[0]\no1 y[1]\n"
+
+// BLIF circuit with the outputs s = a XOR b XOR c, co = MAJ(a, b, c).
+var blifData = `# Full adder.
+.model adder
+.inputs a b \
+  c
+.outputs s co
+.names t c s
+10 1
+01 1
+.names a b t
+01 1
+10 1
+.names a b c co
+11- 1
+1-1 1
+-11 1
+.names unused
+1
+.end
+`
+
+func TestParseExternal(t *testing.T) {
+	circ, err := ParseAIGER(strings.NewReader(aigerData))
+	if err != nil {
+		t.Fatalf("ParseAIGER failed: %s", err)
+	}
+	if circ.Inputs.String() != "a:uint2" || circ.Outputs.String() != "y:uint2" {
+		t.Errorf("unexpected IO: %v -> %v", circ.Inputs, circ.Outputs)
+	}
+	for a := int64(0); a < 4; a++ {
+		result, err := circ.Compute([]*big.Int{big.NewInt(a)})
+		if err != nil {
+			t.Fatalf("Compute failed: %s", err)
+		}
+		expected := (a & ^(a >> 1) & 1) | (^a&1)<<1
+		if result[0].Int64() != expected {
+			t.Errorf("a=%d: got %v, expected %v", a, result[0], expected)
+		}
+	}
+
+	circ, err = ParseBLIF(strings.NewReader(blifData))
+	if err != nil {
+		t.Fatalf("ParseBLIF failed: %s", err)
+	}
+	if len(circ.Inputs) != 3 || len(circ.Outputs) != 2 {
+		t.Fatalf("unexpected IO: %v -> %v", circ.Inputs, circ.Outputs)
+	}
+	if circ.Stats[XOR]+circ.Stats[XNOR] != 2 {
+		t.Errorf("XOR gates not recovered: %v", circ.Stats)
+	}
+	for i := int64(0); i < 8; i++ {
+		var inputs []*big.Int
+		var sum int64
+		for bit := 0; bit < 3; bit++ {
+			inputs = append(inputs, big.NewInt((i>>bit)&1))
+			sum += (i >> bit) & 1
+		}
+		result, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute failed: %s", err)
+		}
+		if result[0].Int64() != sum&1 || result[1].Int64() != sum>>1 {
+			t.Errorf("%03b: got %v %v, expected %d", i, result[0],
+				result[1], sum)
+		}
+	}
+}
+
+func TestParseBLIFErrors(t *testing.T) {
+	tests := []string{
+		".model m\n.inputs a\n.outputs y\n.latch a y 0\n.end\n",
+		".model m\n.inputs a\n.outputs y\n.names y t\n1 1\n.names t y\n1 1\n",
+		".model m\n.inputs a\n.outputs y\n.names a y\n1 1\n0 0\n",
+		".model m\n.inputs a\n.outputs y\n.names b y\n1 1\n",
+	}
+	for idx, test := range tests {
+		_, err := ParseBLIF(strings.NewReader(test))
+		if err == nil {
+			t.Errorf("test %d: ParseBLIF succeeded", idx)
+		}
+	}
+}
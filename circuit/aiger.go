@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MarshalAIGER marshals the circuit in the binary AIGER format. The
+// XOR, XNOR, and OR gates are converted into AND gates and the
+// circuit inputs and outputs are stored in the symbol table and in
+// the comment section.
+func (c *Circuit) MarshalAIGER(out io.Writer) error {
+	g, results, err := circuitAIG(c)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "aig %d %d 0 %d %d\n", g.numInputs+len(g.ands),
+		g.numInputs, len(results), len(g.ands))
+	for _, lit := range results {
+		fmt.Fprintf(w, "%d\n", lit)
+	}
+	for idx, n := range g.ands {
+		lhs := uint32(g.numInputs+idx+1) << 1
+		writeAIGERDelta(w, lhs-n[0])
+		writeAIGERDelta(w, n[0]-n[1])
+	}
+	for idx, name := range ioSymbols(c.Inputs, "NI") {
+		fmt.Fprintf(w, "i%d %s\n", idx, name)
+	}
+	for idx, name := range ioSymbols(c.Outputs, "NO") {
+		fmt.Fprintf(w, "o%d %s\n", idx, name)
+	}
+	meta, err := marshalIOMeta(c.Inputs, c.Outputs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "c\n%s\n", meta)
+
+	return w.Flush()
+}
+
+func writeAIGERDelta(w *bufio.Writer, delta uint32) {
+	for delta&^0x7f != 0 {
+		w.WriteByte(byte(delta&0x7f | 0x80))
+		delta >>= 7
+	}
+	w.WriteByte(byte(delta))
+}
+
+func readAIGERDelta(r *bufio.Reader) (uint32, error) {
+	var result uint32
+	for shift := 0; shift < 32; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid AIGER delta encoding")
+}
+
+// ParseAIGER parses a binary AIGER circuit file. The XOR gates are
+// recovered from their AND implementations. The circuit inputs and
+// outputs are restored from the comment section written by
+// MarshalAIGER or from the symbol table.
+func ParseAIGER(in io.Reader) (*Circuit, error) {
+	r := bufio.NewReader(in)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	header := strings.Fields(line)
+	if len(header) < 6 || header[0] != "aig" {
+		return nil, fmt.Errorf("invalid AIGER header: %s",
+			strings.TrimSpace(line))
+	}
+	var values []int
+	for _, field := range header[1:] {
+		v, err := strconv.ParseUint(field, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AIGER header: %s", err)
+		}
+		values = append(values, int(v))
+	}
+	m, i, l, o, a := values[0], values[1], values[2], values[3], values[4]
+	for _, v := range values[5:] {
+		if v != 0 {
+			return nil, fmt.Errorf("AIGER properties are not supported")
+		}
+	}
+	if l != 0 {
+		return nil, fmt.Errorf("AIGER latches are not supported")
+	}
+	if m != i+a {
+		return nil, fmt.Errorf("invalid AIGER header: M=%d, I=%d, A=%d",
+			m, i, a)
+	}
+
+	var results []uint32
+	for idx := 0; idx < o; idx++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		lit, err := strconv.ParseUint(strings.TrimSpace(line), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AIGER output: %s", err)
+		}
+		if lit>>1 > uint64(m) {
+			return nil, fmt.Errorf("invalid AIGER output literal %d", lit)
+		}
+		results = append(results, uint32(lit))
+	}
+
+	g := newAIG(i)
+	for idx := 0; idx < a; idx++ {
+		lhs := uint32(i+idx+1) << 1
+		d0, err := readAIGERDelta(r)
+		if err != nil {
+			return nil, err
+		}
+		d1, err := readAIGERDelta(r)
+		if err != nil {
+			return nil, err
+		}
+		if d0 == 0 || d0 > lhs || d1 > lhs-d0 {
+			return nil, fmt.Errorf("invalid AIGER gate %d", idx)
+		}
+		rhs0 := lhs - d0
+		g.ands = append(g.ands, [2]uint32{rhs0, rhs0 - d1})
+	}
+
+	// Symbol table and comments.
+	inNames := make([]string, i)
+	outNames := make([]string, o)
+	var meta string
+	var comments bool
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if comments {
+			if strings.HasPrefix(line, ioMetaPrefix) {
+				meta = line
+			}
+		} else if line == "c" {
+			comments = true
+		} else if len(line) > 0 {
+			parseAIGERSymbol(line, inNames, outNames)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	inputs, outputs, err := externalIO(meta, inNames, outNames, i, o)
+	if err != nil {
+		return nil, err
+	}
+	return g.circuit(inputs, outputs, results)
+}
+
+func parseAIGERSymbol(line string, inNames, outNames []string) {
+	idx := strings.IndexByte(line, ' ')
+	if idx < 2 {
+		return
+	}
+	pos, err := strconv.Atoi(line[1:idx])
+	if err != nil || pos < 0 {
+		return
+	}
+	switch line[0] {
+	case 'i':
+		if pos < len(inNames) {
+			inNames[pos] = line[idx+1:]
+		}
+	case 'o':
+		if pos < len(outNames) {
+			outNames[pos] = line[idx+1:]
+		}
+	}
+}
@@ -0,0 +1,297 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MarshalBLIF marshals the circuit in the Berkeley Logic Interchange
+// Format (BLIF). Each gate is marshaled as a single-output cover and
+// the circuit inputs and outputs are stored in a comment.
+func (c *Circuit) MarshalBLIF(out io.Writer) error {
+	w := bufio.NewWriter(out)
+
+	meta, err := marshalIOMeta(c.Inputs, c.Outputs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, ".model circuit\n# %s\n", meta)
+
+	numInputs := c.Inputs.Size()
+	outStart := c.NumWires - c.Outputs.Size()
+
+	names := make([]string, c.NumWires)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%d", i)
+	}
+	inNames := ioSymbols(c.Inputs, "NI")
+	outNames := ioSymbols(c.Outputs, "NO")
+	copy(names, inNames)
+	for idx, name := range outNames {
+		if outStart+idx >= numInputs {
+			names[outStart+idx] = name
+		}
+	}
+
+	writeBLIFNames(w, ".inputs", inNames)
+	writeBLIFNames(w, ".outputs", outNames)
+
+	for _, g := range c.Gates {
+		switch g.Op {
+		case XOR:
+			fmt.Fprintf(w, ".names %s %s %s\n01 1\n10 1\n",
+				names[g.Input0], names[g.Input1], names[g.Output])
+		case XNOR:
+			fmt.Fprintf(w, ".names %s %s %s\n00 1\n11 1\n",
+				names[g.Input0], names[g.Input1], names[g.Output])
+		case AND:
+			fmt.Fprintf(w, ".names %s %s %s\n11 1\n",
+				names[g.Input0], names[g.Input1], names[g.Output])
+		case OR:
+			fmt.Fprintf(w, ".names %s %s %s\n1- 1\n-1 1\n",
+				names[g.Input0], names[g.Input1], names[g.Output])
+		case INV:
+			fmt.Fprintf(w, ".names %s %s\n0 1\n",
+				names[g.Input0], names[g.Output])
+		default:
+			return fmt.Errorf("unsupported gate type %s", g.Op)
+		}
+	}
+	// Outputs that are input wires are copied with buffers.
+	for idx, name := range outNames {
+		if outStart+idx < numInputs {
+			fmt.Fprintf(w, ".names %s %s\n1 1\n", names[outStart+idx], name)
+		}
+	}
+	fmt.Fprintln(w, ".end")
+
+	return w.Flush()
+}
+
+func writeBLIFNames(w *bufio.Writer, directive string, names []string) {
+	w.WriteString(directive)
+	for idx, name := range names {
+		if idx > 0 && idx%8 == 0 {
+			w.WriteString(" \\\n")
+		}
+		w.WriteString(" ")
+		w.WriteString(name)
+	}
+	w.WriteString("\n")
+}
+
+type blifCover struct {
+	inputs []string
+	rows   []string
+	value  byte
+}
+
+// ParseBLIF parses a combinational BLIF circuit file. The covers are
+// converted into AND gates and the XOR gates are recovered from their
+// AND implementations. The circuit inputs and outputs are restored
+// from the comment written by MarshalBLIF or from the signal names.
+func ParseBLIF(in io.Reader) (*Circuit, error) {
+	r := bufio.NewReader(in)
+
+	var inNames, outNames []string
+	var meta string
+	var models int
+	covers := make(map[string]*blifCover)
+	var cover *blifCover
+
+	for lineno := 0; ; {
+		line, n, err := readBLIFLine(r, &meta)
+		lineno += n
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(parts[0], ".") {
+			if cover == nil {
+				return nil, fmt.Errorf("%d: unexpected cover: %s",
+					lineno, line)
+			}
+			if err := cover.addRow(parts); err != nil {
+				return nil, fmt.Errorf("%d: %s", lineno, err)
+			}
+			continue
+		}
+		cover = nil
+
+		switch parts[0] {
+		case ".model":
+			models++
+			if models > 1 {
+				return nil, fmt.Errorf("%d: multiple models are not supported",
+					lineno)
+			}
+		case ".inputs":
+			inNames = append(inNames, parts[1:]...)
+		case ".outputs":
+			outNames = append(outNames, parts[1:]...)
+		case ".names":
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("%d: invalid .names", lineno)
+			}
+			out := parts[len(parts)-1]
+			if _, ok := covers[out]; ok {
+				return nil, fmt.Errorf("%d: signal %s redefined", lineno, out)
+			}
+			cover = &blifCover{
+				inputs: parts[1 : len(parts)-1],
+			}
+			covers[out] = cover
+		case ".end":
+		default:
+			return nil, fmt.Errorf("%d: %s is not supported", lineno, parts[0])
+		}
+	}
+
+	g := newAIG(len(inNames))
+	lits := make(map[string]uint32)
+	for idx, name := range inNames {
+		if _, ok := lits[name]; ok {
+			return nil, fmt.Errorf("input %s redefined", name)
+		}
+		if _, ok := covers[name]; ok {
+			return nil, fmt.Errorf("input %s redefined", name)
+		}
+		lits[name] = g.input(idx)
+	}
+	active := make(map[string]bool)
+
+	var signal func(name string) (uint32, error)
+	signal = func(name string) (uint32, error) {
+		if lit, ok := lits[name]; ok {
+			return lit, nil
+		}
+		cover, ok := covers[name]
+		if !ok {
+			return 0, fmt.Errorf("signal %s not defined", name)
+		}
+		if active[name] {
+			return 0, fmt.Errorf("combinational loop at signal %s", name)
+		}
+		active[name] = true
+
+		var inputs []uint32
+		for _, in := range cover.inputs {
+			lit, err := signal(in)
+			if err != nil {
+				return 0, err
+			}
+			inputs = append(inputs, lit)
+		}
+		var sop uint32
+		for _, row := range cover.rows {
+			var product uint32 = 1
+			for idx, ch := range []byte(row) {
+				switch ch {
+				case '1':
+					product = g.and(product, inputs[idx])
+				case '0':
+					product = g.and(product, inputs[idx]^1)
+				}
+			}
+			sop = g.or(sop, product)
+		}
+		if len(cover.rows) > 0 && cover.value == '0' {
+			sop ^= 1
+		}
+		delete(active, name)
+		lits[name] = sop
+		return sop, nil
+	}
+
+	var results []uint32
+	for _, name := range outNames {
+		lit, err := signal(name)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, lit)
+	}
+
+	inputs, outputs, err := externalIO(meta, inNames, outNames,
+		len(inNames), len(outNames))
+	if err != nil {
+		return nil, err
+	}
+	return g.circuit(inputs, outputs, results)
+}
+
+func (cover *blifCover) addRow(parts []string) error {
+	var row string
+	var value string
+
+	switch {
+	case len(cover.inputs) == 0 && len(parts) == 1:
+		value = parts[0]
+	case len(cover.inputs) > 0 && len(parts) == 2:
+		row = parts[0]
+		value = parts[1]
+	default:
+		return fmt.Errorf("invalid cover: %s", strings.Join(parts, " "))
+	}
+	if len(row) != len(cover.inputs) {
+		return fmt.Errorf("invalid cover %s: expected %d inputs",
+			row, len(cover.inputs))
+	}
+	if strings.Trim(row, "01-") != "" {
+		return fmt.Errorf("invalid cover %s", row)
+	}
+	if value != "0" && value != "1" {
+		return fmt.Errorf("invalid cover output %s", value)
+	}
+	if len(cover.rows) > 0 && cover.value != value[0] {
+		return fmt.Errorf("mixed on-set and off-set covers")
+	}
+	cover.rows = append(cover.rows, row)
+	cover.value = value[0]
+	return nil
+}
+
+// readBLIFLine reads a logical BLIF line. The function removes the
+// comments, joins the continuation lines, and returns the number of
+// physical lines read. The IO metadata comment is stored in meta.
+func readBLIFLine(r *bufio.Reader, meta *string) (string, int, error) {
+	var result string
+	var count int
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err == io.EOF && len(result) > 0 {
+				return result, count, nil
+			}
+			return "", count, err
+		}
+		count++
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			comment := strings.TrimSpace(line[idx+1:])
+			if strings.HasPrefix(comment, ioMetaPrefix) {
+				*meta = comment
+			}
+			line = line[:idx]
+		}
+		line = strings.TrimRight(line, " \t\r\n")
+		if strings.HasSuffix(line, "\\") {
+			result += line[:len(line)-1] + " "
+			continue
+		}
+		return result + line, count, nil
+	}
+}
@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+// builder builds circuits from the netlists of the external circuit
+// formats. The input wires are numbered first, then the gates
+// allocate their output wires in order, and finally the circuit
+// method moves the output wires after all other wires.
+type builder struct {
+	gates     []Gate
+	numInputs Wire
+	numWires  Wire
+	consts    [2]Wire
+	hasConst  [2]bool
+}
+
+func newBuilder(numInputs int) *builder {
+	return &builder{
+		numInputs: Wire(numInputs),
+		numWires:  Wire(numInputs),
+	}
+}
+
+// gate adds a gate and returns its output wire.
+func (b *builder) gate(op Operation, i0, i1 Wire) Wire {
+	w := b.numWires
+	b.numWires++
+	b.gates = append(b.gates, Gate{
+		Input0: i0,
+		Input1: i1,
+		Output: w,
+		Op:     op,
+	})
+	return w
+}
+
+// constant returns a wire holding the constant value v. The
+// constants are computed from the first input wire: 0 = w0 XOR w0, 1
+// = w0 XNOR w0.
+func (b *builder) constant(v uint) Wire {
+	if !b.hasConst[v] {
+		op := XOR
+		if v == 1 {
+			op = XNOR
+		}
+		b.consts[v] = b.gate(op, 0, 0)
+		b.hasConst[v] = true
+	}
+	return b.consts[v]
+}
+
+func (b *builder) isConstant(w Wire) bool {
+	return w == b.consts[0] && b.hasConst[0] ||
+		w == b.consts[1] && b.hasConst[1]
+}
+
+// circuit creates the circuit with the result wires as its output
+// bits.
+func (b *builder) circuit(inputs, outputs IO, results []Wire) *Circuit {
+	// Move output wires after all other wires. The gate outputs
+	// that drive only one output bit are renamed to the output
+	// wire. Other output bits are copied to the output wire with an
+	// XOR with zero.
+	copies := make([]bool, len(results))
+	driven := make(map[Wire]bool)
+	var numCopies int
+	for idx, w := range results {
+		if w < b.numInputs || driven[w] || b.isConstant(w) {
+			copies[idx] = true
+			numCopies++
+		}
+		driven[w] = true
+	}
+	var zero Wire
+	if numCopies > 0 {
+		zero = b.constant(0)
+	}
+	numTemps := b.numWires
+	outStart := numTemps
+	rename := make(map[Wire]Wire)
+	for idx, w := range results {
+		if copies[idx] {
+			b.gates = append(b.gates, Gate{
+				Input0: w,
+				Input1: zero,
+				Output: outStart + Wire(idx),
+				Op:     XOR,
+			})
+		} else {
+			rename[w] = outStart + Wire(idx)
+		}
+	}
+
+	// Renumber temporary wires densely after the input wires.
+	next := b.numInputs
+	for w := b.numInputs; w < numTemps; w++ {
+		if _, ok := rename[w]; !ok {
+			rename[w] = next
+			next++
+		}
+	}
+	shift := outStart - next
+	renumber := func(w Wire) Wire {
+		if w < b.numInputs {
+			return w
+		}
+		if w >= outStart {
+			return w - shift
+		}
+		r := rename[w]
+		if r >= outStart {
+			return r - shift
+		}
+		return r
+	}
+
+	var stats Stats
+	for i := range b.gates {
+		g := &b.gates[i]
+		g.Input0 = renumber(g.Input0)
+		if g.Op != INV {
+			g.Input1 = renumber(g.Input1)
+		}
+		g.Output = renumber(g.Output)
+		stats[g.Op]++
+	}
+
+	return &Circuit{
+		NumGates: len(b.gates),
+		NumWires: int(next) + len(results),
+		Inputs:   inputs,
+		Outputs:  outputs,
+		Gates:    b.gates,
+		Stats:    stats,
+	}
+}
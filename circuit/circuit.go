@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sync/atomic"
 
 	"github.com/markkurossi/tabulate"
 )
@@ -61,9 +62,10 @@ func (stats Stats) Count() uint64 {
 	return result
 }
 
-// Cost computes the relative computational cost of the circuit.
+// Cost computes the relative garbling cost of the circuit as the
+// number of garbled table labels with the half-gates scheme.
 func (stats Stats) Cost() uint64 {
-	return (stats[AND]+stats[INV])*2 + stats[OR]*3
+	return stats[AND]*2 + stats[OR]*3 + stats[INV]
 }
 
 func (stats Stats) String() string {
@@ -110,6 +112,8 @@ type Circuit struct {
 	Outputs  IO
 	Gates    []Gate
 	Stats    Stats
+
+	schedules [numSchemes]atomic.Pointer[schedule]
 }
 
 func (c *Circuit) String() string {
@@ -167,7 +171,7 @@ func (c *Circuit) TabulateRow(row *tabulate.Row) {
 	row.Column(fmt.Sprintf("%v", c.NumWires))
 }
 
-// Cost computes the relative computational cost of the circuit.
+// Cost computes the relative garbling cost of the circuit.
 func (c *Circuit) Cost() uint64 {
 	return c.Stats.Cost()
 }
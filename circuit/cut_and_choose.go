@@ -0,0 +1,713 @@
+//
+// cut_and_choose.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// CutAndChooseHashBits specifies the output size of the garbler input
+// consistency hash.
+const CutAndChooseHashBits = 64
+
+// The cut-and-choose protocol:
+//
+//  1. The garbler creates s garbled circuits from random seeds and
+//     commits to its input labels of each circuit.
+//  2. The evaluator sends a random seed for the input consistency
+//     hash matrix M.
+//  3. The garbler commits to each garbled circuit, including the
+//     output decoding information and the decoding information of the
+//     input consistency hash M·(x||r). The random r hides the garbler's
+//     input x from the evaluator.
+//  4. The evaluator OTs its input labels for all circuits.
+//  5. The evaluator selects a random half of the circuits for
+//     checking.
+//  6. The garbler opens the seeds of the check circuits and sends the
+//     evaluation circuits and its input labels.
+//  7. The evaluator re-garbles and verifies the check circuits,
+//     evaluates the evaluation circuits, verifies that the garbler's
+//     input consistency hash is the same in all evaluation circuits,
+//     and takes the majority output.
+//  8. The evaluator sends the output labels of a majority circuit to
+//     the garbler.
+//
+// The protocol does not protect the evaluator's inputs against
+// selective failure attacks in the OT phase.
+
+// CutAndChooseGarbler runs the cut-and-choose garbler on the P2P
+// network. The argument s specifies the number of garbled circuits
+// i.e. the statistical security parameter.
+func CutAndChooseGarbler(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	inputs *big.Int, s int, verbose bool) ([]*big.Int, error) {
+
+	if s < 2 {
+		return nil, fmt.Errorf("invalid number of circuits: %d", s)
+	}
+	if !circ.Outputs.Shared() {
+		return nil, fmt.Errorf("cut-and-choose does not support " +
+			"per-party outputs")
+	}
+	timing := NewTiming()
+	if verbose {
+		fmt.Printf(" - Garbling %d circuits...\n", s)
+	}
+
+	copies := make([]*cncCopy, s)
+	for j := 0; j < s; j++ {
+		c, err := newCNCCopy(circ, nil)
+		if err != nil {
+			return nil, err
+		}
+		copies[j] = c
+	}
+
+	// Random input for the input consistency hash.
+	r := make([]byte, (CutAndChooseHashBits+8)/8)
+	if _, err := rand.Read(r); err != nil {
+		return nil, err
+	}
+
+	// Commit to our input labels.
+	if err := conn.SendUint32(s); err != nil {
+		return nil, err
+	}
+	for _, c := range copies {
+		c.labels = c.inputLabels(circ, inputs, r)
+		if _, err := rand.Read(c.nonce[:]); err != nil {
+			return nil, err
+		}
+		err := conn.SendData(cncCommitLabels(c.nonce[:], c.labels))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Input consistency hash matrix.
+	mSeed, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	m, err := cncMatrix(mSeed, int(circ.Inputs[0].Type.Bits))
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit to garbled circuits.
+	for _, c := range copies {
+		if err := conn.SendData(c.commit(circ, m)); err != nil {
+			return nil, err
+		}
+	}
+	timing.Sample("Garble", nil)
+
+	// Peer OTs its inputs for all circuits.
+	if err := ot.Negotiate(conn, oti, true); err != nil {
+		return nil, err
+	}
+	if err := oti.InitSender(conn); err != nil {
+		return nil, err
+	}
+	offset := int(circ.Inputs[0].Type.Bits)
+	count := int(circ.Inputs[1].Type.Bits)
+	var wires []ot.Wire
+	for _, c := range copies {
+		wires = append(wires, c.garbled.Wires[offset:offset+count]...)
+	}
+	if err := oti.Send(wires); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	timing.Sample("OT", nil)
+
+	// Open check circuits and send evaluation circuits.
+	challenge, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	if len(challenge) != (s+7)/8 {
+		return nil, fmt.Errorf("invalid challenge length %d", len(challenge))
+	}
+	var labelData ot.LabelData
+	for j, c := range copies {
+		if cncBit(challenge, j) {
+			if err := conn.SendData(c.seed[:]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := conn.SendData(c.key[:]); err != nil {
+			return nil, err
+		}
+		if err := conn.SendUint32(len(c.garbled.Gates)); err != nil {
+			return nil, err
+		}
+		for _, data := range c.garbled.Gates {
+			if err := conn.SendUint32(len(data)); err != nil {
+				return nil, err
+			}
+			for _, d := range data {
+				if err := conn.SendLabel(d, &labelData); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := conn.SendData(c.outLambda); err != nil {
+			return nil, err
+		}
+		if err := conn.SendData(c.hashLambda); err != nil {
+			return nil, err
+		}
+		if err := conn.SendData(c.nonce[:]); err != nil {
+			return nil, err
+		}
+		for _, l := range c.labels {
+			if err := conn.SendLabel(l, &labelData); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	ioStats := conn.Stats.Sum()
+	timing.Sample("Xfer", []string{FileSize(ioStats).String()})
+
+	// Resolve result values.
+	j, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	if j < 0 || j >= s || cncBit(challenge, j) {
+		return nil, fmt.Errorf("invalid result circuit %d", j)
+	}
+	garbled := copies[j].garbled
+	result := big.NewInt(0)
+	var label ot.Label
+	for i := 0; i < circ.Outputs.Size(); i++ {
+		err := conn.ReceiveLabel(&label, &labelData)
+		if err != nil {
+			return nil, err
+		}
+		wire := garbled.Wires[circ.NumWires-circ.Outputs.Size()+i]
+
+		var bit uint
+		if label.Equal(wire.L0) {
+			bit = 0
+		} else if label.Equal(wire.L1) {
+			bit = 1
+		} else {
+			return nil, fmt.Errorf("unknown label %s for result %d", label, i)
+		}
+		result.SetBit(result, i, bit)
+	}
+	timing.Sample("Result", nil)
+	if verbose {
+		timing.Print(conn.Stats)
+	}
+
+	return circ.Outputs.Split(result), nil
+}
+
+// CutAndChooseEvaluator runs the cut-and-choose evaluator on the P2P
+// network. The argument s specifies the number of garbled circuits
+// i.e. the statistical security parameter.
+func CutAndChooseEvaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	inputs *big.Int, s int, verbose bool) ([]*big.Int, error) {
+
+	if !circ.Outputs.Shared() {
+		return nil, fmt.Errorf("cut-and-choose does not support " +
+			"per-party outputs")
+	}
+	timing := NewTiming()
+
+	peerS, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	if peerS != s {
+		return nil, fmt.Errorf("number of circuits mismatch: got %d, "+
+			"expected %d", peerS, s)
+	}
+	labelCommits := make([][]byte, s)
+	for j := 0; j < s; j++ {
+		labelCommits[j], err = conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Select input consistency hash matrix.
+	var mSeed [16]byte
+	if _, err := rand.Read(mSeed[:]); err != nil {
+		return nil, err
+	}
+	if err := conn.SendData(mSeed[:]); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	m, err := cncMatrix(mSeed[:], int(circ.Inputs[0].Type.Bits))
+	if err != nil {
+		return nil, err
+	}
+
+	circCommits := make([][]byte, s)
+	for j := 0; j < s; j++ {
+		circCommits[j], err = conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+	}
+	timing.Sample("Wait", nil)
+
+	// Query our inputs for all circuits.
+	if verbose {
+		fmt.Printf(" - Querying our inputs...\n")
+	}
+	if err := ot.Negotiate(conn, oti, false); err != nil {
+		return nil, err
+	}
+	if err := oti.InitReceiver(conn); err != nil {
+		return nil, err
+	}
+	offset := int(circ.Inputs[0].Type.Bits)
+	count := int(circ.Inputs[1].Type.Bits)
+	flags := make([]bool, s*count)
+	for i := range flags {
+		flags[i] = inputs.Bit(i%count) == 1
+	}
+	ours := make([]ot.Label, s*count)
+	if err := oti.Receive(flags, ours); err != nil {
+		return nil, err
+	}
+	timing.Sample("OT", nil)
+
+	// Select check circuits.
+	challenge, err := cncChallenge(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SendData(challenge); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Printf(" - Checking and evaluating circuits...\n")
+	}
+	numOutputs := circ.Outputs.Size()
+	results := make([]*big.Int, s)
+	outputs := make([][]ot.Label, s)
+	var hash []byte
+	var labelData ot.LabelData
+
+	for j := 0; j < s; j++ {
+		if cncBit(challenge, j) {
+			seed, err := conn.ReceiveData()
+			if err != nil {
+				return nil, err
+			}
+			if len(seed) != 16 {
+				return nil, fmt.Errorf("check circuit %d: invalid seed", j)
+			}
+			c, err := newCNCCopy(circ, seed)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(c.commit(circ, m), circCommits[j]) {
+				return nil, fmt.Errorf("check circuit %d: invalid circuit", j)
+			}
+			for i := 0; i < count; i++ {
+				wire := c.garbled.Wires[offset+i]
+				expected := wire.L0
+				if flags[i] {
+					expected = wire.L1
+				}
+				if !ours[j*count+i].Equal(expected) {
+					return nil, fmt.Errorf("check circuit %d: invalid OT", j)
+				}
+			}
+			continue
+		}
+
+		key, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		n, err := conn.ReceiveUint32()
+		if err != nil {
+			return nil, err
+		}
+		if n != circ.NumGates {
+			return nil, fmt.Errorf("wrong number of gates: got %d, "+
+				"expected %d", n, circ.NumGates)
+		}
+		garbled := make([][]ot.Label, circ.NumGates)
+		for i := 0; i < circ.NumGates; i++ {
+			n, err := conn.ReceiveUint32()
+			if err != nil {
+				return nil, err
+			}
+			values := make([]ot.Label, n)
+			for k := 0; k < n; k++ {
+				err := conn.ReceiveLabel(&values[k], &labelData)
+				if err != nil {
+					return nil, err
+				}
+			}
+			garbled[i] = values
+		}
+		outLambda, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		hashLambda, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		if len(outLambda) != (numOutputs+7)/8 ||
+			len(hashLambda) != CutAndChooseHashBits/8 {
+			return nil, fmt.Errorf("circuit %d: invalid decoding information",
+				j)
+		}
+		nonce, err := conn.ReceiveData()
+		if err != nil {
+			return nil, err
+		}
+		labels := make([]ot.Label, offset+CutAndChooseHashBits+1)
+		for i := range labels {
+			err := conn.ReceiveLabel(&labels[i], &labelData)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !bytes.Equal(cncCommitLabels(nonce, labels), labelCommits[j]) {
+			return nil, fmt.Errorf("circuit %d: invalid input labels", j)
+		}
+		commit := cncCommitCircuit(key, garbled, outLambda, hashLambda)
+		if !bytes.Equal(commit, circCommits[j]) {
+			return nil, fmt.Errorf("circuit %d: invalid circuit", j)
+		}
+
+		// Verify garbler's input consistency.
+		h := cncHash(m, labels, hashLambda)
+		if hash == nil {
+			hash = h
+		} else if !bytes.Equal(h, hash) {
+			return nil, fmt.Errorf("circuit %d: inconsistent garbler input",
+				j)
+		}
+
+		// Evaluate circuit.
+		wires := make([]ot.Label, circ.NumWires)
+		copy(wires, labels[:offset])
+		copy(wires[offset:], ours[j*count:(j+1)*count])
+		if err := circ.Eval(HalfGates, key, wires, garbled); err != nil {
+			return nil, err
+		}
+		outputs[j] = wires[circ.NumWires-numOutputs:]
+		result := big.NewInt(0)
+		for i, l := range outputs[j] {
+			var bit uint
+			if l.S() {
+				bit = 1
+			}
+			result.SetBit(result, i, bit^cncBitUint(outLambda, i))
+		}
+		results[j] = result
+	}
+	timing.Sample("Eval", nil)
+
+	// Take majority output.
+	var numEval, best, bestCount int
+	for j, r := range results {
+		if r == nil {
+			continue
+		}
+		numEval++
+		var count int
+		for _, o := range results {
+			if o != nil && o.Cmp(r) == 0 {
+				count++
+			}
+		}
+		if count > bestCount {
+			best = j
+			bestCount = count
+		}
+	}
+	if bestCount*2 <= numEval {
+		return nil, fmt.Errorf("no majority output: %d/%d",
+			bestCount, numEval)
+	}
+
+	if err := conn.SendUint32(best); err != nil {
+		return nil, err
+	}
+	for _, l := range outputs[best] {
+		if err := conn.SendLabel(l, &labelData); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	timing.Sample("Result", nil)
+	if verbose {
+		timing.Print(conn.Stats)
+	}
+
+	return circ.Outputs.Split(results[best]), nil
+}
+
+// cncCopy contains a garbled circuit created from a seed. The random
+// wires r are the garbler's extra input for the input consistency
+// hash.
+type cncCopy struct {
+	seed       [16]byte
+	key        [32]byte
+	garbled    *Garbled
+	r          []ot.Wire
+	nonce      [32]byte
+	labels     []ot.Label
+	outLambda  []byte
+	hashLambda []byte
+}
+
+// newCNCCopy garbles the circuit from the seed. If the seed is nil, a
+// new random seed is created.
+func newCNCCopy(circ *Circuit, seed []byte) (*cncCopy, error) {
+	c := new(cncCopy)
+	if seed == nil {
+		if _, err := rand.Read(c.seed[:]); err != nil {
+			return nil, err
+		}
+	} else {
+		copy(c.seed[:], seed)
+	}
+	prg, err := newPRG(c.seed[:])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := prg.Read(c.key[:]); err != nil {
+		return nil, err
+	}
+	c.garbled, err = circ.GarbleRand(HalfGates, c.key[:], prg)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i <= CutAndChooseHashBits; i++ {
+		w, err := makeLabels(prg, c.garbled.R)
+		if err != nil {
+			return nil, err
+		}
+		c.r = append(c.r, w)
+	}
+	return c, nil
+}
+
+// inputLabels returns the garbler's input labels for the input value
+// and the random input consistency hash input r.
+func (c *cncCopy) inputLabels(circ *Circuit, inputs *big.Int,
+	r []byte) []ot.Label {
+
+	var result []ot.Label
+	for i := 0; i < int(circ.Inputs[0].Type.Bits); i++ {
+		if inputs.Bit(i) == 1 {
+			result = append(result, c.garbled.Wires[i].L1)
+		} else {
+			result = append(result, c.garbled.Wires[i].L0)
+		}
+	}
+	for i, w := range c.r {
+		if cncBit(r, i) {
+			result = append(result, w.L1)
+		} else {
+			result = append(result, w.L0)
+		}
+	}
+	return result
+}
+
+// commit computes the output and input consistency hash decoding
+// information and returns the commitment of the garbled circuit.
+func (c *cncCopy) commit(circ *Circuit, m [][]bool) []byte {
+	numOutputs := circ.Outputs.Size()
+	c.outLambda = make([]byte, (numOutputs+7)/8)
+	for i := 0; i < numOutputs; i++ {
+		if c.garbled.Lambda(Wire(circ.NumWires-numOutputs+i)) == 1 {
+			cncSetBit(c.outLambda, i)
+		}
+	}
+
+	var l0 []ot.Label
+	for i := 0; i < int(circ.Inputs[0].Type.Bits); i++ {
+		l0 = append(l0, c.garbled.Wires[i].L0)
+	}
+	for _, w := range c.r {
+		l0 = append(l0, w.L0)
+	}
+	c.hashLambda = cncHash(m, l0, nil)
+
+	return cncCommitCircuit(c.key[:], c.garbled.Gates, c.outLambda,
+		c.hashLambda)
+}
+
+// cncHash computes the input consistency hash M·(x||r) from the
+// point-and-permute bits of the labels. The lambda specifies the
+// decoding information.
+func cncHash(m [][]bool, labels []ot.Label, lambda []byte) []byte {
+	result := make([]byte, CutAndChooseHashBits/8)
+	rOfs := len(labels) - CutAndChooseHashBits - 1
+	for i, row := range m {
+		bit := labels[rOfs+i].S() != labels[rOfs+CutAndChooseHashBits].S()
+		for k, set := range row {
+			if set && labels[k].S() {
+				bit = !bit
+			}
+		}
+		if lambda != nil && cncBit(lambda, i) {
+			bit = !bit
+		}
+		if bit {
+			cncSetBit(result, i)
+		}
+	}
+	return result
+}
+
+// cncMatrix creates the input consistency hash matrix from the seed.
+func cncMatrix(seed []byte, n int) ([][]bool, error) {
+	if len(seed) != 16 {
+		return nil, fmt.Errorf("invalid hash matrix seed")
+	}
+	prg, err := newPRG(seed)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, (n+7)/8)
+	m := make([][]bool, CutAndChooseHashBits)
+	for i := range m {
+		if _, err := prg.Read(buf); err != nil {
+			return nil, err
+		}
+		m[i] = make([]bool, n)
+		for k := range m[i] {
+			m[i][k] = cncBit(buf, k)
+		}
+	}
+	return m, nil
+}
+
+// cncChallenge selects a random half of the s circuits for checking.
+func cncChallenge(s int) ([]byte, error) {
+	perm := make([]int, s)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := s - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		perm[i], perm[j.Int64()] = perm[j.Int64()], perm[i]
+	}
+	challenge := make([]byte, (s+7)/8)
+	for i := 0; i < s/2; i++ {
+		cncSetBit(challenge, perm[i])
+	}
+	return challenge, nil
+}
+
+func cncCommitLabels(nonce []byte, labels []ot.Label) []byte {
+	h := sha256.New()
+	h.Write(nonce)
+	var data ot.LabelData
+	for _, l := range labels {
+		l.GetData(&data)
+		h.Write(data[:])
+	}
+	return h.Sum(nil)
+}
+
+func cncCommitCircuit(key []byte, gates [][]ot.Label,
+	outLambda, hashLambda []byte) []byte {
+
+	h := sha256.New()
+	h.Write(key)
+	var data ot.LabelData
+	for _, g := range gates {
+		data[0] = byte(len(g))
+		h.Write(data[:1])
+		for _, l := range g {
+			l.GetData(&data)
+			h.Write(data[:])
+		}
+	}
+	h.Write(outLambda)
+	h.Write(hashLambda)
+	return h.Sum(nil)
+}
+
+func cncBit(buf []byte, i int) bool {
+	return buf[i/8]&(1<<(i%8)) != 0
+}
+
+func cncBitUint(buf []byte, i int) uint {
+	if cncBit(buf, i) {
+		return 1
+	}
+	return 0
+}
+
+func cncSetBit(buf []byte, i int) {
+	buf[i/8] |= 1 << (i % 8)
+}
+
+// prg implements an AES-CTR pseudorandom generator.
+type prg struct {
+	stream cipher.Stream
+}
+
+func newPRG(seed []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+	var iv [aes.BlockSize]byte
+	return &prg{
+		stream: cipher.NewCTR(block, iv[:]),
+	}, nil
+}
+
+func (p *prg) Read(buf []byte) (int, error) {
+	clear(buf)
+	p.stream.XORKeyStream(buf, buf)
+	return len(buf), nil
+}
@@ -0,0 +1,101 @@
+//
+// cut_and_choose_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func cutAndChoose(garbler, evaluator *Circuit, inputs []*big.Int, s int) (
+	g, e dualResult) {
+
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	done := make(chan dualResult)
+	go func() {
+		result, err := CutAndChooseGarbler(gConn, ot.NewIKNP(ot.NewCO()),
+			garbler, inputs[0], s, false)
+		gConn.Close()
+		done <- dualResult{
+			result: result,
+			err:    err,
+		}
+	}()
+
+	result, err := CutAndChooseEvaluator(eConn, ot.NewIKNP(ot.NewCO()),
+		evaluator, inputs[1], s, false)
+	eConn.Close()
+	e = dualResult{
+		result: result,
+		err:    err,
+	}
+	g = <-done
+	return
+}
+
+func TestCutAndChoose(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+
+	for _, test := range dualTests {
+		inputs := []*big.Int{big.NewInt(test[0]), big.NewInt(test[1])}
+		expected, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		g, e := cutAndChoose(circ, circ, inputs, 5)
+		for id, r := range []dualResult{g, e} {
+			if r.err != nil {
+				t.Fatalf("party %d failed: %s", id, r.err)
+			}
+			if len(r.result) != len(expected) {
+				t.Fatalf("party %d: got %d results, expected %d",
+					id, len(r.result), len(expected))
+			}
+			for idx := range expected {
+				if r.result[idx].Cmp(expected[idx]) != 0 {
+					t.Errorf("party %d: %v: result %d: got %v, expected %v",
+						id, test, idx, r.result[idx], expected[idx])
+				}
+			}
+		}
+	}
+}
+
+func TestCutAndChooseCheat(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	malicious, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	for i := range malicious.Gates {
+		if malicious.Gates[i].Op == XOR {
+			malicious.Gates[i].Op = XNOR
+			break
+		}
+	}
+
+	inputs := []*big.Int{big.NewInt(4711), big.NewInt(42)}
+	_, e := cutAndChoose(malicious, circ, inputs, 4)
+	if e.err == nil {
+		t.Fatalf("evaluator accepted a different circuit: %v", e.result)
+	}
+}
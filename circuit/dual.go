@@ -0,0 +1,396 @@
+//
+// dual.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// ErrDualAbort is returned when the dual execution equality test
+// fails i.e. the two executions produced different outputs.
+var ErrDualAbort = errors.New("dual execution: output mismatch, aborting")
+
+// DualExecution runs the dual execution protocol on the P2P
+// network. Both parties garble the circuit once and evaluate the
+// peer's garbled circuit once. The output labels of the two
+// executions are compared with an equality test and the results are
+// returned only if both executions produced the same output. The id
+// specifies the party: IDGarbler or IDEvaluator. The sender and
+// receiver OTs must be separate instances of the same OT algorithm.
+//
+// The protocol protects against a malicious garbler garbling a
+// different function at the cost of leaking at most one bit of
+// information to the malicious party.
+func DualExecution(conn *p2p.Conn, sender, receiver ot.OT, circ *Circuit,
+	id int, inputs *big.Int, verbose bool) ([]*big.Int, error) {
+
+	if len(circ.Inputs) != 2 {
+		return nil, fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
+			len(circ.Inputs))
+	}
+	if id != IDGarbler && id != IDEvaluator {
+		return nil, fmt.Errorf("invalid party ID %d", id)
+	}
+	if !circ.Outputs.Shared() {
+		return nil, fmt.Errorf("dual execution does not support " +
+			"per-party outputs")
+	}
+
+	timing := NewTiming()
+
+	var garbled *Garbled
+	var labels []ot.Label
+	var result *big.Int
+	var err error
+
+	// The garbler garbles first, the evaluator evaluates first.
+	if id == IDGarbler {
+		if verbose {
+			fmt.Printf(" - Garbling...\n")
+		}
+		garbled, err = dualGarble(conn, sender, circ, id, inputs)
+		if err != nil {
+			return nil, err
+		}
+		timing.Sample("Garble", nil)
+		if verbose {
+			fmt.Printf(" - Evaluating...\n")
+		}
+		labels, result, err = dualEval(conn, receiver, circ, id, inputs)
+		if err != nil {
+			return nil, err
+		}
+		timing.Sample("Eval", nil)
+	} else {
+		if verbose {
+			fmt.Printf(" - Evaluating...\n")
+		}
+		labels, result, err = dualEval(conn, receiver, circ, id, inputs)
+		if err != nil {
+			return nil, err
+		}
+		timing.Sample("Eval", nil)
+		if verbose {
+			fmt.Printf(" - Garbling...\n")
+		}
+		garbled, err = dualGarble(conn, sender, circ, id, inputs)
+		if err != nil {
+			return nil, err
+		}
+		timing.Sample("Garble", nil)
+	}
+
+	// Our garbled output labels matching our result.
+	numOutputs := circ.Outputs.Size()
+	own := make([]ot.Label, numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		wire := garbled.Wires[circ.NumWires-numOutputs+i]
+		if result.Bit(i) == 1 {
+			own[i] = wire.L1
+		} else {
+			own[i] = wire.L0
+		}
+	}
+
+	// Hash the garbler's circuit labels first and then the
+	// evaluator's circuit labels.
+	var digest []byte
+	if id == IDGarbler {
+		digest = hashLabels(own, labels)
+	} else {
+		digest = hashLabels(labels, own)
+	}
+
+	if verbose {
+		fmt.Printf(" - Checking outputs...\n")
+	}
+	if err := dualEqual(conn, id, digest); err != nil {
+		return nil, err
+	}
+	timing.Sample("Equal", nil)
+	if verbose {
+		timing.Print(conn.Stats)
+	}
+
+	return circ.Outputs.Split(result), nil
+}
+
+// dualGarble garbles the circuit and sends it to the peer
+// together with our input labels. The peer's input labels are sent
+// with OT.
+func dualGarble(conn *p2p.Conn, oti ot.OT, circ *Circuit, id int,
+	inputs *big.Int) (*Garbled, error) {
+
+	var key [32]byte
+	_, err := rand.Read(key[:])
+	if err != nil {
+		return nil, err
+	}
+	garbled, err := circ.Garble(HalfGates, key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SendData(key[:]); err != nil {
+		return nil, err
+	}
+	if err := conn.SendUint32(len(garbled.Gates)); err != nil {
+		return nil, err
+	}
+	var labelData ot.LabelData
+	for _, data := range garbled.Gates {
+		if err := conn.SendUint32(len(data)); err != nil {
+			return nil, err
+		}
+		for _, d := range data {
+			if err := conn.SendLabel(d, &labelData); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Send our inputs.
+	offset, count := dualInputs(circ, id)
+	for i := 0; i < count; i++ {
+		wire := garbled.Wires[offset+i]
+		l := wire.L0
+		if inputs.Bit(i) == 1 {
+			l = wire.L1
+		}
+		if err := conn.SendLabel(l, &labelData); err != nil {
+			return nil, err
+		}
+	}
+
+	// Send output decoding information.
+	numOutputs := circ.Outputs.Size()
+	lambda := big.NewInt(0)
+	for i := 0; i < numOutputs; i++ {
+		lambda.SetBit(lambda, i,
+			garbled.Lambda(Wire(circ.NumWires-numOutputs+i)))
+	}
+	if err := conn.SendData(lambda.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// Peer OTs its inputs.
+	if err := ot.Negotiate(conn, oti, true); err != nil {
+		return nil, err
+	}
+	if err := oti.InitSender(conn); err != nil {
+		return nil, err
+	}
+	offset, count = dualInputs(circ, 1-id)
+	peerOffset, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	peerCount, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	if peerOffset != offset || peerCount != count {
+		return nil, fmt.Errorf("peer can't OT wires [%d...%d[",
+			peerOffset, peerOffset+peerCount)
+	}
+	if err := oti.Send(garbled.Wires[offset : offset+count]); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	return garbled, nil
+}
+
+// dualEval receives the peer's garbled circuit, OTs our input labels,
+// and evaluates the circuit. It returns the output labels and the
+// decoded output values.
+func dualEval(conn *p2p.Conn, oti ot.OT, circ *Circuit, id int,
+	inputs *big.Int) ([]ot.Label, *big.Int, error) {
+
+	key, err := conn.ReceiveData()
+	if err != nil {
+		return nil, nil, err
+	}
+	count, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	if count != circ.NumGates {
+		return nil, nil, fmt.Errorf(
+			"wrong number of gates: got %d, expected %d", count, circ.NumGates)
+	}
+	garbled := make([][]ot.Label, circ.NumGates)
+	var labelData ot.LabelData
+	for i := 0; i < circ.NumGates; i++ {
+		count, err := conn.ReceiveUint32()
+		if err != nil {
+			return nil, nil, err
+		}
+		values := make([]ot.Label, count)
+		for j := 0; j < count; j++ {
+			err := conn.ReceiveLabel(&values[j], &labelData)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		garbled[i] = values
+	}
+
+	wires := make([]ot.Label, circ.NumWires)
+
+	// Receive peer inputs.
+	offset, count := dualInputs(circ, 1-id)
+	for i := 0; i < count; i++ {
+		err := conn.ReceiveLabel(&wires[offset+i], &labelData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Receive output decoding information.
+	data, err := conn.ReceiveData()
+	if err != nil {
+		return nil, nil, err
+	}
+	lambda := big.NewInt(0).SetBytes(data)
+
+	// Query our inputs.
+	if err := ot.Negotiate(conn, oti, false); err != nil {
+		return nil, nil, err
+	}
+	if err := oti.InitReceiver(conn); err != nil {
+		return nil, nil, err
+	}
+	offset, count = dualInputs(circ, id)
+	if err := conn.SendUint32(offset); err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SendUint32(count); err != nil {
+		return nil, nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, nil, err
+	}
+	flags := make([]bool, count)
+	for i := 0; i < count; i++ {
+		flags[i] = inputs.Bit(i) == 1
+	}
+	if err := oti.Receive(flags, wires[offset:offset+count]); err != nil {
+		return nil, nil, err
+	}
+
+	if err := circ.Eval(HalfGates, key, wires, garbled); err != nil {
+		return nil, nil, err
+	}
+
+	numOutputs := circ.Outputs.Size()
+	labels := make([]ot.Label, numOutputs)
+	result := big.NewInt(0)
+	for i := 0; i < numOutputs; i++ {
+		l := wires[circ.NumWires-numOutputs+i]
+		labels[i] = l
+		var bit uint
+		if l.S() {
+			bit = 1
+		}
+		result.SetBit(result, i, bit^lambda.Bit(i))
+	}
+
+	return labels, result, nil
+}
+
+// dualInputs returns the input wire offset and count of the party.
+func dualInputs(circ *Circuit, id int) (int, int) {
+	if id == IDGarbler {
+		return 0, int(circ.Inputs[0].Type.Bits)
+	}
+	return int(circ.Inputs[0].Type.Bits), int(circ.Inputs[1].Type.Bits)
+}
+
+func hashLabels(a, b []ot.Label) []byte {
+	h := sha256.New()
+	var data ot.LabelData
+	for _, l := range a {
+		l.GetData(&data)
+		h.Write(data[:])
+	}
+	for _, l := range b {
+		l.GetData(&data)
+		h.Write(data[:])
+	}
+	return h.Sum(nil)
+}
+
+// dualEqual runs the equality test of the output label digests. The
+// garbler commits to its digest, the evaluator sends its digest, and
+// the garbler opens its commitment. Both parties compare the digests
+// and return ErrDualAbort if they differ.
+func dualEqual(conn *p2p.Conn, id int, digest []byte) error {
+	if id == IDGarbler {
+		var nonce [32]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return err
+		}
+		opening := append(nonce[:], digest...)
+		commitment := sha256.Sum256(opening)
+		if err := conn.SendData(commitment[:]); err != nil {
+			return err
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		peer, err := conn.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if err := conn.SendData(opening); err != nil {
+			return err
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		if !bytes.Equal(peer, digest) {
+			return ErrDualAbort
+		}
+		return nil
+	}
+
+	commitment, err := conn.ReceiveData()
+	if err != nil {
+		return err
+	}
+	if err := conn.SendData(digest); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	opening, err := conn.ReceiveData()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(opening)
+	if !bytes.Equal(sum[:], commitment) || len(opening) != 32+len(digest) {
+		return fmt.Errorf("dual execution: invalid commitment opening")
+	}
+	if !bytes.Equal(opening[32:], digest) {
+		return ErrDualAbort
+	}
+	return nil
+}
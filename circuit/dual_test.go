@@ -0,0 +1,126 @@
+//
+// dual_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+var dualTests = [][]int64{
+	{0, 0},
+	{1, 2},
+	{300, 200},
+	{65535, 65535},
+	{4711, 42},
+}
+
+type dualResult struct {
+	result []*big.Int
+	err    error
+}
+
+func dualExecution(garbler, evaluator *Circuit, inputs []*big.Int) (
+	g, e dualResult) {
+
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	done := make(chan dualResult)
+	go func() {
+		result, err := DualExecution(gConn, ot.NewIKNP(ot.NewCO()),
+			ot.NewIKNP(ot.NewCO()), garbler, IDGarbler, inputs[0], false)
+		gConn.Close()
+		done <- dualResult{
+			result: result,
+			err:    err,
+		}
+	}()
+
+	result, err := DualExecution(eConn, ot.NewIKNP(ot.NewCO()),
+		ot.NewIKNP(ot.NewCO()), evaluator, IDEvaluator, inputs[1], false)
+	eConn.Close()
+	e = dualResult{
+		result: result,
+		err:    err,
+	}
+	g = <-done
+	return
+}
+
+func TestDualExecution(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+
+	for _, test := range dualTests {
+		inputs := []*big.Int{big.NewInt(test[0]), big.NewInt(test[1])}
+		expected, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		g, e := dualExecution(circ, circ, inputs)
+		for id, r := range []dualResult{g, e} {
+			if r.err != nil {
+				t.Fatalf("party %d failed: %s", id, r.err)
+			}
+			if len(r.result) != len(expected) {
+				t.Fatalf("party %d: got %d results, expected %d",
+					id, len(r.result), len(expected))
+			}
+			for idx := range expected {
+				if r.result[idx].Cmp(expected[idx]) != 0 {
+					t.Errorf("party %d: %v: result %d: got %v, expected %v",
+						id, test, idx, r.result[idx], expected[idx])
+				}
+			}
+		}
+	}
+}
+
+func TestDualExecutionAbort(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+
+	// Malicious garbler: flip an XOR gate driving an output wire into
+	// XNOR. This garbles a different function but evaluates the peer's
+	// circuit correctly.
+	malicious, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	firstOut := Wire(malicious.NumWires - malicious.Outputs.Size())
+	var flipped bool
+	for i := range malicious.Gates {
+		g := &malicious.Gates[i]
+		if g.Op == XOR && g.Output >= firstOut {
+			g.Op = XNOR
+			flipped = true
+			break
+		}
+	}
+	if !flipped {
+		t.Fatalf("no XOR output gate found")
+	}
+
+	inputs := []*big.Int{big.NewInt(4711), big.NewInt(42)}
+	_, e := dualExecution(malicious, circ, inputs)
+	if e.err != ErrDualAbort {
+		t.Fatalf("evaluator did not abort: result=%v, err=%v",
+			e.result, e.err)
+	}
+}
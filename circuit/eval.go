@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2021 Markku Rossi
+// Copyright (c) 2019-2021, 2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,108 +8,151 @@ package circuit
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
 	"fmt"
+	"runtime"
 
 	"github.com/markkurossi/mpc/ot"
 )
 
-// Eval evaluates the circuit.
-func (c *Circuit) Eval(key []byte, wires []ot.Label,
+// Eval evaluates the circuit that is garbled with the garbling
+// scheme.
+func (c *Circuit) Eval(scheme Scheme, key []byte, wires []ot.Label,
 	garbled [][]ot.Label) error {
 
+	return c.EvalParallel(scheme, key, wires, garbled,
+		runtime.GOMAXPROCS(0))
+}
+
+// EvalParallel evaluates the circuit with the argument number of
+// worker goroutines. The gates are evaluated level by level.
+func (c *Circuit) EvalParallel(scheme Scheme, key []byte, wires []ot.Label,
+	garbled [][]ot.Label, workers int) error {
+
+	if scheme >= numSchemes {
+		return fmt.Errorf("invalid garbling scheme %s", scheme)
+	}
+
 	alg, err := aes.NewCipher(key)
 	if err != nil {
 		return err
 	}
 
+	if workers > 1 {
+		return c.getSchedule(scheme).run(workers, func() (gateFunc, error) {
+			alg, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			var data ot.LabelData
+			return func(idx int, id uint32) error {
+				return c.Gates[idx].eval(scheme, alg, wires, garbled[idx],
+					id, &data)
+			}, nil
+		})
+	}
+
 	var data ot.LabelData
 	var id uint32
 
 	for i := 0; i < len(c.Gates); i++ {
 		gate := &c.Gates[i]
+		err := gate.eval(scheme, alg, wires, garbled[i], id, &data)
+		if err != nil {
+			return err
+		}
+		id += gate.tweaks(scheme)
+	}
 
-		var a, b, c ot.Label
-
-		switch gate.Op {
-		case XOR, XNOR, AND, OR:
-			a = wires[gate.Input0]
-			b = wires[gate.Input1]
+	return nil
+}
 
-		case INV:
-			a = wires[gate.Input0]
+// eval evaluates the gate with the garbled table row and tweak ID id.
+func (g *Gate) eval(scheme Scheme, alg cipher.Block, wires []ot.Label,
+	row []ot.Label, id uint32, data *ot.LabelData) error {
 
-		default:
-			return fmt.Errorf("invalid operation %s", gate.Op)
+	if scheme == ThreeHalves {
+		switch g.Op {
+		case AND, OR, INV:
+			return g.evalThreeHalves(alg, wires, row, id, data)
 		}
+	}
 
-		var output ot.Label
+	var a, b, c ot.Label
 
-		switch gate.Op {
-		case XOR, XNOR:
-			a.Xor(b)
-			output = a
+	switch g.Op {
+	case XOR, XNOR, AND, OR:
+		a = wires[g.Input0]
+		b = wires[g.Input1]
 
-		case AND:
-			row := garbled[i]
-			if len(row) != 2 {
-				return fmt.Errorf("corrupted ciruit: AND row length: %d",
-					len(row))
-			}
-			sa := a.S()
-			sb := b.S()
+	case INV:
+		a = wires[g.Input0]
 
-			j0 := id
-			j1 := id + 1
-			id += 2
+	default:
+		return fmt.Errorf("invalid operation %s", g.Op)
+	}
 
-			tg := row[0]
-			te := row[1]
+	var output ot.Label
 
-			wg := encryptHalf(alg, a, j0, &data)
-			if sa {
-				wg.Xor(tg)
-			}
-			we := encryptHalf(alg, b, j1, &data)
-			if sb {
-				we.Xor(te)
-				we.Xor(a)
-			}
-			output = wg
-			output.Xor(we)
-
-		case OR:
-			row := garbled[i]
-			index := idx(a, b)
-			if index > 0 {
-				// First row is zero and not transmitted.
-				index--
-				if index >= len(row) {
-					return fmt.Errorf("corrupted circuit: index %d >= row %d",
-						index, len(row))
-				}
-				c = row[index]
+	switch g.Op {
+	case XOR, XNOR:
+		a.Xor(b)
+		output = a
+
+	case AND:
+		if len(row) != 2 {
+			return fmt.Errorf("corrupted ciruit: AND row length: %d",
+				len(row))
+		}
+		sa := a.S()
+		sb := b.S()
+
+		j0 := id
+		j1 := id + 1
+
+		tg := row[0]
+		te := row[1]
+
+		wg := encryptHalf(alg, a, j0, data)
+		if sa {
+			wg.Xor(tg)
+		}
+		we := encryptHalf(alg, b, j1, data)
+		if sb {
+			we.Xor(te)
+			we.Xor(a)
+		}
+		output = wg
+		output.Xor(we)
+
+	case OR:
+		index := idx(a, b)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			index--
+			if index >= len(row) {
+				return fmt.Errorf("corrupted circuit: index %d >= row %d",
+					index, len(row))
 			}
+			c = row[index]
+		}
+
+		output = decrypt(alg, a, b, id, c, data)
 
-			output = decrypt(alg, a, b, id, c, &data)
-			id++
-
-		case INV:
-			row := garbled[i]
-			index := idxUnary(a)
-			if index > 0 {
-				// First row is zero and not transmitted.
-				index--
-				if index >= len(row) {
-					return fmt.Errorf("corrupted circuit: index %d >= row %d",
-						index, len(row))
-				}
-				c = row[index]
+	case INV:
+		index := idxUnary(a)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			index--
+			if index >= len(row) {
+				return fmt.Errorf("corrupted circuit: index %d >= row %d",
+					index, len(row))
 			}
-			output = decrypt(alg, a, ot.Label{}, id, c, &data)
-			id++
+			c = row[index]
 		}
-		wires[gate.Output] = output
+		output = decrypt(alg, a, ot.Label{}, id, c, data)
 	}
+	wires[g.Output] = output
 
 	return nil
 }
@@ -1,7 +1,7 @@
 //
 // evaluator.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -20,23 +20,44 @@ var (
 	debug = false
 )
 
-// Evaluator runs the evaluator on the P2P network.
+// Evaluator runs the evaluator on the P2P network. The garbling
+// scheme is negotiated with the garbler and the scheme argument
+// specifies the most efficient scheme the evaluator is willing to
+// use.
 func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
-	verbose bool) ([]*big.Int, error) {
+	scheme Scheme, verbose bool) ([]*big.Int, error) {
 
 	timing := NewTiming()
 
-	garbled := make([][]ot.Label, circ.NumGates)
-
 	// Receive program info.
 	if verbose {
 		fmt.Printf(" - Waiting for circuit info...\n")
 	}
-	key, err := conn.ReceiveData()
+	scheme, err := NegotiateScheme(conn, scheme, false)
+	if err != nil {
+		return nil, err
+	}
+	key, garbled, err := receiveGarbled(conn, scheme, circ, timing, verbose)
 	if err != nil {
 		return nil, err
 	}
 
+	return evaluatorOnline(conn, oti, circ, scheme, key, garbled, inputs,
+		timing, verbose)
+}
+
+// receiveGarbled receives the garbling key and the garbled tables
+// from the garbler.
+func receiveGarbled(conn *p2p.Conn, scheme Scheme, circ *Circuit,
+	timing *Timing, verbose bool) ([]byte, [][]ot.Label, error) {
+
+	garbled := make([][]ot.Label, circ.NumGates)
+
+	key, err := conn.ReceiveData()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Receive garbled tables.
 	timing.Sample("Wait", nil)
 	if verbose {
@@ -44,30 +65,72 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	}
 	count, err := conn.ReceiveUint32()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if count != circ.NumGates {
-		return nil, fmt.Errorf("wrong number of gates: got %d, expected %d",
-			count, circ.NumGates)
+		return nil, nil,
+			fmt.Errorf("wrong number of gates: got %d, expected %d",
+				count, circ.NumGates)
 	}
 	var label ot.Label
 	var labelData ot.LabelData
 	for i := 0; i < circ.NumGates; i++ {
 		count, err := conn.ReceiveUint32()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
+		if scheme == ThreeHalves && count == 2 {
+			t0, t1, err := receiveThreeHalves(conn)
+			if err != nil {
+				return nil, nil, err
+			}
+			garbled[i] = []ot.Label{t0, t1}
+			continue
+		}
 		values := make([]ot.Label, count)
 		for j := 0; j < count; j++ {
 			err := conn.ReceiveLabel(&label, &labelData)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			values[j] = label
 		}
 		garbled[i] = values
 	}
+	return key, garbled, nil
+}
+
+// receiveThreeHalves receives the three-halves garbled table.
+func receiveThreeHalves(conn *p2p.Conn) (t0, t1 ot.Label, err error) {
+	var v [3]uint64
+	for i := range v {
+		v[i], err = conn.ReceiveUint64()
+		if err != nil {
+			return
+		}
+	}
+	ctrl, err := conn.ReceiveByte()
+	if err != nil {
+		return
+	}
+	t0.D0 = v[0]
+	t0.D1 = v[1]
+	t1.D0 = v[2]
+	t1.D1 = uint64(ctrl)
+	return
+}
+
+// evaluatorOnline runs the online phase of the evaluator protocol: it
+// receives the garbler's input labels, queries the evaluator's input
+// labels with OT, evaluates the circuit, and resolves the result
+// values.
+func evaluatorOnline(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	scheme Scheme, key []byte, garbled [][]ot.Label, inputs *big.Int,
+	timing *Timing, verbose bool) ([]*big.Int, error) {
+
+	var label ot.Label
+	var labelData ot.LabelData
 
 	wires := make([]ot.Label, circ.NumWires)
 
@@ -81,6 +144,10 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	}
 
 	// Init oblivious transfer.
+	err := ot.Negotiate(conn, oti, false)
+	if err != nil {
+		return nil, err
+	}
 	err = oti.InitReceiver(conn)
 	if err != nil {
 		return nil, err
@@ -120,34 +187,18 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	if verbose {
 		fmt.Printf(" - Evaluating circuit...\n")
 	}
-	err = circ.Eval(key[:], wires, garbled)
+	err = circ.Eval(scheme, key[:], wires, garbled)
 	if err != nil {
 		return nil, err
 	}
 	timing.Sample("Eval", nil)
 
 	// Resolve result values.
-
-	var labels []ot.Label
-
-	for i := 0; i < circ.Outputs.Size(); i++ {
-		r := wires[Wire(circ.NumWires-circ.Outputs.Size()+i)]
-		labels = append(labels, r)
-	}
-	for _, l := range labels {
-		if err := conn.SendLabel(l, &labelData); err != nil {
-			return nil, err
-		}
-	}
-	if err := conn.Flush(); err != nil {
-		return nil, err
-	}
-
-	result, err := conn.ReceiveData()
+	outputs := circ.NumWires - circ.Outputs.Size()
+	result, err := evaluatorResult(conn, circ.Outputs, wires[outputs:])
 	if err != nil {
 		return nil, err
 	}
-	raw := big.NewInt(0).SetBytes(result)
 
 	xfer = conn.Stats.Sum() - ioStats
 	timing.Sample("Result", []string{FileSize(xfer).String()})
@@ -155,5 +206,5 @@ func Evaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 		timing.Print(conn.Stats)
 	}
 
-	return circ.Outputs.Split(raw), nil
+	return result, nil
 }
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -12,6 +12,8 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"runtime"
 
 	"github.com/markkurossi/mpc/ot"
 )
@@ -145,8 +147,8 @@ func makeKHalf(x ot.Label, i uint32) ot.Label {
 	return x
 }
 
-func makeLabels(r ot.Label) (ot.Wire, error) {
-	l0, err := ot.NewLabel(rand.Reader)
+func makeLabels(rand io.Reader, r ot.Label) (ot.Wire, error) {
+	l0, err := ot.NewLabel(rand)
 	if err != nil {
 		return ot.Wire{}, err
 	}
@@ -161,9 +163,10 @@ func makeLabels(r ot.Label) (ot.Wire, error) {
 
 // Garbled contains garbled circuit information.
 type Garbled struct {
-	R     ot.Label
-	Wires []ot.Wire
-	Gates [][]ot.Label
+	Scheme Scheme
+	R      ot.Label
+	Wires  []ot.Wire
+	Gates  [][]ot.Label
 }
 
 // Lambda returns the lambda value of the wire.
@@ -185,10 +188,32 @@ func (g *Garbled) SetLambda(wire Wire, val uint) {
 	g.Wires[wire] = w
 }
 
-// Garble garbles the circuit.
-func (c *Circuit) Garble(key []byte) (*Garbled, error) {
+// Garble garbles the circuit with the garbling scheme.
+func (c *Circuit) Garble(scheme Scheme, key []byte) (*Garbled, error) {
+	return c.GarbleRand(scheme, key, rand.Reader)
+}
+
+// GarbleRand garbles the circuit using the argument random source for
+// the wire labels. Garbling the circuit twice with the same key and
+// random data produces identical garbled circuits.
+func (c *Circuit) GarbleRand(scheme Scheme, key []byte, rand io.Reader) (
+	*Garbled, error) {
+
+	return c.GarbleParallel(scheme, key, rand, runtime.GOMAXPROCS(0))
+}
+
+// GarbleParallel garbles the circuit with the argument number of
+// worker goroutines. The gates are garbled level by level and the
+// result is identical to the sequentially garbled circuit.
+func (c *Circuit) GarbleParallel(scheme Scheme, key []byte, rand io.Reader,
+	workers int) (*Garbled, error) {
+
+	if scheme >= numSchemes {
+		return nil, fmt.Errorf("invalid garbling scheme %s", scheme)
+	}
+
 	// Create R.
-	r, err := ot.NewLabel(rand.Reader)
+	r, err := ot.NewLabel(rand)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +231,7 @@ func (c *Circuit) Garble(key []byte) (*Garbled, error) {
 
 	// Assing all input wires.
 	for i := 0; i < c.Inputs.Size(); i++ {
-		w, err := makeLabels(r)
+		w, err := makeLabels(rand, r)
 		if err != nil {
 			return nil, err
 		}
@@ -214,27 +239,54 @@ func (c *Circuit) Garble(key []byte) (*Garbled, error) {
 	}
 
 	// Garble gates.
-	var data ot.LabelData
-	var id uint32
-	for i := 0; i < len(c.Gates); i++ {
-		gate := &c.Gates[i]
-		data, err := gate.garble(wires, alg, r, &id, &data)
+	if workers > 1 {
+		err = c.getSchedule(scheme).run(workers, func() (gateFunc, error) {
+			alg, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			var data ot.LabelData
+			return func(idx int, id uint32) error {
+				table, err := c.Gates[idx].garble(scheme, wires, alg, r,
+					&id, &data)
+				garbled[idx] = table
+				return err
+			}, nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		garbled[i] = data
+	} else {
+		var data ot.LabelData
+		var id uint32
+		for i := 0; i < len(c.Gates); i++ {
+			gate := &c.Gates[i]
+			data, err := gate.garble(scheme, wires, alg, r, &id, &data)
+			if err != nil {
+				return nil, err
+			}
+			garbled[i] = data
+		}
 	}
 
 	return &Garbled{
-		R:     r,
-		Wires: wires,
-		Gates: garbled,
+		Scheme: scheme,
+		R:      r,
+		Wires:  wires,
+		Gates:  garbled,
 	}, nil
 }
 
 // Garble garbles the gate and returns it labels.
-func (g *Gate) garble(wires []ot.Wire, enc cipher.Block, r ot.Label,
-	idp *uint32, data *ot.LabelData) ([]ot.Label, error) {
+func (g *Gate) garble(scheme Scheme, wires []ot.Wire, enc cipher.Block,
+	r ot.Label, idp *uint32, data *ot.LabelData) ([]ot.Label, error) {
+
+	if scheme == ThreeHalves {
+		switch g.Op {
+		case AND, OR, INV:
+			return g.garbleThreeHalves(wires, enc, r, idp, data)
+		}
+	}
 
 	var a, b, c ot.Wire
 
@@ -1,7 +1,7 @@
 //
 // garbler.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -34,22 +34,29 @@ func (s FileSize) String() string {
 	}
 }
 
-// Garbler runs the garbler on the P2P network.
+// Garbler runs the garbler on the P2P network. The garbling scheme
+// is negotiated with the evaluator and the scheme argument specifies
+// the most efficient scheme the garbler is willing to use.
 func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
-	verbose bool) ([]*big.Int, error) {
+	scheme Scheme, verbose bool) ([]*big.Int, error) {
 
 	timing := NewTiming()
+
+	scheme, err := NegotiateScheme(conn, scheme, true)
+	if err != nil {
+		return nil, err
+	}
 	if verbose {
-		fmt.Printf(" - Garbling...\n")
+		fmt.Printf(" - Garbling with %s...\n", scheme)
 	}
 
 	var key [32]byte
-	_, err := rand.Read(key[:])
+	_, err = rand.Read(key[:])
 	if err != nil {
 		return nil, err
 	}
 
-	garbled, err := circ.Garble(key[:])
+	garbled, err := circ.Garble(scheme, key[:])
 	if err != nil {
 		return nil, err
 	}
@@ -60,25 +67,63 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	if verbose {
 		fmt.Printf(" - Sending garbled circuit...\n")
 	}
-	if err := conn.SendData(key[:]); err != nil {
+	if err := sendGarbled(conn, scheme, key[:], garbled.Gates); err != nil {
 		return nil, err
 	}
 
-	// Send garbled tables.
-	if err := conn.SendUint32(len(garbled.Gates)); err != nil {
-		return nil, err
+	return garblerOnline(conn, oti, circ, garbled, inputs, timing, verbose)
+}
+
+// sendGarbled sends the garbling key and the garbled tables to the
+// evaluator.
+func sendGarbled(conn *p2p.Conn, scheme Scheme, key []byte,
+	gates [][]ot.Label) error {
+
+	if err := conn.SendData(key); err != nil {
+		return err
+	}
+	if err := conn.SendUint32(len(gates)); err != nil {
+		return err
 	}
 	var labelData ot.LabelData
-	for _, data := range garbled.Gates {
+	for _, data := range gates {
 		if err := conn.SendUint32(len(data)); err != nil {
-			return nil, err
+			return err
+		}
+		if scheme == ThreeHalves && len(data) == 2 {
+			if err := sendThreeHalves(conn, data[0], data[1]); err != nil {
+				return err
+			}
+			continue
 		}
 		for _, d := range data {
 			if err := conn.SendLabel(d, &labelData); err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
+	return nil
+}
+
+// sendThreeHalves sends the three-halves garbled table t0 and t1 as
+// three label halves and the control bits byte.
+func sendThreeHalves(conn *p2p.Conn, t0, t1 ot.Label) error {
+	for _, v := range []uint64{t0.D0, t0.D1, t1.D0} {
+		if err := conn.SendUint64(v); err != nil {
+			return err
+		}
+	}
+	return conn.SendByte(byte(t1.D1))
+}
+
+// garblerOnline runs the online phase of the garbler protocol: it
+// sends the garbler's input labels, transfers the evaluator's input
+// labels with OT, and resolves the result values.
+func garblerOnline(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	garbled *Garbled, inputs *big.Int, timing *Timing, verbose bool) (
+	[]*big.Int, error) {
+
+	var labelData ot.LabelData
 
 	// Select our inputs.
 	var n1 []ot.Label
@@ -111,6 +156,10 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	}
 
 	// Init oblivious transfer.
+	err := ot.Negotiate(conn, oti, true)
+	if err != nil {
+		return nil, err
+	}
 	err = oti.InitSender(conn)
 	if err != nil {
 		return nil, err
@@ -142,35 +191,9 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 	timing.Sample("OT", []string{FileSize(xfer).String()})
 
 	// Resolve result values.
-
-	result := big.NewInt(0)
-	var label ot.Label
-
-	for i := 0; i < circ.Outputs.Size(); i++ {
-		err := conn.ReceiveLabel(&label, &labelData)
-		if err != nil {
-			return nil, err
-		}
-		if i == 0 {
-			timing.Sample("Eval", nil)
-		}
-		wire := garbled.Wires[circ.NumWires-circ.Outputs.Size()+i]
-
-		var bit uint
-		if label.Equal(wire.L0) {
-			bit = 0
-		} else if label.Equal(wire.L1) {
-			bit = 1
-		} else {
-			return nil, fmt.Errorf("unknown label %s for result %d", label, i)
-		}
-		result = big.NewInt(0).SetBit(result, i, bit)
-	}
-	data := result.Bytes()
-	if err := conn.SendData(data); err != nil {
-		return nil, err
-	}
-	if err := conn.Flush(); err != nil {
+	outputs := circ.NumWires - circ.Outputs.Size()
+	result, err := GarblerResult(conn, circ.Outputs, garbled.Wires[outputs:])
+	if err != nil {
 		return nil, err
 	}
 
@@ -180,5 +203,5 @@ func Garbler(conn *p2p.Conn, oti ot.OT, circ *Circuit, inputs *big.Int,
 		timing.Print(conn.Stats)
 	}
 
-	return circ.Outputs.Split(result), nil
+	return result, nil
 }
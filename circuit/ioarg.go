@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,7 +8,9 @@ package circuit
 
 import (
 	"fmt"
+	"math"
 	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/markkurossi/mpc/types"
@@ -58,11 +60,13 @@ func (io IO) Split(in *big.Int) []*big.Int {
 	return result
 }
 
-// IOArg describes circuit input argument.
+// IOArg describes circuit input argument. The owner specifies the
+// parties that learn the value of an output argument.
 type IOArg struct {
 	Name     string
 	Type     types.Info
 	Compound IO
+	Owner    Owner
 }
 
 func (io IOArg) String() string {
@@ -95,6 +99,28 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 					inputs[0], io.Type)
 			}
 
+		case types.TFloat:
+			if io.Type.Bits != 32 && io.Type.Bits != 64 {
+				return nil, fmt.Errorf("unsupported input type: %s", io.Type)
+			}
+			f, err := strconv.ParseFloat(inputs[0], int(io.Type.Bits))
+			if err != nil {
+				return nil, fmt.Errorf("invalid input '%s' for %s",
+					inputs[0], io.Type)
+			}
+			if io.Type.Bits == 32 {
+				result.SetUint64(uint64(math.Float32bits(float32(f))))
+			} else {
+				result.SetUint64(math.Float64bits(f))
+			}
+
+		case types.TFixed:
+			v, err := parseFixed(inputs[0], io.Type)
+			if err != nil {
+				return nil, err
+			}
+			result = v
+
 		case types.TBool:
 			switch inputs[0] {
 			case "0", "f", "false":
@@ -176,6 +202,36 @@ func (io IOArg) Parse(inputs []string) (*big.Int, error) {
 	return result, nil
 }
 
+// parseFixed parses the decimal value val into the two's complement
+// value of the fixed-point type t. The value is rounded to the nearest
+// representable value.
+func parseFixed(val string, t types.Info) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(val)
+	if !ok {
+		return nil, fmt.Errorf("invalid input '%s' for %s", val, t)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1),
+		uint(t.Frac))))
+
+	// Round half away from zero.
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	num.Lsh(num, 1).Add(num, den)
+	num.Quo(num, new(big.Int).Lsh(den, 1))
+	if r.Sign() < 0 {
+		num.Neg(num)
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Bits-1))
+	if num.Cmp(limit) >= 0 || num.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, fmt.Errorf("value %s overflows %s", val, t)
+	}
+	if num.Sign() < 0 {
+		num.Add(num, limit.Lsh(limit, 1))
+	}
+	return num, nil
+}
+
 // InputSizes computes the bit sizes of the input arguments. This is
 // used for parametrized main() when the program is instantiated based
 // on input sizes.
@@ -196,10 +252,13 @@ func InputSizes(inputs []string) ([]int, error) {
 			} else {
 				val := new(big.Int)
 				_, ok := val.SetString(input, 0)
-				if !ok {
+				if ok {
+					result = append(result, val.BitLen())
+				} else if _, err := strconv.ParseFloat(input, 64); err == nil {
+					result = append(result, 64)
+				} else {
 					return nil, fmt.Errorf("invalid input: %s", input)
 				}
-				result = append(result, val.BitLen())
 			}
 		}
 	}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2023 Markku Rossi
+// Copyright (c) 2023-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,6 +8,8 @@ package circuit
 
 import (
 	"testing"
+
+	"github.com/markkurossi/mpc/types"
 )
 
 var inputSizeTests = []struct {
@@ -60,3 +62,46 @@ func TestInputSizes(t *testing.T) {
 		}
 	}
 }
+
+var parseFixedTests = []struct {
+	input    string
+	expected int64
+}{
+	{"0", 0},
+	{"1", 256},
+	{"-1", -256},
+	{"1.5", 384},
+	{"-2.25", -576},
+	{"0.1", 26},
+	{"-0.1", -26},
+	{"0.001953125", 1},
+	{"127.99609375", 32767},
+	{"-128", -32768},
+}
+
+func TestParseFixed(t *testing.T) {
+	arg := IOArg{
+		Type: types.Info{
+			Type:       types.TFixed,
+			IsConcrete: true,
+			Bits:       16,
+			Frac:       8,
+		},
+	}
+	for _, test := range parseFixedTests {
+		v, err := arg.Parse([]string{test.input})
+		if err != nil {
+			t.Errorf("Parse(%v) failed: %v", test.input, err)
+			continue
+		}
+		if v.Int64() != test.expected&0xffff {
+			t.Errorf("Parse(%v)=%v, expected %v", test.input, v,
+				test.expected)
+		}
+	}
+	for _, input := range []string{"128", "-128.5", "1.2.3", "abc"} {
+		if _, err := arg.Parse([]string{input}); err == nil {
+			t.Errorf("Parse(%v) succeeded", input)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2021, 2023 Markku Rossi
+// Copyright (c) 2020-2021, 2023-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -15,6 +15,9 @@ import (
 const (
 	// MAGIC is a magic number for the MPCL circuit format version 0.
 	MAGIC = 0x63726300 // crc0
+	// MAGIC1 is a magic number for the MPCL circuit format version
+	// 1. The version 1 adds the owners of the circuit outputs.
+	MAGIC1 = 0x63726301 // crc1
 )
 
 var (
@@ -28,15 +31,26 @@ func (c *Circuit) MarshalFormat(out io.Writer, format string) error {
 		return c.Marshal(out)
 	case "bristol":
 		return c.MarshalBristol(out)
+	case "bristol-fashion":
+		return c.MarshalBristolFashion(out)
+	case "aiger":
+		return c.MarshalAIGER(out)
+	case "blif":
+		return c.MarshalBLIF(out)
 	default:
 		return fmt.Errorf("unsupported circuit format: %s", format)
 	}
 }
 
-// Marshal marshals circuit in the MPCL circuit format.
+// Marshal marshals circuit in the MPCL circuit format. The circuit
+// is marshaled in the format version 0 unless its outputs have owners.
 func (c *Circuit) Marshal(out io.Writer) error {
+	magic := MAGIC
+	if !c.Outputs.Shared() {
+		magic = MAGIC1
+	}
 	var data = []interface{}{
-		uint32(MAGIC),
+		uint32(magic),
 		uint32(c.NumGates),
 		uint32(c.NumWires),
 		uint32(len(c.Inputs)),
@@ -56,6 +70,12 @@ func (c *Circuit) Marshal(out io.Writer) error {
 		if err := marshalIOArg(out, output); err != nil {
 			return err
 		}
+		if magic == MAGIC1 {
+			err := binary.Write(out, bo, byte(output.Owner))
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	for _, g := range c.Gates {
@@ -139,3 +159,84 @@ func (c *Circuit) MarshalBristol(out io.Writer) error {
 
 	return nil
 }
+
+// MarshalBristolFashion marshals the circuit in the Bristol Fashion
+// format. The format supports only XOR, AND, and INV gates so the
+// XNOR and OR gates are rewritten with additional wires that are
+// numbered before the output wires.
+func (c *Circuit) MarshalBristolFashion(out io.Writer) error {
+	numWires := c.NumWires
+	temp := Wire(numWires)
+
+	gates := make([]Gate, 0, c.NumGates)
+	for _, g := range c.Gates {
+		switch g.Op {
+		case XOR, AND, INV:
+			gates = append(gates, g)
+
+		case XNOR:
+			// out = INV(XOR(a, b))
+			gates = append(gates, Gate{
+				Input0: g.Input0,
+				Input1: g.Input1,
+				Output: temp,
+				Op:     XOR,
+			}, Gate{
+				Input0: temp,
+				Output: g.Output,
+				Op:     INV,
+			})
+			temp++
+
+		case OR:
+			// out = XOR(XOR(a, b), AND(a, b))
+			gates = append(gates, Gate{
+				Input0: g.Input0,
+				Input1: g.Input1,
+				Output: temp,
+				Op:     XOR,
+			}, Gate{
+				Input0: g.Input0,
+				Input1: g.Input1,
+				Output: temp + 1,
+				Op:     AND,
+			}, Gate{
+				Input0: temp,
+				Input1: temp + 1,
+				Output: g.Output,
+				Op:     XOR,
+			})
+			temp += 2
+
+		default:
+			return fmt.Errorf("unsupported gate type %s", g.Op)
+		}
+	}
+	numTemps := int(temp) - numWires
+	insertWires(gates, numWires, c.Outputs.Size(), numTemps)
+	numWires += numTemps
+
+	fmt.Fprintf(out, "%d %d\n", len(gates), numWires)
+	fmt.Fprintf(out, "%d", len(c.Inputs))
+	for _, input := range c.Inputs {
+		fmt.Fprintf(out, " %d", input.Type.Bits)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "%d", len(c.Outputs))
+	for _, ret := range c.Outputs {
+		fmt.Fprintf(out, " %d", ret.Type.Bits)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+
+	for _, g := range gates {
+		if g.Op == INV {
+			fmt.Fprintf(out, "1 1 %d %d INV\n", g.Input0, g.Output)
+		} else {
+			fmt.Fprintf(out, "2 1 %d %d %d %s\n",
+				g.Input0, g.Input1, g.Output, g.Op)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// Owner specifies the parties that learn the value of an output.
+type Owner byte
+
+// Output owners.
+const (
+	// OwnerBoth reveals the output to both parties.
+	OwnerBoth Owner = iota
+	// OwnerGarbler reveals the output only to the garbler.
+	OwnerGarbler
+	// OwnerEvaluator reveals the output only to the evaluator.
+	OwnerEvaluator
+)
+
+var ownerNames = map[Owner]string{
+	OwnerBoth:      "both",
+	OwnerGarbler:   "garbler",
+	OwnerEvaluator: "evaluator",
+}
+
+func (o Owner) String() string {
+	name, ok := ownerNames[o]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{Owner %d}", o)
+}
+
+// ParseOwner parses the output owner name.
+func ParseOwner(name string) (Owner, error) {
+	for owner, n := range ownerNames {
+		if n == name {
+			return owner, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown output owner '%s'", name)
+}
+
+// Garbler tests if the garbler learns the output.
+func (o Owner) Garbler() bool {
+	return o == OwnerBoth || o == OwnerGarbler
+}
+
+// Evaluator tests if the evaluator learns the output.
+func (o Owner) Evaluator() bool {
+	return o == OwnerBoth || o == OwnerEvaluator
+}
+
+// Shared tests if all arguments are revealed to both parties.
+func (io IO) Shared() bool {
+	for _, arg := range io {
+		if arg.Owner != OwnerBoth {
+			return false
+		}
+	}
+	return true
+}
+
+// bitOwners returns the owners of the argument bits.
+func (io IO) bitOwners() []Owner {
+	var result []Owner
+	for _, arg := range io {
+		for i := 0; i < int(arg.Type.Bits); i++ {
+			result = append(result, arg.Owner)
+		}
+	}
+	return result
+}
+
+// split splits the value into separate I/O arguments. The arguments
+// that the garbler or the evaluator, as specified by the garbler
+// flag, does not learn are returned as nil values.
+func (io IO) split(in *big.Int, garbler bool) []*big.Int {
+	result := io.Split(in)
+	for idx, arg := range io {
+		if garbler && !arg.Owner.Garbler() ||
+			!garbler && !arg.Owner.Evaluator() {
+			result[idx] = nil
+		}
+	}
+	return result
+}
+
+// GarblerResult resolves the output values with the evaluator. The
+// wires specify the garbled output wires. The evaluator sends the
+// output labels of the outputs the garbler learns, and the garbler
+// sends the decoding bits of the outputs the evaluator learns. The
+// function returns the values of the outputs the garbler learns.
+func GarblerResult(conn *p2p.Conn, outputs IO, wires []ot.Wire) (
+	[]*big.Int, error) {
+
+	var label ot.Label
+	var labelData ot.LabelData
+
+	owners := outputs.bitOwners()
+	result := new(big.Int)
+	decode := new(big.Int)
+	var decodeBit int
+
+	for i, owner := range owners {
+		wire := wires[i]
+		if owner.Garbler() {
+			err := conn.ReceiveLabel(&label, &labelData)
+			if err != nil {
+				return nil, err
+			}
+			var bit uint
+			if label.Equal(wire.L0) {
+				bit = 0
+			} else if label.Equal(wire.L1) {
+				bit = 1
+			} else {
+				return nil, fmt.Errorf("unknown label %s for result %d",
+					label, i)
+			}
+			result.SetBit(result, i, bit)
+		}
+		if owner.Evaluator() {
+			if wire.L0.S() {
+				decode.SetBit(decode, decodeBit, 1)
+			}
+			decodeBit++
+		}
+	}
+	if err := conn.SendData(decode.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	return outputs.split(result, true), nil
+}
+
+// evaluatorResult resolves the output values with the garbler. The
+// labels specify the evaluated output labels. The function returns
+// the values of the outputs the evaluator learns.
+func evaluatorResult(conn *p2p.Conn, outputs IO, labels []ot.Label) (
+	[]*big.Int, error) {
+
+	var labelData ot.LabelData
+
+	owners := outputs.bitOwners()
+	for i, owner := range owners {
+		if owner.Garbler() {
+			if err := conn.SendLabel(labels[i], &labelData); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	data, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	decode := new(big.Int).SetBytes(data)
+
+	result := new(big.Int)
+	var decodeBit int
+	for i, owner := range owners {
+		if !owner.Evaluator() {
+			continue
+		}
+		bit := decode.Bit(decodeBit)
+		decodeBit++
+		if labels[i].S() {
+			bit ^= 1
+		}
+		result.SetBit(result, i, bit)
+	}
+	return outputs.split(result, false), nil
+}
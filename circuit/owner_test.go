@@ -0,0 +1,188 @@
+//
+// owner_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+	"github.com/markkurossi/mpc/types"
+)
+
+func TestParseOwner(t *testing.T) {
+	for owner := OwnerBoth; owner <= OwnerEvaluator; owner++ {
+		parsed, err := ParseOwner(owner.String())
+		if err != nil {
+			t.Fatalf("ParseOwner(%s): %s", owner, err)
+		}
+		if parsed != owner {
+			t.Errorf("ParseOwner(%s) = %s", owner, parsed)
+		}
+	}
+	if _, err := ParseOwner("unknown"); err == nil {
+		t.Errorf("ParseOwner accepted unknown owner")
+	}
+}
+
+func ownerOutputs(owners ...Owner) IO {
+	var io IO
+	for _, owner := range owners {
+		io = append(io, IOArg{
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       8,
+			},
+			Owner: owner,
+		})
+	}
+	return io
+}
+
+func TestOutputDecoding(t *testing.T) {
+	outputs := ownerOutputs(OwnerGarbler, OwnerEvaluator, OwnerBoth)
+	values := []int64{0xa5, 0x3c, 0x81}
+
+	r, err := ot.NewLabel(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetS(true)
+
+	var wires []ot.Wire
+	var labels []ot.Label
+	for _, v := range values {
+		for i := 0; i < 8; i++ {
+			w, err := makeLabels(rand.Reader, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wires = append(wires, w)
+			if v&(1<<i) != 0 {
+				labels = append(labels, w.L1)
+			} else {
+				labels = append(labels, w.L0)
+			}
+		}
+	}
+
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	done := make(chan dualResult)
+	go func() {
+		result, err := GarblerResult(gConn, outputs, wires)
+		gConn.Close()
+		done <- dualResult{
+			result: result,
+			err:    err,
+		}
+	}()
+	eResult, err := evaluatorResult(eConn, outputs, labels)
+	eConn.Close()
+	g := <-done
+	if err != nil {
+		t.Fatalf("evaluator: %s", err)
+	}
+	if g.err != nil {
+		t.Fatalf("garbler: %s", g.err)
+	}
+
+	for idx, arg := range outputs {
+		checkOwnerResult(t, "garbler", idx, g.result[idx], values[idx],
+			arg.Owner.Garbler())
+		checkOwnerResult(t, "evaluator", idx, eResult[idx], values[idx],
+			arg.Owner.Evaluator())
+	}
+
+	// The evaluator sends the labels of the garbler's outputs and
+	// receives the decoding bits of its outputs.
+	if sent := eConn.Stats.Sent.Load(); sent != 16*16 {
+		t.Errorf("evaluator sent %d bytes, expected %d", sent, 16*16)
+	}
+	if recvd := eConn.Stats.Recvd.Load(); recvd > 4+2 {
+		t.Errorf("evaluator received %d bytes, expected at most %d",
+			recvd, 4+2)
+	}
+}
+
+func checkOwnerResult(t *testing.T, party string, idx int, result *big.Int,
+	value int64, learns bool) {
+
+	if !learns {
+		if result != nil {
+			t.Errorf("%s learned output %d", party, idx)
+		}
+		return
+	}
+	if result == nil || result.Int64() != value {
+		t.Errorf("%s: output %d: got %v, expected %v", party, idx, result,
+			value)
+	}
+}
+
+func TestOutputOwners(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	owners := [][]Owner{
+		{OwnerGarbler, OwnerEvaluator, OwnerBoth},
+		{OwnerEvaluator, OwnerEvaluator, OwnerEvaluator},
+		{OwnerGarbler, OwnerGarbler, OwnerGarbler},
+	}
+	inputs := []*big.Int{big.NewInt(4711), big.NewInt(42)}
+	expected, err := circ.Compute(inputs)
+	if err != nil {
+		t.Fatalf("Compute: %s", err)
+	}
+
+	for _, o := range owners {
+		for idx := range circ.Outputs {
+			circ.Outputs[idx].Owner = o[idx]
+		}
+
+		gc, ec := net.Pipe()
+		gConn := p2p.NewConn(gc)
+		eConn := p2p.NewConn(ec)
+
+		done := make(chan dualResult)
+		go func() {
+			result, err := Garbler(gConn, ot.NewCO(), circ, inputs[0],
+				ThreeHalves, false)
+			gConn.Close()
+			done <- dualResult{
+				result: result,
+				err:    err,
+			}
+		}()
+		result, err := Evaluator(eConn, ot.NewCO(), circ, inputs[1],
+			ThreeHalves, false)
+		eConn.Close()
+		g := <-done
+		if err != nil {
+			t.Fatalf("%v: Evaluator: %s", o, err)
+		}
+		if g.err != nil {
+			t.Fatalf("%v: Garbler: %s", o, g.err)
+		}
+		for idx, arg := range circ.Outputs {
+			value := expected[idx].Int64()
+			checkOwnerResult(t, "garbler", idx, g.result[idx], value,
+				arg.Owner.Garbler())
+			checkOwnerResult(t, "evaluator", idx, result[idx], value,
+				arg.Owner.Evaluator())
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -48,6 +48,10 @@ func (s Seen) Set(index Wire) error {
 func IsFilename(file string) bool {
 	return strings.HasSuffix(file, ".circ") ||
 		strings.HasSuffix(file, ".bristol") ||
+		strings.HasSuffix(file, ".txt") ||
+		strings.HasSuffix(file, ".v") ||
+		strings.HasSuffix(file, ".aig") ||
+		strings.HasSuffix(file, ".blif") ||
 		strings.HasSuffix(file, ".mpclc")
 }
 
@@ -59,10 +63,18 @@ func Parse(file string) (*Circuit, error) {
 	}
 	defer f.Close()
 
-	if strings.HasSuffix(file, ".circ") || strings.HasSuffix(file, ".bristol") {
+	if strings.HasSuffix(file, ".circ") ||
+		strings.HasSuffix(file, ".bristol") ||
+		strings.HasSuffix(file, ".txt") {
 		return ParseBristol(f)
 	} else if strings.HasSuffix(file, ".mpclc") {
 		return ParseMPCLC(f)
+	} else if strings.HasSuffix(file, ".v") {
+		return ParseVerilog(f)
+	} else if strings.HasSuffix(file, ".aig") {
+		return ParseAIGER(f)
+	} else if strings.HasSuffix(file, ".blif") {
+		return ParseBLIF(f)
 	}
 	return nil, fmt.Errorf("unsupported circuit format")
 }
@@ -81,6 +93,9 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 	if err := binary.Read(r, bo, &header); err != nil {
 		return nil, err
 	}
+	if header.Magic != MAGIC && header.Magic != MAGIC1 {
+		return nil, fmt.Errorf("invalid circuit magic: %x", header.Magic)
+	}
 	var inputs, outputs IO
 	var inputWires, outputWires int
 
@@ -99,6 +114,16 @@ func ParseMPCLC(in io.Reader) (*Circuit, error) {
 		if err != nil {
 			return nil, err
 		}
+		if header.Magic == MAGIC1 {
+			owner, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			out.Owner = Owner(owner)
+			if _, ok := ownerNames[out.Owner]; !ok {
+				return nil, fmt.Errorf("invalid output owner %s", out.Owner)
+			}
+		}
 		outputs = append(outputs, out)
 		outputWires += int(out.Type.Bits)
 	}
@@ -261,7 +286,10 @@ func parseString(r *bufio.Reader) (string, error) {
 	return string(buf), nil
 }
 
-// ParseBristol parses a Briston circuit file.
+// ParseBristol parses a Bristol circuit file. The parser accepts
+// both the Bristol and Bristol Fashion gates: the Bristol Fashion
+// MAND, EQ, and EQW gates are converted into AND, XOR, and XNOR
+// gates.
 func ParseBristol(in io.Reader) (*Circuit, error) {
 	r := bufio.NewReader(in)
 
@@ -364,7 +392,27 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		})
 	}
 
-	gates := make([]Gate, numGates)
+	outputWires := outputs.Size()
+	if outputWires > numWires {
+		return nil, fmt.Errorf("invalid outputs: %d wires, circuit has %d",
+			outputWires, numWires)
+	}
+
+	// The EQW gates are implemented as XOR with a zero wire that is
+	// created on demand. The zero wire is numbered after all circuit
+	// wires and moved before the output wires when the circuit is
+	// complete.
+	var zero Wire
+	var numTemps int
+	zeroWire := func() Wire {
+		if numTemps == 0 {
+			zero = Wire(numWires)
+			numTemps++
+		}
+		return zero
+	}
+
+	gates := make([]Gate, 0, numGates)
 	var stats Stats
 	var gate int
 	for gate = 0; ; gate++ {
@@ -398,6 +446,7 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		if 2+n1+n2+1 != len(line) {
 			return nil, fmt.Errorf("invalid gate: %v", line)
 		}
+		opName := line[len(line)-1]
 
 		var inputs []Wire
 		for i := 0; i < n1; i++ {
@@ -405,6 +454,14 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 			if err != nil {
 				return nil, err
 			}
+			if opName == "EQ" {
+				// The EQ gate input is a constant value.
+				if v > 1 {
+					return nil, fmt.Errorf("invalid EQ constant %d", v)
+				}
+				inputs = append(inputs, Wire(v))
+				continue
+			}
 			seen, err := wiresSeen.Get(Wire(v))
 			if err != nil {
 				return nil, err
@@ -429,7 +486,7 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		}
 		var op Operation
 		var numInputs int
-		switch line[len(line)-1] {
+		switch opName {
 		case "XOR":
 			op = XOR
 			numInputs = 2
@@ -445,8 +502,55 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		case "INV":
 			op = INV
 			numInputs = 1
+
+		case "MAND":
+			// MAND computes n2 AND gates with inputs a0..an b0..bn.
+			if n1 != 2*n2 {
+				return nil, fmt.Errorf("invalid MAND gate: %v", line)
+			}
+			for i := 0; i < n2; i++ {
+				gates = append(gates, Gate{
+					Input0: inputs[i],
+					Input1: inputs[n2+i],
+					Output: outputs[i],
+					Op:     AND,
+				})
+				stats[AND]++
+			}
+			continue
+
+		case "EQ", "EQW":
+			if len(inputs) != 1 || len(outputs) != 1 {
+				return nil, fmt.Errorf("invalid %s gate: %v", opName, line)
+			}
+			if opName == "EQW" {
+				// out = in XOR 0
+				gates = append(gates, Gate{
+					Input0: inputs[0],
+					Input1: zeroWire(),
+					Output: outputs[0],
+					Op:     XOR,
+				})
+				stats[XOR]++
+				continue
+			}
+			// The constants are computed from the first input wire:
+			// 0 = w0 XOR w0, 1 = w0 XNOR w0.
+			op = XOR
+			if inputs[0] == 1 {
+				op = XNOR
+			}
+			gates = append(gates, Gate{
+				Input0: 0,
+				Input1: 0,
+				Output: outputs[0],
+				Op:     op,
+			})
+			stats[op]++
+			continue
+
 		default:
-			return nil, fmt.Errorf("invalid operation '%s'", line[len(line)-1])
+			return nil, fmt.Errorf("invalid operation '%s'", opName)
 		}
 
 		if len(inputs) != numInputs {
@@ -463,12 +567,12 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 			input1 = inputs[1]
 		}
 
-		gates[gate] = Gate{
+		gates = append(gates, Gate{
 			Input0: inputs[0],
 			Input1: input1,
 			Output: outputs[0],
 			Op:     op,
-		}
+		})
 		stats[op]++
 	}
 	if gate != numGates {
@@ -483,8 +587,20 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 		}
 	}
 
+	if numTemps > 0 {
+		gates = append([]Gate{{
+			Input0: 0,
+			Input1: 0,
+			Output: zero,
+			Op:     XOR,
+		}}, gates...)
+		stats[XOR]++
+		insertWires(gates, numWires, outputWires, numTemps)
+		numWires += numTemps
+	}
+
 	return &Circuit{
-		NumGates: numGates,
+		NumGates: len(gates),
 		NumWires: numWires,
 		Inputs:   inputs,
 		Outputs:  outputs,
@@ -493,6 +609,29 @@ func ParseBristol(in io.Reader) (*Circuit, error) {
 	}, nil
 }
 
+// insertWires renumbers the wires of gates so that the count
+// temporary wires, numbered from numWires onwards, are placed before
+// the outputs output wires of the circuit.
+func insertWires(gates []Gate, numWires, outputs, count int) {
+	outStart := Wire(numWires - outputs)
+	renumber := func(w Wire) Wire {
+		if w >= Wire(numWires) {
+			return outStart + w - Wire(numWires)
+		}
+		if w >= outStart {
+			return w + Wire(count)
+		}
+		return w
+	}
+	for i := range gates {
+		gates[i].Input0 = renumber(gates[i].Input0)
+		if gates[i].Op != INV {
+			gates[i].Input1 = renumber(gates[i].Input1)
+		}
+		gates[i].Output = renumber(gates[i].Output)
+	}
+}
+
 func readLine(r *bufio.Reader) ([]string, error) {
 	for {
 		line, err := r.ReadString('\n')
@@ -1,7 +1,7 @@
 //
 // parser_test.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -10,6 +10,8 @@ package circuit
 
 import (
 	"bytes"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +28,105 @@ func TestParse(t *testing.T) {
 		t.Fatalf("Parse failed: %s", err)
 	}
 }
+
+func TestMarshalOwners(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	circ.Outputs[0].Owner = OwnerGarbler
+	circ.Outputs[2].Owner = OwnerEvaluator
+
+	var buf bytes.Buffer
+	if err := circ.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	parsed, err := ParseMPCLC(&buf)
+	if err != nil {
+		t.Fatalf("ParseMPCLC failed: %s", err)
+	}
+	for idx, arg := range circ.Outputs {
+		if parsed.Outputs[idx].Owner != arg.Owner {
+			t.Errorf("output %d: owner %s, expected %s", idx,
+				parsed.Outputs[idx].Owner, arg.Owner)
+		}
+	}
+}
+
+// Bristol Fashion circuit with three 2-bit inputs and two outputs:
+// out0 = (a AND b) XOR c, out1 = {NOT a0, 1}.
+var dataFashion = `7 14
+3 2 2 2
+2 2 2
+
+4 2 0 1 2 3 6 7 MAND
+2 1 6 4 8 XOR
+2 1 7 5 9 XOR
+1 1 8 10 EQW
+1 1 9 11 EQW
+1 1 0 12 INV
+1 1 1 13 EQ
+`
+
+func TestParseBristolFashion(t *testing.T) {
+	circ, err := ParseBristol(bytes.NewReader([]byte(dataFashion)))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if len(circ.Inputs) != 3 || len(circ.Outputs) != 2 {
+		t.Fatalf("unexpected IO: %v -> %v", circ.Inputs, circ.Outputs)
+	}
+	for a := int64(0); a < 4; a++ {
+		for b := int64(0); b < 4; b++ {
+			for c := int64(0); c < 4; c++ {
+				out, err := circ.Compute([]*big.Int{
+					big.NewInt(a), big.NewInt(b), big.NewInt(c),
+				})
+				if err != nil {
+					t.Fatalf("Compute failed: %s", err)
+				}
+				if out[0].Int64() != (a&b)^c {
+					t.Errorf("out0(%d,%d,%d)=%d", a, b, c, out[0])
+				}
+				if out[1].Int64() != (^a&1)|2 {
+					t.Errorf("out1(%d)=%d", a, out[1])
+				}
+			}
+		}
+	}
+}
+
+func TestMarshalBristolFashion(t *testing.T) {
+	circ, err := Parse("testdata/3party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := circ.MarshalBristolFashion(&buf); err != nil {
+		t.Fatalf("MarshalBristolFashion failed: %s", err)
+	}
+	for _, op := range []string{" OR\n", " XNOR\n"} {
+		if strings.Contains(buf.String(), op) {
+			t.Errorf("Bristol Fashion output contains%s", op)
+		}
+	}
+	parsed, err := ParseBristol(&buf)
+	if err != nil {
+		t.Fatalf("ParseBristol failed: %s", err)
+	}
+	inputs := []*big.Int{big.NewInt(3), big.NewInt(200), big.NewInt(77)}
+	expected, err := circ.Compute(inputs)
+	if err != nil {
+		t.Fatalf("Compute failed: %s", err)
+	}
+	result, err := parsed.Compute(inputs)
+	if err != nil {
+		t.Fatalf("Compute failed: %s", err)
+	}
+	for idx := range expected {
+		if expected[idx].Cmp(result[idx]) != 0 {
+			t.Errorf("output %d: got %v, expected %v", idx, result[idx],
+				expected[idx])
+		}
+	}
+}
@@ -1,7 +1,7 @@
 //
-// garbler.go
+// player.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,6 +9,8 @@
 package circuit
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -17,423 +19,609 @@ import (
 	"github.com/markkurossi/mpc/p2p"
 )
 
-// Player runs the BMR protocol client on the P2P network.
+// Player runs the BMR protocol client on the P2P network. All
+// players must have added all other players as their peers before
+// calling Player. The function returns the circuit outputs.
 func Player(nw *p2p.Network, circ *Circuit, inputs *big.Int, verbose bool) (
 	[]*big.Int, error) {
 
 	numPlayers := len(nw.Peers) + 1
-	player := nw.ID
-
-	timing := NewTiming()
-	if verbose {
-		fmt.Printf(" - Garbling...\n")
+	if len(circ.Inputs) != numPlayers {
+		return nil, fmt.Errorf("invalid circuit for %d players: %d inputs",
+			numPlayers, len(circ.Inputs))
 	}
-
-	var key [32]byte
-	_, err := rand.Read(key[:])
-	if err != nil {
-		return nil, err
+	if nw.ID < 0 || nw.ID >= numPlayers {
+		return nil, fmt.Errorf("invalid player ID %d", nw.ID)
+	}
+	if !circ.Outputs.Shared() {
+		return nil, fmt.Errorf("BMR does not support per-party outputs")
 	}
 
-	garbled, err := circ.Garble(key[:])
+	// The gates are garbled with fixed-key AES using a public key.
+	alg, err := aes.NewCipher(make([]byte, 16))
 	if err != nil {
 		return nil, err
 	}
+	p := &player{
+		nw:   nw,
+		circ: circ,
+		n:    numPlayers,
+		id:   nw.ID,
+		alg:  alg,
+	}
 
-	timing.Sample("Garble", nil)
+	timing := NewTiming()
 
 	// The protocol for Fgc (Protocol 3.1)
 
-	// Step 1: Compute Lambda{u,v} for each non-XOR gate.
+	// Step 1: generate R, wire lambda shares, and wire keys.
 	if verbose {
-		fmt.Printf(" - Step 1: compute Luv\n")
+		fmt.Printf(" - Step 1: generate lambdas and keys\n")
 	}
+	if err := p.initWires(); err != nil {
+		return nil, err
+	}
+	timing.Sample("Fgc Step 1", nil)
 
-	lu := new(big.Int)
-	lv := new(big.Int)
+	// Step 2: compute XOR shares of Lambda{u,v} for each non-free gate.
+	if verbose {
+		fmt.Printf(" - Step 2: compute Luv\n")
+	}
+	ioStats := nw.Stats().Sum()
+	x, err := p.shareLuvw()
+	if err != nil {
+		return nil, err
+	}
+	xfer := nw.Stats().Sum() - ioStats
+	timing.Sample("Fgc Step 2", []string{FileSize(xfer).String()})
 
-	for g, gate := range circ.Gates {
-		switch gate.Op {
-		case XOR, XNOR:
-		case INV:
+	// Step 3: compute XOR shares of Rj multiplied by the lambdas.
+	if verbose {
+		fmt.Printf(" - Step 3: generate XOR shares of Rj\n")
+	}
+	ioStats = nw.Stats().Sum()
+	rShares, err := p.shareR(x)
+	if err != nil {
+		return nil, err
+	}
+	xfer = nw.Stats().Sum() - ioStats
+	timing.Sample("Fgc Step 3", []string{FileSize(xfer).String()})
 
-		default:
-			lu.SetBit(lu, g, garbled.Lambda(gate.Input0))
-			lv.SetBit(lv, g, garbled.Lambda(gate.Input1))
-		}
+	// Step 4: garble gates and exchange garbled gate shares.
+	if verbose {
+		fmt.Printf(" - Step 4: exchange gates\n")
+	}
+	ioStats = nw.Stats().Sum()
+	if err := p.garble(rShares); err != nil {
+		return nil, err
 	}
+	xfer = nw.Stats().Sum() - ioStats
+	timing.Sample("Fgc Step 4", []string{FileSize(xfer).String()})
 
-	// OTs with peers.
+	// Online phase.
+	if verbose {
+		fmt.Printf(" - Evaluating...\n")
+	}
+	ioStats = nw.Stats().Sum()
+	if err := p.exchangeInputs(inputs); err != nil {
+		return nil, err
+	}
+	xfer = nw.Stats().Sum() - ioStats
+	timing.Sample("Inputs", []string{FileSize(xfer).String()})
 
-	lambdaResults := make(chan OTLambdaResult)
+	result, err := p.eval()
+	if err != nil {
+		return nil, err
+	}
+	timing.Sample("Eval", nil)
 
-	for peerID, peer := range nw.Peers {
-		go func(peerID int, peer *p2p.Peer) {
-			x1, result, err := func(peer *p2p.Peer) (
-				*big.Int, *big.Int, error) {
+	if verbose {
+		timing.Print(nw.Stats())
+	}
+	return circ.Outputs.Split(result), nil
+}
 
-				// Random X1
-				buf := make([]byte, len(circ.Gates)/8+1)
-				_, err := rand.Read(buf[:])
-				if err != nil {
-					return nil, nil, err
-				}
-				x1 := new(big.Int).SetBytes(buf)
-				shift := len(buf)*8 - len(circ.Gates)
-				x1.Rsh(x1, uint(shift))
+// player holds the BMR protocol state of a player.
+type player struct {
+	nw   *p2p.Network
+	circ *Circuit
+	n    int
+	id   int
+	alg  cipher.Block
+
+	// R is our global free-XOR offset.
+	r ot.Label
+	// lambda holds our XOR shares of the wire lambdas.
+	lambda []bool
+	// keys holds our 0-keys of the wires.
+	keys []ot.Label
+	// inputStart holds the index of the first input wire of each
+	// player.
+	inputStart []int
+	// tables holds the garbled tables of the non-free gates. Each
+	// table has 4 rows of n keys.
+	tables [][]ot.Label
+	// outputLambda holds the lambda values of the output wires.
+	outputLambda []bool
+
+	// Online values: the masked wire values and the wire keys of all
+	// players.
+	values    []bool
+	inputKeys []ot.Label
+}
 
-				// X2.
-				x2 := new(big.Int).Xor(lu, x1)
+// nonFree tests if the gate needs a garbled table.
+func nonFree(op Operation) bool {
+	return op == AND || op == OR
+}
 
-				result, err := peer.OTLambda(len(circ.Gates), lv, x1, x2)
-				if err != nil {
-					return nil, nil, err
-				}
-				return x1, result, nil
-			}(peer)
-			lambdaResults <- OTLambdaResult{
-				peerID: peerID,
-				x1:     x1,
-				result: result,
-				err:    err,
+// forPeers runs the function concurrently for all peers.
+func (p *player) forPeers(f func(peer *p2p.Peer) error) error {
+	errs := make(chan error)
+	for _, peer := range p.nw.Peers {
+		go func(peer *p2p.Peer) {
+			err := f(peer)
+			if err != nil {
+				err = fmt.Errorf("peer %d: %s", peer.ID(), err)
 			}
-		}(peerID, peer)
+			errs <- err
+		}(peer)
 	}
-
-	// Compute lu AND lv.
-	luv := new(big.Int)
-	luv.And(lu, lv)
-
-	for i := 0; i < len(nw.Peers); i++ {
-		result := <-lambdaResults
-		if result.err != nil {
-			return nil, fmt.Errorf("OT-Lambda with peer %d failed: %s",
-				result.peerID, result.err)
+	var result error
+	for i := 0; i < len(p.nw.Peers); i++ {
+		err := <-errs
+		if err != nil && result == nil {
+			result = err
 		}
-		luv.Xor(luv, result.x1)
-		luv.Xor(luv, result.result)
 	}
+	return result
+}
 
-	fmt.Printf("Luv: %s\n", luv.Text(2))
-
-	ioStats := nw.Stats().Sum()
-	timing.Sample("Fgc Step 1", []string{FileSize(ioStats).String()})
+func randomBits(count int) ([]bool, error) {
+	buf := make([]byte, count/8+1)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	result := make([]bool, count)
+	for i := 0; i < count; i++ {
+		result[i] = buf[i/8]&(1<<(i%8)) != 0
+	}
+	return result, nil
+}
 
-	// Step 2: generate XOR shares of Luvw
-	if verbose {
-		fmt.Printf(" - Step 2: generate XOR shares of Luvw\n")
+func bitLabel(bit bool) ot.Label {
+	if bit {
+		return ot.Label{D1: 1}
 	}
+	return ot.Label{}
+}
 
-	// Init new gate values.
-	Gs := NewGateValues(circ.NumGates, numPlayers, nw.ID)
+func (p *player) initWires() error {
+	var err error
 
-	Ag := new(big.Int)
-	Bg := new(big.Int)
-	Cg := new(big.Int)
+	p.r, err = ot.NewLabel(rand.Reader)
+	if err != nil {
+		return err
+	}
+	random, err := randomBits(p.circ.NumWires)
+	if err != nil {
+		return err
+	}
+	p.lambda = make([]bool, p.circ.NumWires)
+	p.keys = make([]ot.Label, p.circ.NumWires)
+
+	// Input wires. We know only the lambdas of our own inputs, other
+	// players' input lambda shares are zero.
+	var w int
+	for idx, arg := range p.circ.Inputs {
+		p.inputStart = append(p.inputStart, w)
+		for i := 0; i < int(arg.Type.Bits); i++ {
+			if idx == p.id {
+				p.lambda[w] = random[w]
+			}
+			p.keys[w], err = ot.NewLabel(rand.Reader)
+			if err != nil {
+				return err
+			}
+			w++
+		}
+	}
+	p.inputStart = append(p.inputStart, w)
 
-	for g, gate := range circ.Gates {
+	// Gate output wires. Player 0 handles the negations of XNOR and
+	// INV gates.
+	for _, gate := range p.circ.Gates {
 		switch gate.Op {
 		case XOR, XNOR:
-		case INV:
-
-		default:
-			tmp := luv.Bit(g) ^ garbled.Lambda(gate.Output)
-			Ag.SetBit(Ag, g, tmp)
-			if tmp != 0 {
-				Gs.Ag[player][g].Xor(garbled.R)
-				Gs.Dg[player][g].Xor(garbled.R)
+			p.lambda[gate.Output] = p.lambda[gate.Input0] !=
+				p.lambda[gate.Input1]
+			if gate.Op == XNOR && p.id == 0 {
+				p.lambda[gate.Output] = !p.lambda[gate.Output]
 			}
+			k := p.keys[gate.Input0]
+			k.Xor(p.keys[gate.Input1])
+			p.keys[gate.Output] = k
 
-			Bg.SetBit(Bg, g, tmp^garbled.Lambda(gate.Input0))
-			if tmp^garbled.Lambda(gate.Input0) != 0 {
-				Gs.Bg[player][g].Xor(garbled.R)
-				Gs.Dg[player][g].Xor(garbled.R)
+		case INV:
+			p.lambda[gate.Output] = p.lambda[gate.Input0] != (p.id == 0)
+			p.keys[gate.Output] = p.keys[gate.Input0]
+
+		case AND, OR:
+			p.lambda[gate.Output] = random[gate.Output]
+			p.keys[gate.Output], err = ot.NewLabel(rand.Reader)
+			if err != nil {
+				return err
 			}
 
-			Cg.SetBit(Cg, g, tmp^garbled.Lambda(gate.Input1))
-			if tmp^garbled.Lambda(gate.Input1) != 0 {
-				Gs.Cg[player][g].Xor(garbled.R)
-				Gs.Dg[player][g].Xor(garbled.R)
-			}
+		default:
+			return fmt.Errorf("invalid gate %s", gate.Op)
+		}
+	}
+	return nil
+}
 
-			Gs.Dg[player][g].Xor(garbled.R)
+// shareLuvw computes our XOR shares of Lambda{u,v,w} =
+// Lambda{u}*Lambda{v} ^ Lambda{w} for all non-free gates. The
+// cross-products of the players' lambda shares are computed with
+// bit OTs.
+func (p *player) shareLuvw() ([]bool, error) {
+	var x []bool
+	var lu, lv []bool
+
+	for _, gate := range p.circ.Gates {
+		if !nonFree(gate.Op) {
+			continue
 		}
+		u := p.lambda[gate.Input0]
+		v := p.lambda[gate.Input1]
+		lu = append(lu, u)
+		lv = append(lv, v)
+		x = append(x, (u && v) != p.lambda[gate.Output])
 	}
+	count := len(x)
 
-	X1LongAg := make([][]ot.Label, numPlayers)
-	X1LongBg := make([][]ot.Label, numPlayers)
-	X1LongCg := make([][]ot.Label, numPlayers)
+	pads := make([][]bool, p.n)
+	results := make([][]ot.Label, p.n)
 
-	X2LongAg := make([][]ot.Label, numPlayers)
-	X2LongBg := make([][]ot.Label, numPlayers)
-	X2LongCg := make([][]ot.Label, numPlayers)
+	err := p.forPeers(func(peer *p2p.Peer) error {
+		pad, err := randomBits(count)
+		if err != nil {
+			return err
+		}
+		wires := make([]ot.Wire, count)
+		for g := 0; g < count; g++ {
+			wires[g].L0 = bitLabel(pad[g])
+			wires[g].L1 = bitLabel(pad[g] != lv[g])
+		}
+		result := make([]ot.Label, count)
+		if err := peer.OT(wires, lu, result); err != nil {
+			return err
+		}
+		pads[peer.ID()] = pad
+		results[peer.ID()] = result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for peerID := range p.nw.Peers {
+		for g := 0; g < count; g++ {
+			x[g] = x[g] != pads[peerID][g]
+			x[g] = x[g] != (results[peerID][g].D1&1 != 0)
+		}
+	}
+	return x, nil
+}
 
-	for peerID := range nw.Peers {
-		X1LongAg[peerID] = make([]ot.Label, len(circ.Gates))
-		X1LongBg[peerID] = make([]ot.Label, len(circ.Gates))
-		X1LongCg[peerID] = make([]ot.Label, len(circ.Gates))
+// shareR computes our XOR shares of the players' Rj multiplied by
+// Lambda{u,v,w}, Lambda{u}, and Lambda{v} for all non-free gates. The
+// shares are returned for each player j as 3 consecutive labels per
+// gate.
+func (p *player) shareR(x []bool) ([][]ot.Label, error) {
+	count := len(x) * 3
+
+	flags := make([]bool, 0, count)
+	var g int
+	for _, gate := range p.circ.Gates {
+		if !nonFree(gate.Op) {
+			continue
+		}
+		flags = append(flags, x[g], p.lambda[gate.Input0],
+			p.lambda[gate.Input1])
+		g++
+	}
 
-		X2LongAg[peerID] = make([]ot.Label, len(circ.Gates))
-		X2LongBg[peerID] = make([]ot.Label, len(circ.Gates))
-		X2LongCg[peerID] = make([]ot.Label, len(circ.Gates))
+	shares := make([][]ot.Label, p.n)
+	pads := make([][]ot.Wire, p.n)
 
-		for g, gate := range circ.Gates {
-			switch gate.Op {
-			case XOR, XNOR:
-			case INV:
+	err := p.forPeers(func(peer *p2p.Peer) error {
+		wires := make([]ot.Wire, count)
+		for i := 0; i < count; i++ {
+			pad, err := ot.NewLabel(rand.Reader)
+			if err != nil {
+				return err
+			}
+			wires[i].L0 = pad
+			wires[i].L1 = pad
+			wires[i].L1.Xor(p.r)
+		}
+		result := make([]ot.Label, count)
+		if err := peer.OT(wires, flags, result); err != nil {
+			return err
+		}
+		pads[peer.ID()] = wires
+		shares[peer.ID()] = result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			default:
-				rand1, err := ot.NewLabel(rand.Reader)
-				if err != nil {
-					return nil, err
-				}
-				X1LongAg[peerID][g] = rand1
-				Gs.Ag[player][g].Xor(rand1)
+	our := make([]ot.Label, count)
+	for i := 0; i < count; i++ {
+		if flags[i] {
+			our[i] = p.r
+		}
+		for peerID := range p.nw.Peers {
+			our[i].Xor(pads[peerID][i].L0)
+		}
+	}
+	shares[p.id] = our
 
-				rand2, err := ot.NewLabel(rand.Reader)
-				if err != nil {
-					return nil, err
-				}
-				X1LongBg[peerID][g] = rand2
-				Gs.Bg[player][g].Xor(rand2)
+	return shares, nil
+}
 
-				rand3, err := ot.NewLabel(rand.Reader)
-				if err != nil {
-					return nil, err
-				}
-				X1LongCg[peerID][g] = rand3
-				Gs.Cg[player][g].Xor(rand3)
+// tweak returns the encryption tweak for the player j's key of the
+// non-free gate g.
+func (p *player) tweak(g, j int) uint32 {
+	return uint32(g*p.n + j)
+}
 
-				Gs.Dg[player][g].Xor(rand1)
-				Gs.Dg[player][g].Xor(rand2)
-				Gs.Dg[player][g].Xor(rand3)
+// garble computes our shares of the garbled tables and exchanges them
+// with peers.
+func (p *player) garble(rShares [][]ot.Label) error {
+	var data ot.LabelData
+	var zero ot.Label
 
-				X2LongAg[peerID][g] = garbled.R
-				X2LongAg[peerID][g].Xor(rand1)
+	var shares []ot.Label
+	var g int
 
-				X2LongBg[peerID][g] = garbled.R
-				X2LongBg[peerID][g].Xor(rand2)
+	for _, gate := range p.circ.Gates {
+		if !nonFree(gate.Op) {
+			continue
+		}
+		// The gate function as f(a,b) = ca*a ^ cb*b ^ a*b.
+		var ca, cb bool
+		if gate.Op == OR {
+			ca = true
+			cb = true
+		}
+
+		for row := 0; row < 4; row++ {
+			alpha := row&0x2 != 0
+			beta := row&0x1 != 0
 
-				X2LongCg[peerID][g] = garbled.R
-				X2LongCg[peerID][g].Xor(rand3)
+			ka := p.keys[gate.Input0]
+			if alpha {
+				ka.Xor(p.r)
+			}
+			kb := p.keys[gate.Input1]
+			if beta {
+				kb.Xor(p.r)
+			}
+			// The public part of the row's output mask.
+			constant := (ca && alpha) != (cb && beta) != (alpha && beta)
+
+			for j := 0; j < p.n; j++ {
+				l := encrypt(p.alg, ka, kb, zero, p.tweak(g, j), &data)
+				if j == p.id {
+					l.Xor(p.keys[gate.Output])
+					if constant {
+						l.Xor(p.r)
+					}
+				}
+				rs := rShares[j][g*3:]
+				l.Xor(rs[0])
+				if ca != beta {
+					l.Xor(rs[1])
+				}
+				if cb != alpha {
+					l.Xor(rs[2])
+				}
+				shares = append(shares, l)
 			}
 		}
+		g++
 	}
 
-	timing.Sample("Fgc Step 2", nil)
-
-	// Step 3: generate XOR shares of Rj
-	if verbose {
-		fmt.Printf(" - Step 3: generate XOR shares or Rj\n")
+	// Output wire lambdas.
+	numOutputs := p.circ.Outputs.Size()
+	p.outputLambda = make([]bool, numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		p.outputLambda[i] = p.lambda[p.circ.NumWires-numOutputs+i]
 	}
 
-	// OTs with peers.
+	// Exchange shares with peers.
+	peerShares := make([][]ot.Label, p.n)
+	peerLambdas := make([][]bool, p.n)
 
-	rResults := make(chan OTRResult)
-
-	for peerID, peer := range nw.Peers {
-		go func(peerID int, peer *p2p.Peer) {
-			ra, rb, rc, err := peer.OTR(Ag, Bg, Cg,
-				X1LongAg[peerID], X2LongAg[peerID],
-				X1LongBg[peerID], X2LongBg[peerID],
-				X1LongCg[peerID], X2LongCg[peerID])
-
-			rResults <- OTRResult{
-				peerID: peerID,
-				Ra:     ra,
-				Rb:     rb,
-				Rc:     rc,
-				err:    err,
-			}
-		}(peerID, peer)
+	err := p.forPeers(func(peer *p2p.Peer) error {
+		result, err := peer.ExchangeLabels(shares)
+		if err != nil {
+			return err
+		}
+		if len(result) != len(shares) {
+			return fmt.Errorf("invalid number of gate shares: %d, expected %d",
+				len(result), len(shares))
+		}
+		lambdas, err := peer.ExchangeBits(p.outputLambda)
+		if err != nil {
+			return err
+		}
+		if len(lambdas) != numOutputs {
+			return fmt.Errorf("invalid number of output lambdas: %d",
+				len(lambdas))
+		}
+		peerShares[peer.ID()] = result
+		peerLambdas[peer.ID()] = lambdas
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	for i := 0; i < len(nw.Peers); i++ {
-		result := <-rResults
-		if result.err != nil {
-			return nil, fmt.Errorf("OT-R with peer %d failed: %s",
-				result.peerID, result.err)
+	for peerID := range p.nw.Peers {
+		for i := range shares {
+			shares[i].Xor(peerShares[peerID][i])
 		}
-		for g, gate := range circ.Gates {
-			switch gate.Op {
-			case XOR, XNOR:
-			case INV:
-
-			default:
-				Gs.Ag[result.peerID][g].Xor(result.Ra[g])
-				Gs.Bg[result.peerID][g].Xor(result.Rb[g])
-				Gs.Cg[result.peerID][g].Xor(result.Rc[g])
-
-				Gs.Dg[result.peerID][g].Xor(result.Ra[g])
-				Gs.Dg[result.peerID][g].Xor(result.Rb[g])
-				Gs.Dg[result.peerID][g].Xor(result.Rc[g])
-			}
+		for i := range p.outputLambda {
+			p.outputLambda[i] = p.outputLambda[i] != peerLambdas[peerID][i]
 		}
 	}
 
-	xfer := nw.Stats().Sum() - ioStats
-	ioStats = nw.Stats().Sum()
-	timing.Sample("Fgc Step 3", []string{FileSize(xfer).String()})
-
-	// Step 4: generate final secrets
-	if verbose {
-		fmt.Printf(" - Step 4: exchange gates\n")
+	size := 4 * p.n
+	p.tables = make([][]ot.Label, g)
+	for i := 0; i < g; i++ {
+		p.tables[i] = shares[i*size : (i+1)*size]
 	}
 
-	// Output wire lambdas.
-	Lo := new(big.Int)
-	for w := 0; w < circ.Outputs.Size(); w++ {
-		Lo.SetBit(Lo, w,
-			garbled.Lambda(Wire(circ.NumWires-circ.Outputs.Size()+w)))
-	}
-
-	// Exchange gates with peers.
-
-	gResultsC := make(chan GateResults)
-
-	for peerID, peer := range nw.Peers {
-		go func(peerID int, peer *p2p.Peer) {
-			ra, rb, rc, rd, ro, err := peer.ExchangeGates(
-				Gs.Ag, Gs.Bg, Gs.Cg, Gs.Dg, Lo)
-			gResultsC <- GateResults{
-				peerID: peerID,
-				Ra:     ra,
-				Rb:     rb,
-				Rc:     rc,
-				Rd:     rd,
-				Ro:     ro,
-				err:    err,
-			}
-		}(peerID, peer)
-	}
+	return nil
+}
 
-	var gResults []GateResults
-	for i := 0; i < len(nw.Peers); i++ {
-		gResults = append(gResults, <-gResultsC)
+// exchangeInputs exchanges the masked input values and the
+// corresponding input wire keys with peers.
+func (p *player) exchangeInputs(inputs *big.Int) error {
+	numInputs := p.inputStart[len(p.inputStart)-1]
+	p.values = make([]bool, p.circ.NumWires)
+
+	start := p.inputStart[p.id]
+	end := p.inputStart[p.id+1]
+	masked := make([]bool, end-start)
+	for i := range masked {
+		masked[i] = (inputs.Bit(i) == 1) != p.lambda[start+i]
+		p.values[start+i] = masked[i]
 	}
-	for _, result := range gResults {
-		if result.err != nil {
-			return nil, fmt.Errorf("gate exchange with peer %d failed: %s",
-				result.peerID, result.err)
+
+	err := p.forPeers(func(peer *p2p.Peer) error {
+		start := p.inputStart[peer.ID()]
+		end := p.inputStart[peer.ID()+1]
+
+		values, err := peer.ExchangeBits(masked)
+		if err != nil {
+			return err
 		}
-		for p := 0; p < numPlayers; p++ {
-			for g, gate := range circ.Gates {
-				switch gate.Op {
-				case XOR, XNOR:
-				case INV:
-
-				default:
-					Gs.Ag[p][g].Xor(result.Ra[p][g])
-					Gs.Bg[p][g].Xor(result.Rb[p][g])
-					Gs.Cg[p][g].Xor(result.Rc[p][g])
-					Gs.Dg[p][g].Xor(result.Rd[p][g])
-				}
-			}
-		}
-		for w := 0; w < circ.Outputs.Size(); w++ {
-			index := circ.NumWires - circ.Outputs.Size() + w
-			// XOR peer lambda bit with our lambda bit i.e. only
-			// result 1 changes our value.
-			if result.Ro.Bit(index) == 1 {
-				if garbled.Lambda(Wire(index)) == 0 {
-					garbled.SetLambda(Wire(index), 1)
-				} else {
-					garbled.SetLambda(Wire(index), 0)
-				}
-			}
+		if len(values) != end-start {
+			return fmt.Errorf("invalid number of inputs: %d, expected %d",
+				len(values), end-start)
 		}
+		copy(p.values[start:end], values)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	for i := 0; i < numPlayers; i++ {
-	gates:
-		for g, gate := range circ.Gates {
-			switch gate.Op {
-			case XOR, XNOR:
-			case INV:
-
-			default:
-				fmt.Printf("%d:%d: Ag: %s\n", i, g, Gs.Ag[i][g])
-				fmt.Printf("%d:%d: Bg: %s\n", i, g, Gs.Bg[i][g])
-				fmt.Printf("%d:%d: Cg: %s\n", i, g, Gs.Cg[i][g])
-				fmt.Printf("%d:%d: Dg: %s\n", i, g, Gs.Dg[i][g])
-				break gates
-			}
+	// Our keys for the masked input values.
+	keys := make([]ot.Label, numInputs)
+	for w := 0; w < numInputs; w++ {
+		keys[w] = p.keys[w]
+		if p.values[w] {
+			keys[w].Xor(p.r)
 		}
 	}
 
-	xfer = nw.Stats().Sum() - ioStats
-	timing.Sample("Result", []string{FileSize(xfer).String()})
-	if verbose {
-		timing.Print(nw.Stats())
+	p.inputKeys = make([]ot.Label, numInputs*p.n)
+	for w := 0; w < numInputs; w++ {
+		p.inputKeys[w*p.n+p.id] = keys[w]
 	}
 
-	fmt.Printf("player not implemented yet\n")
-
-	return []*big.Int{new(big.Int)}, nil
+	return p.forPeers(func(peer *p2p.Peer) error {
+		result, err := peer.ExchangeLabels(keys)
+		if err != nil {
+			return err
+		}
+		if len(result) != numInputs {
+			return fmt.Errorf("invalid number of input keys: %d, expected %d",
+				len(result), numInputs)
+		}
+		for w := 0; w < numInputs; w++ {
+			p.inputKeys[w*p.n+peer.ID()] = result[w]
+		}
+		return nil
+	})
 }
 
-// OTLambdaResult contain oblivious transfer lambda results.
-type OTLambdaResult struct {
-	peerID int
-	x1     *big.Int
-	result *big.Int
-	err    error
-}
+// eval evaluates the garbled circuit and returns the output value.
+func (p *player) eval() (*big.Int, error) {
+	var data ot.LabelData
+	var zero ot.Label
 
-// OTRResult contain oblivious transfer results.
-type OTRResult struct {
-	peerID int
-	Ra     []ot.Label
-	Rb     []ot.Label
-	Rc     []ot.Label
-	err    error
-}
+	n := p.n
+	keys := make([]ot.Label, p.circ.NumWires*n)
+	copy(keys, p.inputKeys)
 
-// GateResults contain gate exchange results.
-type GateResults struct {
-	peerID int
-	Ra     [][]ot.Label
-	Rb     [][]ot.Label
-	Rc     [][]ot.Label
-	Rd     [][]ot.Label
-	Ro     *big.Int
-	err    error
-}
+	var g int
+	for _, gate := range p.circ.Gates {
+		i0 := int(gate.Input0) * n
+		i1 := int(gate.Input1) * n
+		o := int(gate.Output) * n
 
-// GateValues specify player's gate values.
-type GateValues struct {
-	Ag [][]ot.Label
-	Bg [][]ot.Label
-	Cg [][]ot.Label
-	Dg [][]ot.Label
-}
+		switch gate.Op {
+		case XOR, XNOR:
+			p.values[gate.Output] = p.values[gate.Input0] !=
+				p.values[gate.Input1]
+			for i := 0; i < n; i++ {
+				keys[o+i] = keys[i0+i]
+				keys[o+i].Xor(keys[i1+i])
+			}
 
-// NewGateValues creates GateValues for a player.
-func NewGateValues(numGates, numPlayers, we int) *GateValues {
-	v := &GateValues{
-		Ag: make([][]ot.Label, numPlayers),
-		Bg: make([][]ot.Label, numPlayers),
-		Cg: make([][]ot.Label, numPlayers),
-		Dg: make([][]ot.Label, numPlayers),
-	}
+		case INV:
+			p.values[gate.Output] = p.values[gate.Input0]
+			copy(keys[o:o+n], keys[i0:i0+n])
 
-	for p := 0; p < numPlayers; p++ {
-		v.Ag[p] = arrayOfLabels(numGates)
-		v.Bg[p] = arrayOfLabels(numGates)
-		v.Cg[p] = arrayOfLabels(numGates)
-		v.Dg[p] = arrayOfLabels(numGates)
+		case AND, OR:
+			var row int
+			if p.values[gate.Input0] {
+				row |= 0x2
+			}
+			if p.values[gate.Input1] {
+				row |= 0x1
+			}
+			table := p.tables[g][row*n:]
+			for j := 0; j < n; j++ {
+				l := table[j]
+				for i := 0; i < n; i++ {
+					l.Xor(encrypt(p.alg, keys[i0+i], keys[i1+i], zero,
+						p.tweak(g, j), &data))
+				}
+				keys[o+j] = l
+			}
+			g++
+
+			// Resolve the masked value from our own key.
+			our := keys[o+p.id]
+			if our.Equal(p.keys[gate.Output]) {
+				p.values[gate.Output] = false
+			} else {
+				our.Xor(p.r)
+				if !our.Equal(p.keys[gate.Output]) {
+					return nil, fmt.Errorf("gate %d: invalid output key",
+						gate.Output)
+				}
+				p.values[gate.Output] = true
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid gate %s", gate.Op)
+		}
 	}
-	return v
-}
 
-func arrayOfLabels(count int) []ot.Label {
-	result := make([]ot.Label, count)
-	for i := 0; i < count; i++ {
-		l, err := ot.NewLabel(rand.Reader)
-		if err != nil {
-			panic(err)
+	result := new(big.Int)
+	numOutputs := p.circ.Outputs.Size()
+	for i := 0; i < numOutputs; i++ {
+		w := p.circ.NumWires - numOutputs + i
+		if p.values[w] != p.outputLambda[i] {
+			result.SetBit(result, i, 1)
 		}
-		result[i] = l
 	}
-	return result
+	return result, nil
 }
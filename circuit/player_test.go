@@ -0,0 +1,108 @@
+//
+// player_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+var playerTests = [][]int64{
+	{0, 0, 0},
+	{1, 2, 3},
+	{200, 100, 7},
+	{255, 255, 255},
+	{17, 42, 3},
+}
+
+func TestPlayer(t *testing.T) {
+	circ, err := Parse("testdata/3party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	numPlayers := len(circ.Inputs)
+
+	var networks []*p2p.Network
+	for i := 0; i < numPlayers; i++ {
+		nw, err := p2p.NewNetwork("127.0.0.1:0", i)
+		if err != nil {
+			t.Fatalf("NewNetwork: %s", err)
+		}
+		defer nw.Close()
+		networks = append(networks, nw)
+	}
+
+	errs := make(chan error)
+	for i := 0; i < numPlayers; i++ {
+		go func(nw *p2p.Network) {
+			for j, peer := range networks {
+				if j == nw.ID {
+					continue
+				}
+				if err := nw.AddPeer(peer.Addr().String(), j); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(networks[i])
+	}
+	for i := 0; i < numPlayers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("AddPeer: %s", err)
+		}
+	}
+
+	type playerResult struct {
+		id     int
+		result []*big.Int
+		err    error
+	}
+
+	for _, test := range playerTests {
+		var inputs []*big.Int
+		for _, v := range test {
+			inputs = append(inputs, big.NewInt(v))
+		}
+		expected, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+
+		results := make(chan playerResult)
+		for i := 0; i < numPlayers; i++ {
+			go func(i int) {
+				result, err := Player(networks[i], circ, inputs[i], false)
+				results <- playerResult{
+					id:     i,
+					result: result,
+					err:    err,
+				}
+			}(i)
+		}
+		for i := 0; i < numPlayers; i++ {
+			r := <-results
+			if r.err != nil {
+				t.Fatalf("player %d failed: %s", r.id, r.err)
+			}
+			if len(r.result) != len(expected) {
+				t.Fatalf("player %d: got %d results, expected %d",
+					r.id, len(r.result), len(expected))
+			}
+			for idx := range expected {
+				if r.result[idx].Cmp(expected[idx]) != 0 {
+					t.Errorf("player %d: %v: result %d: got %v, expected %v",
+						r.id, test, idx, r.result[idx], expected[idx])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,403 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+const (
+	// PreGarbledMagic is the magic number of the pre-garbled circuit
+	// file format.
+	PreGarbledMagic = 0x70676300 // pgc0
+
+	// PreGarbledVersion is the version of the pre-garbled circuit
+	// file format.
+	PreGarbledVersion = 1
+)
+
+// Pre-garbled file content types.
+const (
+	preGarbledGarbler   uint32 = 0
+	preGarbledEvaluator uint32 = 1
+)
+
+// Evaluator's pre-garbled circuit status in the online phase.
+const (
+	preGarbledNeedTables = 0
+	preGarbledHaveTables = 1
+	preGarbledMismatch   = 2
+)
+
+// ErrPreGarbledMismatch is returned when the garbler and the
+// evaluator have different pre-garbled circuits.
+var ErrPreGarbledMismatch = errors.New("pre-garbled circuit mismatch")
+
+// PreGarbled holds a circuit that is garbled ahead of the online
+// phase. The garbler's pre-garbled circuit holds the garbling key,
+// the R offset, the wire labels, and the garbled tables. The
+// evaluator's pre-garbled circuit holds the garbling key and the
+// garbled tables. Each pre-garbled circuit must be evaluated only
+// once.
+type PreGarbled struct {
+	ID      [16]byte
+	Digest  [32]byte
+	Key     []byte
+	Garbled *Garbled
+}
+
+// Evaluator tests if the pre-garbled circuit holds only the
+// evaluator's garbled tables.
+func (p *PreGarbled) Evaluator() bool {
+	return p.Garbled.Wires == nil
+}
+
+// PreGarble garbles the circuit for a later online phase.
+func (c *Circuit) PreGarble() (*PreGarbled, error) {
+	digest, err := c.digest()
+	if err != nil {
+		return nil, err
+	}
+	pre := &PreGarbled{
+		Digest: digest,
+		Key:    make([]byte, 32),
+	}
+	if _, err := rand.Read(pre.ID[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(pre.Key); err != nil {
+		return nil, err
+	}
+	pre.Garbled, err = c.Garble(HalfGates, pre.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pre, nil
+}
+
+// digest computes the SHA-256 digest of the circuit.
+func (c *Circuit) digest() ([32]byte, error) {
+	h := sha256.New()
+	if err := c.Marshal(h); err != nil {
+		return [32]byte{}, err
+	}
+	var result [32]byte
+	copy(result[:], h.Sum(nil))
+	return result, nil
+}
+
+// Marshal writes the pre-garbled circuit in the versioned
+// pre-garbled circuit file format.
+func (p *PreGarbled) Marshal(out io.Writer) error {
+	w := bufio.NewWriter(out)
+
+	kind := preGarbledGarbler
+	if p.Evaluator() {
+		kind = preGarbledEvaluator
+	}
+	var data = []interface{}{
+		uint32(PreGarbledMagic),
+		uint32(PreGarbledVersion),
+		kind,
+		p.ID,
+		p.Digest,
+		uint32(len(p.Key)),
+	}
+	for _, v := range data {
+		if err := binary.Write(w, bo, v); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(p.Key); err != nil {
+		return err
+	}
+
+	var labelData ot.LabelData
+	if !p.Evaluator() {
+		if err := writeLabel(w, p.Garbled.R, &labelData); err != nil {
+			return err
+		}
+		err := binary.Write(w, bo, uint32(len(p.Garbled.Wires)))
+		if err != nil {
+			return err
+		}
+		for _, wire := range p.Garbled.Wires {
+			if err := writeLabel(w, wire.L0, &labelData); err != nil {
+				return err
+			}
+		}
+	}
+	err := binary.Write(w, bo, uint32(len(p.Garbled.Gates)))
+	if err != nil {
+		return err
+	}
+	for _, gate := range p.Garbled.Gates {
+		if err := w.WriteByte(byte(len(gate))); err != nil {
+			return err
+		}
+		for _, label := range gate {
+			if err := writeLabel(w, label, &labelData); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func writeLabel(w io.Writer, label ot.Label, data *ot.LabelData) error {
+	label.GetData(data)
+	_, err := w.Write(data[:])
+	return err
+}
+
+func readLabel(r io.Reader, label *ot.Label, data *ot.LabelData) error {
+	if _, err := io.ReadFull(r, data[:]); err != nil {
+		return err
+	}
+	label.SetData(data)
+	return nil
+}
+
+// ParsePreGarbled parses the pre-garbled circuit of the circuit
+// from the reader.
+func ParsePreGarbled(in io.Reader, c *Circuit) (*PreGarbled, error) {
+	r := bufio.NewReader(in)
+
+	var header struct {
+		Magic   uint32
+		Version uint32
+		Kind    uint32
+		ID      [16]byte
+		Digest  [32]byte
+		KeyLen  uint32
+	}
+	if err := binary.Read(r, bo, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != PreGarbledMagic {
+		return nil, fmt.Errorf("invalid pre-garbled circuit magic: %x",
+			header.Magic)
+	}
+	if header.Version != PreGarbledVersion {
+		return nil, fmt.Errorf("unsupported pre-garbled circuit version %d",
+			header.Version)
+	}
+	if header.Kind != preGarbledGarbler && header.Kind != preGarbledEvaluator {
+		return nil, fmt.Errorf("invalid pre-garbled circuit type %d",
+			header.Kind)
+	}
+	digest, err := c.digest()
+	if err != nil {
+		return nil, err
+	}
+	if header.Digest != digest {
+		return nil, fmt.Errorf("pre-garbled circuit is for another circuit")
+	}
+	if header.KeyLen != 16 && header.KeyLen != 24 && header.KeyLen != 32 {
+		return nil, fmt.Errorf("invalid key length %d", header.KeyLen)
+	}
+	pre := &PreGarbled{
+		ID:      header.ID,
+		Digest:  header.Digest,
+		Key:     make([]byte, header.KeyLen),
+		Garbled: new(Garbled),
+	}
+	if _, err := io.ReadFull(r, pre.Key); err != nil {
+		return nil, err
+	}
+
+	var labelData ot.LabelData
+	var count uint32
+	if header.Kind == preGarbledGarbler {
+		if err := readLabel(r, &pre.Garbled.R, &labelData); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, bo, &count); err != nil {
+			return nil, err
+		}
+		if int(count) != c.NumWires {
+			return nil, fmt.Errorf("wrong number of wires: got %d, "+
+				"expected %d", count, c.NumWires)
+		}
+		pre.Garbled.Wires = make([]ot.Wire, count)
+		for i := range pre.Garbled.Wires {
+			var wire ot.Wire
+			if err := readLabel(r, &wire.L0, &labelData); err != nil {
+				return nil, err
+			}
+			wire.L1 = wire.L0
+			wire.L1.Xor(pre.Garbled.R)
+			pre.Garbled.Wires[i] = wire
+		}
+	}
+	if err := binary.Read(r, bo, &count); err != nil {
+		return nil, err
+	}
+	if int(count) != c.NumGates {
+		return nil, fmt.Errorf("wrong number of gates: got %d, expected %d",
+			count, c.NumGates)
+	}
+	pre.Garbled.Gates = make([][]ot.Label, count)
+	for i := range pre.Garbled.Gates {
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if n > 4 {
+			return nil, fmt.Errorf("invalid garbled table size %d", n)
+		}
+		gate := make([]ot.Label, n)
+		for j := range gate {
+			if err := readLabel(r, &gate[j], &labelData); err != nil {
+				return nil, err
+			}
+		}
+		pre.Garbled.Gates[i] = gate
+	}
+	return pre, nil
+}
+
+// OfflineGarbler ships the garbled tables of the pre-garbled circuit
+// to the evaluator.
+func OfflineGarbler(conn *p2p.Conn, pre *PreGarbled) error {
+	if pre.Evaluator() {
+		return fmt.Errorf("pre-garbled circuit has no garbler state")
+	}
+	if err := conn.SendData(pre.ID[:]); err != nil {
+		return err
+	}
+	err := sendGarbled(conn, HalfGates, pre.Key, pre.Garbled.Gates)
+	if err != nil {
+		return err
+	}
+	return conn.Flush()
+}
+
+// OfflineEvaluator receives the garbled tables of the circuit from
+// the garbler.
+func OfflineEvaluator(conn *p2p.Conn, circ *Circuit) (*PreGarbled, error) {
+	digest, err := circ.digest()
+	if err != nil {
+		return nil, err
+	}
+	id, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	pre := &PreGarbled{
+		Digest:  digest,
+		Garbled: new(Garbled),
+	}
+	if len(id) != len(pre.ID) {
+		return nil, fmt.Errorf("invalid pre-garbled circuit ID")
+	}
+	copy(pre.ID[:], id)
+
+	pre.Key, pre.Garbled.Gates, err = receiveGarbled(conn, HalfGates,
+		circ, NewTiming(), false)
+	if err != nil {
+		return nil, err
+	}
+	return pre, nil
+}
+
+// OnlineGarbler runs the online phase of the garbler protocol with
+// the pre-garbled circuit. If the evaluator does not have the
+// circuit's garbled tables, they are sent before the inputs.
+func OnlineGarbler(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	pre *PreGarbled, inputs *big.Int, verbose bool) ([]*big.Int, error) {
+
+	timing := NewTiming()
+
+	if pre.Evaluator() {
+		return nil, fmt.Errorf("pre-garbled circuit has no garbler state")
+	}
+	if err := conn.SendData(pre.ID[:]); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	status, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case preGarbledNeedTables:
+		if verbose {
+			fmt.Printf(" - Sending garbled circuit...\n")
+		}
+		err = sendGarbled(conn, HalfGates, pre.Key, pre.Garbled.Gates)
+		if err != nil {
+			return nil, err
+		}
+	case preGarbledHaveTables:
+	case preGarbledMismatch:
+		return nil, ErrPreGarbledMismatch
+	default:
+		return nil, fmt.Errorf("invalid pre-garbled circuit status %d",
+			status)
+	}
+	return garblerOnline(conn, oti, circ, pre.Garbled, inputs, timing,
+		verbose)
+}
+
+// OnlineEvaluator runs the online phase of the evaluator protocol
+// with the pre-garbled circuit's garbled tables. If pre is nil, the
+// evaluator receives the garbled tables from the garbler.
+func OnlineEvaluator(conn *p2p.Conn, oti ot.OT, circ *Circuit,
+	pre *PreGarbled, inputs *big.Int, verbose bool) ([]*big.Int, error) {
+
+	timing := NewTiming()
+
+	id, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	status := preGarbledNeedTables
+	if pre != nil {
+		status = preGarbledHaveTables
+		if !bytes.Equal(id, pre.ID[:]) {
+			status = preGarbledMismatch
+		}
+	}
+	if err := conn.SendUint32(status); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	if status == preGarbledMismatch {
+		return nil, ErrPreGarbledMismatch
+	}
+
+	var key []byte
+	var gates [][]ot.Label
+	if pre != nil {
+		key = pre.Key
+		gates = pre.Garbled.Gates
+	} else {
+		key, gates, err = receiveGarbled(conn, HalfGates, circ, timing,
+			verbose)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return evaluatorOnline(conn, oti, circ, HalfGates, key, gates, inputs,
+		timing, verbose)
+}
@@ -0,0 +1,166 @@
+//
+// pregarbled_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func reparse(t *testing.T, circ *Circuit, pre *PreGarbled) *PreGarbled {
+	var buf bytes.Buffer
+	if err := pre.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	result, err := ParsePreGarbled(&buf, circ)
+	if err != nil {
+		t.Fatalf("ParsePreGarbled: %s", err)
+	}
+	return result
+}
+
+func online(circ *Circuit, gPre, ePre *PreGarbled, inputs []*big.Int) (
+	g, e dualResult) {
+
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	done := make(chan dualResult)
+	go func() {
+		result, err := OnlineGarbler(gConn, ot.NewCO(), circ, gPre,
+			inputs[0], false)
+		gConn.Close()
+		done <- dualResult{
+			result: result,
+			err:    err,
+		}
+	}()
+
+	result, err := OnlineEvaluator(eConn, ot.NewCO(), circ, ePre,
+		inputs[1], false)
+	eConn.Close()
+	e = dualResult{
+		result: result,
+		err:    err,
+	}
+	g = <-done
+	return
+}
+
+func offline(t *testing.T, circ *Circuit, pre *PreGarbled) *PreGarbled {
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	done := make(chan error)
+	go func() {
+		err := OfflineGarbler(gConn, pre)
+		gConn.Close()
+		done <- err
+	}()
+	result, err := OfflineEvaluator(eConn, circ)
+	eConn.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("OfflineGarbler: %s", err)
+	}
+	if err != nil {
+		t.Fatalf("OfflineEvaluator: %s", err)
+	}
+	return result
+}
+
+func TestPreGarbled(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+
+	for _, test := range dualTests {
+		inputs := []*big.Int{big.NewInt(test[0]), big.NewInt(test[1])}
+		expected, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+
+		pre, err := circ.PreGarble()
+		if err != nil {
+			t.Fatalf("PreGarble: %s", err)
+		}
+		gPre := reparse(t, circ, pre)
+		if !reflect.DeepEqual(gPre, pre) {
+			t.Fatalf("garbler state changed in marshal")
+		}
+
+		// Tables shipped in the offline phase.
+		ePre := reparse(t, circ, offline(t, circ, pre))
+		if !ePre.Evaluator() || ePre.ID != pre.ID ||
+			!reflect.DeepEqual(ePre.Garbled.Gates, pre.Garbled.Gates) {
+			t.Fatalf("evaluator tables changed in transfer")
+		}
+
+		for _, eTables := range []*PreGarbled{ePre, nil} {
+			g, e := online(circ, gPre, eTables, inputs)
+			for id, r := range []dualResult{g, e} {
+				if r.err != nil {
+					t.Fatalf("party %d failed: %s", id, r.err)
+				}
+				for idx := range expected {
+					if r.result[idx].Cmp(expected[idx]) != 0 {
+						t.Errorf("party %d: %v: result %d: got %v, "+
+							"expected %v", id, test, idx, r.result[idx],
+							expected[idx])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPreGarbledMismatch(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	pre1, err := circ.PreGarble()
+	if err != nil {
+		t.Fatalf("PreGarble: %s", err)
+	}
+	pre2, err := circ.PreGarble()
+	if err != nil {
+		t.Fatalf("PreGarble: %s", err)
+	}
+	inputs := []*big.Int{big.NewInt(1), big.NewInt(2)}
+	g, e := online(circ, pre1, offline(t, circ, pre2), inputs)
+	if g.err != ErrPreGarbledMismatch || e.err != ErrPreGarbledMismatch {
+		t.Errorf("got %v and %v, expected %v", g.err, e.err,
+			ErrPreGarbledMismatch)
+	}
+
+	// Pre-garbled circuit for another circuit.
+	other, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	other.Gates[0].Op = XNOR
+	var buf bytes.Buffer
+	if err := pre1.Marshal(&buf); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	_, err = ParsePreGarbled(&buf, other)
+	if err == nil {
+		t.Errorf("ParsePreGarbled accepted another circuit")
+	}
+}
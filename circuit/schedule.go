@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"sync"
+)
+
+// parallelMinGates specifies the minimum number of non-free gates in
+// a level for processing the level in parallel.
+var parallelMinGates = 128
+
+// schedule defines a level-ordered processing schedule for the
+// circuit gates. All gates of a level depend only on the wires of the
+// lower levels so they can be processed in parallel.
+type schedule struct {
+	tweaks []uint32
+	levels []scheduleLevel
+}
+
+// scheduleLevel holds the indices of the free gates, and the indices
+// of the gates with garbled tables of a level.
+type scheduleLevel struct {
+	free    []uint32
+	nonFree []uint32
+}
+
+// gateFunc processes the gate at index idx with the tweak ID id.
+type gateFunc func(idx int, id uint32) error
+
+// tweaks returns the number of tweak IDs the gate consumes with the
+// garbling scheme.
+func (g *Gate) tweaks(scheme Scheme) uint32 {
+	if scheme == ThreeHalves {
+		switch g.Op {
+		case AND, OR:
+			return 3
+		default:
+			return 0
+		}
+	}
+	switch g.Op {
+	case AND:
+		return 2
+	case OR, INV:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// free tests if the gate is garbled without a garbled table with the
+// garbling scheme.
+func (g *Gate) free(scheme Scheme) bool {
+	if scheme == ThreeHalves && g.Op == INV {
+		return true
+	}
+	return g.Op == XOR || g.Op == XNOR
+}
+
+// getSchedule returns the processing schedule of the circuit for the
+// garbling scheme. The schedule is created on the first call and
+// cached in the circuit.
+func (c *Circuit) getSchedule(scheme Scheme) *schedule {
+	s := c.schedules[scheme].Load()
+	if s == nil {
+		s = newSchedule(c, scheme)
+		c.schedules[scheme].Store(s)
+	}
+	return s
+}
+
+// newSchedule creates the processing schedule for the circuit. The
+// gates' tweak IDs are assigned in the gate order so that the
+// garbled circuit does not depend on the processing order.
+func newSchedule(c *Circuit, scheme Scheme) *schedule {
+	s := &schedule{
+		tweaks: make([]uint32, len(c.Gates)),
+	}
+
+	wireLevels := make([]Level, c.NumWires)
+	gateLevels := make([]Level, len(c.Gates))
+	var numFree, numNonFree []int
+
+	var id uint32
+	for idx := range c.Gates {
+		gate := &c.Gates[idx]
+
+		s.tweaks[idx] = id
+		id += gate.tweaks(scheme)
+
+		level := wireLevels[gate.Input0]
+		if gate.Op != INV && wireLevels[gate.Input1] > level {
+			level = wireLevels[gate.Input1]
+		}
+		gateLevels[idx] = level
+		wireLevels[gate.Output] = level + 1
+
+		for int(level) >= len(numFree) {
+			numFree = append(numFree, 0)
+			numNonFree = append(numNonFree, 0)
+		}
+		if gate.free(scheme) {
+			numFree[level]++
+		} else {
+			numNonFree[level]++
+		}
+	}
+
+	gates := make([]uint32, len(c.Gates))
+	s.levels = make([]scheduleLevel, len(numFree))
+	var ofs int
+	for level := range s.levels {
+		s.levels[level].free = gates[ofs : ofs : ofs+numFree[level]]
+		ofs += numFree[level]
+		s.levels[level].nonFree = gates[ofs : ofs : ofs+numNonFree[level]]
+		ofs += numNonFree[level]
+	}
+	for idx := range c.Gates {
+		l := &s.levels[gateLevels[idx]]
+		if c.Gates[idx].free(scheme) {
+			l.free = append(l.free, uint32(idx))
+		} else {
+			l.nonFree = append(l.nonFree, uint32(idx))
+		}
+	}
+
+	return s
+}
+
+// run processes the gates level by level. The non-free gates of each
+// level are split into batches that are processed by the worker
+// goroutines, and the free gates are processed by the calling
+// goroutine. The newFunc creates the gate function for each
+// goroutine.
+func (s *schedule) run(workers int, newFunc func() (gateFunc, error)) error {
+	f, err := newFunc()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var firstErr error
+
+	setErr := func(err error) {
+		m.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		m.Unlock()
+	}
+	process := func(f gateFunc, gates []uint32) {
+		for _, idx := range gates {
+			if err := f(int(idx), s.tweaks[idx]); err != nil {
+				setErr(err)
+				return
+			}
+		}
+	}
+
+	jobs := make(chan []uint32)
+	defer close(jobs)
+
+	for i := 0; i < workers; i++ {
+		wf, err := newFunc()
+		if err != nil {
+			return err
+		}
+		go func() {
+			for batch := range jobs {
+				process(wf, batch)
+				wg.Done()
+			}
+		}()
+	}
+
+	for _, level := range s.levels {
+		n := len(level.nonFree)
+		if n >= parallelMinGates && workers > 1 {
+			size := (n + workers - 1) / workers
+			for start := 0; start < n; start += size {
+				wg.Add(1)
+				jobs <- level.nonFree[start:min(start+size, n)]
+			}
+		} else {
+			process(f, level.nonFree)
+		}
+		process(f, level.free)
+		wg.Wait()
+
+		if firstErr != nil {
+			return firstErr
+		}
+	}
+	return nil
+}
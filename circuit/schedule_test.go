@@ -0,0 +1,176 @@
+//
+// schedule_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+var scheduleCircuits = []string{
+	"../pkg/crypto/aes/aes_128.circ",
+	"../pkg/crypto/sha256/sha256.circ",
+	"testdata/2party.mpclc",
+}
+
+func garbleSeed(c *Circuit, scheme Scheme, workers int) (*Garbled, error) {
+	var key [32]byte
+	prg, err := newPRG(make([]byte, 16))
+	if err != nil {
+		return nil, err
+	}
+	return c.GarbleParallel(scheme, key[:], prg, workers)
+}
+
+func TestParallel(t *testing.T) {
+	saved := parallelMinGates
+	parallelMinGates = 1
+	defer func() {
+		parallelMinGates = saved
+	}()
+
+	for _, file := range scheduleCircuits {
+		circ, err := Parse(file)
+		if err != nil {
+			t.Fatalf("could not load circuit: %s", err)
+		}
+		for scheme := HalfGates; scheme < numSchemes; scheme++ {
+			testParallel(t, fmt.Sprintf("%s/%s", file, scheme), circ,
+				scheme)
+		}
+	}
+}
+
+func testParallel(t *testing.T, file string, circ *Circuit, scheme Scheme) {
+	sequential, err := garbleSeed(circ, scheme, 1)
+	if err != nil {
+		t.Fatalf("%s: garble: %s", file, err)
+	}
+	parallel, err := garbleSeed(circ, scheme, 4)
+	if err != nil {
+		t.Fatalf("%s: parallel garble: %s", file, err)
+	}
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Fatalf("%s: parallel garbling differs from sequential", file)
+	}
+
+	var inputs []*big.Int
+	var labels []ot.Label
+	var bit int
+	for idx, arg := range circ.Inputs {
+		input := new(big.Int)
+		for i := 0; i < int(arg.Type.Bits); i++ {
+			if (bit*7+idx)%3 == 0 {
+				input.SetBit(input, i, 1)
+				labels = append(labels, sequential.Wires[bit].L1)
+			} else {
+				labels = append(labels, sequential.Wires[bit].L0)
+			}
+			bit++
+		}
+		inputs = append(inputs, input)
+	}
+	expected, err := circ.Compute(inputs)
+	if err != nil {
+		t.Fatalf("%s: Compute: %s", file, err)
+	}
+
+	var key [32]byte
+	for _, workers := range []int{1, 4} {
+		wires := make([]ot.Label, circ.NumWires)
+		copy(wires, labels)
+		err := circ.EvalParallel(scheme, key[:], wires, sequential.Gates,
+			workers)
+		if err != nil {
+			t.Fatalf("%s: eval: %s", file, err)
+		}
+		result := new(big.Int)
+		outputs := circ.NumWires - circ.Outputs.Size()
+		for i := 0; i < circ.Outputs.Size(); i++ {
+			w := Wire(outputs + i)
+			var bit uint
+			if wires[w].Equal(sequential.Wires[w].L1) {
+				bit = 1
+			} else if !wires[w].Equal(sequential.Wires[w].L0) {
+				t.Fatalf("%s: invalid output label for wire %d", file, w)
+			}
+			result.SetBit(result, i, bit)
+		}
+		for idx, r := range circ.Outputs.Split(result) {
+			if r.Cmp(expected[idx]) != 0 {
+				t.Errorf("%s: workers=%d: result %d: got %x, "+
+					"expected %x", file, workers, idx, r, expected[idx])
+			}
+		}
+	}
+}
+
+func benchmarkGarble(b *testing.B, file string, workers int) {
+	circ, err := Parse(file)
+	if err != nil {
+		b.Fatalf("could not load circuit: %s", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := garbleSeed(circ, HalfGates, workers)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEval(b *testing.B, file string, workers int) {
+	circ, err := Parse(file)
+	if err != nil {
+		b.Fatalf("could not load circuit: %s", err)
+	}
+	garbled, err := garbleSeed(circ, HalfGates, workers)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var key [32]byte
+	wires := make([]ot.Label, circ.NumWires)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for w := 0; w < circ.Inputs.Size(); w++ {
+			wires[w] = garbled.Wires[w].L0
+		}
+		err := circ.EvalParallel(HalfGates, key[:], wires, garbled.Gates,
+			workers)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGarbleParallel(b *testing.B) {
+	for _, file := range scheduleCircuits[:2] {
+		for _, workers := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%s/%d", file[len("../pkg/crypto/"):],
+				workers), func(b *testing.B) {
+				benchmarkGarble(b, file, workers)
+			})
+		}
+	}
+}
+
+func BenchmarkEvalParallel(b *testing.B) {
+	for _, file := range scheduleCircuits[:2] {
+		for _, workers := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%s/%d", file[len("../pkg/crypto/"):],
+				workers), func(b *testing.B) {
+				benchmarkEval(b, file, workers)
+			})
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// Scheme defines the garbling scheme of the non-free gates.
+type Scheme byte
+
+// Garbling schemes. The schemes are ordered by their efficiency so
+// that the later schemes produce smaller garbled circuits.
+const (
+	// HalfGates garbles AND gates with two labels using the
+	// half-gates scheme, OR gates with three row-reduced labels, and
+	// INV gates with one label.
+	HalfGates Scheme = iota
+
+	// ThreeHalves garbles AND and OR gates with 1.5 labels and 8
+	// control bits using the Rosulek-Roy three-halves scheme. INV
+	// and XNOR gates are free.
+	ThreeHalves
+
+	numSchemes
+)
+
+var schemeNames = map[Scheme]string{
+	HalfGates:   "halfgates",
+	ThreeHalves: "threehalves",
+}
+
+func (s Scheme) String() string {
+	name, ok := schemeNames[s]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{Scheme %d}", s)
+}
+
+// ParseScheme parses the garbling scheme name.
+func ParseScheme(name string) (Scheme, error) {
+	for scheme, n := range schemeNames {
+		if n == name {
+			return scheme, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown garbling scheme '%s'", name)
+}
+
+// NegotiateScheme negotiates the garbling scheme with the peer. Both
+// parties announce the most efficient scheme they are willing to use
+// and select the less efficient of the two announced schemes. The
+// garbler announces its scheme first.
+func NegotiateScheme(conn *p2p.Conn, scheme Scheme, garbler bool) (
+	Scheme, error) {
+
+	if scheme >= numSchemes {
+		return 0, fmt.Errorf("invalid garbling scheme %s", scheme)
+	}
+	var peer Scheme
+	var err error
+
+	if garbler {
+		if err = conn.SendByte(byte(scheme)); err != nil {
+			return 0, err
+		}
+		if err = conn.Flush(); err != nil {
+			return 0, err
+		}
+		peer, err = receiveScheme(conn)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		peer, err = receiveScheme(conn)
+		if err != nil {
+			return 0, err
+		}
+		if err = conn.SendByte(byte(scheme)); err != nil {
+			return 0, err
+		}
+		if err = conn.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return min(scheme, peer), nil
+}
+
+func receiveScheme(conn *p2p.Conn) (Scheme, error) {
+	b, err := conn.ReceiveByte()
+	if err != nil {
+		return 0, err
+	}
+	return Scheme(b), nil
+}
@@ -0,0 +1,115 @@
+//
+// scheme_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func TestParseScheme(t *testing.T) {
+	for scheme := HalfGates; scheme < numSchemes; scheme++ {
+		parsed, err := ParseScheme(scheme.String())
+		if err != nil {
+			t.Fatalf("ParseScheme(%s): %s", scheme, err)
+		}
+		if parsed != scheme {
+			t.Errorf("ParseScheme(%s) = %s", scheme, parsed)
+		}
+	}
+	if _, err := ParseScheme("unknown"); err == nil {
+		t.Errorf("ParseScheme accepted unknown scheme")
+	}
+}
+
+func TestNegotiateScheme(t *testing.T) {
+	for g := HalfGates; g < numSchemes; g++ {
+		for e := HalfGates; e < numSchemes; e++ {
+			gc, ec := net.Pipe()
+			gConn := p2p.NewConn(gc)
+			eConn := p2p.NewConn(ec)
+
+			done := make(chan Scheme)
+			go func() {
+				scheme, err := NegotiateScheme(gConn, g, true)
+				if err != nil {
+					t.Errorf("garbler: %s", err)
+				}
+				gConn.Close()
+				done <- scheme
+			}()
+			scheme, err := NegotiateScheme(eConn, e, false)
+			if err != nil {
+				t.Fatalf("evaluator: %s", err)
+			}
+			eConn.Close()
+
+			expected := min(g, e)
+			if gScheme := <-done; gScheme != expected {
+				t.Errorf("garbler %s, evaluator %s: garbler got %s",
+					g, e, gScheme)
+			}
+			if scheme != expected {
+				t.Errorf("garbler %s, evaluator %s: evaluator got %s",
+					g, e, scheme)
+			}
+		}
+	}
+}
+
+func TestSchemes(t *testing.T) {
+	circ, err := Parse("testdata/2party.mpclc")
+	if err != nil {
+		t.Fatalf("could not load circuit: %s", err)
+	}
+	for _, input := range dualTests {
+		inputs := []*big.Int{big.NewInt(input[0]), big.NewInt(input[1])}
+		expected, err := circ.Compute(inputs)
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		for scheme := HalfGates; scheme < numSchemes; scheme++ {
+			gc, ec := net.Pipe()
+			gConn := p2p.NewConn(gc)
+			eConn := p2p.NewConn(ec)
+
+			done := make(chan dualResult)
+			go func() {
+				result, err := Garbler(gConn, ot.NewCO(), circ, inputs[0],
+					scheme, false)
+				gConn.Close()
+				done <- dualResult{
+					result: result,
+					err:    err,
+				}
+			}()
+			result, err := Evaluator(eConn, ot.NewCO(), circ, inputs[1],
+				ThreeHalves, false)
+			eConn.Close()
+			g := <-done
+			if err != nil {
+				t.Fatalf("%s: Evaluator: %s", scheme, err)
+			}
+			if g.err != nil {
+				t.Fatalf("%s: Garbler: %s", scheme, g.err)
+			}
+			for idx, r := range result {
+				if r.Cmp(expected[idx]) != 0 || g.result[idx].Cmp(r) != 0 {
+					t.Errorf("%s: %v: result %d: got %v and %v, "+
+						"expected %v", scheme, input, idx, g.result[idx], r,
+						expected[idx])
+				}
+			}
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,6 +7,7 @@
 package circuit
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
@@ -23,6 +24,8 @@ const (
 	OpResult = iota
 	OpCircuit
 	OpReturn
+	OpTemplate
+	OpInstance
 )
 
 // StreamEval is a streaming garbled circuit evaluator.
@@ -86,9 +89,171 @@ func (stream *StreamEval) InitCircuit(numWires, numTmpWires int) {
 	}
 }
 
-// StreamEvaluator runs the stream evaluator on the connection.
-func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
-	verbose bool) (IO, []*big.Int, error) {
+// evalGate receives the garbled table of the gate from the
+// connection and evaluates the gate. The idp specifies the tweak ID
+// of the gate and it is advanced by the IDs the gate consumes.
+func (stream *StreamEval) evalGate(conn *p2p.Conn, scheme Scheme,
+	op Operation, aTmp, bTmp, cTmp bool, aIndex, bIndex, cIndex int,
+	idp *uint32) error {
+
+	var tableCount int
+	var err error
+
+	switch op {
+	case XOR, XNOR:
+		tableCount = 0
+	case INV:
+		tableCount = 1
+	case AND:
+		tableCount = 2
+	case OR:
+		tableCount = 3
+	default:
+		return fmt.Errorf("invalid operation %s", op)
+	}
+	threeHalves := scheme == ThreeHalves
+	if threeHalves {
+		switch op {
+		case INV:
+			tableCount = 0
+		case OR:
+			tableCount = 2
+		}
+	}
+
+	var garbled [4]ot.Label
+	var labelData ot.LabelData
+
+	if threeHalves && tableCount == 2 {
+		garbled[0], garbled[1], err = receiveThreeHalves(conn)
+		if err != nil {
+			return err
+		}
+	} else {
+		for c := 0; c < tableCount; c++ {
+			err = conn.ReceiveLabel(&garbled[c], &labelData)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var a, b, c ot.Label
+
+	a = stream.Get(aTmp, aIndex)
+	if op != INV {
+		b = stream.Get(bTmp, bIndex)
+	}
+
+	var output ot.Label
+	id := *idp
+
+	switch op {
+	case XOR, XNOR:
+		a.Xor(b)
+		output = a
+
+	case AND:
+		if threeHalves {
+			output = evalThreeHalves(stream.alg, a, b, garbled[0],
+				garbled[1], id, &labelData)
+			*idp = id + 3
+			break
+		}
+		sa := a.S()
+		sb := b.S()
+
+		j0 := id
+		j1 := id + 1
+		*idp = id + 2
+
+		tg := garbled[0]
+		te := garbled[1]
+
+		wg := encryptHalf(stream.alg, a, j0, &labelData)
+		if sa {
+			wg.Xor(tg)
+		}
+		we := encryptHalf(stream.alg, b, j1, &labelData)
+		if sb {
+			we.Xor(te)
+			we.Xor(a)
+		}
+		output = wg
+		output.Xor(we)
+
+	case OR:
+		if threeHalves {
+			// OR is garbled as AND of inverted labels.
+			output = evalThreeHalves(stream.alg, a, b, garbled[0],
+				garbled[1], id, &labelData)
+			*idp = id + 3
+			break
+		}
+		index := idx(a, b)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			c = garbled[index-1]
+		}
+		output = decrypt(stream.alg, a, b, id, c, &labelData)
+		*idp = id + 1
+
+	case INV:
+		if threeHalves {
+			// Free INV.
+			output = a
+			break
+		}
+		index := idxUnary(a)
+		if index > 0 {
+			// First row is zero and not transmitted.
+			c = garbled[index-1]
+		}
+		output = decrypt(stream.alg, a, b, id, c, &labelData)
+		*idp = id + 1
+	}
+	stream.Set(cTmp, cIndex, output)
+
+	return nil
+}
+
+// StreamVerifier verifies the arguments of the streamed program and
+// returns the expected program hash. The function returns an error if
+// the arguments do not match the expected program.
+type StreamVerifier func(in1, in2 IOArg, outputs IO) ([]byte, error)
+
+// InputFunc encodes the party's input value for the program
+// argument.
+type InputFunc func(arg IOArg) (*big.Int, error)
+
+// StreamEvaluator runs the stream evaluator on the connection. If the
+// verifier is not nil, the evaluator verifies that the garbler
+// streams the expected program and aborts the evaluation before
+// revealing any results if the program hash does not match. The
+// scheme specifies the most efficient garbling scheme the evaluator
+// is willing to use. The inputFlag specifies the evaluator's input
+// values as strings.
+func StreamEvaluator(conn *p2p.Conn, oti ot.OT, scheme Scheme,
+	inputFlag []string, verifier StreamVerifier, verbose bool) (
+	IO, []*big.Int, error) {
+
+	return StreamEvaluatorInput(conn, oti, scheme,
+		func(arg IOArg) (*big.Int, error) {
+			input, err := arg.Parse(inputFlag)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf(" -  In: %s\n", inputFlag)
+			return input, nil
+		}, verifier, verbose)
+}
+
+// StreamEvaluatorInput runs the stream evaluator on the connection
+// like StreamEvaluator. The input function encodes the evaluator's
+// input for the program argument.
+func StreamEvaluatorInput(conn *p2p.Conn, oti ot.OT, scheme Scheme,
+	input InputFunc, verifier StreamVerifier, verbose bool) (
+	IO, []*big.Int, error) {
 
 	timing := NewTiming()
 
@@ -100,7 +265,7 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	if err != nil {
 		return nil, nil, err
 	}
-	alg, err := aes.NewCipher(key)
+	scheme, err = NegotiateScheme(conn, scheme, false)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,10 +279,6 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	if err != nil {
 		return nil, nil, err
 	}
-	inputs, err := in2.Parse(inputFlag)
-	if err != nil {
-		return nil, nil, err
-	}
 	// Program outputs.
 	numOutputs, err := conn.ReceiveUint32()
 	if err != nil {
@@ -140,7 +301,22 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	fmt.Printf(" - In1: %s\n", in1)
 	fmt.Printf(" + In2: %s\n", in2)
 	fmt.Printf(" - Out: %s\n", outputs)
-	fmt.Printf(" -  In: %s\n", inputFlag)
+
+	inputs, err := input(in2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	programHash := NewStreamHash()
+	programHash.Arguments(in1, in2, outputs)
+
+	var expectedHash []byte
+	if verifier != nil {
+		expectedHash, err = verifier(in1, in2, outputs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
 	streaming, err := NewStreamEval(key, int(in1.Type.Bits+in2.Type.Bits),
 		outputs.Size())
@@ -160,6 +336,10 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	}
 
 	// Init oblivious transfer.
+	err = ot.Negotiate(conn, oti, false)
+	if err != nil {
+		return nil, nil, err
+	}
 	err = oti.InitReceiver(conn)
 	if err != nil {
 		return nil, nil, err
@@ -196,13 +376,39 @@ func StreamEvaluator(conn *p2p.Conn, oti ot.OT, inputFlag []string,
 	if verbose {
 		fmt.Printf(" - Evaluating program...\n")
 	}
-	var garbled [4]ot.Label
 	var lastStep int
 
-	var rawResult *big.Int
+	var result []*big.Int
 
 	start := time.Now()
 	lastReport := start
+
+	// report prints the evaluation progress.
+	report := func(step int) {
+		if step-lastStep >= 10 && verbose {
+			lastStep = step
+			now := time.Now()
+			if now.Sub(lastReport) > time.Second*5 {
+				lastReport = now
+				elapsed := time.Now().Sub(start)
+				done := float64(step) / float64(numSteps)
+				if done > 0 {
+					total := time.Duration(float64(elapsed) / done)
+					progress := fmt.Sprintf("%d/%d", step, numSteps)
+					remaining := fmt.Sprintf("%24s", total-elapsed)
+					fmt.Printf("%-14s\t%s remaining\tETA %s\n",
+						progress, remaining,
+						start.Add(total).Format(time.Stamp))
+				} else {
+					fmt.Printf("%d/%d\n", step, numSteps)
+				}
+			}
+		}
+	}
+
+	var templates []*streamTemplate
+	var in, out []Wire
+
 loop:
 	for {
 		op, err := conn.ReceiveUint32()
@@ -227,25 +433,8 @@ loop:
 			if err != nil {
 				return nil, nil, err
 			}
-			if step-lastStep >= 10 && verbose {
-				lastStep = step
-				now := time.Now()
-				if now.Sub(lastReport) > time.Second*5 {
-					lastReport = now
-					elapsed := time.Now().Sub(start)
-					done := float64(step) / float64(numSteps)
-					if done > 0 {
-						total := time.Duration(float64(elapsed) / done)
-						progress := fmt.Sprintf("%d/%d", step, numSteps)
-						remaining := fmt.Sprintf("%24s", total-elapsed)
-						fmt.Printf("%-14s\t%s remaining\tETA %s\n",
-							progress, remaining,
-							start.Add(total).Format(time.Stamp))
-					} else {
-						fmt.Printf("%d/%d\n", step, numSteps)
-					}
-				}
-			}
+			report(step)
+			programHash.CircuitHeader(step, numGates, numTmpWires, numWires)
 			streaming.InitCircuit(numWires, numTmpWires)
 			var id uint32
 			for i := 0; i < numGates; i++ {
@@ -270,10 +459,10 @@ loop:
 					recvWire = conn.ReceiveUint32
 				}
 
+				hashOp := gop &^ 0b00010000
 				gop &^= 0b11110000
 
 				var aIndex, bIndex, cIndex int
-				var tableCount int
 
 				switch Operation(gop) {
 				case XOR, XNOR, AND, OR:
@@ -303,112 +492,100 @@ loop:
 					return nil, nil, fmt.Errorf("invalid operation %s",
 						Operation(gop))
 				}
-				switch Operation(gop) {
-				case XOR, XNOR:
-					tableCount = 0
-				case INV:
-					tableCount = 1
-				case AND:
-					tableCount = 2
-				case OR:
-					tableCount = 3
-				}
+				programHash.Gate(hashOp, aIndex, bIndex, cIndex)
 
-				for c := 0; c < tableCount; c++ {
-					err = conn.ReceiveLabel(&label, &labelData)
-					if err != nil {
-						return nil, nil, err
-					}
-					garbled[c] = label
-				}
-
-				var a, b, c ot.Label
-
-				switch Operation(gop) {
-				case XOR, XNOR, AND, OR:
-					if StreamDebug {
+				if StreamDebug {
+					switch Operation(gop) {
+					case XOR, XNOR, AND, OR:
 						fmt.Printf("Gate%d:\t %s %s %s %s\n", i,
 							ws(aIndex, aTmp), ws(bIndex, bTmp),
 							Operation(gop), ws(cIndex, cTmp))
-					}
-					a = streaming.Get(aTmp, aIndex)
-					b = streaming.Get(bTmp, bIndex)
-
-				case INV:
-					if StreamDebug {
+					case INV:
 						fmt.Printf("Gate%d:\t %s %s %s\n", i,
 							ws(aIndex, aTmp), Operation(gop), ws(bIndex, bTmp))
 					}
-					a = streaming.Get(aTmp, aIndex)
 				}
+				err = streaming.evalGate(conn, scheme, Operation(gop),
+					aTmp, bTmp, cTmp, aIndex, bIndex, cIndex, &id)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
 
-				var output ot.Label
+		case OpTemplate:
+			id, err := conn.ReceiveUint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			if id != len(templates) {
+				return nil, nil, fmt.Errorf("invalid template ID %d", id)
+			}
+			tmpl, err := receiveTemplate(conn)
+			if err != nil {
+				return nil, nil, err
+			}
+			templates = append(templates, tmpl)
 
-				switch Operation(gop) {
-				case XOR, XNOR:
-					a.Xor(b)
-					output = a
-
-				case AND:
-					if tableCount != 2 {
-						return nil, nil,
-							fmt.Errorf("corrupted ciruit: AND table size: %d",
-								tableCount)
-					}
-					sa := a.S()
-					sb := b.S()
+		case OpInstance:
+			step, err := conn.ReceiveUint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			id, err := conn.ReceiveUint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			if id >= len(templates) {
+				return nil, nil, fmt.Errorf("unknown template ID %d", id)
+			}
+			tmpl := templates[id]
+			numWires, err := conn.ReceiveUint32()
+			if err != nil {
+				return nil, nil, err
+			}
+			in, err = receiveWires(conn, in[:0], tmpl.numInputs, numWires)
+			if err != nil {
+				return nil, nil, err
+			}
+			out, err = receiveWires(conn, out[:0], tmpl.numOutputs, numWires)
+			if err != nil {
+				return nil, nil, err
+			}
+			report(step)
+			err = programHash.Circuit(step, tmpl.circ, in, out)
+			if err != nil {
+				return nil, nil, err
+			}
+			streaming.InitCircuit(numWires, tmpl.circ.NumWires)
 
-					j0 := id
-					j1 := id + 1
-					id += 2
+			firstTmp := Wire(len(in))
+			firstOut := Wire(tmpl.circ.NumWires - len(out))
 
-					tg := garbled[0]
-					te := garbled[1]
+			wire := func(w Wire) (int, bool) {
+				if w < firstTmp {
+					return int(in[w]), false
+				} else if w >= firstOut {
+					return int(out[w-firstOut]), false
+				}
+				return int(w), true
+			}
 
-					wg := encryptHalf(alg, a, j0, &labelData)
-					if sa {
-						wg.Xor(tg)
-					}
-					we := encryptHalf(alg, b, j1, &labelData)
-					if sb {
-						we.Xor(te)
-						we.Xor(a)
-					}
-					output = wg
-					output.Xor(we)
-
-				case OR:
-					index := idx(a, b)
-					if index > 0 {
-						// First row is zero and not transmitted.
-						index--
-						if index >= tableCount {
-							return nil, nil,
-								fmt.Errorf("corrupted circuit: index %d >= %d",
-									index, tableCount)
-						}
-						c = garbled[index]
-					}
-					output = decrypt(alg, a, b, id, c, &labelData)
-					id++
+			var tweak uint32
+			for _, g := range tmpl.circ.Gates {
+				var aIndex, bIndex, cIndex int
+				var aTmp, bTmp, cTmp bool
 
-				case INV:
-					index := idxUnary(a)
-					if index > 0 {
-						// First row is zero and not transmitted.
-						index--
-						if index >= tableCount {
-							return nil, nil,
-								fmt.Errorf("corrupted circuit: index %d >= %d",
-									index, tableCount)
-						}
-						c = garbled[index]
-					}
+				aIndex, aTmp = wire(g.Input0)
+				if g.Op != INV {
+					bIndex, bTmp = wire(g.Input1)
+				}
+				cIndex, cTmp = wire(g.Output)
 
-					output = decrypt(alg, a, b, id, c, &labelData)
-					id++
+				err = streaming.evalGate(conn, scheme, g.Op, aTmp, bTmp, cTmp,
+					aIndex, bIndex, cIndex, &tweak)
+				if err != nil {
+					return nil, nil, err
 				}
-				streaming.Set(cTmp, cIndex, output)
 			}
 
 		case OpReturn:
@@ -417,6 +594,7 @@ loop:
 			timing.Sample("Eval", []string{FileSize(xfer).String()})
 
 			var labels []ot.Label
+			var ids []Wire
 			for i := 0; i < outputs.Size(); i++ {
 				id, err := conn.ReceiveUint32()
 				if err != nil {
@@ -424,27 +602,26 @@ loop:
 				}
 				label := streaming.Get(false, id)
 				labels = append(labels, label)
+				ids = append(ids, Wire(id))
 			}
 
+			// Verify program before revealing any results.
+			programHash.Return(ids)
+			sum := programHash.Sum()
+			if expectedHash != nil && !bytes.Equal(sum, expectedHash) {
+				return nil, nil, fmt.Errorf("program hash mismatch: "+
+					"got %x, expected %x", sum, expectedHash)
+			}
+			fmt.Printf("Program hash: %x\n", sum)
+
 			// Resolve result values.
 			if err := conn.SendUint32(OpResult); err != nil {
 				return nil, nil, err
 			}
-			var labelData ot.LabelData
-			for _, l := range labels {
-				if err := conn.SendLabel(l, &labelData); err != nil {
-					return nil, nil, err
-				}
-			}
-			if err := conn.Flush(); err != nil {
-				return nil, nil, err
-			}
-
-			result, err := conn.ReceiveData()
+			result, err = evaluatorResult(conn, outputs, labels)
 			if err != nil {
 				return nil, nil, err
 			}
-			rawResult = new(big.Int).SetBytes(result)
 			break loop
 
 		default:
@@ -459,7 +636,7 @@ loop:
 		timing.Print(conn.Stats)
 	}
 
-	return outputs, outputs.Split(rawResult), nil
+	return outputs, result, nil
 }
 
 func receiveArgument(conn *p2p.Conn) (arg IOArg, err error) {
@@ -482,6 +659,15 @@ func receiveArgument(conn *p2p.Conn) (arg IOArg, err error) {
 	}
 	arg.Type.Bits = types.Size(size)
 
+	owner, err := conn.ReceiveByte()
+	if err != nil {
+		return arg, err
+	}
+	arg.Owner = Owner(owner)
+	if _, ok := ownerNames[arg.Owner]; !ok {
+		return arg, fmt.Errorf("invalid output owner %s", arg.Owner)
+	}
+
 	count, err := conn.ReceiveUint32()
 	if err != nil {
 		return arg, err
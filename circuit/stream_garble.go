@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2021, 2023 Markku Rossi
+// Copyright (c) 2020-2021, 2023-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -26,6 +26,7 @@ const (
 // Streaming is a streaming garbled circuit garbler.
 type Streaming struct {
 	conn     *p2p.Conn
+	scheme   Scheme
 	key      []byte
 	alg      cipher.Block
 	r        ot.Label
@@ -37,10 +38,14 @@ type Streaming struct {
 	firstOut Wire
 }
 
-// NewStreaming creates a new streaming garbled circuit garbler.
-func NewStreaming(key []byte, inputs []Wire, conn *p2p.Conn) (
-	*Streaming, error) {
+// NewStreaming creates a new streaming garbled circuit garbler that
+// garbles the circuits with the garbling scheme.
+func NewStreaming(scheme Scheme, key []byte, inputs []Wire,
+	conn *p2p.Conn) (*Streaming, error) {
 
+	if scheme >= numSchemes {
+		return nil, fmt.Errorf("invalid garbling scheme %s", scheme)
+	}
 	r, err := ot.NewLabel(rand.Reader)
 	if err != nil {
 		return nil, err
@@ -53,17 +58,18 @@ func NewStreaming(key []byte, inputs []Wire, conn *p2p.Conn) (
 	}
 
 	stream := &Streaming{
-		conn: conn,
-		key:  key,
-		alg:  alg,
-		r:    r,
+		conn:   conn,
+		scheme: scheme,
+		key:    key,
+		alg:    alg,
+		r:      r,
 	}
 
 	stream.ensureWires(maxWire(0, inputs))
 
 	// Assing all input wires.
 	for i := 0; i < len(inputs); i++ {
-		w, err := makeLabels(stream.r)
+		w, err := makeLabels(rand.Reader, stream.r)
 		if err != nil {
 			return nil, err
 		}
@@ -150,6 +156,20 @@ func (stream *Streaming) Set(w Wire, val ot.Wire) (index Wire, tmp bool) {
 // Garble garbles the circuit and streams the garbled tables into the
 // stream.
 func (stream *Streaming) Garble(c *Circuit, in, out []Wire) (
+	time.Duration, time.Duration, error) {
+	return stream.garble(c, in, out, true)
+}
+
+// GarbleTemplate garbles the circuit and streams only the garbled
+// tables of its gates into the stream. The evaluator takes the gate
+// operations and wires from the circuit template, defined with
+// DefineTemplate.
+func (stream *Streaming) GarbleTemplate(c *Circuit, in, out []Wire) (
+	time.Duration, time.Duration, error) {
+	return stream.garble(c, in, out, false)
+}
+
+func (stream *Streaming) garble(c *Circuit, in, out []Wire, wires bool) (
 	time.Duration, time.Duration, error) {
 	if StreamDebug {
 		fmt.Printf(" - Streaming.Garble: in=%v, out=%v\n", in, out)
@@ -173,7 +193,7 @@ func (stream *Streaming) Garble(c *Circuit, in, out []Wire) (
 		if err != nil {
 			return 0, 0, err
 		}
-		err = stream.garbleGate(gate, &id, table[:], &data,
+		err = stream.garbleGate(gate, &id, table[:], &data, wires,
 			stream.conn.WriteBuf, &stream.conn.WritePos)
 		if err != nil {
 			return 0, 0, err
@@ -182,9 +202,12 @@ func (stream *Streaming) Garble(c *Circuit, in, out []Wire) (
 	return mid.Sub(start), time.Now().Sub(mid), nil
 }
 
-// GarbleGate garbles the gate and streams it to the stream.
+// GarbleGate garbles the gate and streams it to the stream. If wires
+// is false, the gate operation and wire indices are omitted and only
+// the garbled table is streamed.
 func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
-	table []ot.Label, data *ot.LabelData, buf []byte, bufpos *int) error {
+	table []ot.Label, data *ot.LabelData, wires bool, buf []byte,
+	bufpos *int) error {
 
 	var a, b, c ot.Wire
 	var aIndex, bIndex, cIndex Wire
@@ -231,6 +254,12 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		}
 
 	case AND:
+		if stream.scheme == ThreeHalves {
+			c, table[0], table[1], _ = garbleThreeHalvesOp(stream.alg,
+				g.Op, a, b, stream.r, idp, data)
+			tableCount = 2
+			break
+		}
 		pa := a.L0.S()
 		pb := b.L0.S()
 
@@ -275,6 +304,14 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		tableCount = 2
 
 	case OR, INV:
+		if stream.scheme == ThreeHalves {
+			c, table[0], table[1], _ = garbleThreeHalvesOp(stream.alg,
+				g.Op, a, b, stream.r, idp, data)
+			if g.Op == OR {
+				tableCount = 2
+			}
+			break
+		}
 		// Row reduction creates labels below so that the first row is
 		// all zero.
 
@@ -292,6 +329,11 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		wireCount = 3
 
 	case OR:
+		if stream.scheme == ThreeHalves {
+			// Three-halves OR garbled above.
+			wireCount = 3
+			break
+		}
 		// a b c
 		// -----
 		// 0 0 0
@@ -331,6 +373,11 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		wireCount = 3
 
 	case INV:
+		if stream.scheme == ThreeHalves {
+			// Free INV.
+			wireCount = 2
+			break
+		}
 		// a b c
 		// -----
 		// 0   1
@@ -379,7 +426,35 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 		stream.tmp[g.Output] = c
 	}
 
-	op := byte(g.Op)
+	if wires {
+		putGateWires(buf, bufpos, g.Op, wireCount, aIndex, bIndex, cIndex,
+			aTmp, bTmp, cTmp)
+	}
+
+	if stream.scheme == ThreeHalves && tableCount == 2 {
+		// Three label halves and the control bits.
+		bo.PutUint64(buf[*bufpos+0:], table[0].D0)
+		bo.PutUint64(buf[*bufpos+8:], table[0].D1)
+		bo.PutUint64(buf[*bufpos+16:], table[1].D0)
+		buf[*bufpos+24] = byte(table[1].D1)
+		*bufpos = *bufpos + 25
+		return nil
+	}
+	for i := 0; i < tableCount; i++ {
+		bytes := table[tableStart+i].Bytes(data)
+		copy(buf[*bufpos:], bytes)
+		*bufpos = *bufpos + len(bytes)
+	}
+
+	return nil
+}
+
+// putGateWires encodes the gate operation and wire indices into the
+// buffer.
+func putGateWires(buf []byte, bufpos *int, gop Operation, wireCount int,
+	aIndex, bIndex, cIndex Wire, aTmp, bTmp, cTmp bool) {
+
+	op := byte(gop)
 	if aTmp {
 		op |= 0b10000000
 	}
@@ -429,12 +504,4 @@ func (stream *Streaming) garbleGate(g *Gate, idp *uint32,
 			panic(fmt.Sprintf("invalid wire count: %d", wireCount))
 		}
 	}
-
-	for i := 0; i < tableCount; i++ {
-		bytes := table[tableStart+i].Bytes(data)
-		copy(buf[*bufpos:], bytes)
-		*bufpos = *bufpos + len(bytes)
-	}
-
-	return nil
 }
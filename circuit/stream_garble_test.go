@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -14,23 +14,31 @@ import (
 )
 
 func BenchmarkGarbleXOR(b *testing.B) {
-	benchmarkGate(b, newGate(XOR))
+	benchmarkGate(b, HalfGates, newGate(XOR))
 }
 
 func BenchmarkGarbleXNOR(b *testing.B) {
-	benchmarkGate(b, newGate(XNOR))
+	benchmarkGate(b, HalfGates, newGate(XNOR))
 }
 
 func BenchmarkGarbleAND(b *testing.B) {
-	benchmarkGate(b, newGate(AND))
+	benchmarkGate(b, HalfGates, newGate(AND))
 }
 
 func BenchmarkGarbleOR(b *testing.B) {
-	benchmarkGate(b, newGate(OR))
+	benchmarkGate(b, HalfGates, newGate(OR))
 }
 
 func BenchmarkGarbleINV(b *testing.B) {
-	benchmarkGate(b, newGate(INV))
+	benchmarkGate(b, HalfGates, newGate(INV))
+}
+
+func BenchmarkGarbleThreeHalvesAND(b *testing.B) {
+	benchmarkGate(b, ThreeHalves, newGate(AND))
+}
+
+func BenchmarkGarbleThreeHalvesOR(b *testing.B) {
+	benchmarkGate(b, ThreeHalves, newGate(OR))
 }
 
 func newGate(op Operation) *Gate {
@@ -42,12 +50,12 @@ func newGate(op Operation) *Gate {
 	}
 }
 
-func benchmarkGate(b *testing.B, g *Gate) {
+func benchmarkGate(b *testing.B, scheme Scheme, g *Gate) {
 	var key [16]byte
 	inputs := []Wire{0, 1}
 	outputs := []Wire{2}
 
-	stream, err := NewStreaming(key[:], inputs, nil)
+	stream, err := NewStreaming(scheme, key[:], inputs, nil)
 	if err != nil {
 		b.Fatalf("failed to init streaming: %s", err)
 	}
@@ -66,7 +74,8 @@ func benchmarkGate(b *testing.B, g *Gate) {
 		var buf [128]byte
 		var bufpos int
 
-		err = stream.garbleGate(g, &id, table[:], &data, buf[:], &bufpos)
+		err = stream.garbleGate(g, &id, table[:], &data, true, buf[:],
+			&bufpos)
 		if err != nil {
 			b.Fatalf("garble failed: %s", err)
 		}
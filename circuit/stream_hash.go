@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// StreamHash computes the program hash of a streamed program. The
+// hash covers the program arguments and the structure of the streamed
+// circuits i.e. the circuit steps, gate operations, and wire
+// indices. It does not cover the garbling key or the garbled tables
+// so the garbler and the evaluator compute the same hash for the same
+// program.
+type StreamHash struct {
+	hash hash.Hash
+	buf  []byte
+}
+
+// NewStreamHash creates a new program hash.
+func NewStreamHash() *StreamHash {
+	return &StreamHash{
+		hash: sha256.New(),
+		buf:  make([]byte, 0, 4096),
+	}
+}
+
+func (sh *StreamHash) flush() {
+	sh.hash.Write(sh.buf)
+	sh.buf = sh.buf[:0]
+}
+
+func (sh *StreamHash) uint32(val int) {
+	if len(sh.buf)+4 > cap(sh.buf) {
+		sh.flush()
+	}
+	sh.buf = bo.AppendUint32(sh.buf, uint32(val))
+}
+
+func (sh *StreamHash) string(val string) {
+	sh.uint32(len(val))
+	sh.flush()
+	sh.hash.Write([]byte(val))
+}
+
+// Argument adds the program argument to the hash.
+func (sh *StreamHash) Argument(arg IOArg) {
+	sh.string(arg.Name)
+	sh.string(arg.Type.String())
+	sh.uint32(int(arg.Type.Bits))
+	sh.uint32(int(arg.Owner))
+	sh.uint32(len(arg.Compound))
+	for _, a := range arg.Compound {
+		sh.Argument(a)
+	}
+}
+
+// Arguments adds the program inputs and outputs to the hash.
+func (sh *StreamHash) Arguments(in1, in2 IOArg, outputs IO) {
+	sh.Argument(in1)
+	sh.Argument(in2)
+	sh.uint32(len(outputs))
+	for _, o := range outputs {
+		sh.Argument(o)
+	}
+}
+
+// CircuitHeader adds the streamed circuit header to the hash.
+func (sh *StreamHash) CircuitHeader(step, numGates, numTmpWires,
+	numWires int) {
+	sh.uint32(OpCircuit)
+	sh.uint32(step)
+	sh.uint32(numGates)
+	sh.uint32(numTmpWires)
+	sh.uint32(numWires)
+}
+
+// Gate adds the streamed gate to the hash. The op specifies the gate
+// operation and the temporary wire flags of the wire indices.
+func (sh *StreamHash) Gate(op byte, a, b, c int) {
+	if len(sh.buf)+13 > cap(sh.buf) {
+		sh.flush()
+	}
+	sh.buf = append(sh.buf, op)
+	sh.uint32(a)
+	sh.uint32(b)
+	sh.uint32(c)
+}
+
+// Circuit adds the circuit to the hash. The circuit's gates are
+// hashed as Streaming.Garble streams them.
+func (sh *StreamHash) Circuit(step int, c *Circuit, in, out []Wire) error {
+	sh.CircuitHeader(step, c.NumGates, c.NumWires,
+		int(maxWire(maxWire(0, in), out)+1))
+
+	firstTmp := Wire(len(in))
+	firstOut := Wire(c.NumWires - len(out))
+
+	wire := func(w Wire) (Wire, bool) {
+		if w < firstTmp {
+			return in[w], false
+		} else if w >= firstOut {
+			return out[w-firstOut], false
+		}
+		return w, true
+	}
+
+	for _, g := range c.Gates {
+		var aIndex, bIndex, cIndex Wire
+		var aTmp, bTmp, cTmp bool
+
+		switch g.Op {
+		case XOR, XNOR, AND, OR:
+			bIndex, bTmp = wire(g.Input1)
+			fallthrough
+
+		case INV:
+			aIndex, aTmp = wire(g.Input0)
+
+		default:
+			return fmt.Errorf("invalid gate type %s", g.Op)
+		}
+		cIndex, cTmp = wire(g.Output)
+
+		op := byte(g.Op)
+		if aTmp {
+			op |= 0b10000000
+		}
+		if bTmp {
+			op |= 0b01000000
+		}
+		if cTmp {
+			op |= 0b00100000
+		}
+		sh.Gate(op, int(aIndex), int(bIndex), int(cIndex))
+	}
+	return nil
+}
+
+// Return adds the program return wires to the hash.
+func (sh *StreamHash) Return(ids []Wire) error {
+	sh.uint32(OpReturn)
+	sh.uint32(len(ids))
+	for _, id := range ids {
+		sh.uint32(int(id))
+	}
+	return nil
+}
+
+// Sum returns the program hash.
+func (sh *StreamHash) Sum() []byte {
+	sh.flush()
+	return sh.hash.Sum(nil)
+}
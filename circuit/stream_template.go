@@ -0,0 +1,178 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// The streaming garbler can define circuit templates for the circuits
+// it streams more than once. The OpTemplate operation sends the
+// template ID and the gate structure of the circuit:
+//
+//	numInputs numOutputs numWires numGates {op input0 [input1] output}*
+//
+// The wire indices are 16-bit values if numWires is at most 65536,
+// and 32-bit values otherwise. The OpInstance operation streams the
+// template circuit for a program step:
+//
+//	step templateID numWires {inputWire}* {outputWire}* {garbledTable}*
+//
+// where the input and output wires are the program wire IDs of the
+// circuit's inputs and outputs, and the garbled tables are the tables
+// of the non-free gates in the circuit's gate order.
+
+// streamTemplate is a circuit template of the streaming evaluator.
+type streamTemplate struct {
+	circ       *Circuit
+	numInputs  int
+	numOutputs int
+}
+
+// DefineTemplate streams the gate structure of the circuit template
+// into the stream. The numInputs and numOutputs specify the number of
+// the circuit's input and output wires.
+func (stream *Streaming) DefineTemplate(c *Circuit, numInputs,
+	numOutputs int) error {
+
+	conn := stream.conn
+
+	if err := conn.SendUint32(numInputs); err != nil {
+		return err
+	}
+	if err := conn.SendUint32(numOutputs); err != nil {
+		return err
+	}
+	if err := conn.SendUint32(c.NumWires); err != nil {
+		return err
+	}
+	if err := conn.SendUint32(len(c.Gates)); err != nil {
+		return err
+	}
+	sendWire := func(w Wire) error {
+		return conn.SendUint32(int(w))
+	}
+	if c.NumWires <= 0x10000 {
+		sendWire = func(w Wire) error {
+			return conn.SendUint16(int(w))
+		}
+	}
+	for _, g := range c.Gates {
+		if err := conn.SendByte(byte(g.Op)); err != nil {
+			return err
+		}
+		if err := sendWire(g.Input0); err != nil {
+			return err
+		}
+		if g.Op != INV {
+			if err := sendWire(g.Input1); err != nil {
+				return err
+			}
+		}
+		if err := sendWire(g.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func receiveTemplate(conn *p2p.Conn) (*streamTemplate, error) {
+	numInputs, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	numOutputs, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	numWires, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	numGates, err := conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	if numInputs+numOutputs > numWires {
+		return nil, fmt.Errorf("invalid template: %d+%d wires > %d",
+			numInputs, numOutputs, numWires)
+	}
+	recvWire := conn.ReceiveUint32
+	if numWires <= 0x10000 {
+		recvWire = conn.ReceiveUint16
+	}
+	wire := func() (Wire, error) {
+		w, err := recvWire()
+		if err != nil {
+			return 0, err
+		}
+		if w >= numWires {
+			return 0, fmt.Errorf("invalid template: wire %d >= %d",
+				w, numWires)
+		}
+		return Wire(w), nil
+	}
+
+	gates := make([]Gate, numGates)
+	for i := range gates {
+		g := &gates[i]
+		op, err := conn.ReceiveByte()
+		if err != nil {
+			return nil, err
+		}
+		g.Op = Operation(op)
+		switch g.Op {
+		case XOR, XNOR, AND, OR, INV:
+		default:
+			return nil, fmt.Errorf("invalid template: operation %s", g.Op)
+		}
+		g.Input0, err = wire()
+		if err != nil {
+			return nil, err
+		}
+		if g.Op != INV {
+			g.Input1, err = wire()
+			if err != nil {
+				return nil, err
+			}
+		}
+		g.Output, err = wire()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &streamTemplate{
+		circ: &Circuit{
+			NumGates: numGates,
+			NumWires: numWires,
+			Gates:    gates,
+		},
+		numInputs:  numInputs,
+		numOutputs: numOutputs,
+	}, nil
+}
+
+// receiveWires receives count wire IDs and appends them to wires. The
+// wire IDs must be smaller than numWires.
+func receiveWires(conn *p2p.Conn, wires []Wire, count, numWires int) (
+	[]Wire, error) {
+
+	for i := 0; i < count; i++ {
+		w, err := conn.ReceiveUint32()
+		if err != nil {
+			return nil, err
+		}
+		if w >= numWires {
+			return nil, fmt.Errorf("invalid wire ID %d >= %d", w, numWires)
+		}
+		wires = append(wires, Wire(w))
+	}
+	return wires, nil
+}
@@ -0,0 +1,247 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// The three-halves garbling scheme is from Rosulek and Roy: "Three
+// Halves Make a Whole? Beating the Half-Gates Lower Bound for Garbled
+// Circuits", CRYPTO 2021.
+//
+// The labels are split into the left (D0) and right (D1) halves. The
+// evaluator with the input labels A and B of the color row ij
+// computes the output label halves as:
+//
+//	C_L = H(A) ⊕ H(A⊕B) ⊕ G_L(ij) ⊕ M_L(ij, r) · [A_L A_R B_L B_R]
+//	C_R = H(B) ⊕ H(A⊕B) ⊕ G_R(ij) ⊕ M_R(ij, r) · [A_L A_R B_L B_R]
+//
+// where G(ij) selects a combination of the garbled table halves G0,
+// G1, and G2, and M(ij, r) is a linear combination of the input label
+// halves, selected by the row's 2 control bits r. The garbler picks
+// the control bits of the rows randomly so that the evaluator does
+// not learn its truth table row from them, and encrypts them with the
+// hashes of the input labels so that the evaluator learns only the
+// control bits of its row. The garbled table has three label halves
+// and 8 control bits.
+
+// threeHalvesBeta specifies the control bit offsets of the rows when
+// the B input label's color bit is set.
+var threeHalvesBeta = [4]int{0, 2, 3, 1}
+
+// threeHalvesLinear computes the linear combination of the input
+// label halves for the color row and control bits.
+func threeHalvesLinear(row, ctrl int, a, b ot.Label) ot.Label {
+	var l ot.Label
+
+	switch ctrl {
+	case 1:
+		l.D0 = a.D0 ^ a.D1 ^ b.D1
+		l.D1 = a.D1 ^ b.D0
+	case 2:
+		l.D0 = a.D0 ^ b.D0 ^ b.D1
+		l.D1 = a.D0 ^ a.D1 ^ b.D1
+	case 3:
+		l.D0 = a.D1 ^ b.D0
+		l.D1 = a.D0 ^ b.D0 ^ b.D1
+	}
+	if row&2 != 0 {
+		l.D0 ^= b.D0
+	}
+	if row&1 != 0 {
+		l.D1 ^= a.D1
+	}
+	return l
+}
+
+// garbleThreeHalves garbles the AND gate with the input wires a and b
+// and returns the output wire and the garbled table. The gate
+// consumes three tweak IDs, starting from id.
+func garbleThreeHalves(alg cipher.Block, a, b ot.Wire, r ot.Label,
+	id uint32, data *ot.LabelData) (ot.Wire, ot.Label, ot.Label) {
+
+	alpha := idxUnary(a.L0)
+	beta := idxUnary(b.L0)
+
+	la := [2]ot.Label{a.L0, a.L1}
+	lb := [2]ot.Label{b.L0, b.L1}
+	ha := [2]ot.Label{
+		encryptHalf(alg, a.L0, id, data),
+		encryptHalf(alg, a.L1, id, data),
+	}
+	hb := [2]ot.Label{
+		encryptHalf(alg, b.L0, id+1, data),
+		encryptHalf(alg, b.L1, id+1, data),
+	}
+	ab := a.L0
+	ab.Xor(b.L0)
+	var hab [2]ot.Label
+	hab[0] = encryptHalf(alg, ab, id+2, data)
+	ab.Xor(r)
+	hab[1] = encryptHalf(alg, ab, id+2, data)
+
+	// The random control bits. The evaluator knows only one of
+	// H(A0) and H(A1) and these hash bits are not used elsewhere.
+	random := int((ha[0].D1^ha[1].D1)>>8) & 3
+
+	var x [4]ot.Label
+	var ctrl uint64
+
+	for row := 0; row < 4; row++ {
+		va := (row >> 1) ^ alpha
+		vb := (row & 1) ^ beta
+
+		c := random
+		if alpha == 1 {
+			c ^= row
+		}
+		if beta == 1 {
+			c ^= threeHalvesBeta[row]
+		}
+		pad := (ha[va].D1 ^ hb[vb].D1) >> (2 * row)
+		ctrl |= ((uint64(c) ^ pad) & 3) << (2 * row)
+
+		l := threeHalvesLinear(row, c, la[va], lb[vb])
+		l.D0 ^= ha[va].D0 ^ hab[va^vb].D0
+		l.D1 ^= hb[vb].D0 ^ hab[va^vb].D0
+		if va&vb == 1 {
+			l.Xor(r)
+		}
+		x[row] = l
+	}
+
+	l0 := x[0]
+	l1 := l0
+	l1.Xor(r)
+
+	t0 := ot.Label{
+		D0: x[0].D0 ^ x[1].D0,
+		D1: x[0].D1 ^ x[1].D1,
+	}
+	t1 := ot.Label{
+		D0: x[0].D0 ^ x[2].D0,
+		D1: ctrl,
+	}
+	return ot.Wire{
+		L0: l0,
+		L1: l1,
+	}, t0, t1
+}
+
+// evalThreeHalves evaluates the AND gate with the input labels a and
+// b and the garbled table t0 and t1.
+func evalThreeHalves(alg cipher.Block, a, b, t0, t1 ot.Label, id uint32,
+	data *ot.LabelData) ot.Label {
+
+	row := idx(a, b)
+
+	ha := encryptHalf(alg, a, id, data)
+	hb := encryptHalf(alg, b, id+1, data)
+	ab := a
+	ab.Xor(b)
+	hab := encryptHalf(alg, ab, id+2, data)
+
+	ctrl := int((t1.D1^ha.D1^hb.D1)>>(2*row)) & 3
+
+	c := threeHalvesLinear(row, ctrl, a, b)
+	c.D0 ^= ha.D0 ^ hab.D0
+	c.D1 ^= hb.D0 ^ hab.D0
+
+	switch row {
+	case 1:
+		c.D0 ^= t0.D0
+		c.D1 ^= t0.D1
+	case 2:
+		c.D0 ^= t1.D0
+		c.D1 ^= t0.D0
+	case 3:
+		c.D0 ^= t0.D0 ^ t1.D0
+		c.D1 ^= t0.D0 ^ t0.D1
+	}
+	return c
+}
+
+// garbleThreeHalvesOp garbles the AND, OR, or INV operation with the
+// input wires a and b and returns the output wire and the garbled
+// table. OR is garbled as AND of the inverted inputs and output, and
+// INV is free and has no garbled table.
+func garbleThreeHalvesOp(alg cipher.Block, op Operation, a, b ot.Wire,
+	r ot.Label, idp *uint32, data *ot.LabelData) (
+	c ot.Wire, t0, t1 ot.Label, err error) {
+
+	switch op {
+	case AND, OR:
+		if op == OR {
+			a.L0, a.L1 = a.L1, a.L0
+			b.L0, b.L1 = b.L1, b.L0
+		}
+		c, t0, t1 = garbleThreeHalves(alg, a, b, r, *idp, data)
+		*idp = *idp + 3
+		if op == OR {
+			c.L0, c.L1 = c.L1, c.L0
+		}
+
+	case INV:
+		c = ot.Wire{
+			L0: a.L1,
+			L1: a.L0,
+		}
+
+	default:
+		err = fmt.Errorf("invalid gate type %s", op)
+	}
+	return
+}
+
+// garbleThreeHalves garbles the AND, OR, and INV gates with the
+// three-halves scheme.
+func (g *Gate) garbleThreeHalves(wires []ot.Wire, enc cipher.Block,
+	r ot.Label, idp *uint32, data *ot.LabelData) ([]ot.Label, error) {
+
+	var b ot.Wire
+	if g.Op != INV {
+		b = wires[g.Input1]
+	}
+	c, t0, t1, err := garbleThreeHalvesOp(enc, g.Op, wires[g.Input0], b, r,
+		idp, data)
+	if err != nil {
+		return nil, err
+	}
+	wires[g.Output] = c
+
+	if g.Op == INV {
+		return nil, nil
+	}
+	return []ot.Label{t0, t1}, nil
+}
+
+// evalThreeHalves evaluates the AND, OR, and INV gates with the
+// three-halves scheme.
+func (g *Gate) evalThreeHalves(alg cipher.Block, wires []ot.Label,
+	row []ot.Label, id uint32, data *ot.LabelData) error {
+
+	switch g.Op {
+	case AND, OR:
+		if len(row) != 2 {
+			return fmt.Errorf("corrupted circuit: %s row length: %d",
+				g.Op, len(row))
+		}
+		wires[g.Output] = evalThreeHalves(alg, wires[g.Input0],
+			wires[g.Input1], row[0], row[1], id, data)
+
+	case INV:
+		wires[g.Output] = wires[g.Input0]
+
+	default:
+		return fmt.Errorf("invalid operation %s", g.Op)
+	}
+	return nil
+}
@@ -0,0 +1,1117 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// ParseVerilog parses a gate-level structural Verilog netlist, such
+// as the one that yosys `write_verilog -noattr` emits after technology
+// mapping with `abc -g`. The netlist must contain one module. The
+// module input and output ports become the circuit inputs and
+// outputs in the order they are listed in the module header. The
+// nets are driven by `assign` statements with the bitwise operators
+// ~, &, |, and ^, or by the yosys internal gate cells `$_AND_`,
+// `$_OR_`, `$_XOR_`, `$_NOT_`, and their variants. The expressions
+// and the assignment targets can use bit selects `a[n]`, part
+// selects `a[m:n]`, concatenations `{a, b}`, and replications
+// `{n{a}}`.
+func ParseVerilog(in io.Reader) (*Circuit, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	p := &verilogParser{
+		lexer: &verilogLexer{
+			data: data,
+			line: 1,
+		},
+		nets:    make(map[string]*verilogNet),
+		drivers: make(map[string]*verilogExpr),
+	}
+	if err := p.parseModule(); err != nil {
+		return nil, err
+	}
+	return p.circuit()
+}
+
+type verilogTokenType int
+
+const (
+	vtEOF verilogTokenType = iota
+	vtIdent
+	vtNumber
+	vtPunct
+)
+
+type verilogToken struct {
+	t    verilogTokenType
+	val  string
+	line int
+}
+
+func (t *verilogToken) String() string {
+	if t.t == vtEOF {
+		return "EOF"
+	}
+	return t.val
+}
+
+type verilogLexer struct {
+	data  []byte
+	pos   int
+	line  int
+	ungot *verilogToken
+}
+
+func (l *verilogLexer) unget(t *verilogToken) {
+	l.ungot = t
+}
+
+func (l *verilogLexer) get() (*verilogToken, error) {
+	if l.ungot != nil {
+		t := l.ungot
+		l.ungot = nil
+		return t, nil
+	}
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+
+		case c == '/' && l.peek(1) == '/':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+
+		case c == '/' && l.peek(1) == '*':
+			if err := l.skipUntil("*/"); err != nil {
+				return nil, err
+			}
+
+		case c == '(' && l.peek(1) == '*':
+			// Attribute.
+			if err := l.skipUntil("*)"); err != nil {
+				return nil, err
+			}
+
+		case c == '\\':
+			// Escaped identifier ends at whitespace.
+			start := l.pos + 1
+			for l.pos < len(l.data) && !isVerilogSpace(l.data[l.pos]) {
+				l.pos++
+			}
+			return l.token(vtIdent, string(l.data[start:l.pos])), nil
+
+		case isVerilogIdentStart(c):
+			start := l.pos
+			for l.pos < len(l.data) && isVerilogIdent(l.data[l.pos]) {
+				l.pos++
+			}
+			return l.token(vtIdent, string(l.data[start:l.pos])), nil
+
+		case c >= '0' && c <= '9' || c == '\'':
+			start := l.pos
+			for l.pos < len(l.data) && (isVerilogIdent(l.data[l.pos]) ||
+				l.data[l.pos] == '\'') {
+				l.pos++
+			}
+			return l.token(vtNumber, string(l.data[start:l.pos])), nil
+
+		default:
+			l.pos++
+			if (c == '~' && l.peek(0) == '^') ||
+				(c == '^' && l.peek(0) == '~') {
+				l.pos++
+				return l.token(vtPunct, "~^"), nil
+			}
+			return l.token(vtPunct, string([]byte{c})), nil
+		}
+	}
+	return l.token(vtEOF, ""), nil
+}
+
+func (l *verilogLexer) token(t verilogTokenType, val string) *verilogToken {
+	return &verilogToken{
+		t:    t,
+		val:  val,
+		line: l.line,
+	}
+}
+
+func (l *verilogLexer) peek(ofs int) byte {
+	if l.pos+ofs < len(l.data) {
+		return l.data[l.pos+ofs]
+	}
+	return 0
+}
+
+func (l *verilogLexer) skipUntil(end string) error {
+	idx := strings.Index(string(l.data[l.pos+2:]), end)
+	if idx < 0 {
+		return fmt.Errorf("%d: unterminated comment", l.line)
+	}
+	for _, c := range l.data[l.pos : l.pos+2+idx] {
+		if c == '\n' {
+			l.line++
+		}
+	}
+	l.pos += 2 + idx + len(end)
+	return nil
+}
+
+func isVerilogSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isVerilogIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' ||
+		c == '$'
+}
+
+func isVerilogIdent(c byte) bool {
+	return isVerilogIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// verilogNet describes a declared net.
+type verilogNet struct {
+	name   string
+	dir    string
+	vector bool
+	msb    int
+	lsb    int
+}
+
+// Width returns the net width in bits.
+func (n *verilogNet) Width() int {
+	if !n.vector {
+		return 1
+	}
+	if n.msb >= n.lsb {
+		return n.msb - n.lsb + 1
+	}
+	return n.lsb - n.msb + 1
+}
+
+// Key returns the name of the net's bit, counted from its least
+// significant bit.
+func (n *verilogNet) Key(bit int) string {
+	if !n.vector {
+		return n.name
+	}
+	if n.msb >= n.lsb {
+		return fmt.Sprintf("%s[%d]", n.name, n.lsb+bit)
+	}
+	return fmt.Sprintf("%s[%d]", n.name, n.lsb-bit)
+}
+
+// Contains tests if the index is in the net's range.
+func (n *verilogNet) Contains(index int) bool {
+	if n.msb >= n.lsb {
+		return index >= n.lsb && index <= n.msb
+	}
+	return index >= n.msb && index <= n.lsb
+}
+
+type verilogOp int
+
+const (
+	veRef verilogOp = iota
+	veConst
+	veNot
+	veAnd
+	veOr
+	veXor
+	veXnor
+	veConcat
+)
+
+// verilogExpr implements expressions of the assign statements and
+// cell connections. The references select the bit index or the part
+// msb:lsb of their nets. The concatenations list their elements from
+// the most significant element.
+type verilogExpr struct {
+	op       verilogOp
+	x, y     *verilogExpr
+	elems    []*verilogExpr
+	name     string
+	index    int
+	part     bool
+	msb, lsb int
+	value    *big.Int
+	size     int
+}
+
+// keys returns the names of the net bits the reference selects,
+// counted from the least significant bit.
+func (e *verilogExpr) keys(p *verilogParser) ([]string, error) {
+	net, ok := p.nets[e.name]
+	if !ok {
+		return nil, fmt.Errorf("undefined net %s", e.name)
+	}
+	var keys []string
+	if e.index < 0 && !e.part {
+		for bit := 0; bit < net.Width(); bit++ {
+			keys = append(keys, net.Key(bit))
+		}
+		return keys, nil
+	}
+	if !net.vector {
+		return nil, fmt.Errorf("indexing scalar net %s", e.name)
+	}
+	if !e.part {
+		return append(keys, fmt.Sprintf("%s[%d]", e.name, e.index)), nil
+	}
+	if !net.Contains(e.msb) || !net.Contains(e.lsb) ||
+		(e.msb != e.lsb && (e.msb > e.lsb) != (net.msb > net.lsb)) {
+		return nil, fmt.Errorf("invalid part select %s[%d:%d]",
+			e.name, e.msb, e.lsb)
+	}
+	if e.msb >= e.lsb {
+		for i := e.lsb; i <= e.msb; i++ {
+			keys = append(keys, fmt.Sprintf("%s[%d]", e.name, i))
+		}
+	} else {
+		for i := e.lsb; i >= e.msb; i-- {
+			keys = append(keys, fmt.Sprintf("%s[%d]", e.name, i))
+		}
+	}
+	return keys, nil
+}
+
+// width returns the expression width in bits. The concatenation
+// elements must have a width so the unsized constants are errors.
+func (e *verilogExpr) width(p *verilogParser) (int, error) {
+	switch e.op {
+	case veRef:
+		keys, err := e.keys(p)
+		return len(keys), err
+
+	case veConst:
+		if e.size == 0 {
+			return 0, fmt.Errorf("unsized constant %s in concatenation",
+				e.value)
+		}
+		return e.size, nil
+
+	case veNot:
+		return e.x.width(p)
+
+	case veConcat:
+		var result int
+		for _, el := range e.elems {
+			w, err := el.width(p)
+			if err != nil {
+				return 0, err
+			}
+			result += w
+		}
+		return result, nil
+
+	default:
+		x, err := e.x.width(p)
+		if err != nil {
+			return 0, err
+		}
+		y, err := e.y.width(p)
+		if err != nil {
+			return 0, err
+		}
+		if x > y {
+			return x, nil
+		}
+		return y, nil
+	}
+}
+
+// bit resolves the expression for the bit of a multi-bit
+// assignment. The references select the bit from their nets and the
+// concatenations from their elements.
+func (e *verilogExpr) bit(p *verilogParser, bit int) (*verilogExpr, error) {
+	switch e.op {
+	case veRef:
+		keys, err := e.keys(p)
+		if err != nil {
+			return nil, err
+		}
+		if bit >= len(keys) {
+			return p.constant(0), nil
+		}
+		return &verilogExpr{
+			op:   veRef,
+			name: keys[bit],
+		}, nil
+
+	case veConst:
+		return p.constant(e.value.Bit(bit)), nil
+
+	case veConcat:
+		for i := len(e.elems) - 1; i >= 0; i-- {
+			w, err := e.elems[i].width(p)
+			if err != nil {
+				return nil, err
+			}
+			if bit < w {
+				return e.elems[i].bit(p, bit)
+			}
+			bit -= w
+		}
+		return p.constant(0), nil
+
+	default:
+		result := &verilogExpr{
+			op: e.op,
+		}
+		var err error
+		result.x, err = e.x.bit(p, bit)
+		if err != nil {
+			return nil, err
+		}
+		if e.y != nil {
+			result.y, err = e.y.bit(p, bit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+}
+
+type verilogParser struct {
+	lexer   *verilogLexer
+	name    string
+	ports   []string
+	nets    map[string]*verilogNet
+	drivers map[string]*verilogExpr
+
+	builder  *builder
+	wires    map[string]Wire
+	visiting map[string]bool
+}
+
+func (p *verilogParser) errorf(t *verilogToken, format string,
+	a ...interface{}) error {
+	return fmt.Errorf("%d: %s", t.line, fmt.Sprintf(format, a...))
+}
+
+func (p *verilogParser) constant(v uint) *verilogExpr {
+	return &verilogExpr{
+		op:    veConst,
+		value: big.NewInt(int64(v)),
+		size:  1,
+	}
+}
+
+func (p *verilogParser) need(val string) (*verilogToken, error) {
+	t, err := p.lexer.get()
+	if err != nil {
+		return nil, err
+	}
+	if t.val != val || t.t == vtEOF {
+		return nil, p.errorf(t, "unexpected %s: expected %s", t, val)
+	}
+	return t, nil
+}
+
+func (p *verilogParser) ident() (*verilogToken, error) {
+	t, err := p.lexer.get()
+	if err != nil {
+		return nil, err
+	}
+	if t.t != vtIdent {
+		return nil, p.errorf(t, "unexpected %s: expected identifier", t)
+	}
+	return t, nil
+}
+
+func (p *verilogParser) integer() (int, error) {
+	t, err := p.lexer.get()
+	if err != nil {
+		return 0, err
+	}
+	if t.t != vtNumber {
+		return 0, p.errorf(t, "unexpected %s: expected number", t)
+	}
+	v, err := strconv.Atoi(t.val)
+	if err != nil {
+		return 0, p.errorf(t, "invalid number %s", t)
+	}
+	return v, nil
+}
+
+func (p *verilogParser) parseModule() error {
+	t, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if t.val != "module" {
+		return p.errorf(t, "unexpected %s: expected module", t)
+	}
+	t, err = p.ident()
+	if err != nil {
+		return err
+	}
+	p.name = t.val
+
+	// Port list.
+	if _, err := p.need("("); err != nil {
+		return err
+	}
+	for {
+		t, err = p.lexer.get()
+		if err != nil {
+			return err
+		}
+		if t.val == ")" && len(p.ports) == 0 {
+			break
+		}
+		if t.t != vtIdent {
+			return p.errorf(t, "unexpected %s: expected port name", t)
+		}
+		p.ports = append(p.ports, t.val)
+
+		t, err = p.lexer.get()
+		if err != nil {
+			return err
+		}
+		if t.val == ")" {
+			break
+		}
+		if t.val != "," {
+			return p.errorf(t, "unexpected %s in port list", t)
+		}
+	}
+	if _, err := p.need(";"); err != nil {
+		return err
+	}
+
+	for {
+		t, err = p.lexer.get()
+		if err != nil {
+			return err
+		}
+		if t.t != vtIdent {
+			return p.errorf(t, "unexpected %s", t)
+		}
+		switch t.val {
+		case "endmodule":
+			return nil
+
+		case "input", "output", "wire":
+			err = p.parseDecl(t.val)
+
+		case "assign":
+			err = p.parseAssign()
+
+		case "inout", "reg", "always", "initial":
+			return p.errorf(t, "%s not supported in structural netlists", t)
+
+		default:
+			err = p.parseCell(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *verilogParser) parseDecl(kind string) error {
+	net := &verilogNet{}
+
+	t, err := p.lexer.get()
+	if err != nil {
+		return err
+	}
+	if t.val == "[" {
+		net.vector = true
+		net.msb, err = p.integer()
+		if err != nil {
+			return err
+		}
+		if _, err := p.need(":"); err != nil {
+			return err
+		}
+		net.lsb, err = p.integer()
+		if err != nil {
+			return err
+		}
+		if _, err := p.need("]"); err != nil {
+			return err
+		}
+	} else {
+		p.lexer.unget(t)
+	}
+	for {
+		t, err = p.ident()
+		if err != nil {
+			return err
+		}
+		n, ok := p.nets[t.val]
+		if !ok {
+			n = &verilogNet{
+				name:   t.val,
+				vector: net.vector,
+				msb:    net.msb,
+				lsb:    net.lsb,
+			}
+			p.nets[t.val] = n
+		} else if n.vector != net.vector || n.msb != net.msb ||
+			n.lsb != net.lsb {
+			return p.errorf(t, "net %s redeclared with different range", t)
+		}
+		if kind != "wire" {
+			if len(n.dir) > 0 {
+				return p.errorf(t, "port %s redeclared", t)
+			}
+			n.dir = kind
+		}
+
+		t, err = p.lexer.get()
+		if err != nil {
+			return err
+		}
+		if t.val == ";" {
+			return nil
+		}
+		if t.val != "," {
+			return p.errorf(t, "unexpected %s in declaration", t)
+		}
+	}
+}
+
+func (p *verilogParser) parseAssign() error {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return err
+	}
+	t, err := p.need("=")
+	if err != nil {
+		return err
+	}
+	rhs, err := p.parseExpr()
+	if err != nil {
+		return err
+	}
+	if _, err := p.need(";"); err != nil {
+		return err
+	}
+	return p.drive(t, lhs, rhs)
+}
+
+// drive sets the expression rhs as the driver of the net bits lhs.
+func (p *verilogParser) drive(t *verilogToken, lhs, rhs *verilogExpr) error {
+	keys, err := p.targets(lhs)
+	if err != nil {
+		return p.errorf(t, "%s", err)
+	}
+	for bit, key := range keys {
+		if _, ok := p.drivers[key]; ok {
+			return p.errorf(t, "net %s has multiple drivers", key)
+		}
+		e, err := rhs.bit(p, bit)
+		if err != nil {
+			return p.errorf(t, "%s", err)
+		}
+		p.drivers[key] = e
+	}
+	return nil
+}
+
+// targets returns the net bits the assignment target lhs drives,
+// counted from the least significant bit.
+func (p *verilogParser) targets(lhs *verilogExpr) ([]string, error) {
+	switch lhs.op {
+	case veRef:
+		net, ok := p.nets[lhs.name]
+		if ok && net.dir == "input" {
+			return nil, fmt.Errorf("assignment to input %s", lhs.name)
+		}
+		return lhs.keys(p)
+
+	case veConcat:
+		var result []string
+		for i := len(lhs.elems) - 1; i >= 0; i-- {
+			keys, err := p.targets(lhs.elems[i])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, keys...)
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("invalid assignment target")
+	}
+}
+
+// parseCell parses yosys internal gate cell instances:
+//
+//	\$_AND_ _1_ (.A(a), .B(b), .Y(y));
+func (p *verilogParser) parseCell(cell *verilogToken) error {
+	if _, err := p.ident(); err != nil {
+		return err
+	}
+	if _, err := p.need("("); err != nil {
+		return err
+	}
+	conns := make(map[string]*verilogExpr)
+	for {
+		if _, err := p.need("."); err != nil {
+			return err
+		}
+		port, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if _, err := p.need("("); err != nil {
+			return err
+		}
+		e, err := p.parseExpr()
+		if err != nil {
+			return err
+		}
+		if _, err := p.need(")"); err != nil {
+			return err
+		}
+		conns[port.val] = e
+
+		t, err := p.lexer.get()
+		if err != nil {
+			return err
+		}
+		if t.val == ")" {
+			break
+		}
+		if t.val != "," {
+			return p.errorf(t, "unexpected %s in cell connections", t)
+		}
+	}
+	if _, err := p.need(";"); err != nil {
+		return err
+	}
+
+	var op verilogOp
+	var invert, invertB, unary bool
+	switch cell.val {
+	case "$_BUF_":
+		unary = true
+	case "$_NOT_":
+		unary = true
+		invert = true
+	case "$_AND_":
+		op = veAnd
+	case "$_NAND_":
+		op = veAnd
+		invert = true
+	case "$_OR_":
+		op = veOr
+	case "$_NOR_":
+		op = veOr
+		invert = true
+	case "$_XOR_":
+		op = veXor
+	case "$_XNOR_":
+		op = veXnor
+	case "$_ANDNOT_":
+		op = veAnd
+		invertB = true
+	case "$_ORNOT_":
+		op = veOr
+		invertB = true
+	default:
+		return p.errorf(cell, "unsupported cell %s", cell)
+	}
+
+	a, ok := conns["A"]
+	if !ok {
+		return p.errorf(cell, "cell %s: input A not connected", cell)
+	}
+	y, ok := conns["Y"]
+	if !ok || y.op != veRef {
+		return p.errorf(cell, "cell %s: invalid output Y", cell)
+	}
+	e := a
+	if !unary {
+		b, ok := conns["B"]
+		if !ok {
+			return p.errorf(cell, "cell %s: input B not connected", cell)
+		}
+		if invertB {
+			b = &verilogExpr{
+				op: veNot,
+				x:  b,
+			}
+		}
+		e = &verilogExpr{
+			op: op,
+			x:  a,
+			y:  b,
+		}
+	}
+	if invert {
+		e = &verilogExpr{
+			op: veNot,
+			x:  e,
+		}
+	}
+	return p.drive(cell, y, e)
+}
+
+func (p *verilogParser) parseExpr() (*verilogExpr, error) {
+	return p.parseBinary(0)
+}
+
+var verilogBinaryOps = []map[string]verilogOp{
+	{"|": veOr},
+	{"^": veXor, "~^": veXnor},
+	{"&": veAnd},
+}
+
+func (p *verilogParser) parseBinary(level int) (*verilogExpr, error) {
+	if level >= len(verilogBinaryOps) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.lexer.get()
+		if err != nil {
+			return nil, err
+		}
+		op, ok := verilogBinaryOps[level][t.val]
+		if !ok || t.t != vtPunct {
+			p.lexer.unget(t)
+			return x, nil
+		}
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &verilogExpr{
+			op: op,
+			x:  x,
+			y:  y,
+		}
+	}
+}
+
+func (p *verilogParser) parseUnary() (*verilogExpr, error) {
+	t, err := p.lexer.get()
+	if err != nil {
+		return nil, err
+	}
+	if t.val == "~" {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &verilogExpr{
+			op: veNot,
+			x:  x,
+		}, nil
+	}
+	p.lexer.unget(t)
+	return p.parsePrimary()
+}
+
+func (p *verilogParser) parsePrimary() (*verilogExpr, error) {
+	t, err := p.lexer.get()
+	if err != nil {
+		return nil, err
+	}
+	switch t.t {
+	case vtIdent:
+		e := &verilogExpr{
+			op:    veRef,
+			name:  t.val,
+			index: -1,
+		}
+		n, err := p.lexer.get()
+		if err != nil {
+			return nil, err
+		}
+		if n.val != "[" {
+			p.lexer.unget(n)
+			return e, nil
+		}
+		e.index, err = p.integer()
+		if err != nil {
+			return nil, err
+		}
+		n, err = p.lexer.get()
+		if err != nil {
+			return nil, err
+		}
+		if n.val == ":" {
+			e.part = true
+			e.msb = e.index
+			e.lsb, err = p.integer()
+			if err != nil {
+				return nil, err
+			}
+			e.index = -1
+		} else {
+			p.lexer.unget(n)
+		}
+		if _, err := p.need("]"); err != nil {
+			return nil, err
+		}
+		return e, nil
+
+	case vtNumber:
+		return p.parseNumber(t)
+
+	case vtPunct:
+		if t.val == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.need(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+		if t.val == "{" {
+			return p.parseConcat()
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s in expression", t)
+}
+
+// parseConcat parses the concatenation {a, b} or the replication
+// {n{a}} after the opening brace.
+func (p *verilogParser) parseConcat() (*verilogExpr, error) {
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.lexer.get()
+	if err != nil {
+		return nil, err
+	}
+	if t.val == "{" {
+		if e.op != veConst || !e.value.IsInt64() || e.value.Int64() <= 0 {
+			return nil, p.errorf(t, "invalid replication count")
+		}
+		el, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.need("}"); err != nil {
+			return nil, err
+		}
+		result := &verilogExpr{
+			op: veConcat,
+		}
+		for i := int64(0); i < e.value.Int64(); i++ {
+			result.elems = append(result.elems, el)
+		}
+		return result, nil
+	}
+	result := &verilogExpr{
+		op:    veConcat,
+		elems: []*verilogExpr{e},
+	}
+	for t.val != "}" {
+		if t.val != "," {
+			return nil, p.errorf(t, "unexpected %s in concatenation", t)
+		}
+		e, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		result.elems = append(result.elems, e)
+
+		t, err = p.lexer.get()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (p *verilogParser) parseNumber(t *verilogToken) (*verilogExpr, error) {
+	val := t.val
+	base := 10
+	var size int
+	idx := strings.IndexByte(val, '\'')
+	if idx >= 0 {
+		if idx+1 >= len(val) {
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		if idx > 0 {
+			var err error
+			size, err = strconv.Atoi(val[:idx])
+			if err != nil || size <= 0 {
+				return nil, p.errorf(t, "invalid number %s", t)
+			}
+		}
+		switch val[idx+1] {
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		case 'd', 'D':
+			base = 10
+		case 'h', 'H':
+			base = 16
+		default:
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		val = val[idx+2:]
+	}
+	v, ok := new(big.Int).SetString(strings.ReplaceAll(val, "_", ""), base)
+	if !ok {
+		return nil, p.errorf(t, "invalid number %s", t)
+	}
+	return &verilogExpr{
+		op:    veConst,
+		value: v,
+		size:  size,
+	}, nil
+}
+
+// circuit creates the circuit from the parsed netlist.
+func (p *verilogParser) circuit() (*Circuit, error) {
+	var inputs, outputs IO
+	var inputNets, outputNets []*verilogNet
+
+	for _, port := range p.ports {
+		net, ok := p.nets[port]
+		if !ok || len(net.dir) == 0 {
+			return nil, fmt.Errorf("port %s direction not declared", port)
+		}
+		arg := IOArg{
+			Name: port,
+			Type: types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(net.Width()),
+			},
+		}
+		if net.dir == "input" {
+			inputs = append(inputs, arg)
+			inputNets = append(inputNets, net)
+		} else {
+			outputs = append(outputs, arg)
+			outputNets = append(outputNets, net)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("module %s: no inputs defined", p.name)
+	}
+
+	var numInputs int
+	for _, net := range inputNets {
+		numInputs += net.Width()
+	}
+	p.builder = newBuilder(numInputs)
+	p.wires = make(map[string]Wire)
+	p.visiting = make(map[string]bool)
+
+	var w Wire
+	for _, net := range inputNets {
+		for bit := 0; bit < net.Width(); bit++ {
+			p.wires[net.Key(bit)] = w
+			w++
+		}
+	}
+
+	// Generate the gates driving the output bits.
+	var results []Wire
+	for _, net := range outputNets {
+		for bit := 0; bit < net.Width(); bit++ {
+			w, err := p.wire(net.Key(bit))
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, w)
+		}
+	}
+
+	return p.builder.circuit(inputs, outputs, results), nil
+}
+
+// wire returns the wire holding the value of the net bit key,
+// generating its driver gates on demand.
+func (p *verilogParser) wire(key string) (Wire, error) {
+	w, ok := p.wires[key]
+	if ok {
+		return w, nil
+	}
+	driver, ok := p.drivers[key]
+	if !ok {
+		return 0, fmt.Errorf("net %s is not driven", key)
+	}
+	if p.visiting[key] {
+		return 0, fmt.Errorf("combinational loop at net %s", key)
+	}
+	p.visiting[key] = true
+	w, err := p.expr(driver)
+	if err != nil {
+		return 0, err
+	}
+	delete(p.visiting, key)
+	p.wires[key] = w
+	return w, nil
+}
+
+func (p *verilogParser) expr(e *verilogExpr) (Wire, error) {
+	switch e.op {
+	case veRef:
+		return p.wire(e.name)
+
+	case veConst:
+		return p.builder.constant(e.value.Bit(0)), nil
+
+	case veNot:
+		x, err := p.expr(e.x)
+		if err != nil {
+			return 0, err
+		}
+		return p.builder.gate(INV, x, 0), nil
+
+	default:
+		x, err := p.expr(e.x)
+		if err != nil {
+			return 0, err
+		}
+		y, err := p.expr(e.y)
+		if err != nil {
+			return 0, err
+		}
+		var op Operation
+		switch e.op {
+		case veAnd:
+			op = AND
+		case veOr:
+			op = OR
+		case veXor:
+			op = XOR
+		case veXnor:
+			op = XNOR
+		default:
+			return 0, fmt.Errorf("invalid expression %v", e.op)
+		}
+		return p.builder.gate(op, x, y), nil
+	}
+}
@@ -0,0 +1,147 @@
+//
+// verilog_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuit
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+var verilogNetlist = `/* Generated by Yosys */
+
+module test(a, b, c, y, z, w);
+  wire _0_;
+  wire _1_;
+  wire [1:0] t;
+  input [1:0] a;
+  wire [1:0] a;
+  input [1:0] b;
+  input c;
+  output [1:0] y;
+  output z;
+  output [2:0] w;
+  // Assignments are not in topological order.
+  assign y[1] = _1_ ^ _0_;
+  assign _0_ = a[0] & b[0];
+  assign y[0] = a[0] ^ b[0];
+  \$_XOR_  _2_ ( .A(a[1]), .B(b[1]), .Y(_1_) );
+  \$_NAND_ _3_ (
+    .A(y[1]),
+    .B(c),
+    .Y(z)
+  );
+  assign t = ~(a | b);
+  assign w = 3'b101 ^ c;
+endmodule
+`
+
+func TestParseVerilog(t *testing.T) {
+	circ, err := ParseVerilog(bytes.NewReader([]byte(verilogNetlist)))
+	if err != nil {
+		t.Fatalf("ParseVerilog failed: %s", err)
+	}
+	if len(circ.Inputs) != 3 || len(circ.Outputs) != 3 {
+		t.Fatalf("unexpected IO: %v -> %v", circ.Inputs, circ.Outputs)
+	}
+	for a := int64(0); a < 4; a++ {
+		for b := int64(0); b < 4; b++ {
+			for c := int64(0); c < 2; c++ {
+				out, err := circ.Compute([]*big.Int{
+					big.NewInt(a), big.NewInt(b), big.NewInt(c),
+				})
+				if err != nil {
+					t.Fatalf("Compute failed: %s", err)
+				}
+				y := (a + b) & 3
+				z := ^((y >> 1) & c) & 1
+				w := 5 ^ c
+				if out[0].Int64() != y || out[1].Int64() != z ||
+					out[2].Int64() != w {
+					t.Errorf("%d,%d,%d: got %v, expected [%d %d %d]",
+						a, b, c, out, y, z, w)
+				}
+			}
+		}
+	}
+}
+
+var verilogConcat = `
+module concat(a, b, y, z, w);
+  input [3:0] a;
+  input [1:0] b;
+  output [5:0] y;
+  output [3:0] z;
+  output [7:0] w;
+  wire [0:3] r;
+  wire hi, lo;
+  assign y = { b, a[3:2] ^ b, a[1:0] };
+  assign { hi, z[2:0], lo } = { a[3], a[2:0] & { 3 { b[0] } }, 1'b1 };
+  assign z[3] = hi ^ lo;
+  assign r = a;
+  assign w = { r[1:2], 2'b01, { 2 { b[1] } }, r[3], a[0] };
+endmodule
+`
+
+func TestParseVerilogConcat(t *testing.T) {
+	circ, err := ParseVerilog(bytes.NewReader([]byte(verilogConcat)))
+	if err != nil {
+		t.Fatalf("ParseVerilog failed: %s", err)
+	}
+	for a := int64(0); a < 16; a++ {
+		for b := int64(0); b < 4; b++ {
+			out, err := circ.Compute([]*big.Int{
+				big.NewInt(a), big.NewInt(b),
+			})
+			if err != nil {
+				t.Fatalf("Compute failed: %s", err)
+			}
+			y := b<<4 | ((a>>2)^b)<<2 | a&3
+			b0 := b & 1
+			z := ((a>>3)^1)<<3 | (a & (b0 | b0<<1 | b0<<2) & 7)
+			// The vector r is declared as [0:3] so r[0] is its most
+			// significant bit: r[1:2] holds a[2:1] and r[3] holds
+			// a[0].
+			b1 := b >> 1
+			w := (a>>1)&3<<6 | 1<<4 | (b1|b1<<1)<<2 | (a&1)<<1 | a&1
+			if out[0].Int64() != y || out[1].Int64() != z ||
+				out[2].Int64() != w {
+				t.Errorf("%d,%d: got %v, expected [%d %d %d]",
+					a, b, out, y, z, w)
+			}
+		}
+	}
+}
+
+func TestParseVerilogErrors(t *testing.T) {
+	for _, netlist := range []string{
+		"module m(a, y); input a; output y; assign y = x; endmodule",
+		"module m(a, y); input a; output y; endmodule",
+		"module m(a, y); input a; output y; wire t; " +
+			"assign t = y; assign y = t; endmodule",
+		"module m(a, y); input a; output y; " +
+			"assign y = a; assign y = ~a; endmodule",
+		"module m(a, y); input a; output y; always y = a; endmodule",
+		"module m(a, y); input [3:0] a; output [1:0] y; " +
+			"assign y = a[4:3]; endmodule",
+		"module m(a, y); input [3:0] a; output [1:0] y; " +
+			"assign y = a[0:1]; endmodule",
+		"module m(a, y); input a; output [1:0] y; " +
+			"assign y = { a, 1 }; endmodule",
+		"module m(a, y); input a; output [1:0] y; " +
+			"assign { a, y[0] } = 2'b11; assign y[1] = a; endmodule",
+		"module m(a, y); input a; output [1:0] y; " +
+			"assign y = { a, a; endmodule",
+	} {
+		_, err := ParseVerilog(bytes.NewReader([]byte(netlist)))
+		if err == nil {
+			t.Errorf("invalid netlist accepted: %s", netlist)
+		}
+	}
+}
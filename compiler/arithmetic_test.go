@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -127,12 +127,12 @@ func TestArithmetics(t *testing.T) {
 
 				go func() {
 					_, err := circuit.Garbler(p2p.NewConn(gio), ot.NewCO(),
-						circ, gInput, false)
+						circ, gInput, circuit.ThreeHalves, false)
 					gerr <- err
 				}()
 
 				result, err := circuit.Evaluator(p2p.NewConn(eio),
-					ot.NewCO(), circ, eInput, false)
+					ot.NewCO(), circ, eInput, circuit.ThreeHalves, false)
 				if err != nil {
 					t.Fatalf("Evaluator failed: %s\n", err)
 				}
@@ -180,12 +180,12 @@ func BenchmarkMult(b *testing.B) {
 
 	go func() {
 		_, err := circuit.Garbler(p2p.NewConn(gio), ot.NewCO(), circ, gInput,
-			false)
+			circuit.ThreeHalves, false)
 		gerr <- err
 	}()
 
 	_, err = circuit.Evaluator(p2p.NewConn(eio), ot.NewCO(), circ, eInput,
-		false)
+		circuit.ThreeHalves, false)
 	if err != nil {
 		b.Fatalf("Evaluator failed: %s\n", err)
 	}
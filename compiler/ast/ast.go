@@ -1,7 +1,7 @@
 //
 // ast.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -11,6 +11,7 @@ package ast
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -31,6 +32,9 @@ var (
 	_ AST = &Return{}
 	_ AST = &For{}
 	_ AST = &ForRange{}
+	_ AST = &Switch{}
+	_ AST = &Break{}
+	_ AST = &Continue{}
 	_ AST = &Binary{}
 	_ AST = &Unary{}
 	_ AST = &Slice{}
@@ -675,6 +679,65 @@ func (ast *ForRange) String() string {
 	return result
 }
 
+// Switch implements an AST switch statement.
+type Switch struct {
+	utils.Point
+	Init  AST
+	Expr  AST
+	Cases []*Case
+}
+
+func (ast *Switch) String() string {
+	result := "switch "
+	if ast.Init != nil {
+		result += ast.Init.String() + "; "
+	}
+	if ast.Expr != nil {
+		result += ast.Expr.String()
+	}
+	return result
+}
+
+// Case implements a switch statement case clause. The default clause
+// has no expressions.
+type Case struct {
+	utils.Point
+	Exprs []AST
+	Body  List
+}
+
+func (ast *Case) String() string {
+	if len(ast.Exprs) == 0 {
+		return "default:"
+	}
+	result := "case "
+	for idx, expr := range ast.Exprs {
+		if idx > 0 {
+			result += ", "
+		}
+		result += expr.String()
+	}
+	return result + ":"
+}
+
+// Break implements an AST break statement.
+type Break struct {
+	utils.Point
+}
+
+func (ast *Break) String() string {
+	return "break"
+}
+
+// Continue implements an AST continue statement.
+type Continue struct {
+	utils.Point
+}
+
+func (ast *Continue) String() string {
+	return "continue"
+}
+
 // BinaryType defines binary expression types.
 type BinaryType int
 
@@ -843,6 +906,8 @@ func ConstantName(value interface{}) string {
 		return fmt.Sprintf("%d", val)
 	case *mpa.Int:
 		return fmt.Sprintf("%s", val)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
 	case bool:
 		return fmt.Sprintf("%v", val)
 	case string:
@@ -1,7 +1,7 @@
 //
 // ast.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -206,6 +206,129 @@ type Compilation struct {
 	Return *ssa.Block
 	Caller *ssa.Block
 	Called *Func
+	Loops  []Loop
 	// XXX Bindings
 	// XXX Parent scope.
 }
+
+// Loop defines the break and continue state of an enclosing for or
+// switch statement. The state is kept in boolean variables so that
+// break and continue statements can depend on secret values.
+type Loop struct {
+	Break    string
+	Continue string
+}
+
+// Loops returns the enclosing for and switch statements of the
+// current compilation.
+func (ctx *Codegen) Loops() []Loop {
+	if len(ctx.Stack) == 0 {
+		return nil
+	}
+	return ctx.Stack[len(ctx.Stack)-1].Loops
+}
+
+// PushLoop pushes a new for or switch statement to the current
+// compilation and clears its state in the block. The continue
+// statement is valid only in for statements.
+func (ctx *Codegen) PushLoop(block *ssa.Block, gen *ssa.Generator,
+	isFor bool) Loop {
+
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	loop := Loop{
+		Break: fmt.Sprintf("%%break%d", len(c.Loops)),
+	}
+	if isFor {
+		loop.Continue = fmt.Sprintf("%%continue%d", len(c.Loops))
+	}
+	c.Loops = append(c.Loops, loop)
+	ctx.SetLoopFlag(block, gen, loop.Break, false)
+	ctx.SetLoopFlag(block, gen, loop.Continue, false)
+
+	return loop
+}
+
+// PopLoop pops the topmost for or switch statement from the current
+// compilation.
+func (ctx *Codegen) PopLoop() {
+	c := &ctx.Stack[len(ctx.Stack)-1]
+	c.Loops = c.Loops[:len(c.Loops)-1]
+}
+
+// SetLoopFlag sets the value of the named loop state variable.
+func (ctx *Codegen) SetLoopFlag(block *ssa.Block, gen *ssa.Generator,
+	name string, val bool) {
+
+	if len(name) == 0 {
+		return
+	}
+	v := gen.NewVal(name, types.Bool, ctx.Scope())
+	c := gen.Constant(val, types.Bool)
+	gen.AddConstant(c)
+	block.Bindings.Define(v, &c)
+}
+
+// LoopFlag returns the constant value of the named loop state
+// variable. The ok result is false if the value is not constant.
+func (ctx *Codegen) LoopFlag(block *ssa.Block, name string) (
+	val, ok bool) {
+
+	if len(name) == 0 {
+		return false, true
+	}
+	b, ok := block.Bindings.Get(name)
+	if !ok {
+		return false, true
+	}
+	v, ok := b.Bound.(*ssa.Value)
+	if !ok || !v.Const {
+		return false, false
+	}
+	val, ok = v.ConstValue.(bool)
+	return val, ok
+}
+
+// LoopCond returns the condition for executing the next statement of
+// the enclosing for and switch statements. The done result is true if
+// a break or continue statement has been executed so the statement is
+// never reached. The ok result is true if the statement is executed
+// only if the secret condition cond is true.
+func (ctx *Codegen) LoopCond(block *ssa.Block, gen *ssa.Generator) (
+	cond ssa.Value, ok, done bool, err error) {
+
+	var flags []ssa.Value
+	for _, loop := range ctx.Loops() {
+		for _, name := range []string{loop.Break, loop.Continue} {
+			val, isConst := ctx.LoopFlag(block, name)
+			if isConst {
+				if val {
+					return cond, false, true, nil
+				}
+				continue
+			}
+			b, _ := block.Bindings.Get(name)
+			flags = append(flags, b.Value(block, gen))
+		}
+	}
+	if len(flags) == 0 {
+		return cond, false, false, nil
+	}
+	taken := flags[0]
+	for _, flag := range flags[1:] {
+		v := gen.AnonVal(types.Bool)
+		instr, err := ssa.NewOrInstr(taken, flag, v)
+		if err != nil {
+			return cond, false, false, err
+		}
+		block.AddInstr(instr)
+		taken = v
+	}
+	cond = gen.AnonVal(types.Bool)
+	instr, err := ssa.NewNotInstr(taken, cond)
+	if err != nil {
+		return cond, false, false, err
+	}
+	block.AddInstr(instr)
+
+	return cond, true, false, nil
+}
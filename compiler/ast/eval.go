@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,9 +9,11 @@ package ast
 import (
 	"fmt"
 	"math"
+	"strconv"
 
 	"github.com/markkurossi/mpc/compiler/mpa"
 	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/types"
 )
 
@@ -197,6 +199,19 @@ func (ast *Call) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			return ssa.Undefined, false,
 				ctx.Errorf(ast.Ref, "casting %T not supported", constVal.Type)
 		}
+
+	case types.TFloat, types.TFixed:
+		if !typeInfo.Concrete() {
+			return ssa.Undefined, false, nil
+		}
+		cast, err := convertConst(ctx, gen, ast.Exprs[0], constVal, typeInfo)
+		if err != nil {
+			return ssa.Undefined, false, err
+		}
+		if !cast.Type.Equal(typeInfo) {
+			return ssa.Undefined, false, nil
+		}
+		return cast, true, nil
 	}
 
 	return ssa.Undefined, false, nil
@@ -280,6 +295,24 @@ func (ast *ForRange) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	return ssa.Undefined, false, nil
 }
 
+// Eval implements the compiler.ast.AST.Eval for switch statements.
+func (ast *Switch) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for break statements.
+func (ast *Break) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
+// Eval implements the compiler.ast.AST.Eval for continue statements.
+func (ast *Continue) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
+	ssa.Value, bool, error) {
+	return ssa.Undefined, false, nil
+}
+
 // Eval implements the compiler.ast.AST.Eval for binary expressions.
 func (ast *Binary) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 	ssa.Value, bool, error) {
@@ -298,6 +331,16 @@ func (ast *Binary) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			ast.Left, l, l.Type, ast.Op, ast.Right, r, r.Type)
 	}
 
+	// Integer constants are converted to floats in float expressions.
+	if _, ok := l.ConstValue.(float64); ok {
+		r, err = convertConst(ctx, gen, ast.Right, r, l.Type)
+	} else if _, ok := r.ConstValue.(float64); ok {
+		l, err = convertConst(ctx, gen, ast.Left, l, r.Type)
+	}
+	if err != nil {
+		return ssa.Undefined, false, err
+	}
+
 	// Resolve result type.
 	rt, err := ast.resultType(ctx, l, r)
 	if err != nil {
@@ -376,6 +419,39 @@ func (ast *Binary) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			return gen.Constant(lval.Cmp(rval) != -1, types.Bool), true, nil
 		}
 
+	case float64:
+		rval, ok := r.ConstValue.(float64)
+		if !ok {
+			return ssa.Undefined, false, ctx.Errorf(ast.Right,
+				"%s %v %s: invalid r-value %v (%T)", l, ast.Op, r, rval, rval)
+		}
+		switch ast.Op {
+		case BinaryMul:
+			return gen.Constant(lval*rval, rt), true, nil
+		case BinaryDiv:
+			if rval == 0 {
+				return ssa.Undefined, false, ctx.Errorf(ast.Right,
+					"division by zero")
+			}
+			return gen.Constant(lval/rval, rt), true, nil
+		case BinaryAdd:
+			return gen.Constant(lval+rval, rt), true, nil
+		case BinarySub:
+			return gen.Constant(lval-rval, rt), true, nil
+		case BinaryEq:
+			return gen.Constant(lval == rval, types.Bool), true, nil
+		case BinaryNeq:
+			return gen.Constant(lval != rval, types.Bool), true, nil
+		case BinaryLt:
+			return gen.Constant(lval < rval, types.Bool), true, nil
+		case BinaryLe:
+			return gen.Constant(lval <= rval, types.Bool), true, nil
+		case BinaryGt:
+			return gen.Constant(lval > rval, types.Bool), true, nil
+		case BinaryGe:
+			return gen.Constant(lval >= rval, types.Bool), true, nil
+		}
+
 	case string:
 		rval, ok := r.ConstValue.(string)
 		if !ok {
@@ -412,6 +488,11 @@ func (ast *Unary) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 			r := mpa.NewInt(0, expr.Type.Bits)
 			return gen.Constant(r.Sub(r, val), expr.Type), true, nil
 		}
+	case float64:
+		switch ast.Type {
+		case UnaryMinus:
+			return gen.Constant(-val, expr.Type), true, nil
+		}
 	}
 	return ssa.Undefined, false, ctx.Errorf(ast.Expr,
 		"invalid unary expression: %s%T", ast.Type, ast.Expr)
@@ -500,6 +581,56 @@ func (ast *Slice) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 		"invalid operation: cannot slice %v (%v)", expr, expr.Type)
 }
 
+// convertConst converts the numeric constant v to the float or
+// fixed-point type t. Float and fixed-point constants are encoded with
+// their type so constants must be converted to the type of the value
+// they are used with. Other values are returned unmodified.
+func convertConst(ctx *Codegen, gen *ssa.Generator, loc utils.Locator,
+	v ssa.Value, t types.Info) (ssa.Value, error) {
+
+	if !v.Const || !t.Concrete() ||
+		(t.Type != types.TFloat && t.Type != types.TFixed) ||
+		v.Type.Equal(t) {
+		return v, nil
+	}
+	var f float64
+	switch val := v.ConstValue.(type) {
+	case float64:
+		f = val
+		switch v.Type.Type {
+		case types.TFloat:
+			if v.Type.Bits == 32 {
+				f = float64(float32(f))
+			}
+		case types.TFixed:
+			f = math.Ldexp(math.Round(math.Ldexp(f, int(v.Type.Frac))),
+				-int(v.Type.Frac))
+		}
+	case *mpa.Int:
+		if v.Type.Type != types.TInt && v.Type.Type != types.TUint {
+			return v, nil
+		}
+		f, _ = strconv.ParseFloat(val.String(), 64)
+	default:
+		return v, nil
+	}
+	switch t.Type {
+	case types.TFloat:
+		if t.Bits == 32 && math.Abs(f) > math.MaxFloat32 {
+			return ssa.Undefined, ctx.Errorf(loc, "constant %v overflows %v",
+				ConstantName(v.ConstValue), t)
+		}
+	case types.TFixed:
+		limit := math.Ldexp(1, int(t.Bits-1))
+		fixed := math.Round(math.Ldexp(f, int(t.Frac)))
+		if fixed < -limit || fixed >= limit {
+			return ssa.Undefined, ctx.Errorf(loc, "constant %v overflows %v",
+				ConstantName(v.ConstValue), t)
+		}
+	}
+	return gen.Constant(f, t), nil
+}
+
 func intVal(val interface{}) (int, error) {
 	switch v := val.(type) {
 	case *mpa.Int:
@@ -617,6 +748,13 @@ func (ast *CompositeLit) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 				return ssa.Undefined, ok, err
 			}
 			// XXX check that v is assignment compatible with typeInfo.Struct[i]
+			if len(values) < len(typeInfo.Struct) {
+				v, err = convertConst(ctx, gen, el.Element, v,
+					typeInfo.Struct[len(values)].Type)
+				if err != nil {
+					return ssa.Undefined, false, err
+				}
+			}
 			values = append(values, v)
 		}
 		return gen.Constant(values, typeInfo), true, nil
@@ -632,6 +770,11 @@ func (ast *CompositeLit) Eval(env *Env, ctx *Codegen, gen *ssa.Generator) (
 				return ssa.Undefined, ok, err
 			}
 			// XXX check that v is assignment compatible with array.
+			v, err = convertConst(ctx, gen, el.Element, v,
+				*typeInfo.ElementType)
+			if err != nil {
+				return ssa.Undefined, false, err
+			}
 			values = append(values, v)
 		}
 		typeInfo.ArraySize = types.Size(len(values))
@@ -155,8 +155,8 @@ func (lrv *LRValue) ConstValue() (ssa.Value, bool, error) {
 	case types.TUndefined:
 		return lrv.value, false, nil
 
-	case types.TBool, types.TInt, types.TUint, types.TFloat, types.TString,
-		types.TStruct, types.TArray, types.TNil:
+	case types.TBool, types.TInt, types.TUint, types.TFloat, types.TFixed,
+		types.TString, types.TStruct, types.TArray, types.TNil:
 		return lrv.value, true, nil
 
 	default:
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,6 +9,7 @@ package ast
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/compiler/ssa"
@@ -140,12 +141,20 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 		}
 
 		v := returnVars[idx]
+		name := v.String()
+		if main.NamedReturn {
+			name = rt.Name
+		}
 		outputs = append(outputs, circuit.IOArg{
-			Name: v.String(),
+			Name: name,
 			Type: v.Type,
 		})
 	}
 
+	if err := outputOwners(ctx, main, outputs); err != nil {
+		return nil, nil, err
+	}
+
 	steps := init.Serialize()
 
 	program, err := ssa.NewProgram(ctx.Params, inputs, outputs, gen.Constants(),
@@ -159,6 +168,7 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 			return nil, nil, err
 		}
 	}
+	program.CSE()
 	program.GC()
 
 	if ctx.Params.SSAOut != nil {
@@ -171,6 +181,42 @@ func (pkg *Package) Compile(ctx *Codegen) (*ssa.Program, Annotations, error) {
 	return program, main.Annotations, nil
 }
 
+// outputOwners sets the output owners from the main function's
+// annotations. The annotation "@Output name owner" specifies that
+// only the owner, garbler or evaluator, learns the named return value
+// name. The outputs without annotations are revealed to both parties.
+func outputOwners(ctx *Codegen, main *Func, outputs circuit.IO) error {
+	for _, ann := range main.Annotations {
+		parts := strings.Fields(ann)
+		if len(parts) == 0 || parts[0] != "@Output" {
+			continue
+		}
+		if len(parts) != 3 {
+			return ctx.Errorf(main, "invalid annotation: %s",
+				strings.TrimSpace(ann))
+		}
+		if !main.NamedReturn {
+			return ctx.Errorf(main, "@Output requires named return values")
+		}
+		owner, err := circuit.ParseOwner(parts[2])
+		if err != nil {
+			return ctx.Errorf(main, "@Output: %s", err)
+		}
+		var found bool
+		for idx := range outputs {
+			if outputs[idx].Name == parts[1] {
+				outputs[idx].Owner = owner
+				found = true
+			}
+		}
+		if !found {
+			return ctx.Errorf(main, "@Output: unknown return value %s",
+				parts[1])
+		}
+	}
+	return nil
+}
+
 // Main returns package's main function.
 func (pkg *Package) Main() (*Func, error) {
 	main, ok := pkg.Functions["main"]
@@ -282,6 +328,10 @@ func (pkg *Package) defineConstant(def *ConstantDef, ctx *Codegen,
 	if !ok {
 		return ctx.Errorf(def.Init, "init value is not constant")
 	}
+	constVal, err = convertConst(ctx, gen, def.Init, constVal, typeInfo)
+	if err != nil {
+		return err
+	}
 	constVar := gen.Constant(constVal, typeInfo)
 	if typeInfo.Undefined() {
 		typeInfo.Type = constVar.Type.Type
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -24,9 +24,7 @@ const (
 func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
 
-	var err error
-
-	for _, b := range ast {
+	for idx, b := range ast {
 		if block.Dead {
 			warn := true
 			ret, ok := b.(*Return)
@@ -38,6 +36,37 @@ func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			}
 			break
 		}
+		cond, ok, done, err := ctx.LoopCond(block, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if done {
+			if idx > 0 && isJump(ast[idx-1]) {
+				ctx.Warningf(b, "unreachable code")
+			}
+			break
+		}
+		if ok {
+			// The rest of the list is executed only if no break or
+			// continue statement was taken.
+			block.BranchCond = cond
+			tBlock := gen.BranchBlock(block)
+			for _, loop := range ctx.Loops() {
+				ctx.SetLoopFlag(tBlock, gen, loop.Break, false)
+				ctx.SetLoopFlag(tBlock, gen, loop.Continue, false)
+			}
+			tNext, _, err := ast[idx:].SSA(tBlock, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if tNext.Dead {
+				tNext = gen.NextBlock(block)
+			} else {
+				tNext.Bindings = tNext.Bindings.Merge(cond, block.Bindings)
+				block.SetNext(tNext)
+			}
+			return tNext, nil, nil
+		}
 		block, _, err = b.SSA(block, ctx, gen)
 		if err != nil {
 			return nil, nil, err
@@ -47,6 +76,15 @@ func (ast List) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	return block, nil, nil
 }
 
+func isJump(ast AST) bool {
+	switch ast.(type) {
+	case *Break, *Continue:
+		return true
+	default:
+		return false
+	}
+}
+
 // SSA implements the compiler.ast.AST.SSA for function definitions.
 func (ast *Func) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
@@ -191,6 +229,11 @@ func (ast *VariableDef) SSA(block *ssa.Block, ctx *Codegen,
 			typeInfo.Bits = init.Type.Bits
 			typeInfo.SetConcrete(true)
 		}
+		init, err = convertConst(ctx, gen, ast.Init, init, typeInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(init)
 		if !typeInfo.CanAssignConst(init.Type) {
 			return nil, nil, ctx.Errorf(ast,
 				"cannot use %s (type %s) as type %s in assignment",
@@ -211,7 +254,7 @@ func initValue(typeInfo types.Info) (interface{}, error) {
 	switch typeInfo.Type {
 	case types.TBool:
 		return false, nil
-	case types.TInt, types.TUint:
+	case types.TInt, types.TUint, types.TFloat, types.TFixed:
 		return int64(0), nil
 	case types.TString:
 		return "", nil
@@ -302,6 +345,12 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 				continue
 			}
 
+			rv, err = convertConst(ctx, gen, lvalue, rv,
+				lrv.ValueType())
+			if err != nil {
+				return nil, nil, err
+			}
+			gen.AddConstant(rv)
 			err = lrv.Set(rv)
 			if err != nil {
 				return nil, nil, ctx.Error(lvalue, err.Error())
@@ -331,6 +380,13 @@ func (ast *Assign) SSA(block *ssa.Block, ctx *Codegen,
 				arraySize := valueType.ArraySize
 				elementSize := valueType.ElementType.Bits
 
+				rv, err = convertConst(ctx, gen, lvalue, rv,
+					*valueType.ElementType)
+				if err != nil {
+					return nil, nil, err
+				}
+				gen.AddConstant(rv)
+
 				block, val, err := lv.Index.SSA(block, ctx, gen)
 				if err != nil {
 					return nil, nil, err
@@ -663,6 +719,11 @@ func (ast *Call) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"cannot use %v as type %s in argument to %s",
 				args[idx].Type, typeInfo, called.Name)
 		}
+		args[idx], err = convertConst(ctx, gen, ast, args[idx], typeInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(args[idx])
 		if !ssa.LValueFor(typeInfo, args[idx]) {
 			return nil, nil, ctx.Errorf(ast,
 				"cannot use %v as type %s in argument to %s",
@@ -804,7 +865,15 @@ castTargetType:
 			cv.Type, typeInfo)
 	}
 
-	if cv.Type.Type == types.TInt && typeInfo.Type == types.TInt &&
+	if cv.Type.Type == types.TFloat || typeInfo.Type == types.TFloat ||
+		cv.Type.Type == types.TFixed || typeInfo.Type == types.TFixed {
+		instr, err := ssa.NewCvtInstr(cv, t)
+		if err != nil {
+			return nil, nil, ctx.Errorf(ast.Exprs[0], "cast from %v to %v",
+				cv.Type, typeInfo)
+		}
+		block.AddInstr(instr)
+	} else if cv.Type.Type == types.TInt && typeInfo.Type == types.TInt &&
 		typeInfo.Bits > cv.Type.Bits {
 		// The src and dst are signed integers and we are casting to
 		// bigger bit size. Use sign-extension version smov.
@@ -1053,6 +1122,11 @@ func (ast *Return) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			result[idx].Type.Type = typeInfo.Type
 		}
 
+		result[idx], err = convertConst(ctx, gen, ast, result[idx], typeInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(result[idx])
 		if !ssa.LValueFor(typeInfo, result[idx]) {
 			return nil, nil, ctx.Errorf(ast,
 				"invalid value %v for return value %v",
@@ -1120,6 +1194,8 @@ func (ast *Return) error(ctx *Codegen, message string, have [][]ssa.Value,
 func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	*ssa.Block, []ssa.Value, error) {
 
+	loop := ctx.PushLoop(block, gen, true)
+
 	// Use the same env for the whole for-loop unrolling.
 	env := NewEnv(block)
 
@@ -1165,6 +1241,10 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		if err != nil {
 			return nil, nil, err
 		}
+		if brk, ok := ctx.LoopFlag(block, loop.Break); ok && brk {
+			break
+		}
+		ctx.SetLoopFlag(block, gen, loop.Continue, false)
 
 		// Increment.
 		env = NewEnv(block)
@@ -1177,6 +1257,7 @@ func (ast *For) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 				"increment statement is not compile-time constant: %s", ast.Inc)
 		}
 	}
+	ctx.PopLoop()
 
 	return block, nil, nil
 }
@@ -1252,6 +1333,8 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			"cannot range over unspecified element type %v", it)
 	}
 
+	loop := ctx.PushLoop(block, gen, true)
+
 	// Expand body for each element in value.
 	for i := 0; i < count; i++ {
 		// Index variable.
@@ -1330,11 +1413,150 @@ func (ast *ForRange) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 		if err != nil {
 			return nil, nil, err
 		}
+		if brk, ok := ctx.LoopFlag(block, loop.Break); ok && brk {
+			break
+		}
+		ctx.SetLoopFlag(block, gen, loop.Continue, false)
 	}
+	ctx.PopLoop()
 
 	return block, nil, nil
 }
 
+// SSA implements the compiler.ast.AST.SSA for switch statements.
+func (ast *Switch) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Value, error) {
+
+	var err error
+
+	if ast.Init != nil {
+		block, _, err = ast.Init.SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	ctx.PushLoop(block, gen, false)
+
+	// Evaluate the tag expression once and bind it to a variable
+	// that the case expressions are compared against.
+	var tag *VariableRef
+	if ast.Expr != nil {
+		var v ssa.Value
+
+		env := NewEnv(block)
+		constVal, ok, err := ast.Expr.Eval(env, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			block.Bindings = env.Bindings
+			gen.AddConstant(constVal)
+			v = constVal
+		} else {
+			var values []ssa.Value
+			block, values, err = ast.Expr.SSA(block, ctx, gen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(values) == 0 {
+				return nil, nil, ctx.Errorf(ast.Expr, "%s used as value",
+					ast.Expr)
+			} else if len(values) > 1 {
+				return nil, nil, ctx.Errorf(ast.Expr,
+					"multiple-value %s used in single-value context",
+					ast.Expr)
+			}
+			v = values[0]
+		}
+		name := fmt.Sprintf("%%switch%d", len(ctx.Loops())-1)
+		block.Bindings.Define(gen.NewVal(name, v.Type, ctx.Scope()), &v)
+		tag = &VariableRef{
+			Point: ast.Expr.Location(),
+			Name: Identifier{
+				Name: name,
+			},
+		}
+	}
+
+	// Lower cases into an if-else chain that ends to the default
+	// clause.
+	var chain AST
+	for _, c := range ast.Cases {
+		if len(c.Exprs) == 0 {
+			chain = c.Body
+		}
+	}
+	for i := len(ast.Cases) - 1; i >= 0; i-- {
+		c := ast.Cases[i]
+		if len(c.Exprs) == 0 {
+			continue
+		}
+		var cond AST
+		for _, expr := range c.Exprs {
+			if tag != nil {
+				expr = &Binary{
+					Point: expr.Location(),
+					Left:  tag,
+					Op:    BinaryEq,
+					Right: expr,
+				}
+			}
+			if cond == nil {
+				cond = expr
+			} else {
+				cond = &Binary{
+					Point: expr.Location(),
+					Left:  cond,
+					Op:    BinaryOr,
+					Right: expr,
+				}
+			}
+		}
+		chain = &If{
+			Point: c.Point,
+			Expr:  cond,
+			True:  c.Body,
+			False: chain,
+		}
+	}
+	if chain != nil {
+		block, _, err = chain.SSA(block, ctx, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	ctx.PopLoop()
+
+	return block, nil, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for break statements.
+func (ast *Break) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
+	*ssa.Block, []ssa.Value, error) {
+
+	loops := ctx.Loops()
+	if len(loops) == 0 {
+		return nil, nil, ctx.Errorf(ast, "break is not in a loop or switch")
+	}
+	ctx.SetLoopFlag(block, gen, loops[len(loops)-1].Break, true)
+
+	return block, nil, nil
+}
+
+// SSA implements the compiler.ast.AST.SSA for continue statements.
+func (ast *Continue) SSA(block *ssa.Block, ctx *Codegen,
+	gen *ssa.Generator) (*ssa.Block, []ssa.Value, error) {
+
+	loops := ctx.Loops()
+	for i := len(loops) - 1; i >= 0; i-- {
+		if len(loops[i].Continue) > 0 {
+			ctx.SetLoopFlag(block, gen, loops[i].Continue, true)
+			return block, nil, nil
+		}
+	}
+	return nil, nil, ctx.Errorf(ast, "continue is not in a loop")
+}
+
 func isPowerOf2(ast AST, env *Env, ctx *Codegen, gen *ssa.Generator) (
 	int64, bool) {
 
@@ -1446,6 +1668,19 @@ func (ast *Binary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 	if err != nil {
 		return nil, nil, err
 	}
+	if l.Const && !r.Const {
+		l, err = convertConst(ctx, gen, ast.Left, l, r.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(l)
+	} else if r.Const && !l.Const {
+		r, err = convertConst(ctx, gen, ast.Right, r, l.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		gen.AddConstant(r)
+	}
 
 	// Resolve target type.
 	resultType, err := ast.resultType(ctx, l, r)
@@ -1651,7 +1886,7 @@ func (ast *Unary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 
 		t := gen.AnonVal(expr.Type)
 		switch expr.Type.Type {
-		case types.TInt, types.TUint:
+		case types.TInt, types.TUint, types.TFixed:
 			zero := gen.Constant(int64(0), types.Undefined)
 			gen.AddConstant(zero)
 			instr, err := ssa.NewSubInstr(expr.Type, zero, expr, t)
@@ -1661,6 +1896,17 @@ func (ast *Unary) SSA(block *ssa.Block, ctx *Codegen, gen *ssa.Generator) (
 			block.AddInstr(instr)
 			return block, []ssa.Value{t}, nil
 
+		case types.TFloat:
+			// Negate the value by flipping its sign bit.
+			mask := gen.Constant(int64(1)<<(expr.Type.Bits-1), expr.Type)
+			gen.AddConstant(mask)
+			instr, err := ssa.NewBxorInstr(expr, mask, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			block.AddInstr(instr)
+			return block, []ssa.Value{t}, nil
+
 		default:
 			return nil, nil, ctx.Errorf(ast, "%s not supported", ast)
 		}
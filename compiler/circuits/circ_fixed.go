@@ -0,0 +1,152 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/types"
+)
+
+// Fixed-point values are signed two's complement integers with frac
+// fractional bits i.e. the wires x hold the value x*2^-frac.
+
+// fixedArgs checks the fixed-point operation arguments.
+func fixedArgs(frac int, x, y, z []*Wire) error {
+	if len(x) != len(y) || len(x) != len(z) {
+		return fmt.Errorf("invalid fixed arguments: x=%d, y=%d, z=%d",
+			len(x), len(y), len(z))
+	}
+	if frac < 0 || frac >= len(z) {
+		return fmt.Errorf("invalid fixed fraction bits %d for size %d",
+			frac, len(z))
+	}
+	return nil
+}
+
+// abs returns the sign and the absolute value of the signed value x.
+func abs(cc *Compiler, x []*Wire) (*Wire, []*Wire) {
+	sign := x[len(x)-1]
+	return sign, mux(cc, sign, subtract(cc, constWires(cc, 0, len(x)), x), x)
+}
+
+// NewFixedMultiplier creates a fixed-point multiplier circuit
+// implementing z=x*y. The result is truncated toward zero.
+func NewFixedMultiplier(cc *Compiler, frac int, x, y, z []*Wire) error {
+	if err := fixedArgs(frac, x, y, z); err != nil {
+		return err
+	}
+	n := len(z)
+	xs, xa := abs(cc, x)
+	ys, ya := abs(cc, y)
+
+	p := cc.Calloc.Wires(types.Size(2 * n))
+	err := NewMultiplier(cc, cc.Params.CircMultArrayTreshold, xa, ya, p)
+	if err != nil {
+		return err
+	}
+	mag := p[frac : frac+n]
+	neg := newGate(cc, circuit.XOR, xs, ys)
+
+	return NewMUX(cc, []*Wire{neg}, subtract(cc, constWires(cc, 0, n), mag),
+		mag, z)
+}
+
+// NewFixedDivider creates a fixed-point divider circuit implementing
+// z=x/y. The result is truncated toward zero. The result is undefined
+// if y is zero.
+func NewFixedDivider(cc *Compiler, frac int, x, y, z []*Wire) error {
+	if err := fixedArgs(frac, x, y, z); err != nil {
+		return err
+	}
+	n := len(z)
+	xs, xa := abs(cc, x)
+	ys, ya := abs(cc, y)
+
+	num := append(constWires(cc, 0, frac), xa...)
+	q := cc.Calloc.Wires(types.Size(n))
+	err := NewDivider(cc, num, ya, q, nil)
+	if err != nil {
+		return err
+	}
+	neg := newGate(cc, circuit.XOR, xs, ys)
+
+	return NewMUX(cc, []*Wire{neg}, subtract(cc, constWires(cc, 0, n), q),
+		q, z)
+}
+
+// signedComparator compares the signed values x and y with the
+// unsigned comparator cmp by flipping their sign bits.
+func signedComparator(cc *Compiler, x, y, r []*Wire,
+	cmp func(cc *Compiler, x, y, r []*Wire) error) error {
+
+	if len(x) != len(y) {
+		return fmt.Errorf("invalid comparator arguments: x=%d, y=%d",
+			len(x), len(y))
+	}
+	xf := make([]*Wire, len(x))
+	copy(xf, x)
+	xf[len(x)-1] = newINV(cc, x[len(x)-1])
+
+	yf := make([]*Wire, len(y))
+	copy(yf, y)
+	yf[len(y)-1] = newINV(cc, y[len(y)-1])
+
+	return cmp(cc, xf, yf, r)
+}
+
+// NewFixedLtComparator tests if x<y.
+func NewFixedLtComparator(cc *Compiler, x, y, r []*Wire) error {
+	return signedComparator(cc, x, y, r, NewLtComparator)
+}
+
+// NewFixedLeComparator tests if x<=y.
+func NewFixedLeComparator(cc *Compiler, x, y, r []*Wire) error {
+	return signedComparator(cc, x, y, r, NewLeComparator)
+}
+
+// NewFixedGtComparator tests if x>y.
+func NewFixedGtComparator(cc *Compiler, x, y, r []*Wire) error {
+	return signedComparator(cc, x, y, r, NewGtComparator)
+}
+
+// NewFixedGeComparator tests if x>=y.
+func NewFixedGeComparator(cc *Compiler, x, y, r []*Wire) error {
+	return signedComparator(cc, x, y, r, NewGeComparator)
+}
+
+// NewFixedConvert creates a circuit that converts the value x with
+// xfrac fractional bits to the value z with zfrac fractional
+// bits. Integers are fixed-point values with zero fractional bits. The
+// signed flag specifies if x is signed. The conversion truncates the
+// value toward zero and the result is undefined if the value does not
+// fit into z.
+func NewFixedConvert(cc *Compiler, xfrac, zfrac int, signed bool,
+	x, z []*Wire) error {
+
+	if xfrac < 0 || xfrac >= len(x) || zfrac < 0 || zfrac >= len(z) {
+		return fmt.Errorf("invalid fixed conversion: x=%d.%d, z=%d.%d",
+			len(x), xfrac, len(z), zfrac)
+	}
+	if zfrac >= xfrac {
+		shifted := append(constWires(cc, 0, zfrac-xfrac), x...)
+		for i, w := range extend(cc, shifted, len(z), signed) {
+			cc.ID(w, z[i])
+		}
+		return nil
+	}
+	sign := cc.ZeroWire()
+	mag := x
+	if signed {
+		sign, mag = abs(cc, x)
+	}
+	mag = extend(cc, mag[xfrac-zfrac:], len(z), false)
+
+	return NewMUX(cc, []*Wire{sign},
+		subtract(cc, constWires(cc, 0, len(z)), mag), mag, z)
+}
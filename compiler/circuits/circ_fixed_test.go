@@ -0,0 +1,150 @@
+//
+// circ_fixed_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func fixedValues(bits int, count int) []int64 {
+	rnd := rand.New(rand.NewSource(42))
+	min := int64(-1) << (bits - 1)
+	max := int64(1)<<(bits-1) - 1
+	values := []int64{0, 1, -1, 2, -2, 255, 256, -256, 1000, -1000, min, max}
+	for i := 0; i < count; i++ {
+		values = append(values, rnd.Int63n(max)-rnd.Int63n(max))
+	}
+	return values
+}
+
+// fixedTrunc returns v*2^-shift truncated toward zero and wrapped to
+// bits bits.
+func fixedTrunc(v *big.Int, shift uint, bits int) int64 {
+	r := new(big.Int).Quo(v, new(big.Int).Lsh(big.NewInt(1), shift))
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	r.Mod(r, mod)
+	if r.Bit(bits-1) == 1 {
+		r.Sub(r, mod)
+	}
+	return r.Int64()
+}
+
+func signExtend(v uint64, bits int) int64 {
+	return int64(v<<(64-bits)) >> (64 - bits)
+}
+
+func TestFixedArithmetic(t *testing.T) {
+	const bits = 32
+	const frac = 8
+	mask := uint64(1)<<bits - 1
+
+	mul := floatCircuit(t, 2*bits, bits, func(cc *Compiler, in,
+		out []*Wire) error {
+		return NewFixedMultiplier(cc, frac, in[:bits], in[bits:], out)
+	})
+	div := floatCircuit(t, 2*bits, bits, func(cc *Compiler, in,
+		out []*Wire) error {
+		return NewFixedDivider(cc, frac, in[:bits], in[bits:], out)
+	})
+	values := fixedValues(bits, 20)
+	for _, x := range values {
+		for _, y := range values {
+			xv := uint64(x) & mask
+			yv := uint64(y) & mask
+
+			result := signExtend(floatCompute(t, mul, bits, xv, yv), bits)
+			expected := fixedTrunc(new(big.Int).Mul(big.NewInt(x),
+				big.NewInt(y)), frac, bits)
+			if result != expected {
+				t.Errorf("%d*%d: got %d, expected %d", x, y, result, expected)
+			}
+			if y == 0 {
+				continue
+			}
+			result = signExtend(floatCompute(t, div, bits, xv, yv), bits)
+			num := new(big.Int).Lsh(big.NewInt(x), frac)
+			expected = fixedTrunc(num.Quo(num, big.NewInt(y)), 0, bits)
+			if result != expected {
+				t.Errorf("%d/%d: got %d, expected %d", x, y, result, expected)
+			}
+		}
+	}
+}
+
+func TestFixedComparators(t *testing.T) {
+	const bits = 16
+	comparators := []struct {
+		name string
+		circ func(cc *Compiler, x, y, r []*Wire) error
+		cmp  func(x, y int64) bool
+	}{
+		{"<", NewFixedLtComparator, func(x, y int64) bool { return x < y }},
+		{"<=", NewFixedLeComparator, func(x, y int64) bool { return x <= y }},
+		{">", NewFixedGtComparator, func(x, y int64) bool { return x > y }},
+		{">=", NewFixedGeComparator, func(x, y int64) bool { return x >= y }},
+	}
+	values := fixedValues(bits, 10)
+	for _, c := range comparators {
+		circ := floatCircuit(t, 2*bits, 1, func(cc *Compiler, in,
+			out []*Wire) error {
+			return c.circ(cc, in[:bits], in[bits:], out)
+		})
+		for _, x := range values {
+			for _, y := range values {
+				result := floatCompute(t, circ, bits, uint64(x)&0xffff,
+					uint64(y)&0xffff)
+				if (result == 1) != c.cmp(x, y) {
+					t.Errorf("%d %s %d: got %v", x, c.name, y, result == 1)
+				}
+			}
+		}
+	}
+}
+
+func TestFixedConvert(t *testing.T) {
+	tests := []struct {
+		xbits, xfrac int
+		zbits, zfrac int
+		signed       bool
+	}{
+		{32, 0, 32, 8, true},
+		{32, 0, 64, 16, false},
+		{32, 8, 32, 0, true},
+		{32, 8, 64, 16, true},
+		{64, 16, 32, 8, true},
+		{32, 8, 16, 0, true},
+	}
+	for _, test := range tests {
+		circ := floatCircuit(t, test.xbits, test.zbits, func(cc *Compiler,
+			in, out []*Wire) error {
+			return NewFixedConvert(cc, test.xfrac, test.zfrac, test.signed,
+				in, out)
+		})
+		for _, v := range fixedValues(test.xbits, 20) {
+			if !test.signed && v < 0 {
+				continue
+			}
+			x := uint64(v) & (uint64(1)<<test.xbits - 1)
+			if test.xbits == 64 {
+				x = uint64(v)
+			}
+			result := signExtend(floatCompute(t, circ, test.xbits, x),
+				test.zbits)
+
+			val := new(big.Int).Lsh(big.NewInt(v), uint(test.zfrac))
+			expected := fixedTrunc(val, uint(test.xfrac), test.zbits)
+			if result != expected {
+				t.Errorf("%v: convert %d: got %d, expected %d",
+					test, v, result, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,691 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/types"
+)
+
+// floatFormat defines an IEEE-754 binary interchange format.
+type floatFormat struct {
+	exp  int
+	frac int
+}
+
+func newFloatFormat(bits int) (floatFormat, error) {
+	switch bits {
+	case 32:
+		return floatFormat{exp: 8, frac: 23}, nil
+	case 64:
+		return floatFormat{exp: 11, frac: 52}, nil
+	default:
+		return floatFormat{}, fmt.Errorf("unsupported float size %d", bits)
+	}
+}
+
+func (f floatFormat) bits() int {
+	return 1 + f.exp + f.frac
+}
+
+func (f floatFormat) bias() int64 {
+	return 1<<(f.exp-1) - 1
+}
+
+// inf returns the wires of the infinity value with the sign.
+func (f floatFormat) inf(cc *Compiler, sign *Wire) []*Wire {
+	result := constWires(cc, (1<<f.exp-1)<<f.frac, f.exp+f.frac)
+	return append(result, sign)
+}
+
+// nan returns the wires of the quiet NaN value.
+func (f floatFormat) nan(cc *Compiler) []*Wire {
+	return constWires(cc, (1<<(f.exp+1)-1)<<(f.frac-1), f.bits())
+}
+
+// zero returns the wires of the zero value with the sign.
+func (f floatFormat) zero(cc *Compiler, sign *Wire) []*Wire {
+	return append(constWires(cc, 0, f.exp+f.frac), sign)
+}
+
+// unpackedFloat holds the fields of an unpacked floating point
+// value. The exp is the biased exponent of the value. For zero and
+// subnormal values, the exponent is 1 and the significand does not
+// have the hidden bit set.
+type unpackedFloat struct {
+	sign *Wire
+	exp  []*Wire
+	sig  []*Wire
+	zero *Wire
+	inf  *Wire
+	nan  *Wire
+}
+
+func (f floatFormat) unpack(cc *Compiler, x []*Wire) *unpackedFloat {
+	frac := x[:f.frac]
+	exp := x[f.frac : f.frac+f.exp]
+
+	expNonZero := orReduce(cc, exp)
+	expOnes := andReduce(cc, exp)
+	fracNonZero := orReduce(cc, frac)
+
+	u := &unpackedFloat{
+		sign: x[f.frac+f.exp],
+		exp:  make([]*Wire, f.exp),
+		sig:  make([]*Wire, f.frac+1),
+	}
+	copy(u.exp, exp)
+	u.exp[0] = newGate(cc, circuit.OR, exp[0], newINV(cc, expNonZero))
+
+	copy(u.sig, frac)
+	u.sig[f.frac] = expNonZero
+
+	u.zero = newINV(cc, newGate(cc, circuit.OR, expNonZero, fracNonZero))
+	u.inf = newGate(cc, circuit.AND, expOnes, newINV(cc, fracNonZero))
+	u.nan = newGate(cc, circuit.AND, expOnes, fracNonZero)
+
+	return u
+}
+
+// roundPack rounds the value sign*sig*2^(e-bias-len(sig)+1) to the
+// nearest even value and packs it into the output wires z. The e is a
+// signed integer and it must be wide enough to hold all exponent
+// values of the computation.
+func (f floatFormat) roundPack(cc *Compiler, sign *Wire, e, sig,
+	z []*Wire) error {
+
+	if len(z) != f.bits() {
+		return fmt.Errorf("invalid float result size %d", len(z))
+	}
+	ew := len(e)
+
+	// Make sure we have at least the guard bit.
+	if len(sig) < f.frac+2 {
+		sig = append(constWires(cc, 0, f.frac+2-len(sig)), sig...)
+	}
+	sigZero := newINV(cc, orReduce(cc, sig))
+
+	// Normalize significand.
+	sig, lz := normalize(cc, sig)
+	e = subtract(cc, e, extend(cc, lz, ew, false))
+
+	// Denormalize tiny values.
+	tiny := newGate(cc, circuit.OR, e[ew-1], newINV(cc, orReduce(cc, e)))
+	amount := subtract(cc, constWires(cc, 1, ew), e)
+	sig = mux(cc, tiny, shiftRight(cc, sig, amount, true), sig)
+	e = mux(cc, tiny, constWires(cc, 0, ew),
+		subtract(cc, e, constWires(cc, 1, ew)))
+
+	// Round to nearest even.
+	s := len(sig)
+	mant := sig[s-1-f.frac:]
+	guard := sig[s-2-f.frac]
+	sticky := orReduce(cc, sig[:s-2-f.frac])
+	up := newGate(cc, circuit.AND, guard,
+		newGate(cc, circuit.OR, sticky, mant[0]))
+	mant = add(cc, mant, []*Wire{up}, f.frac+2)
+
+	// Pack exponent and significand. The hidden bit and the rounding
+	// carry increment the exponent.
+	pw := ew + f.frac
+	packed := add(cc, append(constWires(cc, 0, f.frac), e...),
+		extend(cc, mant, pw, false), pw)
+
+	overflow := cc.Calloc.Wire()
+	err := NewGeComparator(cc, packed,
+		constWires(cc, (1<<f.exp-1)<<f.frac, pw), []*Wire{overflow})
+	if err != nil {
+		return err
+	}
+	magnitude := mux(cc, overflow, f.inf(cc, sign)[:f.exp+f.frac],
+		packed[:f.exp+f.frac])
+
+	err = NewMUX(cc, []*Wire{sigZero}, constWires(cc, 0, f.exp+f.frac),
+		magnitude, z[:f.exp+f.frac])
+	if err != nil {
+		return err
+	}
+	cc.ID(sign, z[f.exp+f.frac])
+	return nil
+}
+
+// floatArgs checks the float operation arguments.
+func floatArgs(x, y, z []*Wire) (floatFormat, error) {
+	if len(x) != len(y) || len(x) != len(z) {
+		return floatFormat{}, fmt.Errorf(
+			"invalid float arguments: x=%d, y=%d, z=%d",
+			len(x), len(y), len(z))
+	}
+	return newFloatFormat(len(z))
+}
+
+// expWidth returns the signed exponent width for the float format
+// and for the maximum significand size.
+func (f floatFormat) expWidth(sig int) int {
+	ew := f.exp + 3
+	for int64(1)<<(ew-2) < f.bias()+int64(sig) {
+		ew++
+	}
+	return ew
+}
+
+// NewFloatAdder creates a floating point adder circuit implementing
+// z=x+y.
+func NewFloatAdder(cc *Compiler, x, y, z []*Wire) error {
+	return floatAdder(cc, x, y, z, false)
+}
+
+// NewFloatSubtractor creates a floating point subtractor circuit
+// implementing z=x-y.
+func NewFloatSubtractor(cc *Compiler, x, y, z []*Wire) error {
+	return floatAdder(cc, x, y, z, true)
+}
+
+func floatAdder(cc *Compiler, x, y, z []*Wire, negate bool) error {
+	f, err := floatArgs(x, y, z)
+	if err != nil {
+		return err
+	}
+	n := f.bits()
+	if negate {
+		neg := make([]*Wire, n)
+		copy(neg, y)
+		neg[n-1] = newINV(cc, y[n-1])
+		y = neg
+	}
+
+	// Order arguments so that |a| >= |b|.
+	swap := cc.Calloc.Wire()
+	err = NewGtComparator(cc, y[:n-1], x[:n-1], []*Wire{swap})
+	if err != nil {
+		return err
+	}
+	a := mux(cc, swap, y, x)
+	b := mux(cc, swap, x, y)
+	ua := f.unpack(cc, a)
+	ub := f.unpack(cc, b)
+
+	// Align significands with guard, round, and sticky bits.
+	sw := f.frac + 5
+	d := subtract(cc, ua.exp, ub.exp)
+	ma := extend(cc, append(constWires(cc, 0, 3), ua.sig...), sw, false)
+	mb := shiftRight(cc, append(constWires(cc, 0, 3), ub.sig...), d, true)
+	mb = extend(cc, mb, sw, false)
+
+	diff := newGate(cc, circuit.XOR, ua.sign, ub.sign)
+	sig := mux(cc, diff, subtract(cc, ma, mb), add(cc, ma, mb, sw))
+
+	ew := f.expWidth(sw)
+	e := add(cc, extend(cc, ua.exp, ew, false), constWires(cc, 1, ew), ew)
+
+	// Exact zero sum is negative only if both arguments are negative.
+	sign := mux(cc, newINV(cc, orReduce(cc, sig)),
+		[]*Wire{newGate(cc, circuit.AND, ua.sign, ub.sign)},
+		[]*Wire{ua.sign})[0]
+
+	result := cc.Calloc.Wires(types.Size(n))
+	err = f.roundPack(cc, sign, e, sig, result)
+	if err != nil {
+		return err
+	}
+	result = mux(cc, ua.inf, a, result)
+
+	nan := newGate(cc, circuit.OR, ua.nan, ub.nan)
+	nan = newGate(cc, circuit.OR, nan, newGate(cc, circuit.AND, diff,
+		newGate(cc, circuit.AND, ua.inf, ub.inf)))
+
+	return NewMUX(cc, []*Wire{nan}, f.nan(cc), result, z)
+}
+
+// NewFloatMultiplier creates a floating point multiplier circuit
+// implementing z=x*y.
+func NewFloatMultiplier(cc *Compiler, x, y, z []*Wire) error {
+	f, err := floatArgs(x, y, z)
+	if err != nil {
+		return err
+	}
+	ux := f.unpack(cc, x)
+	uy := f.unpack(cc, y)
+
+	sign := newGate(cc, circuit.XOR, ux.sign, uy.sign)
+
+	sw := 2 * (f.frac + 1)
+	sig := cc.Calloc.Wires(types.Size(sw))
+	err = NewMultiplier(cc, cc.Params.CircMultArrayTreshold, ux.sig, uy.sig,
+		sig)
+	if err != nil {
+		return err
+	}
+
+	ew := f.expWidth(sw)
+	e := add(cc, extend(cc, ux.exp, ew, false), extend(cc, uy.exp, ew, false),
+		ew)
+	e = subtract(cc, e, constWires(cc, f.bias()-1, ew))
+
+	result := cc.Calloc.Wires(types.Size(f.bits()))
+	err = f.roundPack(cc, sign, e, sig, result)
+	if err != nil {
+		return err
+	}
+	inf := newGate(cc, circuit.OR, ux.inf, uy.inf)
+	result = mux(cc, inf, f.inf(cc, sign), result)
+
+	nan := newGate(cc, circuit.OR, ux.nan, uy.nan)
+	nan = newGate(cc, circuit.OR, nan,
+		newGate(cc, circuit.AND, ux.inf, uy.zero))
+	nan = newGate(cc, circuit.OR, nan,
+		newGate(cc, circuit.AND, ux.zero, uy.inf))
+
+	return NewMUX(cc, []*Wire{nan}, f.nan(cc), result, z)
+}
+
+// NewFloatDivider creates a floating point divider circuit
+// implementing z=x/y.
+func NewFloatDivider(cc *Compiler, x, y, z []*Wire) error {
+	f, err := floatArgs(x, y, z)
+	if err != nil {
+		return err
+	}
+	ux := f.unpack(cc, x)
+	uy := f.unpack(cc, y)
+
+	sign := newGate(cc, circuit.XOR, ux.sign, uy.sign)
+
+	// Normalize significands so that their ratio is in range (1/2, 2).
+	ew := f.expWidth(2 * (f.frac + 1))
+	ma, lzx := normalize(cc, ux.sig)
+	mb, lzy := normalize(cc, uy.sig)
+	ex := subtract(cc, extend(cc, ux.exp, ew, false),
+		extend(cc, lzx, ew, false))
+	ey := subtract(cc, extend(cc, uy.exp, ew, false),
+		extend(cc, lzy, ew, false))
+	e := add(cc, subtract(cc, ex, ey), constWires(cc, f.bias(), ew), ew)
+
+	// The quotient has the result bits and the guard bit. The
+	// remainder gives the sticky bit.
+	num := append(constWires(cc, 0, f.frac+2), ma...)
+	q := cc.Calloc.Wires(types.Size(f.frac + 3))
+	r := cc.Calloc.Wires(types.Size(f.frac + 1))
+	err = NewDivider(cc, num, mb, q, r)
+	if err != nil {
+		return err
+	}
+	sig := append([]*Wire{orReduce(cc, r)}, q...)
+
+	result := cc.Calloc.Wires(types.Size(f.bits()))
+	err = f.roundPack(cc, sign, e, sig, result)
+	if err != nil {
+		return err
+	}
+	zero := newGate(cc, circuit.OR, ux.zero, uy.inf)
+	result = mux(cc, zero, f.zero(cc, sign), result)
+	inf := newGate(cc, circuit.OR, ux.inf, uy.zero)
+	result = mux(cc, inf, f.inf(cc, sign), result)
+
+	nan := newGate(cc, circuit.OR, ux.nan, uy.nan)
+	nan = newGate(cc, circuit.OR, nan,
+		newGate(cc, circuit.AND, ux.zero, uy.zero))
+	nan = newGate(cc, circuit.OR, nan,
+		newGate(cc, circuit.AND, ux.inf, uy.inf))
+
+	return NewMUX(cc, []*Wire{nan}, f.nan(cc), result, z)
+}
+
+// floatCompare compares x and y. It returns the wires for x<y and
+// x==y. Both wires are false if either argument is NaN.
+func floatCompare(cc *Compiler, x, y []*Wire) (lt, eq *Wire, err error) {
+	f, err := floatArgs(x, y, y)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := f.bits()
+	ux := f.unpack(cc, x)
+	uy := f.unpack(cc, y)
+
+	ordered := newINV(cc, newGate(cc, circuit.OR, ux.nan, uy.nan))
+	zeros := newGate(cc, circuit.AND, ux.zero, uy.zero)
+
+	// Map values to unsigned integers with the same order.
+	kx := make([]*Wire, n)
+	ky := make([]*Wire, n)
+	for i := 0; i < n-1; i++ {
+		kx[i] = newGate(cc, circuit.XOR, x[i], ux.sign)
+		ky[i] = newGate(cc, circuit.XOR, y[i], uy.sign)
+	}
+	kx[n-1] = newINV(cc, ux.sign)
+	ky[n-1] = newINV(cc, uy.sign)
+
+	lt = cc.Calloc.Wire()
+	err = NewLtComparator(cc, kx, ky, []*Wire{lt})
+	if err != nil {
+		return nil, nil, err
+	}
+	lt = newGate(cc, circuit.AND, lt, newINV(cc, zeros))
+	lt = newGate(cc, circuit.AND, lt, ordered)
+
+	eq = cc.Calloc.Wire()
+	err = NewEqComparator(cc, x, y, []*Wire{eq})
+	if err != nil {
+		return nil, nil, err
+	}
+	eq = newGate(cc, circuit.OR, eq, zeros)
+	eq = newGate(cc, circuit.AND, eq, ordered)
+
+	return lt, eq, nil
+}
+
+func floatComparator(cc *Compiler, x, y, r []*Wire, orEqual bool) error {
+	if len(r) != 1 {
+		return fmt.Errorf("invalid float comparator arguments: r=%d", len(r))
+	}
+	lt, eq, err := floatCompare(cc, x, y)
+	if err != nil {
+		return err
+	}
+	if orEqual {
+		cc.AddGate(cc.Calloc.BinaryGate(circuit.OR, lt, eq, r[0]))
+	} else {
+		cc.ID(lt, r[0])
+	}
+	return nil
+}
+
+// NewFloatLtComparator tests if x<y.
+func NewFloatLtComparator(cc *Compiler, x, y, r []*Wire) error {
+	return floatComparator(cc, x, y, r, false)
+}
+
+// NewFloatLeComparator tests if x<=y.
+func NewFloatLeComparator(cc *Compiler, x, y, r []*Wire) error {
+	return floatComparator(cc, x, y, r, true)
+}
+
+// NewFloatGtComparator tests if x>y.
+func NewFloatGtComparator(cc *Compiler, x, y, r []*Wire) error {
+	return floatComparator(cc, y, x, r, false)
+}
+
+// NewFloatGeComparator tests if x>=y.
+func NewFloatGeComparator(cc *Compiler, x, y, r []*Wire) error {
+	return floatComparator(cc, y, x, r, true)
+}
+
+// NewFloatEqComparator tests if x==y.
+func NewFloatEqComparator(cc *Compiler, x, y, r []*Wire) error {
+	if len(r) != 1 {
+		return fmt.Errorf("invalid float eq comparator arguments: r=%d",
+			len(r))
+	}
+	_, eq, err := floatCompare(cc, x, y)
+	if err != nil {
+		return err
+	}
+	cc.ID(eq, r[0])
+	return nil
+}
+
+// NewFloatNeqComparator tests if x!=y.
+func NewFloatNeqComparator(cc *Compiler, x, y, r []*Wire) error {
+	if len(r) != 1 {
+		return fmt.Errorf("invalid float neq comparator arguments: r=%d",
+			len(r))
+	}
+	_, eq, err := floatCompare(cc, x, y)
+	if err != nil {
+		return err
+	}
+	cc.INV(eq, r[0])
+	return nil
+}
+
+// NewIntToFloat creates a circuit that converts the signed integer x
+// to the floating point value z.
+func NewIntToFloat(cc *Compiler, x, z []*Wire) error {
+	return intToFloat(cc, x, z, true)
+}
+
+// NewUintToFloat creates a circuit that converts the unsigned integer
+// x to the floating point value z.
+func NewUintToFloat(cc *Compiler, x, z []*Wire) error {
+	return intToFloat(cc, x, z, false)
+}
+
+func intToFloat(cc *Compiler, x, z []*Wire, signed bool) error {
+	f, err := newFloatFormat(len(z))
+	if err != nil {
+		return err
+	}
+	sign := cc.ZeroWire()
+	sig := x
+	if signed {
+		sign = x[len(x)-1]
+		sig = mux(cc, sign, subtract(cc, constWires(cc, 0, len(x)), x), x)
+	}
+	ew := f.expWidth(len(x))
+	e := constWires(cc, f.bias()+int64(len(x))-1, ew)
+
+	return f.roundPack(cc, sign, e, sig, z)
+}
+
+// NewFloatToInt creates a circuit that converts the floating point
+// value x to the integer z. The conversion truncates the value toward
+// zero. The result is undefined if the value does not fit into z.
+func NewFloatToInt(cc *Compiler, x, z []*Wire) error {
+	f, err := newFloatFormat(len(x))
+	if err != nil {
+		return err
+	}
+	ux := f.unpack(cc, x)
+
+	w := len(z)
+	if w < len(ux.sig) {
+		w = len(ux.sig)
+	}
+	sig := extend(cc, ux.sig, w, false)
+
+	// The value is sig*2^(exp-bias-frac).
+	ew := f.expWidth(w)
+	e := subtract(cc, extend(cc, ux.exp, ew, false),
+		constWires(cc, f.bias()+int64(f.frac), ew))
+	left := shiftLeft(cc, sig, e)
+	right := shiftRight(cc, sig, subtract(cc, constWires(cc, 0, ew), e),
+		false)
+	mag := mux(cc, e[ew-1], right, left)[:len(z)]
+
+	return NewMUX(cc, []*Wire{ux.sign},
+		subtract(cc, constWires(cc, 0, len(z)), mag), mag, z)
+}
+
+// NewFloatConvert creates a circuit that converts the floating point
+// value x to the floating point value z of different size.
+func NewFloatConvert(cc *Compiler, x, z []*Wire) error {
+	fx, err := newFloatFormat(len(x))
+	if err != nil {
+		return err
+	}
+	fz, err := newFloatFormat(len(z))
+	if err != nil {
+		return err
+	}
+	ux := fx.unpack(cc, x)
+
+	ew := fx.expWidth(len(ux.sig))
+	if zw := fz.expWidth(len(ux.sig)); zw > ew {
+		ew = zw
+	}
+	e := add(cc, extend(cc, ux.exp, ew, false),
+		constWires(cc, fz.bias()-fx.bias(), ew), ew)
+
+	result := cc.Calloc.Wires(types.Size(fz.bits()))
+	err = fz.roundPack(cc, ux.sign, e, ux.sig, result)
+	if err != nil {
+		return err
+	}
+	result = mux(cc, ux.inf, fz.inf(cc, ux.sign), result)
+
+	return NewMUX(cc, []*Wire{ux.nan}, fz.nan(cc), result, z)
+}
+
+// newGate creates a binary gate and returns its output wire.
+func newGate(cc *Compiler, op circuit.Operation, a, b *Wire) *Wire {
+	o := cc.Calloc.Wire()
+	cc.AddGate(cc.Calloc.BinaryGate(op, a, b, o))
+	return o
+}
+
+// newINV creates an inverter and returns its output wire.
+func newINV(cc *Compiler, a *Wire) *Wire {
+	o := cc.Calloc.Wire()
+	cc.INV(a, o)
+	return o
+}
+
+// orReduce returns a wire that is set if any of the wires x is set.
+func orReduce(cc *Compiler, x []*Wire) *Wire {
+	if len(x) == 0 {
+		return cc.ZeroWire()
+	}
+	r := x[0]
+	for i := 1; i < len(x); i++ {
+		r = newGate(cc, circuit.OR, r, x[i])
+	}
+	return r
+}
+
+// andReduce returns a wire that is set if all of the wires x are set.
+func andReduce(cc *Compiler, x []*Wire) *Wire {
+	if len(x) == 0 {
+		return cc.OneWire()
+	}
+	r := x[0]
+	for i := 1; i < len(x); i++ {
+		r = newGate(cc, circuit.AND, r, x[i])
+	}
+	return r
+}
+
+// constWires returns the bits wires holding the value v.
+func constWires(cc *Compiler, v int64, bits int) []*Wire {
+	result := make([]*Wire, bits)
+	for i := 0; i < bits; i++ {
+		if i < 64 && v&(1<<i) != 0 || i >= 64 && v < 0 {
+			result[i] = cc.OneWire()
+		} else {
+			result[i] = cc.ZeroWire()
+		}
+	}
+	return result
+}
+
+// extend extends or truncates x to bits wires. The signed flag
+// specifies if the value is sign or zero extended.
+func extend(cc *Compiler, x []*Wire, bits int, signed bool) []*Wire {
+	result := make([]*Wire, bits)
+	for i := 0; i < bits; i++ {
+		if i < len(x) {
+			result[i] = x[i]
+		} else if signed {
+			result[i] = x[len(x)-1]
+		} else {
+			result[i] = cc.ZeroWire()
+		}
+	}
+	return result
+}
+
+// add returns bits wires holding the value x+y.
+func add(cc *Compiler, x, y []*Wire, bits int) []*Wire {
+	z := cc.Calloc.Wires(types.Size(bits))
+	NewAdder(cc, extend(cc, x, bits, false), extend(cc, y, bits, false), z)
+	return z
+}
+
+// subtract returns wires holding the value x-y. The arguments must
+// have the same size.
+func subtract(cc *Compiler, x, y []*Wire) []*Wire {
+	z := cc.Calloc.Wires(types.Size(len(x)))
+	NewSubtractor(cc, x, y, z)
+	return z
+}
+
+// mux returns wires holding the value t if c is set and f otherwise.
+func mux(cc *Compiler, c *Wire, t, f []*Wire) []*Wire {
+	z := cc.Calloc.Wires(types.Size(len(t)))
+	NewMUX(cc, []*Wire{c}, t, f, z)
+	return z
+}
+
+// shiftRight shifts x right by the unsigned amount s. If the sticky
+// flag is set, the bits shifted out are ORed into the lowest result
+// bit.
+func shiftRight(cc *Compiler, x, s []*Wire, sticky bool) []*Wire {
+	zero := cc.ZeroWire()
+	lost := zero
+	for k := 0; k < len(s); k++ {
+		n := 1 << k
+		if n >= len(x) {
+			// The remaining shift bits shift all bits out.
+			over := orReduce(cc, s[k:])
+			if sticky {
+				lost = newGate(cc, circuit.OR, lost,
+					newGate(cc, circuit.AND, over, orReduce(cc, x)))
+			}
+			x = mux(cc, over, constWires(cc, 0, len(x)), x)
+			break
+		}
+		if sticky {
+			lost = newGate(cc, circuit.OR, lost,
+				newGate(cc, circuit.AND, s[k], orReduce(cc, x[:n])))
+		}
+		x = mux(cc, s[k], extend(cc, x[n:], len(x), false), x)
+	}
+	if sticky && lost != zero {
+		result := make([]*Wire, len(x))
+		copy(result, x)
+		result[0] = newGate(cc, circuit.OR, x[0], lost)
+		x = result
+	}
+	return x
+}
+
+// shiftLeft shifts x left by the unsigned amount s.
+func shiftLeft(cc *Compiler, x, s []*Wire) []*Wire {
+	for k := 0; k < len(s); k++ {
+		n := 1 << k
+		if n >= len(x) {
+			over := orReduce(cc, s[k:])
+			return mux(cc, over, constWires(cc, 0, len(x)), x)
+		}
+		shifted := append(constWires(cc, 0, n), x[:len(x)-n]...)
+		x = mux(cc, s[k], shifted, x)
+	}
+	return x
+}
+
+// normalize shifts x left until its highest bit is set. It returns
+// the shifted value and the number of leading zero bits. The result
+// is undefined if x is zero.
+func normalize(cc *Compiler, x []*Wire) (result, lz []*Wire) {
+	var k int
+	for 1<<(k+1) < len(x) {
+		k++
+	}
+	lz = make([]*Wire, k+1)
+	for ; k >= 0; k-- {
+		n := 1 << k
+		if n > len(x) {
+			n = len(x)
+		}
+		zero := newINV(cc, orReduce(cc, x[len(x)-n:]))
+		shifted := append(constWires(cc, 0, n), x[:len(x)-n]...)
+		x = mux(cc, zero, shifted, x)
+		lz[k] = zero
+	}
+	return x, lz
+}
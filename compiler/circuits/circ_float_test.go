@@ -0,0 +1,300 @@
+//
+// circ_float_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+var float64Tests = []float64{
+	0, math.Copysign(0, -1), 1, -1, 0.5, 1.5, 2.5, -3.75, 3, 10, 0.1, 1e-3,
+	1e300, -1e300, 1e-300, math.MaxFloat64, -math.MaxFloat64,
+	math.SmallestNonzeroFloat64, -math.SmallestNonzeroFloat64,
+	2.2250738585072014e-308, 1.5e-310, math.Inf(1), math.Inf(-1), math.NaN(),
+	4503599627370497, 9007199254740993, 1 + 1.0/(1<<52),
+}
+
+var float32Tests = []float32{
+	0, float32(math.Copysign(0, -1)), 1, -1, 0.5, 1.5, 2.5, -3.75, 3, 10,
+	0.1, 1e-3, 1e38, -1e38, 1e-38, math.MaxFloat32, -math.MaxFloat32,
+	math.SmallestNonzeroFloat32, -math.SmallestNonzeroFloat32,
+	1.1754944e-38, 1.5e-40, float32(math.Inf(1)), float32(math.Inf(-1)),
+	float32(math.NaN()), 8388609, 16777217, 1 + 1.0/(1<<23),
+}
+
+func floatCircuit(t *testing.T, inBits, outBits int,
+	f func(cc *Compiler, in, out []*Wire) error) *circuit.Circuit {
+
+	inputs := makeWires(inBits, false)
+	outputs := makeWires(outBits, true)
+	cc, err := NewCompiler(params, calloc, NewIO(inBits, "in"),
+		NewIO(outBits, "out"), inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+	err = f(cc, inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc.Compile()
+}
+
+func floatCompute(t *testing.T, circ *circuit.Circuit, bits int,
+	args ...uint64) uint64 {
+
+	input := new(big.Int)
+	for i := len(args) - 1; i >= 0; i-- {
+		input.Lsh(input, uint(bits))
+		input.Or(input, new(big.Int).SetUint64(args[i]))
+	}
+	out, err := circ.Compute([]*big.Int{input})
+	if err != nil {
+		t.Fatalf("Compute: %s", err)
+	}
+	return out[0].Uint64()
+}
+
+func float64Values(count int) []float64 {
+	rnd := rand.New(rand.NewSource(42))
+	values := append([]float64{}, float64Tests...)
+	for i := 0; i < count; i++ {
+		values = append(values, math.Float64frombits(rnd.Uint64()))
+		values = append(values, rnd.NormFloat64()*1000)
+	}
+	return values
+}
+
+func float32Values(count int) []float32 {
+	rnd := rand.New(rand.NewSource(42))
+	values := append([]float32{}, float32Tests...)
+	for i := 0; i < count; i++ {
+		values = append(values, math.Float32frombits(rnd.Uint32()))
+		values = append(values, float32(rnd.NormFloat64()*1000))
+	}
+	return values
+}
+
+func sameFloat64(a, b uint64) bool {
+	if math.IsNaN(math.Float64frombits(a)) {
+		return math.IsNaN(math.Float64frombits(b))
+	}
+	return a == b
+}
+
+func sameFloat32(a, b uint32) bool {
+	if math.IsNaN(float64(math.Float32frombits(a))) {
+		return math.IsNaN(float64(math.Float32frombits(b)))
+	}
+	return a == b
+}
+
+type floatOp struct {
+	name string
+	circ func(cc *Compiler, x, y, z []*Wire) error
+	f64  func(x, y float64) float64
+	f32  func(x, y float32) float32
+}
+
+var floatOps = []floatOp{
+	{
+		name: "add",
+		circ: NewFloatAdder,
+		f64:  func(x, y float64) float64 { return x + y },
+		f32:  func(x, y float32) float32 { return x + y },
+	},
+	{
+		name: "sub",
+		circ: NewFloatSubtractor,
+		f64:  func(x, y float64) float64 { return x - y },
+		f32:  func(x, y float32) float32 { return x - y },
+	},
+	{
+		name: "mul",
+		circ: NewFloatMultiplier,
+		f64:  func(x, y float64) float64 { return x * y },
+		f32:  func(x, y float32) float32 { return x * y },
+	},
+	{
+		name: "div",
+		circ: NewFloatDivider,
+		f64:  func(x, y float64) float64 { return x / y },
+		f32:  func(x, y float32) float32 { return x / y },
+	},
+}
+
+func TestFloat64Arithmetic(t *testing.T) {
+	values := float64Values(10)
+	for _, op := range floatOps {
+		circ := floatCircuit(t, 128, 64, func(cc *Compiler, in,
+			out []*Wire) error {
+			return op.circ(cc, in[:64], in[64:], out)
+		})
+		for _, x := range values {
+			for _, y := range values {
+				xb := math.Float64bits(x)
+				yb := math.Float64bits(y)
+				expected := math.Float64bits(op.f64(x, y))
+				result := floatCompute(t, circ, 64, xb, yb)
+				if !sameFloat64(result, expected) {
+					t.Errorf("%v %s %v: got %v (%x), expected %v (%x)",
+						x, op.name, y, math.Float64frombits(result), result,
+						math.Float64frombits(expected), expected)
+				}
+			}
+		}
+	}
+}
+
+func TestFloat32Arithmetic(t *testing.T) {
+	values := float32Values(10)
+	for _, op := range floatOps {
+		circ := floatCircuit(t, 64, 32, func(cc *Compiler, in,
+			out []*Wire) error {
+			return op.circ(cc, in[:32], in[32:], out)
+		})
+		for _, x := range values {
+			for _, y := range values {
+				xb := math.Float32bits(x)
+				yb := math.Float32bits(y)
+				expected := math.Float32bits(op.f32(x, y))
+				result := uint32(floatCompute(t, circ, 32, uint64(xb),
+					uint64(yb)))
+				if !sameFloat32(result, expected) {
+					t.Errorf("%v %s %v: got %v (%x), expected %v (%x)",
+						x, op.name, y, math.Float32frombits(result), result,
+						math.Float32frombits(expected), expected)
+				}
+			}
+		}
+	}
+}
+
+func TestFloatComparators(t *testing.T) {
+	comparators := []struct {
+		name string
+		circ func(cc *Compiler, x, y, r []*Wire) error
+		cmp  func(x, y float64) bool
+	}{
+		{"<", NewFloatLtComparator, func(x, y float64) bool { return x < y }},
+		{"<=", NewFloatLeComparator, func(x, y float64) bool { return x <= y }},
+		{">", NewFloatGtComparator, func(x, y float64) bool { return x > y }},
+		{">=", NewFloatGeComparator, func(x, y float64) bool { return x >= y }},
+		{"==", NewFloatEqComparator, func(x, y float64) bool { return x == y }},
+		{"!=", NewFloatNeqComparator, func(x, y float64) bool { return x != y }},
+	}
+	values := float64Values(5)
+	for _, c := range comparators {
+		circ := floatCircuit(t, 128, 1, func(cc *Compiler, in,
+			out []*Wire) error {
+			return c.circ(cc, in[:64], in[64:], out)
+		})
+		for _, x := range values {
+			for _, y := range values {
+				result := floatCompute(t, circ, 64, math.Float64bits(x),
+					math.Float64bits(y))
+				if (result == 1) != c.cmp(x, y) {
+					t.Errorf("%v %s %v: got %v", x, c.name, y, result == 1)
+				}
+			}
+		}
+	}
+}
+
+func TestIntToFloat(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	values := []int64{
+		0, 1, -1, 2, 3, 1 << 24, 1<<24 + 1, 1<<24 + 3, 1<<53 + 1, 1<<53 + 3,
+		-(1<<53 + 1), math.MaxInt64, math.MinInt64, math.MaxInt32,
+		math.MinInt32,
+	}
+	for i := 0; i < 50; i++ {
+		values = append(values, rnd.Int63()>>rnd.Intn(63)*int64(rnd.Intn(3)-1))
+	}
+	i64 := floatCircuit(t, 64, 64, NewIntToFloat)
+	u64 := floatCircuit(t, 64, 64, NewUintToFloat)
+	i32 := floatCircuit(t, 32, 32, NewIntToFloat)
+	i64f32 := floatCircuit(t, 64, 32, NewIntToFloat)
+
+	for _, v := range values {
+		result := floatCompute(t, i64, 64, uint64(v))
+		if expected := math.Float64bits(float64(v)); result != expected {
+			t.Errorf("float64(int64(%v)): got %v, expected %v", v,
+				math.Float64frombits(result), float64(v))
+		}
+		result = floatCompute(t, u64, 64, uint64(v))
+		if expected := math.Float64bits(float64(uint64(v))); result !=
+			expected {
+			t.Errorf("float64(uint64(%v)): got %v, expected %v", uint64(v),
+				math.Float64frombits(result), float64(uint64(v)))
+		}
+		result = floatCompute(t, i32, 32, uint64(uint32(v)))
+		expected := uint64(math.Float32bits(float32(int32(v))))
+		if result != expected {
+			t.Errorf("float32(int32(%v)): got %v, expected %v", int32(v),
+				math.Float32frombits(uint32(result)), float32(int32(v)))
+		}
+		result = floatCompute(t, i64f32, 64, uint64(v))
+		expected = uint64(math.Float32bits(float32(v)))
+		if result != expected {
+			t.Errorf("float32(int64(%v)): got %v, expected %v", v,
+				math.Float32frombits(uint32(result)), float32(v))
+		}
+	}
+}
+
+func TestFloatToInt(t *testing.T) {
+	f64 := floatCircuit(t, 64, 64, NewFloatToInt)
+	f32 := floatCircuit(t, 32, 32, NewFloatToInt)
+	values := float64Values(50)
+	for _, v := range values {
+		if math.IsNaN(v) || math.Abs(v) >= 1<<63 {
+			continue
+		}
+		result := int64(floatCompute(t, f64, 64, math.Float64bits(v)))
+		if result != int64(v) {
+			t.Errorf("int64(%v): got %v, expected %v", v, result, int64(v))
+		}
+		v32 := float32(v)
+		if math.Abs(float64(v32)) >= 1<<31 {
+			continue
+		}
+		result32 := int32(floatCompute(t, f32, 32,
+			uint64(math.Float32bits(v32))))
+		if result32 != int32(v32) {
+			t.Errorf("int32(%v): got %v, expected %v", v32, result32,
+				int32(v32))
+		}
+	}
+}
+
+func TestFloatConvert(t *testing.T) {
+	narrow := floatCircuit(t, 64, 32, NewFloatConvert)
+	for _, v := range float64Values(50) {
+		result := uint32(floatCompute(t, narrow, 64, math.Float64bits(v)))
+		expected := math.Float32bits(float32(v))
+		if !sameFloat32(result, expected) {
+			t.Errorf("float32(%v): got %v, expected %v", v,
+				math.Float32frombits(result), float32(v))
+		}
+	}
+	widen := floatCircuit(t, 32, 64, NewFloatConvert)
+	for _, v := range float32Values(50) {
+		result := floatCompute(t, widen, 32, uint64(math.Float32bits(v)))
+		expected := math.Float64bits(float64(v))
+		if !sameFloat64(result, expected) {
+			t.Errorf("float64(%v): got %v, expected %v", v,
+				math.Float64frombits(result), float64(v))
+		}
+	}
+}
@@ -1,7 +1,7 @@
 //
 // circuits_test.go
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -10,6 +10,7 @@ package circuits
 
 import (
 	"fmt"
+	"math/big"
 	"os"
 	"testing"
 
@@ -142,3 +143,46 @@ func TestMultiply(t *testing.T) {
 		result.Marshal(os.Stdout)
 	}
 }
+
+func TestRewriteORINV(t *testing.T) {
+	inputs := makeWires(3, false)
+	outputs := makeWires(4, true)
+	c, err := NewCompiler(params, calloc, NewIO(3, "in"), NewIO(4, "out"),
+		inputs, outputs)
+	if err != nil {
+		t.Fatalf("NewCompiler: %s", err)
+	}
+
+	c.AddGate(c.Calloc.BinaryGate(circuit.OR, inputs[0], inputs[1],
+		outputs[0]))
+	c.AddGate(c.Calloc.INVGate(inputs[2], outputs[1]))
+	c.AddGate(c.Calloc.BinaryGate(circuit.XOR, inputs[0], c.ZeroWire(),
+		outputs[2]))
+	c.AddGate(c.Calloc.BinaryGate(circuit.XOR, inputs[1], c.OneWire(),
+		outputs[3]))
+
+	c.RewriteORINV()
+	c.Prune()
+	result := c.Compile()
+	if verbose {
+		fmt.Printf("Result: %s\n", result)
+		result.Marshal(os.Stdout)
+	}
+	if result.Stats[circuit.AND] != 1 || result.Stats[circuit.OR] != 0 ||
+		result.Stats[circuit.INV] != 0 {
+		t.Errorf("unexpected gates: %s", result)
+	}
+
+	for i := int64(0); i < 8; i++ {
+		out, err := result.Compute([]*big.Int{big.NewInt(i)})
+		if err != nil {
+			t.Fatalf("Compute: %s", err)
+		}
+		a := i & 1
+		b := (i >> 1) & 1
+		expected := (a | b) | (^(i>>2)&1)<<1 | a<<2 | (b^1)<<3
+		if out[0].Int64() != expected {
+			t.Errorf("%03b: got %04b, expected %04b", i, out[0], expected)
+		}
+	}
+}
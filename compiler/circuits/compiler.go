@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -324,6 +324,71 @@ func (cc *Compiler) ShortCircuitXORZero() {
 	}
 }
 
+// RewriteORINV rewrites OR gates as XOR-AND-XOR and INV gates as XOR
+// with a constant one wire so that only AND gates need garbled
+// tables. The gates computing the constant zero and one wires are
+// rewritten as free XOR and XNOR gates of the first input wire.
+func (cc *Compiler) RewriteORINV() {
+	var stats circuit.Stats
+
+	start := time.Now()
+
+	var one *Wire
+	gates := make([]*Gate, 0, len(cc.Gates))
+
+	for _, g := range cc.Gates {
+		switch g.Op {
+		case circuit.AND:
+			if g.O == cc.zeroWire {
+				// zero = XOR(i0, i0)
+				stats[g.Op]++
+				g.Op = circuit.XOR
+				g.ReplaceInput(g.B, g.A)
+			}
+
+		case circuit.OR:
+			stats[g.Op]++
+			if g.O == cc.oneWire {
+				// one = XNOR(i0, i0)
+				g.Op = circuit.XNOR
+				g.ReplaceInput(g.B, g.A)
+				break
+			}
+			// a|b = a^b^(a&b)
+			t0 := cc.Calloc.Wire()
+			t1 := cc.Calloc.Wire()
+			gates = append(gates,
+				cc.Calloc.BinaryGate(circuit.XOR, g.A, g.B, t0),
+				cc.Calloc.BinaryGate(circuit.AND, g.A, g.B, t1))
+			g.Op = circuit.XOR
+			g.ReplaceInput(g.A, t0)
+			g.ReplaceInput(g.B, t1)
+
+		case circuit.INV:
+			stats[g.Op]++
+			if one == nil {
+				one = cc.Calloc.Wire()
+				i0 := cc.InputWires[0]
+				gates = append(gates,
+					cc.Calloc.BinaryGate(circuit.XNOR, i0, i0, one))
+			}
+			g.Op = circuit.XOR
+			g.B = one
+			one.AddOutput(g)
+		}
+		gates = append(gates, g)
+	}
+	cc.Gates = gates
+
+	elapsed := time.Since(start)
+
+	if cc.Params.Diagnostics && stats.Count() > 0 {
+		fmt.Printf(" - RewriteORINV:        %12s: %d/%d (%.2f%%)\n",
+			elapsed, stats.Count(), len(cc.Gates),
+			float64(stats.Count())/float64(len(cc.Gates))*100)
+	}
+}
+
 // Prune removes all gates whose output wires are unused.
 func (cc *Compiler) Prune() int {
 
@@ -0,0 +1,529 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/bits"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+const (
+	// cutSize specifies the maximum number of cut leaves.
+	cutSize = 4
+	// maxCuts specifies the maximum number of cuts per wire.
+	maxCuts = 8
+)
+
+// cut defines a cut of a wire: the wire's value is the function tt
+// of the leaf wires. The sign is a bloom filter of the leaves.
+type cut struct {
+	leaves [cutSize]int32
+	n      int
+	sign   uint64
+	tt     uint16
+}
+
+func newCut(w int32) cut {
+	return cut{
+		leaves: [cutSize]int32{w},
+		n:      1,
+		sign:   1 << (w % 64),
+		tt:     xagVars[0],
+	}
+}
+
+func (c *cut) isLeaf(w int32) bool {
+	for i := 0; i < c.n; i++ {
+		if c.leaves[i] == w {
+			return true
+		}
+	}
+	return false
+}
+
+// subset tests if the leaves of the cut c are a subset of the leaves
+// of the cut o.
+func (c *cut) subset(o *cut) bool {
+	if c.n > o.n || c.sign&^o.sign != 0 {
+		return false
+	}
+	for i := 0; i < c.n; i++ {
+		if !o.isLeaf(c.leaves[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge merges the leaves of the cuts a and b. The function returns
+// false if the merged cut has more than cutSize leaves.
+func merge(a, b *cut) (cut, bool) {
+	var result cut
+	result.sign = a.sign | b.sign
+	if bits.OnesCount64(result.sign) > cutSize {
+		return result, false
+	}
+	var i, j int
+	for i < a.n || j < b.n {
+		if result.n >= cutSize {
+			return result, false
+		}
+		switch {
+		case j >= b.n || (i < a.n && a.leaves[i] < b.leaves[j]):
+			result.leaves[result.n] = a.leaves[i]
+			i++
+		case i >= a.n || b.leaves[j] < a.leaves[i]:
+			result.leaves[result.n] = b.leaves[j]
+			j++
+		default:
+			result.leaves[result.n] = a.leaves[i]
+			i++
+			j++
+		}
+		result.n++
+	}
+	return result, true
+}
+
+// expand expands the truth table of the cut c to the leaves of the
+// cut to. The leaves of c are a sorted subset of the leaves of to so
+// the expansion moves the variables to their new positions, starting
+// from the last variable.
+func expand(c *cut, to *cut) uint16 {
+	tt := c.tt
+	j := to.n - 1
+	for i := c.n - 1; i >= 0; i-- {
+		for to.leaves[j] != c.leaves[i] {
+			j--
+		}
+		if i != j {
+			tt = swapVars(tt, i, j)
+		}
+		j--
+	}
+	return tt
+}
+
+// swapVars swaps the variables i and j, i < j, of the truth table
+// tt.
+func swapVars(tt uint16, i, j int) uint16 {
+	shift := (1 << j) - (1 << i)
+	m := xagVars[i] &^ xagVars[j]
+	return tt&^(m|m<<shift) | (tt&m)<<shift | (tt>>shift)&m
+}
+
+// rewriter implements the cut rewriting. The wires are indexed with
+// integer IDs and the gates with their positions in the gates array.
+type rewriter struct {
+	cc      *Compiler
+	db      *xagDB
+	gates   []*Gate
+	inputs  [][2]int32
+	outputs []int32
+	dead    []bool
+	replace [][]*Gate
+	consts  []*Gate
+	index   map[*Wire]int32
+	wires   []*Wire
+	driver  []int32
+	refs    []int32
+	cuts    [][]cut
+	arena   []cut
+	scratch []cut
+	zero    *Wire
+	one     *Wire
+	emitted []*Gate
+}
+
+func (rw *rewriter) id(w *Wire) int32 {
+	id, ok := rw.index[w]
+	if !ok {
+		id = int32(len(rw.wires))
+		rw.index[w] = id
+		rw.wires = append(rw.wires, w)
+		rw.driver = append(rw.driver, -1)
+		var refs int32
+		if w.Output() {
+			refs = 1
+		}
+		rw.refs = append(rw.refs, refs)
+		rw.cuts = append(rw.cuts, nil)
+	}
+	return id
+}
+
+func (rw *rewriter) numInputs(gi int32) int {
+	if rw.gates[gi].Op == circuit.INV {
+		return 1
+	}
+	return 2
+}
+
+func gateCost(g *Gate) int {
+	switch g.Op {
+	case circuit.AND, circuit.OR:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// wireCuts returns the cuts of the wire w. The first cut is the
+// trivial cut of the wire itself.
+func (rw *rewriter) wireCuts(w int32, trivial *[1]cut) []cut {
+	if rw.cuts[w] != nil {
+		return rw.cuts[w]
+	}
+	trivial[0] = newCut(w)
+	return trivial[:]
+}
+
+// computeCuts computes the cuts of the output wire of the gate gi.
+func (rw *rewriter) computeCuts(gi int32) []cut {
+	g := rw.gates[gi]
+	result := append(rw.scratch[:0], newCut(rw.outputs[gi]))
+
+	add := func(c cut) {
+		for i := 0; i < len(result); i++ {
+			if result[i].subset(&c) {
+				return
+			}
+		}
+		n := 1
+		for i := 1; i < len(result); i++ {
+			if !c.subset(&result[i]) {
+				result[n] = result[i]
+				n++
+			}
+		}
+		result = append(result[:n], c)
+	}
+
+	var ta, tb [1]cut
+	ca := rw.wireCuts(rw.inputs[gi][0], &ta)
+	if g.Op == circuit.INV {
+		for _, c := range ca {
+			c.tt = ^c.tt
+			add(c)
+		}
+	} else {
+		cb := rw.wireCuts(rw.inputs[gi][1], &tb)
+		for i := range ca {
+			for j := range cb {
+				c, ok := merge(&ca[i], &cb[j])
+				if !ok {
+					continue
+				}
+				a := expand(&ca[i], &c)
+				b := expand(&cb[j], &c)
+				switch g.Op {
+				case circuit.XOR:
+					c.tt = a ^ b
+				case circuit.XNOR:
+					c.tt = ^(a ^ b)
+				case circuit.AND:
+					c.tt = a & b
+				case circuit.OR:
+					c.tt = a | b
+				}
+				add(c)
+			}
+		}
+	}
+	// Sort the non-trivial cuts by their sizes.
+	for i := 2; i < len(result); i++ {
+		for j := i; j > 1 && result[j].n < result[j-1].n; j-- {
+			result[j], result[j-1] = result[j-1], result[j]
+		}
+	}
+	if len(result) > maxCuts {
+		result = result[:maxCuts]
+	}
+	rw.scratch = result
+
+	if len(rw.arena)+len(result) > cap(rw.arena) {
+		rw.arena = make([]cut, 0, 65536)
+	}
+	start := len(rw.arena)
+	rw.arena = append(rw.arena, result...)
+	return rw.arena[start:len(rw.arena):len(rw.arena)]
+}
+
+// deref dereferences the gate gi and the gates of its maximum
+// fanout-free cone down to the leaves of the cut c. The function
+// returns the number of AND gates in the cone. If removed is not nil,
+// the cone gates are appended to it.
+func (rw *rewriter) deref(gi int32, c *cut, removed *[]int32) int {
+	cost := gateCost(rw.gates[gi])
+	if removed != nil {
+		*removed = append(*removed, gi)
+	}
+	for i := 0; i < rw.numInputs(gi); i++ {
+		w := rw.inputs[gi][i]
+		rw.refs[w]--
+		if rw.refs[w] == 0 && !c.isLeaf(w) && rw.driver[w] >= 0 {
+			cost += rw.deref(rw.driver[w], c, removed)
+		}
+	}
+	return cost
+}
+
+// ref references the gates dereferenced by deref.
+func (rw *rewriter) ref(gi int32, c *cut) {
+	for i := 0; i < rw.numInputs(gi); i++ {
+		w := rw.inputs[gi][i]
+		if rw.refs[w] == 0 && !c.isLeaf(w) && rw.driver[w] >= 0 {
+			rw.ref(rw.driver[w], c)
+		}
+		rw.refs[w]++
+	}
+}
+
+func (rw *rewriter) gate(op circuit.Operation, a, b, o *Wire) {
+	if o == nil {
+		o = rw.cc.Calloc.Wire()
+	}
+	g := rw.cc.Calloc.BinaryGate(op, a, b, o)
+	rw.emitted = append(rw.emitted, g)
+	for _, w := range []*Wire{a, b} {
+		if id, ok := rw.index[w]; ok {
+			rw.refs[id]++
+		}
+	}
+}
+
+func (rw *rewriter) constant(one bool) *Wire {
+	i0 := rw.cc.InputWires[0]
+	if one {
+		if rw.one == nil {
+			rw.one = rw.cc.Calloc.Wire()
+			rw.consts = append(rw.consts, rw.cc.Calloc.BinaryGate(
+				circuit.XNOR, i0, i0, rw.one))
+		}
+		return rw.one
+	}
+	if rw.zero == nil {
+		rw.zero = rw.cc.Calloc.Wire()
+		rw.consts = append(rw.consts, rw.cc.Calloc.BinaryGate(
+			circuit.XOR, i0, i0, rw.zero))
+	}
+	return rw.zero
+}
+
+// linConst is the constant term of the linear combinations of the
+// emit function.
+const linConst = 0x8000
+
+// realize creates XOR gates computing the linear combination lin of
+// the nodes. If o is nil, the function returns the result wire,
+// possibly without creating any gates. Otherwise the result is
+// computed to the wire o.
+func (rw *rewriter) realize(lin uint16, nodes []*Wire, o *Wire) *Wire {
+	var terms []*Wire
+	for i, w := range nodes {
+		if lin&(1<<i) != 0 {
+			terms = append(terms, w)
+		}
+	}
+	neg := lin&linConst != 0
+	if o == nil {
+		if len(terms) == 0 {
+			return rw.constant(neg)
+		}
+		if len(terms) == 1 && !neg {
+			return terms[0]
+		}
+		o = rw.cc.Calloc.Wire()
+	}
+	op := circuit.XOR
+	if neg {
+		op = circuit.XNOR
+	}
+	switch len(terms) {
+	case 0:
+		i0 := rw.cc.InputWires[0]
+		rw.gate(op, i0, i0, o)
+
+	case 1:
+		rw.gate(op, terms[0], rw.constant(false), o)
+
+	default:
+		acc := terms[0]
+		for i := 1; i < len(terms); i++ {
+			if i+1 < len(terms) {
+				w := rw.cc.Calloc.Wire()
+				rw.gate(circuit.XOR, acc, terms[i], w)
+				acc = w
+			} else {
+				rw.gate(op, acc, terms[i], o)
+			}
+		}
+	}
+	return o
+}
+
+// emit creates the AND-optimal implementation of the cut c to the
+// wire o.
+func (rw *rewriter) emit(c *cut, o *Wire) {
+	cls, e := rw.db.lookup(c.tt)
+
+	// The missing leaves are constant zero.
+	var unused uint16
+	for i := c.n; i < cutSize; i++ {
+		unused |= 1 << i
+	}
+	lin := func(f xagForm) uint16 {
+		result := uint16(f & xagInputs)
+		if f&xagConst != 0 {
+			result |= linConst
+		}
+		return result &^ unused
+	}
+	var y [4]uint16
+	for i := 0; i < 4; i++ {
+		y[i] = lin(e.y[i])
+	}
+	form := func(f xagForm) uint16 {
+		result := uint16(f & 0x70)
+		for i := 0; i < 4; i++ {
+			if f&(1<<i) != 0 {
+				result ^= y[i]
+			}
+		}
+		if f&xagConst != 0 {
+			result ^= linConst
+		}
+		return result
+	}
+
+	nodes := make([]*Wire, 7)
+	for i := 0; i < c.n; i++ {
+		nodes[i] = rw.wires[c.leaves[i]]
+	}
+	out := form(cls.out) ^ lin(e.out)
+	last := len(cls.ands) - 1
+	for idx, and := range cls.ands {
+		a := rw.realize(form(and[0]), nodes, nil)
+		b := rw.realize(form(and[1]), nodes, nil)
+		if idx == last && out == 1<<(4+idx) {
+			rw.gate(circuit.AND, a, b, o)
+			return
+		}
+		nodes[4+idx] = rw.cc.Calloc.Wire()
+		rw.gate(circuit.AND, a, b, nodes[4+idx])
+	}
+	rw.realize(out, nodes, o)
+}
+
+// RewriteCuts rewrites the circuit by replacing subcircuits with
+// equivalent subcircuits that use fewer AND gates. The function
+// enumerates the 4-input cuts of each wire and replaces the maximum
+// fanout-free cone of the cut with its AND-optimal implementation
+// from the XAG database if the replacement reduces the number of AND
+// gates. The function returns the circuit statistics before and after
+// the rewrite.
+func (cc *Compiler) RewriteCuts() (before, after circuit.Stats) {
+	cc.Prune()
+
+	rw := &rewriter{
+		cc:    cc,
+		db:    getXAGDB(),
+		index: make(map[*Wire]int32),
+	}
+	for _, g := range cc.Gates {
+		if g.Dead {
+			continue
+		}
+		before[g.Op]++
+
+		gi := int32(len(rw.gates))
+		rw.gates = append(rw.gates, g)
+
+		var in [2]int32
+		in[0] = rw.id(g.A)
+		rw.refs[in[0]]++
+		if g.Op != circuit.INV {
+			in[1] = rw.id(g.B)
+			rw.refs[in[1]]++
+		}
+		rw.inputs = append(rw.inputs, in)
+
+		o := rw.id(g.O)
+		rw.driver[o] = gi
+		rw.outputs = append(rw.outputs, o)
+	}
+	rw.dead = make([]bool, len(rw.gates))
+	rw.replace = make([][]*Gate, len(rw.gates))
+
+	// Compute cuts in the topological order.
+	for gi := range rw.gates {
+		switch rw.gates[gi].Op {
+		case circuit.XOR, circuit.XNOR, circuit.AND, circuit.OR,
+			circuit.INV:
+			rw.cuts[rw.outputs[gi]] = rw.computeCuts(int32(gi))
+		}
+	}
+
+	// Rewrite in the reverse topological order.
+	for gi := int32(len(rw.gates) - 1); gi >= 0; gi-- {
+		o := rw.outputs[gi]
+		if rw.dead[gi] || rw.refs[o] == 0 || rw.driver[o] != gi {
+			continue
+		}
+		var best *cut
+		var bestGain int
+		cuts := rw.cuts[o]
+		for i := 1; i < len(cuts); i++ {
+			c := &cuts[i]
+			cls, _ := rw.db.lookup(c.tt)
+			gain := rw.deref(gi, c, nil) - len(cls.ands)
+			rw.ref(gi, c)
+			if gain > bestGain {
+				best = c
+				bestGain = gain
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		var removed []int32
+		rw.deref(gi, best, &removed)
+		for _, r := range removed {
+			g := rw.gates[r]
+			g.Dead = true
+			g.A.RemoveOutput(g)
+			if g.Op != circuit.INV {
+				g.B.RemoveOutput(g)
+			}
+			rw.dead[r] = true
+		}
+		rw.driver[o] = -1
+
+		w := rw.wires[o]
+		w.SetInput(nil)
+		rw.emitted = nil
+		rw.emit(best, w)
+		rw.replace[gi] = rw.emitted
+	}
+
+	gates := make([]*Gate, 0, len(cc.Gates))
+	gates = append(gates, rw.consts...)
+	for gi, g := range rw.gates {
+		gates = append(gates, rw.replace[gi]...)
+		if !rw.dead[gi] {
+			gates = append(gates, g)
+		}
+	}
+	cc.Gates = gates
+
+	for _, g := range cc.Gates {
+		after[g.Op]++
+	}
+	return
+}
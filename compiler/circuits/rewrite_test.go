@@ -0,0 +1,147 @@
+//
+// rewrite_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+)
+
+func TestXAGDB(t *testing.T) {
+	db := getXAGDB()
+
+	var counts [4]int
+	for _, cls := range db.classes {
+		counts[len(cls.ands)]++
+	}
+	if counts != [4]int{1, 1, 3, 3} {
+		t.Errorf("unexpected class AND counts: %v", counts)
+	}
+
+	for f := 0; f < 1<<16; f++ {
+		cls, e := db.lookup(uint16(f))
+
+		var vars [7]uint16
+		for i := 0; i < 4; i++ {
+			vars[i] = evalForm(e.y[i], xagVars[:])
+		}
+		for idx, and := range cls.ands {
+			vars[4+idx] = evalForm(and[0], vars[:]) &
+				evalForm(and[1], vars[:])
+		}
+		tt := evalForm(cls.out, vars[:]) ^ evalForm(e.out, xagVars[:])
+		if tt != uint16(f) {
+			t.Fatalf("function %04x: got %04x", f, tt)
+		}
+	}
+}
+
+type buildFunc func(cc *Compiler, x, y, z []*Wire) error
+
+// newMajority creates the majority function OR(AND(x, y), AND(x, z),
+// AND(y, z)) of the argument bits.
+func newMajority(cc *Compiler, x, y, z []*Wire) error {
+	xy := cc.Calloc.Wire()
+	xz := cc.Calloc.Wire()
+	yz := cc.Calloc.Wire()
+	t := cc.Calloc.Wire()
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, x[0], y[0], xy))
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, x[0], y[1], xz))
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.AND, y[0], y[1], yz))
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.OR, xy, xz, t))
+	cc.AddGate(cc.Calloc.BinaryGate(circuit.OR, t, yz, z[0]))
+	return nil
+}
+
+var rewriteTests = []struct {
+	name   string
+	xBits  int
+	yBits  int
+	zBits  int
+	build  buildFunc
+	maxAND uint64
+}{
+	{"majority", 1, 2, 1, newMajority, 1},
+	{"adder", 8, 8, 9, NewAdder, 8},
+	{"lt", 8, 8, 1, NewLtComparator, 8},
+	{"eq", 8, 8, 1, NewEqComparator, 7},
+	{"multiplier", 8, 8, 16, NewArrayMultiplier, 0},
+	{"divider", 8, 8, 8, func(cc *Compiler, x, y, z []*Wire) error {
+		return NewDivider(cc, x, y, z, cc.Calloc.Wires(8))
+	}, 0},
+}
+
+func rewriteCircuit(xBits, yBits, zBits int, build buildFunc,
+	rewrite bool) (*circuit.Circuit, error) {
+
+	inputs := makeWires(xBits+yBits, false)
+	outputs := makeWires(zBits, true)
+	cc, err := NewCompiler(params, calloc,
+		append(NewIO(xBits, "x"), NewIO(yBits, "y")...),
+		NewIO(zBits, "z"), inputs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	err = build(cc, inputs[:xBits], inputs[xBits:], outputs)
+	if err != nil {
+		return nil, err
+	}
+	cc.ConstPropagate()
+	cc.ShortCircuitXORZero()
+	cc.RewriteORINV()
+	if rewrite {
+		cc.RewriteCuts()
+	}
+	cc.Prune()
+	return cc.Compile(), nil
+}
+
+func TestRewriteCuts(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, test := range rewriteTests {
+		orig, err := rewriteCircuit(test.xBits, test.yBits, test.zBits,
+			test.build, false)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		circ, err := rewriteCircuit(test.xBits, test.yBits, test.zBits,
+			test.build, true)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if circ.Stats[circuit.AND] > orig.Stats[circuit.AND] {
+			t.Errorf("%s: AND gates increased: %v -> %v", test.name,
+				orig.Stats, circ.Stats)
+		}
+		if test.maxAND > 0 && circ.Stats[circuit.AND] > test.maxAND {
+			t.Errorf("%s: got %d AND gates, expected at most %d",
+				test.name, circ.Stats[circuit.AND], test.maxAND)
+		}
+		for i := 0; i < 256; i++ {
+			x := big.NewInt(rnd.Int63n(1 << test.xBits))
+			y := big.NewInt(rnd.Int63n(1 << test.yBits))
+			expected, err := orig.Compute([]*big.Int{x, y})
+			if err != nil {
+				t.Fatalf("%s: Compute failed: %s", test.name, err)
+			}
+			result, err := circ.Compute([]*big.Int{x, y})
+			if err != nil {
+				t.Fatalf("%s: Compute failed: %s", test.name, err)
+			}
+			if result[0].Cmp(expected[0]) != 0 {
+				t.Fatalf("%s(%v, %v): got %v, expected %v", test.name,
+					x, y, result[0], expected[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package circuits
+
+import (
+	"sync"
+)
+
+// The XAG database holds AND-optimal XOR-AND implementations of all
+// 4-input Boolean functions. The functions are grouped into affine
+// equivalence classes: each function f is expressed as f(x) =
+// g(y(x)) ^ o(x), where g is the class representative, y is an
+// invertible affine transformation of the inputs, and o is an affine
+// function. The class representatives and their implementations are
+// precomputed and the database classifies all functions on first
+// use.
+
+// xagForm defines an affine form. The bits 0-3 select the inputs,
+// the bits 4-6 select the AND gates, and the bit 7 is the constant
+// term.
+type xagForm uint8
+
+const (
+	xagInputs xagForm = 0x0f
+	xagConst  xagForm = 0x80
+)
+
+// xagVars define the truth tables of the input variables.
+var xagVars = [4]uint16{0xaaaa, 0xcccc, 0xf0f0, 0xff00}
+
+// xagClass defines an XAG implementation of a class representative.
+type xagClass struct {
+	ands [][2]xagForm
+	out  xagForm
+}
+
+// eval computes the truth table of the class representative.
+func (cls *xagClass) eval() uint16 {
+	var vars [7]uint16
+	copy(vars[:], xagVars[:])
+	for idx, and := range cls.ands {
+		vars[4+idx] = evalForm(and[0], vars[:]) & evalForm(and[1], vars[:])
+	}
+	return evalForm(cls.out, vars[:])
+}
+
+func evalForm(f xagForm, vars []uint16) uint16 {
+	var result uint16
+	for i := 0; i < 7; i++ {
+		if f&(1<<i) != 0 {
+			result ^= vars[i]
+		}
+	}
+	if f&xagConst != 0 {
+		result ^= 0xffff
+	}
+	return result
+}
+
+// xagClasses define the AND-optimal implementations of the
+// representatives of the 8 affine equivalence classes of the 4-input
+// Boolean functions. The comments show the representative functions
+// where the AND gates are denoted by multiplication and XOR gates by
+// addition.
+var xagClasses = []*xagClass{
+	// 0
+	{},
+	// x0x1
+	{
+		ands: [][2]xagForm{{0x01, 0x02}},
+		out:  0x10,
+	},
+	// x0x1 + x2x3
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x08}},
+		out:  0x30,
+	},
+	// x0x1x2
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x10}},
+		out:  0x20,
+	},
+	// x0x1x2 + x2x3
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x18}},
+		out:  0x20,
+	},
+	// x0x1x2x3
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x08}, {0x10, 0x20}},
+		out:  0x40,
+	},
+	// x0x1x2x3 + x0x1
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x08}, {0x10, 0x20}},
+		out:  0x50,
+	},
+	// x0x1x2x3 + x0x1 + x2x3
+	{
+		ands: [][2]xagForm{{0x01, 0x02}, {0x04, 0x08}, {0x10, 0x20}},
+		out:  0x70,
+	},
+}
+
+// xagEntry defines a function as the affine transformation of its
+// class representative.
+type xagEntry struct {
+	class uint8
+	valid bool
+	y     [4]xagForm
+	out   xagForm
+}
+
+// xagDB implements the XAG database.
+type xagDB struct {
+	classes []*xagClass
+	entries [1 << 16]xagEntry
+}
+
+var (
+	xagDBOnce sync.Once
+	xagDBInst *xagDB
+)
+
+// getXAGDB returns the XAG database. The database is created on the
+// first call.
+func getXAGDB() *xagDB {
+	xagDBOnce.Do(func() {
+		xagDBInst = newXAGDB()
+	})
+	return xagDBInst
+}
+
+// lookup returns the class and the transformation of the function
+// tt.
+func (db *xagDB) lookup(tt uint16) (*xagClass, *xagEntry) {
+	e := &db.entries[tt]
+	return db.classes[e.class], e
+}
+
+// xagGenerator defines a generator of the affine group. The input
+// transformation x -> t(x) is applied when out is false. Otherwise
+// the affine function t[0] is added to the function output.
+type xagGenerator struct {
+	t    [4]xagForm
+	out  bool
+	perm [16]uint8
+}
+
+func newXAGGenerators() []*xagGenerator {
+	var result []*xagGenerator
+
+	identity := [4]xagForm{1, 2, 4, 8}
+
+	input := func(t [4]xagForm) {
+		g := &xagGenerator{
+			t: t,
+		}
+		for x := 0; x < 16; x++ {
+			var y uint8
+			for i := 0; i < 4; i++ {
+				bit := parity(uint16(t[i]&xagInputs) & uint16(x))
+				if bit != (t[i]&xagConst != 0) {
+					y |= 1 << i
+				}
+			}
+			g.perm[x] = y
+		}
+		result = append(result, g)
+	}
+
+	// Swap adjacent inputs.
+	for i := 0; i < 3; i++ {
+		t := identity
+		t[i], t[i+1] = t[i+1], t[i]
+		input(t)
+	}
+	// Add input j to input i.
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			if i != j {
+				t := identity
+				t[i] |= 1 << j
+				input(t)
+			}
+		}
+	}
+	// Negate input.
+	for i := 0; i < 4; i++ {
+		t := identity
+		t[i] |= xagConst
+		input(t)
+	}
+	// Add input or constant to output.
+	for i := 0; i < 4; i++ {
+		result = append(result, &xagGenerator{
+			t:   [4]xagForm{1 << i},
+			out: true,
+		})
+	}
+	result = append(result, &xagGenerator{
+		t:   [4]xagForm{xagConst},
+		out: true,
+	})
+
+	return result
+}
+
+func parity(v uint16) bool {
+	v ^= v >> 8
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return v&1 != 0
+}
+
+// compose computes the affine form f(t(x)).
+func compose(f xagForm, t [4]xagForm) xagForm {
+	result := f & xagConst
+	for i := 0; i < 4; i++ {
+		if f&(1<<i) != 0 {
+			result ^= t[i]
+		}
+	}
+	return result
+}
+
+func newXAGDB() *xagDB {
+	db := &xagDB{
+		classes: xagClasses,
+	}
+	gens := newXAGGenerators()
+
+	// Classify the affine equivalence class of each representative.
+	for id, cls := range db.classes {
+		tt := cls.eval()
+		if db.entries[tt].valid {
+			panic("XAG class representatives are not unique")
+		}
+		db.entries[tt] = xagEntry{
+			class: uint8(id),
+			valid: true,
+			y:     [4]xagForm{1, 2, 4, 8},
+		}
+		queue := []uint16{tt}
+		for len(queue) > 0 {
+			f := queue[0]
+			queue = queue[1:]
+			e := &db.entries[f]
+
+			for _, g := range gens {
+				var n uint16
+				next := xagEntry{
+					class: uint8(id),
+					valid: true,
+				}
+				if g.out {
+					n = f ^ evalForm(g.t[0], xagVars[:])
+					next.y = e.y
+					next.out = e.out ^ g.t[0]
+				} else {
+					for x := 0; x < 16; x++ {
+						n |= (f >> g.perm[x] & 1) << x
+					}
+					for i := 0; i < 4; i++ {
+						next.y[i] = compose(e.y[i], g.t)
+					}
+					next.out = compose(e.out, g.t)
+				}
+				if !db.entries[n].valid {
+					db.entries[n] = next
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+	for tt := range db.entries {
+		if !db.entries[tt].valid {
+			panic("XAG database incomplete")
+		}
+	}
+	return db
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -96,10 +96,34 @@ func (c *Compiler) compile(source string, in io.Reader, inputSizes [][]int) (
 	return circ, annotation, nil
 }
 
+// Stream compiles the input program and uses the streaming mode to
+// garble and stream the circuit to the evaluator node.
+func (c *Compiler) Stream(conn *p2p.Conn, oti ot.OT, data string,
+	input []string, inputSizes [][]int) (circuit.IO, []*big.Int, error) {
+	return c.StreamInput(conn, oti, data, parseInput(input), inputSizes)
+}
+
 // StreamFile compiles the input program and uses the streaming mode
 // to garble and stream the circuit to the evaluator node.
 func (c *Compiler) StreamFile(conn *p2p.Conn, oti ot.OT, file string,
 	input []string, inputSizes [][]int) (circuit.IO, []*big.Int, error) {
+	return c.StreamFileInput(conn, oti, file, parseInput(input), inputSizes)
+}
+
+// StreamInput is like Stream but the input function encodes the
+// garbler's input for the program argument.
+func (c *Compiler) StreamInput(conn *p2p.Conn, oti ot.OT, data string,
+	input circuit.InputFunc, inputSizes [][]int) (
+	circuit.IO, []*big.Int, error) {
+	return c.stream(conn, oti, "{data}", strings.NewReader(data), input,
+		inputSizes)
+}
+
+// StreamFileInput is like StreamFile but the input function encodes
+// the garbler's input for the program argument.
+func (c *Compiler) StreamFileInput(conn *p2p.Conn, oti ot.OT, file string,
+	input circuit.InputFunc, inputSizes [][]int) (
+	circuit.IO, []*big.Int, error) {
 
 	f, err := os.Open(file)
 	if err != nil {
@@ -109,8 +133,21 @@ func (c *Compiler) StreamFile(conn *p2p.Conn, oti ot.OT, file string,
 	return c.stream(conn, oti, file, f, input, inputSizes)
 }
 
+// parseInput returns an input function that parses the input values
+// from their string presentation.
+func parseInput(inputFlag []string) circuit.InputFunc {
+	return func(arg circuit.IOArg) (*big.Int, error) {
+		input, err := arg.Parse(inputFlag)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf(" -  In: %s\n", inputFlag)
+		return input, nil
+	}
+}
+
 func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
-	in io.Reader, inputFlag []string, inputSizes [][]int) (
+	in io.Reader, inputFunc circuit.InputFunc, inputSizes [][]int) (
 	circuit.IO, []*big.Int, error) {
 
 	timing := circuit.NewTiming()
@@ -140,7 +177,12 @@ func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
 			fmt.Errorf("invalid program for 2-party computation: %d parties",
 				len(program.Inputs))
 	}
-	input, err := program.Inputs[0].Parse(inputFlag)
+
+	fmt.Printf(" + In1: %s\n", program.Inputs[0])
+	fmt.Printf(" - In2: %s\n", program.Inputs[1])
+	fmt.Printf(" - Out: %s\n", program.Outputs)
+
+	input, err := inputFunc(program.Inputs[0])
 	if err != nil {
 		main, err2 := pkg.Main()
 		if err2 != nil {
@@ -149,11 +191,6 @@ func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
 		return nil, nil, ctx.Errorf(main.Location(), "%s: %v", main.Name, err)
 	}
 
-	fmt.Printf(" + In1: %s\n", program.Inputs[0])
-	fmt.Printf(" - In2: %s\n", program.Inputs[1])
-	fmt.Printf(" - Out: %s\n", program.Outputs)
-	fmt.Printf(" -  In: %s\n", inputFlag)
-
 	out, bits, err := program.Stream(conn, oti, c.params, input, timing)
 	if err != nil {
 		return nil, nil, err
@@ -164,6 +201,54 @@ func (c *Compiler) stream(conn *p2p.Conn, oti ot.OT, source string,
 	return out, bits, err
 }
 
+// StreamHash compiles the input program and returns the program
+// arguments and the program hash of its streamed circuits.
+func (c *Compiler) StreamHash(data string, inputSizes [][]int) (
+	circuit.IO, circuit.IO, []byte, error) {
+	return c.streamHash("{data}", strings.NewReader(data), inputSizes)
+}
+
+// StreamHashFile compiles the input program and returns the program
+// arguments and the program hash of its streamed circuits. The
+// streaming evaluator uses the hash to verify that the garbler
+// streams the same program.
+func (c *Compiler) StreamHashFile(file string, inputSizes [][]int) (
+	circuit.IO, circuit.IO, []byte, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+	return c.streamHash(file, f, inputSizes)
+}
+
+func (c *Compiler) streamHash(source string, in io.Reader,
+	inputSizes [][]int) (circuit.IO, circuit.IO, []byte, error) {
+
+	logger := utils.NewLogger(os.Stdout)
+	pkg, err := c.parse(source, in, logger, ast.NewPackage("main", source, nil))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx := ast.NewCodegen(logger, pkg, c.packages, c.params, inputSizes)
+
+	program, _, err := pkg.Compile(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(program.Inputs) != 2 {
+		return nil, nil, nil,
+			fmt.Errorf("invalid program for 2-party computation: %d parties",
+				len(program.Inputs))
+	}
+	hash, err := program.StreamHash(c.params)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return program.Inputs, program.Outputs, hash, nil
+}
+
 func (c *Compiler) parse(source string, in io.Reader, logger *utils.Logger,
 	pkg *ast.Package) (*ast.Package, error) {
 
@@ -268,3 +268,72 @@ func main(a, b uint64) uint64 {
 		}
 	}
 }
+
+const cseProgram = `
+package main
+func main(a, b uint32) (uint32, uint32) {
+    var r uint32
+    if a > b {
+        r = a * b
+    } else {
+        r = b * a
+    }
+    return a*b + r, r
+}
+`
+
+const cseSingleProgram = `
+package main
+func main(a, b uint32) (uint32, uint32) {
+    r := a * b
+    return r + r, r
+}
+`
+
+func TestCSE(t *testing.T) {
+	params := utils.NewParams()
+	params.OptPruneGates = true
+
+	circ, _, err := New(params).Compile(cseProgram, nil)
+	if err != nil {
+		t.Fatalf("failed to compile test: %s", err)
+	}
+	single, _, err := New(params).Compile(cseSingleProgram, nil)
+	if err != nil {
+		t.Fatalf("failed to compile test: %s", err)
+	}
+	if circ.NumGates != single.NumGates {
+		t.Errorf("common subexpressions not eliminated: #gates=%d, "+
+			"expected %d", circ.NumGates, single.NumGates)
+	}
+	results, err := circ.Compute([]*big.Int{big.NewInt(7), big.NewInt(5)})
+	if err != nil {
+		t.Fatalf("compute failed: %s", err)
+	}
+	if results[0].Int64() != 70 || results[1].Int64() != 35 {
+		t.Errorf("unexpected result: %v", results)
+	}
+}
+
+func TestNamedOutputs(t *testing.T) {
+	circ, _, err := New(utils.NewParams()).Compile(`
+package main
+func main(a, b uint8) (sum, diff uint8, lt bool) {
+    return a + b, a - b, a < b
+}
+`, nil)
+	if err != nil {
+		t.Fatalf("failed to compile test: %s", err)
+	}
+	expected := []string{"sum", "diff", "lt"}
+	if len(circ.Outputs) != len(expected) {
+		t.Fatalf("got %d outputs, expected %d", len(circ.Outputs),
+			len(expected))
+	}
+	for idx, out := range circ.Outputs {
+		if out.Name != expected[idx] {
+			t.Errorf("output %d: got name %s, expected %s", idx, out.Name,
+				expected[idx])
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -39,6 +39,11 @@ const (
 	TSymFor
 	TSymRange
 	TSymNil
+	TSymSwitch
+	TSymCase
+	TSymDefault
+	TSymBreak
+	TSymContinue
 	TDefAssign
 	TMultEq
 	TDivEq
@@ -66,45 +71,50 @@ const (
 )
 
 var tokenTypes = map[TokenType]string{
-	TIdentifier: "identifier",
-	TConstant:   "constant",
-	TSymPackage: "package",
-	TSymImport:  "import",
-	TSymFunc:    "func",
-	TSymIf:      "if",
-	TSymElse:    "else",
-	TSymReturn:  "return",
-	TSymStruct:  "struct",
-	TSymVar:     "var",
-	TSymConst:   "const",
-	TSymType:    "type",
-	TSymFor:     "for",
-	TSymRange:   "range",
-	TSymNil:     "nil",
-	TDefAssign:  ":=",
-	TMultEq:     "*=",
-	TDivEq:      "/=",
-	TLshiftEq:   "<<=",
-	TLshift:     "<<",
-	TRshiftEq:   ">>=",
-	TRshift:     ">>",
-	TPlusPlus:   "++",
-	TPlusEq:     "+=",
-	TMinusMinus: "--",
-	TMinusEq:    "-=",
-	TOrEq:       "|=",
-	TXorEq:      "^=",
-	TAndEq:      "&=",
-	TLt:         "<",
-	TLe:         "<=",
-	TGt:         ">",
-	TGe:         ">=",
-	TEq:         "==",
-	TNeq:        "!=",
-	TAnd:        "&&",
-	TOr:         "||",
-	TBitClear:   "&^",
-	TSend:       "<-",
+	TIdentifier:  "identifier",
+	TConstant:    "constant",
+	TSymPackage:  "package",
+	TSymImport:   "import",
+	TSymFunc:     "func",
+	TSymIf:       "if",
+	TSymElse:     "else",
+	TSymReturn:   "return",
+	TSymStruct:   "struct",
+	TSymVar:      "var",
+	TSymConst:    "const",
+	TSymType:     "type",
+	TSymFor:      "for",
+	TSymRange:    "range",
+	TSymNil:      "nil",
+	TSymSwitch:   "switch",
+	TSymCase:     "case",
+	TSymDefault:  "default",
+	TSymBreak:    "break",
+	TSymContinue: "continue",
+	TDefAssign:   ":=",
+	TMultEq:      "*=",
+	TDivEq:       "/=",
+	TLshiftEq:    "<<=",
+	TLshift:      "<<",
+	TRshiftEq:    ">>=",
+	TRshift:      ">>",
+	TPlusPlus:    "++",
+	TPlusEq:      "+=",
+	TMinusMinus:  "--",
+	TMinusEq:     "-=",
+	TOrEq:        "|=",
+	TXorEq:       "^=",
+	TAndEq:       "&=",
+	TLt:          "<",
+	TLe:          "<=",
+	TGt:          ">",
+	TGe:          ">=",
+	TEq:          "==",
+	TNeq:         "!=",
+	TAnd:         "&&",
+	TOr:          "||",
+	TBitClear:    "&^",
+	TSend:        "<-",
 }
 
 func (t TokenType) String() string {
@@ -169,19 +179,24 @@ func (t TokenType) UnaryType() ast.UnaryType {
 }
 
 var symbols = map[string]TokenType{
-	"import":  TSymImport,
-	"const":   TSymConst,
-	"type":    TSymType,
-	"for":     TSymFor,
-	"range":   TSymRange,
-	"nil":     TSymNil,
-	"else":    TSymElse,
-	"func":    TSymFunc,
-	"if":      TSymIf,
-	"package": TSymPackage,
-	"return":  TSymReturn,
-	"struct":  TSymStruct,
-	"var":     TSymVar,
+	"import":   TSymImport,
+	"switch":   TSymSwitch,
+	"case":     TSymCase,
+	"default":  TSymDefault,
+	"break":    TSymBreak,
+	"continue": TSymContinue,
+	"const":    TSymConst,
+	"type":     TSymType,
+	"for":      TSymFor,
+	"range":    TSymRange,
+	"nil":      TSymNil,
+	"else":     TSymElse,
+	"func":     TSymFunc,
+	"if":       TSymIf,
+	"package":  TSymPackage,
+	"return":   TSymReturn,
+	"struct":   TSymStruct,
+	"var":      TSymVar,
 }
 
 // Token specifies an input token.
@@ -206,6 +221,8 @@ func (t *Token) String() string {
 			str = fmt.Sprintf("%v", val)
 		case *mpa.Int:
 			str = val.String()
+		case float64:
+			str = strconv.FormatFloat(val, 'g', -1, 64)
 		default:
 			str = t.Type.String()
 		}
@@ -641,6 +658,9 @@ func (l *Lexer) Get() (*Token, error) {
 					ival, err = l.readHexLiteral([]rune{'0', r})
 				case '0', '1', '2', '3', '4', '5', '6', '7':
 					ival, err = l.readOctalLiteral([]rune{'0', r})
+				case '.', 'e', 'E':
+					l.UnreadRune()
+					return l.readFloatLiteral([]rune{'0'})
 				default:
 					l.UnreadRune()
 				}
@@ -700,6 +720,9 @@ func (l *Lexer) Get() (*Token, error) {
 						val = append(val, r)
 					} else {
 						l.UnreadRune()
+						if r == '.' || r == 'e' || r == 'E' {
+							return l.readFloatLiteral(val)
+						}
 						break
 					}
 				}
@@ -832,6 +855,84 @@ loop:
 	return ival, nil
 }
 
+// readFloatLiteral reads the fraction and exponent parts of the
+// decimal floating-point literal whose integer part is val.
+func (l *Lexer) readFloatLiteral(val []rune) (*Token, error) {
+	r, _, err := l.ReadRune()
+	if err != nil {
+		return nil, err
+	}
+	if r == '.' {
+		val = append(val, r)
+		val, err = l.readDigits(val)
+		if err != nil {
+			return nil, err
+		}
+		r, _, err = l.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			r = 0
+		}
+	}
+	if r == 'e' || r == 'E' {
+		val = append(val, r)
+		r, _, err = l.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			r = 0
+		}
+		if r == '+' || r == '-' {
+			val = append(val, r)
+			r, _, err = l.ReadRune()
+			if err != nil {
+				if err != io.EOF {
+					return nil, err
+				}
+				r = 0
+			}
+		}
+		if !unicode.IsDigit(r) {
+			return nil, fmt.Errorf("malformed float literal '%s'",
+				string(val))
+		}
+		val = append(val, r)
+		val, err = l.readDigits(val)
+		if err != nil {
+			return nil, err
+		}
+	} else if r != 0 {
+		l.UnreadRune()
+	}
+	fval, err := strconv.ParseFloat(string(val), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal '%s'", string(val))
+	}
+	token := l.Token(TConstant)
+	token.ConstVal = fval
+	return token, nil
+}
+
+func (l *Lexer) readDigits(val []rune) ([]rune, error) {
+	for {
+		r, _, err := l.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			return val, nil
+		}
+		if !unicode.IsDigit(r) {
+			l.UnreadRune()
+			return val, nil
+		}
+		val = append(val, r)
+	}
+}
+
 func (l *Lexer) readOctalLiteral(val []rune) (*mpa.Int, error) {
 loop:
 	for {
@@ -38,3 +38,36 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerFloat(t *testing.T) {
+	tests := []struct {
+		input string
+		value float64
+	}{
+		{"0.5", 0.5},
+		{"1.25", 1.25},
+		{"3.", 3},
+		{"0e0", 0},
+		{"1e3", 1000},
+		{"2.5E-2", 0.025},
+		{"6.25e+1", 62.5},
+	}
+	for _, test := range tests {
+		lexer := NewLexer("{data}", bytes.NewReader([]byte(test.input)))
+		token, err := lexer.Get()
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", test.input, err)
+		}
+		val, ok := token.ConstVal.(float64)
+		if token.Type != TConstant || !ok || val != test.value {
+			t.Errorf("Get(%s) = %v, expected %v", test.input, token, test.value)
+		}
+	}
+	for _, input := range []string{"1e", "1.5e+"} {
+		lexer := NewLexer("{data}", bytes.NewReader([]byte(input)))
+		_, err := lexer.Get()
+		if err == nil {
+			t.Errorf("malformed literal %s accepted", input)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/markkurossi/mpc/compiler/ast"
+	"github.com/markkurossi/mpc/compiler/mpa"
 	"github.com/markkurossi/mpc/compiler/utils"
 )
 
@@ -182,6 +183,19 @@ func (p *Parser) errUnexpected(offending *Token, expected TokenType) error {
 		offending, expected)
 }
 
+// fixedTypeName tests if the identifier t and the constant n form a
+// fixed-point type name, such as fixed64.16.
+func fixedTypeName(t, n *Token) (string, bool) {
+	if n.Type != TConstant || !strings.HasPrefix(t.StrVal, "fixed") {
+		return "", false
+	}
+	frac, ok := n.ConstVal.(*mpa.Int)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s.%s", t.StrVal, frac), true
+}
+
 func (p *Parser) needToken(tt TokenType) (*Token, error) {
 	token, err := p.lexer.Get()
 	if err != nil {
@@ -668,6 +682,7 @@ func (p *Parser) parseFunc(annotations ast.Annotations) (*ast.Func, error) {
 						Type:  typeInfo,
 					})
 				}
+				identifiers = nil
 				namedReturnValues = true
 			}
 			n, err = p.lexer.Get()
@@ -922,6 +937,19 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 			Body:  body,
 		}, nil
 
+	case TSymSwitch:
+		return p.parseSwitch(tStmt)
+
+	case TSymBreak:
+		return &ast.Break{
+			Point: tStmt.From,
+		}, nil
+
+	case TSymContinue:
+		return &ast.Continue{
+			Point: tStmt.From,
+		}, nil
+
 	default:
 		p.lexer.Unget(tStmt)
 		lvalues, err := p.parseExprList(needLBrace)
@@ -1043,6 +1071,105 @@ func (p *Parser) parseStatement(needLBrace bool) (ast.AST, error) {
 	}
 }
 
+func (p *Parser) parseSwitch(tStmt *Token) (ast.AST, error) {
+	result := &ast.Switch{
+		Point: tStmt.From,
+	}
+	t, err := p.lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != '{' {
+		p.lexer.Unget(t)
+		stmt, err := p.parseStatement(true)
+		if err != nil {
+			return nil, err
+		}
+		t, err = p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == ';' {
+			result.Init = stmt
+			t, err = p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			if t.Type != '{' {
+				p.lexer.Unget(t)
+				result.Expr, err = p.parseExpr(true)
+				if err != nil {
+					return nil, err
+				}
+				_, err = p.needToken('{')
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else if t.Type == '{' {
+			list, ok := stmt.(ast.List)
+			if !ok || len(list) != 1 {
+				return nil, p.errf(stmt.Location(),
+					"%s used as value", stmt)
+			}
+			result.Expr = list[0]
+		} else {
+			return nil, p.errf(t.From, "unexpected %s, expected {", t)
+		}
+	}
+
+	var hasDefault bool
+	for {
+		t, err := p.lexer.Get()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == '}' {
+			return result, nil
+		}
+		c := &ast.Case{
+			Point: t.From,
+		}
+		switch t.Type {
+		case TSymCase:
+			c.Exprs, err = p.parseExprList(false)
+			if err != nil {
+				return nil, err
+			}
+
+		case TSymDefault:
+			if hasDefault {
+				return nil, p.errf(t.From, "multiple defaults in switch")
+			}
+			hasDefault = true
+
+		default:
+			return nil, p.errf(t.From,
+				"unexpected %s, expected case or default or }", t)
+		}
+		_, err = p.needToken(':')
+		if err != nil {
+			return nil, err
+		}
+		for {
+			n, err := p.lexer.Get()
+			if err != nil {
+				return nil, err
+			}
+			p.lexer.Unget(n)
+			if n.Type == TSymCase || n.Type == TSymDefault || n.Type == '}' {
+				break
+			}
+			stmt, err := p.parseStatement(false)
+			if err != nil {
+				return nil, err
+			}
+			c.Body = append(c.Body, stmt)
+		}
+		result.Cases = append(result.Cases, c)
+	}
+}
+
 func (p *Parser) parseExprList(needLBrace bool) ([]ast.AST, error) {
 	var list []ast.AST
 
@@ -1458,18 +1585,32 @@ func (p *Parser) parseOperand(needLBrace bool) (ast.AST, error) {
 		}
 		var operandName *ast.VariableRef
 		if n.Type == '.' {
-			id, err := p.needToken(TIdentifier)
+			id, err := p.lexer.Get()
 			if err != nil {
 				return nil, err
 			}
-			// QualifiedIdent.
-			operandName = &ast.VariableRef{
-				Point: t.From,
-				Name: ast.Identifier{
-					Defined: p.pkg.Name,
-					Package: t.StrVal,
-					Name:    id.StrVal,
-				},
+			if fixed, ok := fixedTypeName(t, id); ok {
+				// Fixed-point type conversion.
+				operandName = &ast.VariableRef{
+					Point: t.From,
+					Name: ast.Identifier{
+						Defined: p.pkg.Name,
+						Name:    fixed,
+					},
+				}
+			} else if id.Type == TIdentifier {
+				// QualifiedIdent.
+				operandName = &ast.VariableRef{
+					Point: t.From,
+					Name: ast.Identifier{
+						Defined: p.pkg.Name,
+						Package: t.StrVal,
+						Name:    id.StrVal,
+					},
+				}
+			} else {
+				p.lexer.Unget(id)
+				return nil, p.errUnexpected(id, TIdentifier)
 			}
 		} else {
 			// Identifier in current package.
@@ -1683,6 +1824,13 @@ func (p *Parser) parseType() (*ast.TypeInfo, error) {
 				if n.Type == TIdentifier {
 					name = n.StrVal
 					loc = n.From
+				} else if fixed, ok := fixedTypeName(t, n); ok {
+					t = &Token{
+						Type:   TIdentifier,
+						From:   t.From,
+						To:     n.To,
+						StrVal: fixed,
+					}
 				} else {
 					p.lexer.Unget(n)
 				}
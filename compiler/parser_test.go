@@ -127,3 +127,48 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestParserNamedReturn(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{
+			code: `
+package main
+func main() (a, b int4) {
+    return
+}`,
+			expected: []string{"a int4", "b int4"},
+		},
+		{
+			code: `
+package main
+func main() (a, b int4, c uint8) {
+    return
+}`,
+			expected: []string{"a int4", "b int4", "c uint8"},
+		},
+	}
+	for idx, test := range tests {
+		logger := utils.NewLogger(os.Stdout)
+		parser := NewParser(fmt.Sprintf("{test %d}", idx), nil, logger,
+			bytes.NewReader([]byte(test.code)))
+		pkg, err := parser.Parse(nil)
+		if err != nil {
+			t.Fatalf("Parse test %d failed: %v", idx, err)
+		}
+		main := pkg.Functions["main"]
+		if !main.NamedReturn {
+			t.Errorf("test %d: return values not named", idx)
+		}
+		var got []string
+		for _, ret := range main.Return {
+			got = append(got, fmt.Sprintf("%s %s", ret.Name, ret.Type))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("test %d: got %v, expected %v", idx, got,
+				test.expected)
+		}
+	}
+}
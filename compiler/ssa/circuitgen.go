@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -45,6 +45,14 @@ func (prog *Program) CompileCircuit(params *utils.Params) (
 	}
 	cc.ConstPropagate()
 	cc.ShortCircuitXORZero()
+	cc.RewriteORINV()
+	if params.OptRewriteCuts {
+		before, after := cc.RewriteCuts()
+		if params.Verbose {
+			fmt.Printf(" - Cut rewrite before: %s\n", before)
+			fmt.Printf(" - Cut rewrite after:  %s\n", after)
+		}
+	}
 	if params.OptPruneGates {
 		orig := float64(len(cc.Gates))
 		pruned := cc.Prune()
@@ -167,6 +175,68 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 				return err
 			}
 
+		case Fadd:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatAdder(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fsub:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatSubtractor(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fmult:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatMultiplier(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fdiv:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatDivider(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qmult:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedMultiplier(cc, int(instr.Out.Type.Frac),
+				wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qdiv:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedDivider(cc, int(instr.Out.Type.Frac),
+				wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
 		case Concat:
 			o := make([]*circuits.Wire, instr.Out.Type.Bits)
 			for i := 0; i < len(wires[0]); i++ {
@@ -316,12 +386,97 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 				return err
 			}
 
+		case Flt:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatLtComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fle:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatLeComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fgt:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatGtComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Fge:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatGeComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qlt:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedLtComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qle:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedLeComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qgt:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedGtComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
+		case Qge:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedGeComparator(cc, wires[0], wires[1], o)
+			if err != nil {
+				return err
+			}
+
 		case Eq:
 			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
 			if err != nil {
 				return err
 			}
-			err = circuits.NewEqComparator(cc, wires[0], wires[1], o)
+			if instr.In[0].Type.Type == types.TFloat {
+				err = circuits.NewFloatEqComparator(cc, wires[0], wires[1],
+					o)
+			} else {
+				err = circuits.NewEqComparator(cc, wires[0], wires[1], o)
+			}
 			if err != nil {
 				return err
 			}
@@ -331,7 +486,12 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 			if err != nil {
 				return err
 			}
-			err = circuits.NewNeqComparator(cc, wires[0], wires[1], o)
+			if instr.In[0].Type.Type == types.TFloat {
+				err = circuits.NewFloatNeqComparator(cc, wires[0], wires[1],
+					o)
+			} else {
+				err = circuits.NewNeqComparator(cc, wires[0], wires[1], o)
+			}
 			if err != nil {
 				return err
 			}
@@ -456,6 +616,58 @@ func (prog *Program) Circuit(cc *circuits.Compiler) error {
 			}
 			prog.walloc.SetWires(*instr.Out, o)
 
+		case Itof:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewIntToFloat(cc, wires[0], o)
+			if err != nil {
+				return err
+			}
+
+		case Utof:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewUintToFloat(cc, wires[0], o)
+			if err != nil {
+				return err
+			}
+
+		case Ftoi:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatToInt(cc, wires[0], o)
+			if err != nil {
+				return err
+			}
+
+		case Ftof:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFloatConvert(cc, wires[0], o)
+			if err != nil {
+				return err
+			}
+
+		case Itoq, Utoq, Qtoi, Qtoq:
+			o, err := prog.walloc.Wires(*instr.Out, instr.Out.Type.Bits)
+			if err != nil {
+				return err
+			}
+			err = circuits.NewFixedConvert(cc, int(instr.In[0].Type.Frac),
+				int(instr.Out.Type.Frac), instr.In[0].Type.Type != types.TUint,
+				wires[0], o)
+			if err != nil {
+				return err
+			}
+
 		case Amov:
 			// v arr from to:
 			// array[from:to] = v
@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markkurossi/mpc/types"
+)
+
+// CSE runs the global value numbering and common subexpression
+// elimination for the program. The program steps are in the
+// flattened SSA form where all values are defined exactly once and
+// the phi instructions are multiplexers selecting between their
+// true and false inputs. This allows the pass to process the steps
+// in one forward pass: an instruction computing the same operation
+// from the same value numbers as an earlier instruction is removed
+// and all uses of its outputs are rewritten to use the earlier
+// instruction's outputs. The CSE must be run before GC.
+func (prog *Program) CSE() {
+	start := time.Now()
+
+	// Count value definitions. Only values with exactly one
+	// definition can be replaced.
+	defs := make(map[ValueID]int)
+	for i := 0; i < len(prog.Steps); i++ {
+		instr := &prog.Steps[i].Instr
+		if instr.Out != nil {
+			defs[instr.Out.ID]++
+		}
+		for _, r := range instr.Ret {
+			defs[r.ID]++
+		}
+	}
+
+	numbers := make(map[string]int)
+	repl := make(map[ValueID]Value)
+	steps := make([]Step, 0, len(prog.Steps))
+
+	var sb strings.Builder
+	var removed int
+	var label string
+
+	for i := 0; i < len(prog.Steps); i++ {
+		step := prog.Steps[i]
+		instr := &step.Instr
+
+		// Keep the labels of the removed steps.
+		if len(label) > 0 && len(step.Label) == 0 {
+			step.Label = label
+		}
+		label = ""
+
+		// Rewrite inputs to their value numbers. The In slices may be
+		// shared between instructions so they are copied on write.
+		var copied bool
+		for idx, in := range instr.In {
+			if in.Const {
+				continue
+			}
+			v, ok := repl[in.ID]
+			if !ok {
+				continue
+			}
+			if !copied {
+				instr.In = append([]Value(nil), instr.In...)
+				copied = true
+			}
+			instr.In[idx] = v
+		}
+
+		if !cseReplaceable(instr, defs) {
+			steps = append(steps, step)
+			continue
+		}
+
+		// Mov to a value of the same type is a copy of its input.
+		if instr.Op == Mov && !instr.In[0].Const &&
+			instr.In[0].Type.Equal(instr.Out.Type) {
+			repl[instr.Out.ID] = instr.In[0]
+			label = step.Label
+			removed++
+			continue
+		}
+
+		// Phi with a constant condition or equal true and false
+		// values selects one of its inputs.
+		if instr.Op == Phi {
+			sel := -1
+			if instr.In[0].Const {
+				if cond, ok := instr.In[0].ConstValue.(bool); ok {
+					if cond {
+						sel = 1
+					} else {
+						sel = 2
+					}
+				}
+			} else if cseEqual(instr.In[1], instr.In[2]) {
+				sel = 1
+			}
+			if sel > 0 && !instr.In[sel].Const &&
+				instr.In[sel].Type.Equal(instr.Out.Type) {
+				repl[instr.Out.ID] = instr.In[sel]
+				label = step.Label
+				removed++
+				continue
+			}
+		}
+
+		key := cseKey(&sb, instr)
+		if idx, ok := numbers[key]; ok && cseMatch(&steps[idx].Instr, instr) {
+			prev := &steps[idx].Instr
+			if instr.Out != nil {
+				repl[instr.Out.ID] = *prev.Out
+			}
+			for ri, r := range instr.Ret {
+				repl[r.ID] = prev.Ret[ri]
+			}
+			label = step.Label
+			removed++
+			continue
+		}
+		numbers[key] = len(steps)
+		steps = append(steps, step)
+	}
+	prog.Steps = steps
+
+	elapsed := time.Since(start)
+
+	if prog.Params.Diagnostics {
+		fmt.Printf(" - Program.CSE: %s, removed %d instructions\n",
+			elapsed, removed)
+	}
+}
+
+// cseReplaceable tests if the instruction can be replaced by an
+// earlier instruction computing the same value.
+func cseReplaceable(instr *Instr, defs map[ValueID]int) bool {
+	switch instr.Op {
+	case Ret, GC, Builtin:
+		return false
+
+	case Circ:
+		if instr.Circ == nil || len(instr.Ret) == 0 {
+			return false
+		}
+		for _, r := range instr.Ret {
+			if defs[r.ID] != 1 || r.PtrInfo != nil {
+				return false
+			}
+		}
+		return true
+
+	default:
+		if instr.Out == nil || instr.Out.PtrInfo != nil {
+			return false
+		}
+		return defs[instr.Out.ID] == 1
+	}
+}
+
+// cseKey creates the value numbering key for the instruction. The key
+// consists of the operand, the result types, and the input value
+// numbers. The inputs of the commutative operands are sorted.
+func cseKey(sb *strings.Builder, instr *Instr) string {
+	sb.Reset()
+	sb.WriteString(instr.Op.String())
+
+	if instr.Out != nil {
+		cseWriteType(sb, instr.Out.Type)
+	}
+	if instr.Circ != nil {
+		fmt.Fprintf(sb, " %p", instr.Circ)
+		for _, r := range instr.Ret {
+			cseWriteType(sb, r.Type)
+		}
+	}
+
+	in := instr.In
+	if cseCommutative(instr.Op) && len(in) == 2 && cseLess(in[1], in[0]) {
+		in = []Value{in[1], in[0]}
+	}
+	for _, v := range in {
+		sb.WriteByte(' ')
+		if v.Const {
+			sb.WriteString(v.Name)
+			cseWriteType(sb, v.Type)
+		} else {
+			sb.WriteByte('v')
+			sb.WriteString(strconv.FormatUint(uint64(v.ID), 10))
+		}
+	}
+	return sb.String()
+}
+
+// cseWriteType writes the type class and size into the key. The
+// cseMatch compares the full types of the matching instructions.
+func cseWriteType(sb *strings.Builder, t types.Info) {
+	sb.WriteByte(':')
+	sb.WriteString(strconv.Itoa(int(t.Type)))
+	sb.WriteByte('/')
+	sb.WriteString(strconv.Itoa(int(t.Bits)))
+}
+
+// cseLess defines a total order for the inputs of the commutative
+// operands.
+func cseLess(a, b Value) bool {
+	if a.Const != b.Const {
+		return a.Const
+	}
+	if a.Const {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type.Bits < b.Type.Bits
+	}
+	return a.ID < b.ID
+}
+
+// cseMatch verifies that the instructions with equal value numbering
+// keys compute the same value. The keys do not identify composite
+// types so the types are compared here.
+func cseMatch(a, b *Instr) bool {
+	if a.Op != b.Op || a.Circ != b.Circ || len(a.In) != len(b.In) ||
+		len(a.Ret) != len(b.Ret) {
+		return false
+	}
+	if a.Out != nil && !a.Out.Type.Equal(b.Out.Type) {
+		return false
+	}
+	for idx, r := range a.Ret {
+		if !r.Type.Equal(b.Ret[idx].Type) {
+			return false
+		}
+	}
+	if cseInputsMatch(a.In, b.In) {
+		return true
+	}
+	if cseCommutative(a.Op) && len(a.In) == 2 {
+		return cseInputsMatch(a.In, []Value{b.In[1], b.In[0]})
+	}
+	return false
+}
+
+func cseInputsMatch(a, b []Value) bool {
+	for idx, in := range a {
+		if !cseEqual(in, b[idx]) || !in.Type.Equal(b[idx].Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// cseEqual tests if the values have the same value number.
+func cseEqual(a, b Value) bool {
+	if a.Const != b.Const {
+		return false
+	}
+	if a.Const {
+		return a.Name == b.Name && a.Type.Equal(b.Type)
+	}
+	return a.ID == b.ID
+}
+
+// cseCommutative tests if the operand is commutative.
+func cseCommutative(op Operand) bool {
+	switch op {
+	case Iadd, Uadd, Imult, Umult, Bor, Bxor, Band, Eq, Neq, And, Or:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,13 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa
+
+// SetStreamTemplates enables or disables the circuit templates of the
+// streaming garbler.
+func SetStreamTemplates(enabled bool) {
+	streamTemplates = enabled
+}
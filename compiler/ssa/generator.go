@@ -8,6 +8,7 @@ package ssa
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/markkurossi/mpc/compiler/mpa"
@@ -240,6 +241,22 @@ func (gen *Generator) Constant(value interface{}, ti types.Info) Value {
 		val.SetTypeSize(bits)
 		v.ConstValue = val
 
+	case float64:
+		// Float constants are encoded with their type so the type is
+		// part of the constant name.
+		if v.Type.Undefined() {
+			v.Type = types.Info{
+				Type: types.TFloat,
+			}
+		}
+		if v.Type.Bits == 0 {
+			v.Type.Bits = 64
+		}
+		v.Type.MinBits = v.Type.Bits
+		v.Type.SetConcrete(true)
+		v.Name = fmt.Sprintf("$%s(%s)", v.Type,
+			strconv.FormatFloat(val, 'g', -1, 64))
+
 	case bool:
 		v.Name = fmt.Sprintf("$%v", val)
 		v.Type = types.Bool
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -35,9 +35,11 @@ const (
 	Imult
 	Umult
 	Fmult
+	Qmult
 	Idiv
 	Udiv
 	Fdiv
+	Qdiv
 	Imod
 	Umod
 	Fmod
@@ -50,15 +52,19 @@ const (
 	Ilt
 	Ult
 	Flt
+	Qlt
 	Ile
 	Ule
 	Fle
+	Qle
 	Igt
 	Ugt
 	Fgt
+	Qgt
 	Ige
 	Uge
 	Fge
+	Qge
 	Eq
 	Neq
 	And
@@ -66,6 +72,14 @@ const (
 	Not
 	Mov
 	Smov
+	Itof
+	Utof
+	Ftoi
+	Ftof
+	Itoq
+	Utoq
+	Qtoi
+	Qtoq
 	Amov
 	Phi
 	Ret
@@ -90,9 +104,11 @@ var operands = map[Operand]string{
 	Imult:   "imult",
 	Umult:   "umult",
 	Fmult:   "fmult",
+	Qmult:   "qmult",
 	Idiv:    "idiv",
 	Udiv:    "udiv",
 	Fdiv:    "fdiv",
+	Qdiv:    "qdiv",
 	Imod:    "imod",
 	Umod:    "umod",
 	Fmod:    "fmod",
@@ -105,15 +121,19 @@ var operands = map[Operand]string{
 	Ilt:     "ilt",
 	Ult:     "ult",
 	Flt:     "flt",
+	Qlt:     "qlt",
 	Ile:     "ile",
 	Ule:     "ule",
 	Fle:     "fle",
+	Qle:     "qle",
 	Igt:     "igt",
 	Ugt:     "ugt",
 	Fgt:     "fgt",
+	Qgt:     "qgt",
 	Ige:     "ige",
 	Uge:     "uge",
 	Fge:     "fge",
+	Qge:     "qge",
 	Eq:      "eq",
 	Neq:     "neq",
 	And:     "and",
@@ -121,6 +141,14 @@ var operands = map[Operand]string{
 	Not:     "not",
 	Mov:     "mov",
 	Smov:    "smov",
+	Itof:    "itof",
+	Utof:    "utof",
+	Ftoi:    "ftoi",
+	Ftof:    "ftof",
+	Itoq:    "itoq",
+	Utoq:    "utoq",
+	Qtoi:    "qtoi",
+	Qtoq:    "qtoq",
 	Amov:    "amov",
 	Phi:     "phi",
 	Ret:     "ret",
@@ -171,7 +199,7 @@ func (i Instr) Check() {
 func NewAddInstr(t types.Info, l, r, o Value) (Instr, error) {
 	var op Operand
 	switch t.Type {
-	case types.TInt:
+	case types.TInt, types.TFixed:
 		op = Iadd
 	case types.TUint:
 		op = Uadd
@@ -195,7 +223,7 @@ func NewAddInstr(t types.Info, l, r, o Value) (Instr, error) {
 func NewSubInstr(t types.Info, l, r, o Value) (Instr, error) {
 	var op Operand
 	switch t.Type {
-	case types.TInt:
+	case types.TInt, types.TFixed:
 		op = Isub
 	case types.TUint:
 		op = Usub
@@ -222,6 +250,8 @@ func NewMultInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Umult
 	case types.TFloat:
 		op = Fmult
+	case types.TFixed:
+		op = Qmult
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for multiplication", t)
 	}
@@ -242,6 +272,8 @@ func NewDivInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Udiv
 	case types.TFloat:
 		op = Fdiv
+	case types.TFixed:
+		op = Qdiv
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for division", t)
 	}
@@ -260,8 +292,6 @@ func NewModInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Imod
 	case types.TUint:
 		op = Umod
-	case types.TFloat:
-		op = Fmod
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for modulo", t)
 	}
@@ -338,6 +368,8 @@ func NewLtInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Ult
 	case types.TFloat:
 		op = Flt
+	case types.TFixed:
+		op = Qlt
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for < comparison", t)
 	}
@@ -359,6 +391,8 @@ func NewLeInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Ule
 	case types.TFloat:
 		op = Fle
+	case types.TFixed:
+		op = Qle
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for <= comparison", t)
 	}
@@ -380,6 +414,8 @@ func NewGtInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Ugt
 	case types.TFloat:
 		op = Fgt
+	case types.TFixed:
+		op = Qgt
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for > comparison", t)
 	}
@@ -401,6 +437,8 @@ func NewGeInstr(t types.Info, l, r, o Value) (Instr, error) {
 		op = Uge
 	case types.TFloat:
 		op = Fge
+	case types.TFixed:
+		op = Qge
 	default:
 		return Instr{}, fmt.Errorf("invalid type %s for >= comparison", t)
 	}
@@ -519,6 +557,59 @@ func NewSmovInstr(from, to Value) Instr {
 	}
 }
 
+// NewCvtInstr creates a new conversion instruction that converts
+// the value between integer, floating point, and fixed-point types.
+func NewCvtInstr(from, to Value) (Instr, error) {
+	var op Operand
+	var ok bool
+
+	switch from.Type.Type {
+	case types.TInt:
+		switch to.Type.Type {
+		case types.TFloat:
+			op, ok = Itof, true
+		case types.TFixed:
+			op, ok = Itoq, true
+		}
+	case types.TUint:
+		switch to.Type.Type {
+		case types.TFloat:
+			op, ok = Utof, true
+		case types.TFixed:
+			op, ok = Utoq, true
+		}
+	case types.TFloat:
+		switch to.Type.Type {
+		case types.TInt, types.TUint:
+			op, ok = Ftoi, true
+		case types.TFloat:
+			if from.Type.Bits == to.Type.Bits {
+				return NewMovInstr(from, to), nil
+			}
+			op, ok = Ftof, true
+		}
+	case types.TFixed:
+		switch to.Type.Type {
+		case types.TInt, types.TUint:
+			op, ok = Qtoi, true
+		case types.TFixed:
+			if from.Type.Equal(to.Type) {
+				return NewMovInstr(from, to), nil
+			}
+			op, ok = Qtoq, true
+		}
+	}
+	if !ok {
+		return Instr{}, fmt.Errorf("invalid conversion from %s to %s",
+			from.Type, to.Type)
+	}
+	return Instr{
+		Op:  op,
+		In:  []Value{from},
+		Out: &to,
+	}, nil
+}
+
 // NewAmovInstr creates a new Amov instruction.
 func NewAmovInstr(v, arr, from, to, o Value) Instr {
 	return Instr{
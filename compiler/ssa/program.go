@@ -22,21 +22,26 @@ import (
 
 // Program implements SSA program.
 type Program struct {
-	Params      *utils.Params
-	Inputs      circuit.IO
-	Outputs     circuit.IO
-	InputWires  []*circuits.Wire
-	OutputWires []*circuits.Wire
-	Constants   map[string]ConstantInst
-	Steps       []Step
-	walloc      *WireAllocator
-	calloc      *circuits.Allocator
-	zeroWire    *circuits.Wire
-	oneWire     *circuits.Wire
-	stats       circuit.Stats
-	numWires    int
-	tInit       time.Duration
-	tGarble     time.Duration
+	Params       *utils.Params
+	Inputs       circuit.IO
+	Outputs      circuit.IO
+	InputWires   []*circuits.Wire
+	OutputWires  []*circuits.Wire
+	Constants    map[string]ConstantInst
+	Steps        []Step
+	walloc       *WireAllocator
+	calloc       *circuits.Allocator
+	zeroWire     *circuits.Wire
+	oneWire      *circuits.Wire
+	stats        circuit.Stats
+	numWires     int
+	tInit        time.Duration
+	tGarble      time.Duration
+	tInstrInit   time.Duration
+	tCircCompile time.Duration
+	istats       map[string]circuit.Stats
+	numCached    int
+	rewriteStats [2]circuit.Stats
 }
 
 // NewProgram creates a new program for the constants and program
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -40,6 +40,13 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	if err := conn.SendData(key[:]); err != nil {
 		return nil, nil, err
 	}
+	scheme, err := circuit.NegotiateScheme(conn, params.Scheme, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params.Verbose {
+		fmt.Printf(" - Garbling with %s\n", scheme)
+	}
 	// Our input.
 	if err := sendArgument(conn, prog.Inputs[0]); err != nil {
 		return nil, nil, err
@@ -62,16 +69,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		return nil, nil, err
 	}
 
-	// Collect input wire IDs.
-	var ids []circuit.Wire
-	for _, w := range prog.InputWires {
-		// Program's inputs are unassigned because parser is shared
-		// between streaming and non-streaming modes.
-		w.SetID(prog.walloc.NextWireID())
-		ids = append(ids, w.ID())
-	}
+	ids := prog.assignInputIDs()
 
-	streaming, err := circuit.NewStreaming(key[:], ids, conn)
+	streaming, err := circuit.NewStreaming(scheme, key[:], ids, conn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -105,6 +105,10 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	timing.Sample("Init", []string{circuit.FileSize(ioStats).String()})
 
 	// Init oblivious transfer.
+	err = ot.Negotiate(conn, oti, true)
+	if err != nil {
+		return nil, nil, err
+	}
 	err = oti.InitSender(conn)
 	if err != nil {
 		return nil, nil, err
@@ -123,21 +127,172 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 	ioStats = conn.Stats.Sum()
 	timing.Sample("Peer Inputs", []string{circuit.FileSize(xfer).String()})
 
-	zero, err := prog.ZeroWire(conn, streaming)
+	sink := &streamGarbler{
+		prog:      prog,
+		conn:      conn,
+		streaming: streaming,
+		hash:      circuit.NewStreamHash(),
+		templates: make(map[*circuit.Circuit]int),
+	}
+	sink.hash.Arguments(prog.Inputs[0], prog.Inputs[1], prog.Outputs)
+
+	if err := prog.defineStreamConstants(sink); err != nil {
+		return nil, nil, err
+	}
+
+	// Stream circuit.
+	returnIDs, err := prog.streamSteps(params, sink)
 	if err != nil {
 		return nil, nil, err
 	}
-	one, err := prog.OneWire(conn, streaming)
+
+	xfer = conn.Stats.Sum() - ioStats
+	ioStats = conn.Stats.Sum()
+	sample := timing.Sample("Stream", []string{circuit.FileSize(xfer).String()})
+	sample.Samples = append(sample.Samples, &circuit.Sample{
+		Label: "InstrInit",
+		Abs:   prog.tInstrInit,
+	})
+	sample.Samples = append(sample.Samples, &circuit.Sample{
+		Label: "CircComp",
+		Abs:   prog.tCircCompile,
+	})
+	sample.Samples = append(sample.Samples, &circuit.Sample{
+		Label: "StreamInit",
+		Abs:   prog.tInit,
+	})
+	sample.Samples = append(sample.Samples, &circuit.Sample{
+		Label: "Garble",
+		Abs:   prog.tGarble,
+	})
+
+	op, err := conn.ReceiveUint32()
 	if err != nil {
 		return nil, nil, err
 	}
+	if op != circuit.OpResult {
+		return nil, nil, fmt.Errorf("unexpected operation: %d", op)
+	}
 
-	err = prog.DefineConstants(zero, one)
+	var wires []ot.Wire
+	for _, id := range returnIDs {
+		wires = append(wires, streaming.GetInput(id))
+	}
+	result, err := circuit.GarblerResult(conn, prog.Outputs, wires)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Stream circuit.
+	xfer = conn.Stats.Sum() - ioStats
+	timing.Sample("Result", []string{circuit.FileSize(xfer).String()})
+
+	if params.Verbose {
+		timing.Print(conn.Stats)
+	}
+
+	fmt.Printf("Max permanent wires: %d, cached circuits: %d\n",
+		prog.walloc.NextWireID(), prog.numCached)
+	fmt.Printf("#gates=%d (%s) #w=%d\n", prog.stats.Count(), prog.stats,
+		prog.numWires)
+	if params.OptRewriteCuts {
+		fmt.Printf("Cut rewrite: %d circuits\n",
+			prog.rewriteStats[0][circuit.Count])
+		fmt.Printf(" - before: %s\n", prog.rewriteStats[0])
+		fmt.Printf(" - after:  %s\n", prog.rewriteStats[1])
+	}
+	fmt.Printf("Program hash: %x\n", sink.hash.Sum())
+
+	if params.Diagnostics {
+		tab := tabulate.New(tabulate.CompactUnicodeLight)
+		tab.Header("Instr").SetAlign(tabulate.ML)
+		tab.Header("Count").SetAlign(tabulate.MR)
+		tab.Header("XOR").SetAlign(tabulate.MR)
+		tab.Header("XNOR").SetAlign(tabulate.MR)
+		tab.Header("AND").SetAlign(tabulate.MR)
+		tab.Header("OR").SetAlign(tabulate.MR)
+		tab.Header("INV").SetAlign(tabulate.MR)
+		tab.Header("!XOR").SetAlign(tabulate.MR)
+		tab.Header("L").SetAlign(tabulate.MR)
+		tab.Header("W").SetAlign(tabulate.MR)
+
+		istats := prog.istats
+		var keys []string
+		for k := range istats {
+			keys = append(keys, k)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return istats[keys[i]].Cost() > istats[keys[j]].Cost()
+		})
+
+		for _, key := range keys {
+			stats := istats[key]
+			if stats.Count() > 0 {
+				row := tab.Row()
+				row.Column(key)
+				row.Column(fmt.Sprintf("%d", stats[circuit.Count]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.XOR]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.XNOR]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.AND]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.OR]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.INV]))
+				row.Column(fmt.Sprintf("%d",
+					stats[circuit.OR]+stats[circuit.AND]+stats[circuit.INV]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.NumLevels]))
+				row.Column(fmt.Sprintf("%d", stats[circuit.MaxWidth]))
+			}
+		}
+		tab.Print(os.Stdout)
+	}
+
+	return prog.Outputs, result, nil
+}
+
+// StreamHash computes the program hash of the streamed program
+// without garbling it. The hash matches the hash the garbler and the
+// evaluator compute when the program is streamed with Stream.
+func (prog *Program) StreamHash(params *utils.Params) ([]byte, error) {
+	hash := circuit.NewStreamHash()
+	hash.Arguments(prog.Inputs[0], prog.Inputs[1], prog.Outputs)
+
+	prog.assignInputIDs()
+	if err := prog.defineStreamConstants(hashSink{hash}); err != nil {
+		return nil, err
+	}
+	if _, err := prog.streamSteps(params, hashSink{hash}); err != nil {
+		return nil, err
+	}
+	return hash.Sum(), nil
+}
+
+// assignInputIDs assigns wire IDs for the program's input wires.
+func (prog *Program) assignInputIDs() []circuit.Wire {
+	var ids []circuit.Wire
+	for _, w := range prog.InputWires {
+		// Program's inputs are unassigned because parser is shared
+		// between streaming and non-streaming modes.
+		w.SetID(prog.walloc.NextWireID())
+		ids = append(ids, w.ID())
+	}
+	return ids
+}
+
+func (prog *Program) defineStreamConstants(sink circuitSink) error {
+	zero, err := prog.ZeroWire(sink)
+	if err != nil {
+		return err
+	}
+	one, err := prog.OneWire(sink)
+	if err != nil {
+		return err
+	}
+	return prog.DefineConstants(zero, one)
+}
+
+// streamSteps streams the program steps into the sink. The function
+// returns the program's return wires.
+func (prog *Program) streamSteps(params *utils.Params, sink circuitSink) (
+	[]circuit.Wire, error) {
 
 	cache := make(map[string]*circuit.Circuit)
 	var returnIDs []circuit.Wire
@@ -178,7 +333,7 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		for _, in := range instr.In {
 			w, err := prog.walloc.AssignedIDs(in, in.Type.Bits)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			if len(w) != int(in.Type.Bits) {
 				// Const values are cast to different value
@@ -190,9 +345,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 					// Sign expansion.
 					pad = w[len(w)-1]
 				} else {
-					zero, err = prog.ZeroWire(conn, streaming)
+					zero, err := prog.ZeroWire(sink)
 					if err != nil {
-						return nil, nil, err
+						return nil, err
 					}
 					pad = zero.ID()
 				}
@@ -215,7 +370,7 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		if instr.Out != nil {
 			out, err = prog.walloc.AssignedIDs(*instr.Out, instr.Out.Type.Bits)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 		}
 
@@ -240,12 +395,12 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		case Lshift:
 			count, err := instr.In[1].ConstInt()
 			if err != nil {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: unsupported index type %T: %s",
 						instr.Op, instr.In[1], err)
 			}
 			if count < 0 {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: negative shift count %d", instr.Op, count)
 			}
 			for bit := 0; bit < len(out); bit++ {
@@ -253,9 +408,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				if bit-int(count) >= 0 && bit-int(count) < len(wires[0]) {
 					id = wires[0][bit-int(count)]
 				} else {
-					w, err := prog.ZeroWire(conn, streaming)
+					w, err := prog.ZeroWire(sink)
 					if err != nil {
-						return nil, nil, err
+						return nil, err
 					}
 					id = w.ID()
 				}
@@ -267,20 +422,20 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			if instr.Op == Srshift {
 				signWire = wires[0][len(wires[0])-1]
 			} else {
-				zero, err := prog.ZeroWire(conn, streaming)
+				zero, err := prog.ZeroWire(sink)
 				if err != nil {
-					return nil, nil, err
+					return nil, err
 				}
 				signWire = zero.ID()
 			}
 			count, err := instr.In[1].ConstInt()
 			if err != nil {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: unsupported index type %T: %s",
 						instr.Op, instr.In[1], err)
 			}
 			if count < 0 {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: negative shift count %d", instr.Op, count)
 			}
 			for bit := 0; bit < len(out); bit++ {
@@ -296,18 +451,18 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		case Slice:
 			from, err := instr.In[1].ConstInt()
 			if err != nil {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: unsupported index type %T: %s",
 						instr.Op, instr.In[1], err)
 			}
 			to, err := instr.In[2].ConstInt()
 			if err != nil {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("%s: unsupported index type %T: %s",
 						instr.Op, instr.In[2], err)
 			}
 			if from >= to {
-				return nil, nil, fmt.Errorf("%s: bounds out of range [%d:%d]",
+				return nil, fmt.Errorf("%s: bounds out of range [%d:%d]",
 					instr.Op, from, to)
 			}
 			for bit := from; bit < to; bit++ {
@@ -315,9 +470,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				if int(bit) < len(wires[0]) {
 					id = wires[0][bit]
 				} else {
-					w, err := prog.ZeroWire(conn, streaming)
+					w, err := prog.ZeroWire(sink)
 					if err != nil {
-						return nil, nil, err
+						return nil, err
 					}
 					id = w.ID()
 				}
@@ -329,9 +484,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			if instr.Op == Smov {
 				signWire = wires[0][len(wires[0])-1]
 			} else {
-				zero, err := prog.ZeroWire(conn, streaming)
+				zero, err := prog.ZeroWire(sink)
 				if err != nil {
-					return nil, nil, err
+					return nil, err
 				}
 				signWire = zero.ID()
 			}
@@ -350,16 +505,16 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			// array[from:to] = v
 			from, err := instr.In[2].ConstInt()
 			if err != nil {
-				return nil, nil, fmt.Errorf("%s: unsupported index type %T: %s",
+				return nil, fmt.Errorf("%s: unsupported index type %T: %s",
 					instr.Op, instr.In[2], err)
 			}
 			to, err := instr.In[3].ConstInt()
 			if err != nil {
-				return nil, nil, fmt.Errorf("%s: unsupported index type %T: %s",
+				return nil, fmt.Errorf("%s: unsupported index type %T: %s",
 					instr.Op, instr.In[3], err)
 			}
 			if from < 0 || from >= to {
-				return nil, nil, fmt.Errorf("%s: bounds out of range [%d:%d]",
+				return nil, fmt.Errorf("%s: bounds out of range [%d:%d]",
 					instr.Op, from, to)
 			}
 
@@ -369,9 +524,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 					if bit < types.Size(len(wires[1])) {
 						id = wires[1][bit]
 					} else {
-						w, err := prog.ZeroWire(conn, streaming)
+						w, err := prog.ZeroWire(sink)
 						if err != nil {
-							return nil, nil, err
+							return nil, err
 						}
 						id = w.ID()
 					}
@@ -380,9 +535,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 					if idx < types.Size(len(wires[0])) {
 						id = wires[0][idx]
 					} else {
-						w, err := prog.ZeroWire(conn, streaming)
+						w, err := prog.ZeroWire(sink)
 						if err != nil {
-							return nil, nil, err
+							return nil, err
 						}
 						id = w.ID()
 					}
@@ -391,22 +546,14 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			}
 
 		case Ret:
-			if err := conn.SendUint32(circuit.OpReturn); err != nil {
-				return nil, nil, err
-			}
 			for _, arg := range wires {
-				for _, w := range arg {
-					if err := conn.SendUint32(w.Int()); err != nil {
-						return nil, nil, err
-					}
-					returnIDs = append(returnIDs, w)
-				}
+				returnIDs = append(returnIDs, arg...)
 			}
 			if circuit.StreamDebug {
 				fmt.Printf("return=%v\n", returnIDs)
 			}
-			if err := conn.Flush(); err != nil {
-				return nil, nil, err
+			if err := sink.Return(returnIDs); err != nil {
+				return nil, err
 			}
 
 		case Circ:
@@ -426,7 +573,7 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			for i, ret := range instr.Ret {
 				wires, err := prog.walloc.AssignedIDs(ret, ret.Type.Bits)
 				if err != nil {
-					return nil, nil, err
+					return nil, err
 				}
 				for j := 0; j < int(instr.Circ.Outputs[i].Type.Bits); j++ {
 					if j < len(wires) {
@@ -437,7 +584,7 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				}
 			}
 			if len(oIDs) != instr.Circ.Outputs.Size() {
-				return nil, nil, fmt.Errorf("%s: output mismatch: %d vs. %d",
+				return nil, fmt.Errorf("%s: output mismatch: %d vs. %d",
 					instr.Op, len(oIDs), instr.Circ.Outputs.Size())
 			}
 			if params.Verbose && circuit.StreamDebug {
@@ -446,9 +593,9 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 			if params.Diagnostics {
 				addStats(istats, instr, instr.Circ)
 			}
-			err = prog.garble(conn, streaming, idx, instr.Circ, iIDs, oIDs)
+			err = sink.Circuit(idx, instr.Circ, iIDs, oIDs, true)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 
 		case GC:
@@ -457,15 +604,15 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 		default:
 			f, ok := circuitGenerators[instr.Op]
 			if !ok {
-				return nil, nil,
+				return nil,
 					fmt.Errorf("Program.StreamCircuit: %s not implemented yet",
 						instr.Op)
 			}
 			if params.Verbose && circuit.StreamDebug {
 				fmt.Printf(" - %s\n", instr.StringTyped())
 			}
-			circ, ok := cache[instr.StringTyped()]
-			if !ok {
+			circ, cached := cache[instr.StringTyped()]
+			if !cached {
 				var cIn [][]*circuits.Wire
 				var flat []*circuits.Wire
 				startTime := time.Now()
@@ -484,13 +631,19 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				cc, err := circuits.NewCompiler(params, prog.calloc, nil, nil,
 					flat, cOut)
 				if err != nil {
-					return nil, nil, err
+					return nil, err
 				}
 				cacheable, err := f(cc, instr, cIn, cOut)
 				if err != nil {
-					return nil, nil, err
+					return nil, err
 				}
 				cc.ConstPropagate()
+				cc.RewriteORINV()
+				if params.OptRewriteCuts {
+					before, after := cc.RewriteCuts()
+					prog.rewriteStats[0].Add(before)
+					prog.rewriteStats[1].Add(after)
+				}
 				pruned := cc.Prune()
 				if params.Verbose && circuit.StreamDebug {
 					fmt.Printf("%05d: - pruned %d gates\n", idx, pruned)
@@ -498,6 +651,7 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				circ = cc.Compile()
 				if cacheable {
 					cache[instr.StringTyped()] = circ
+					cached = true
 				}
 				if params.Verbose && circuit.StreamDebug {
 					fmt.Printf("%05d: - %s\n", idx, circ)
@@ -525,125 +679,19 @@ func (prog *Program) Stream(conn *p2p.Conn, oti ot.OT,
 				oIDs = append(oIDs, w)
 			}
 
-			err = prog.garble(conn, streaming, idx, circ, iIDs, oIDs)
+			err = sink.Circuit(idx, circ, iIDs, oIDs, cached)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 		}
 	}
 
-	xfer = conn.Stats.Sum() - ioStats
-	ioStats = conn.Stats.Sum()
-	sample := timing.Sample("Stream", []string{circuit.FileSize(xfer).String()})
-	sample.Samples = append(sample.Samples, &circuit.Sample{
-		Label: "InstrInit",
-		Abs:   dInstrInit,
-	})
-	sample.Samples = append(sample.Samples, &circuit.Sample{
-		Label: "CircComp",
-		Abs:   dCircCompile,
-	})
-	sample.Samples = append(sample.Samples, &circuit.Sample{
-		Label: "StreamInit",
-		Abs:   prog.tInit,
-	})
-	sample.Samples = append(sample.Samples, &circuit.Sample{
-		Label: "Garble",
-		Abs:   prog.tGarble,
-	})
+	prog.tInstrInit += dInstrInit
+	prog.tCircCompile += dCircCompile
+	prog.istats = istats
+	prog.numCached = len(cache)
 
-	result := new(big.Int)
-
-	op, err := conn.ReceiveUint32()
-	if err != nil {
-		return nil, nil, err
-	}
-	if op != circuit.OpResult {
-		return nil, nil, fmt.Errorf("unexpected operation: %d", op)
-	}
-
-	var label ot.Label
-
-	for i := 0; i < prog.Outputs.Size(); i++ {
-		err := conn.ReceiveLabel(&label, &labelData)
-		if err != nil {
-			return nil, nil, err
-		}
-		wire := streaming.GetInput(returnIDs[i])
-		var bit uint
-		if label.Equal(wire.L0) {
-			bit = 0
-		} else if label.Equal(wire.L1) {
-			bit = 1
-		} else {
-			return nil, nil, fmt.Errorf("unknown label %s for result %d",
-				label, i)
-		}
-		result.SetBit(result, i, bit)
-	}
-	data := result.Bytes()
-	if err := conn.SendData(data); err != nil {
-		return nil, nil, err
-	}
-	if err := conn.Flush(); err != nil {
-		return nil, nil, err
-	}
-
-	xfer = conn.Stats.Sum() - ioStats
-	timing.Sample("Result", []string{circuit.FileSize(xfer).String()})
-
-	if params.Verbose {
-		timing.Print(conn.Stats)
-	}
-
-	fmt.Printf("Max permanent wires: %d, cached circuits: %d\n",
-		prog.walloc.NextWireID(), len(cache))
-	fmt.Printf("#gates=%d (%s) #w=%d\n", prog.stats.Count(), prog.stats,
-		prog.numWires)
-
-	if params.Diagnostics {
-		tab := tabulate.New(tabulate.CompactUnicodeLight)
-		tab.Header("Instr").SetAlign(tabulate.ML)
-		tab.Header("Count").SetAlign(tabulate.MR)
-		tab.Header("XOR").SetAlign(tabulate.MR)
-		tab.Header("XNOR").SetAlign(tabulate.MR)
-		tab.Header("AND").SetAlign(tabulate.MR)
-		tab.Header("OR").SetAlign(tabulate.MR)
-		tab.Header("INV").SetAlign(tabulate.MR)
-		tab.Header("!XOR").SetAlign(tabulate.MR)
-		tab.Header("L").SetAlign(tabulate.MR)
-		tab.Header("W").SetAlign(tabulate.MR)
-
-		var keys []string
-		for k := range istats {
-			keys = append(keys, k)
-		}
-
-		sort.Slice(keys, func(i, j int) bool {
-			return istats[keys[i]].Cost() > istats[keys[j]].Cost()
-		})
-
-		for _, key := range keys {
-			stats := istats[key]
-			if stats.Count() > 0 {
-				row := tab.Row()
-				row.Column(key)
-				row.Column(fmt.Sprintf("%d", stats[circuit.Count]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.XOR]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.XNOR]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.AND]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.OR]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.INV]))
-				row.Column(fmt.Sprintf("%d",
-					stats[circuit.OR]+stats[circuit.AND]+stats[circuit.INV]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.NumLevels]))
-				row.Column(fmt.Sprintf("%d", stats[circuit.MaxWidth]))
-			}
-		}
-		tab.Print(os.Stdout)
-	}
-
-	return prog.Outputs, prog.Outputs.Split(result), nil
+	return returnIDs, nil
 }
 
 func addStats(istats map[string]circuit.Stats, instr Instr,
@@ -664,8 +712,42 @@ func addStats(istats map[string]circuit.Stats, instr Instr,
 	istats[key] = stats
 }
 
-func (prog *Program) garble(conn *p2p.Conn, streaming *circuit.Streaming,
-	step int, circ *circuit.Circuit, in, out []circuit.Wire) error {
+// circuitSink receives the circuits of a streamed program. The
+// cached flag tells if the same circuit can be streamed again in
+// later steps.
+type circuitSink interface {
+	Circuit(step int, circ *circuit.Circuit, in, out []circuit.Wire,
+		cached bool) error
+	Return(ids []circuit.Wire) error
+}
+
+// hashSink computes the program hash of the streamed circuits.
+type hashSink struct {
+	*circuit.StreamHash
+}
+
+func (s hashSink) Circuit(step int, circ *circuit.Circuit,
+	in, out []circuit.Wire, cached bool) error {
+	return s.StreamHash.Circuit(step, circ, in, out)
+}
+
+// streamTemplates enables the circuit templates for the cached
+// circuits. The tests disable it to measure the template savings.
+var streamTemplates = true
+
+// streamGarbler garbles the circuits and streams them to the
+// evaluator. The cached circuits are streamed as circuit templates
+// so that their gate structure is sent only once.
+type streamGarbler struct {
+	prog      *Program
+	conn      *p2p.Conn
+	streaming *circuit.Streaming
+	hash      *circuit.StreamHash
+	templates map[*circuit.Circuit]int
+}
+
+func (s *streamGarbler) Circuit(step int, circ *circuit.Circuit,
+	in, out []circuit.Wire, cached bool) error {
 
 	var maxID circuit.Wire
 	for _, id := range in {
@@ -679,36 +761,115 @@ func (prog *Program) garble(conn *p2p.Conn, streaming *circuit.Streaming,
 		}
 	}
 
-	if err := conn.SendUint32(circuit.OpCircuit); err != nil {
-		return err
+	var tInit, tGarble time.Duration
+	var err error
+	if cached && streamTemplates {
+		tInit, tGarble, err = s.instance(step, circ, in, out, maxID)
+	} else {
+		tInit, tGarble, err = s.circuit(step, circ, in, out, maxID)
 	}
-	if err := conn.SendUint32(step); err != nil {
+	if err != nil {
 		return err
 	}
-	if err := conn.SendUint32(circ.NumGates); err != nil {
+	if err := s.hash.Circuit(step, circ, in, out); err != nil {
 		return err
 	}
-	if err := conn.SendUint32(circ.NumWires); err != nil {
-		return err
+	s.prog.tInit += tInit
+	s.prog.tGarble += tGarble
+	s.prog.stats.Add(circ.Stats)
+	s.prog.numWires += circ.NumWires
+
+	return nil
+}
+
+// circuit streams the circuit with its gate structure.
+func (s *streamGarbler) circuit(step int, circ *circuit.Circuit,
+	in, out []circuit.Wire, maxID circuit.Wire) (
+	time.Duration, time.Duration, error) {
+
+	if err := s.conn.SendUint32(circuit.OpCircuit); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(step); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(circ.NumGates); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(circ.NumWires); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(int(maxID + 1)); err != nil {
+		return 0, 0, err
+	}
+	return s.streaming.Garble(circ, in, out)
+}
+
+// instance streams the circuit as an instance of its circuit
+// template. The template is defined when the circuit is streamed for
+// the first time.
+func (s *streamGarbler) instance(step int, circ *circuit.Circuit,
+	in, out []circuit.Wire, maxID circuit.Wire) (
+	time.Duration, time.Duration, error) {
+
+	id, ok := s.templates[circ]
+	if !ok {
+		id = len(s.templates)
+		s.templates[circ] = id
+
+		if err := s.conn.SendUint32(circuit.OpTemplate); err != nil {
+			return 0, 0, err
+		}
+		if err := s.conn.SendUint32(id); err != nil {
+			return 0, 0, err
+		}
+		err := s.streaming.DefineTemplate(circ, len(in), len(out))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := s.conn.SendUint32(circuit.OpInstance); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(step); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(id); err != nil {
+		return 0, 0, err
+	}
+	if err := s.conn.SendUint32(int(maxID + 1)); err != nil {
+		return 0, 0, err
+	}
+	for _, w := range in {
+		if err := s.conn.SendUint32(w.Int()); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, w := range out {
+		if err := s.conn.SendUint32(w.Int()); err != nil {
+			return 0, 0, err
+		}
 	}
-	if err := conn.SendUint32(int(maxID + 1)); err != nil {
+	return s.streaming.GarbleTemplate(circ, in, out)
+}
+
+func (s *streamGarbler) Return(ids []circuit.Wire) error {
+	if err := s.conn.SendUint32(circuit.OpReturn); err != nil {
 		return err
 	}
-	tInit, tGarble, err := streaming.Garble(circ, in, out)
-	if err != nil {
+	for _, id := range ids {
+		if err := s.conn.SendUint32(id.Int()); err != nil {
+			return err
+		}
+	}
+	if err := s.hash.Return(ids); err != nil {
 		return err
 	}
-	prog.tInit += tInit
-	prog.tGarble += tGarble
-	prog.stats.Add(circ.Stats)
-	prog.numWires += circ.NumWires
-
-	return nil
+	return s.conn.Flush()
 }
 
 // ZeroWire returns a wire with value 0.
-func (prog *Program) ZeroWire(conn *p2p.Conn, streaming *circuit.Streaming) (
-	*circuits.Wire, error) {
+func (prog *Program) ZeroWire(sink circuitSink) (*circuits.Wire, error) {
 
 	if prog.zeroWire == nil {
 		wires, err := prog.walloc.AssignedWires(Value{
@@ -718,7 +879,7 @@ func (prog *Program) ZeroWire(conn *p2p.Conn, streaming *circuit.Streaming) (
 		if err != nil {
 			return nil, err
 		}
-		err = prog.garble(conn, streaming, 0, &circuit.Circuit{
+		err = sink.Circuit(0, &circuit.Circuit{
 			NumGates: 1,
 			NumWires: 2,
 			Inputs: []circuit.IOArg{
@@ -752,7 +913,7 @@ func (prog *Program) ZeroWire(conn *p2p.Conn, streaming *circuit.Streaming) (
 			Stats: circuit.Stats{
 				circuit.XOR: 1,
 			},
-		}, []circuit.Wire{0}, []circuit.Wire{wires[0].ID()})
+		}, []circuit.Wire{0}, []circuit.Wire{wires[0].ID()}, false)
 		if err != nil {
 			return nil, err
 		}
@@ -762,8 +923,7 @@ func (prog *Program) ZeroWire(conn *p2p.Conn, streaming *circuit.Streaming) (
 }
 
 // OneWire returns wire with value 1.
-func (prog *Program) OneWire(conn *p2p.Conn, streaming *circuit.Streaming) (
-	*circuits.Wire, error) {
+func (prog *Program) OneWire(sink circuitSink) (*circuits.Wire, error) {
 
 	if prog.oneWire == nil {
 		wires, err := prog.walloc.AssignedWires(Value{
@@ -773,7 +933,7 @@ func (prog *Program) OneWire(conn *p2p.Conn, streaming *circuit.Streaming) (
 		if err != nil {
 			return nil, err
 		}
-		err = prog.garble(conn, streaming, 0, &circuit.Circuit{
+		err = sink.Circuit(0, &circuit.Circuit{
 			NumGates: 1,
 			NumWires: 2,
 			Inputs: []circuit.IOArg{
@@ -807,7 +967,7 @@ func (prog *Program) OneWire(conn *p2p.Conn, streaming *circuit.Streaming) (
 			Stats: circuit.Stats{
 				circuit.XNOR: 1,
 			},
-		}, []circuit.Wire{0}, []circuit.Wire{wires[0].ID()})
+		}, []circuit.Wire{0}, []circuit.Wire{wires[0].ID()}, false)
 		if err != nil {
 			return nil, err
 		}
@@ -826,6 +986,9 @@ func sendArgument(conn *p2p.Conn, arg circuit.IOArg) error {
 	if err := conn.SendUint32(int(arg.Type.Bits)); err != nil {
 		return err
 	}
+	if err := conn.SendByte(byte(arg.Owner)); err != nil {
+		return err
+	}
 
 	if err := conn.SendUint32(len(arg.Compound)); err != nil {
 		return err
@@ -870,6 +1033,25 @@ func newModulo(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	return true, circuits.NewDivider(cc, in[0], in[1], nil, out)
 }
 
+func newFixedMultiplier(cc *circuits.Compiler, instr Instr,
+	in [][]*circuits.Wire, out []*circuits.Wire) (bool, error) {
+	return true, circuits.NewFixedMultiplier(cc, int(instr.Out.Type.Frac),
+		in[0], in[1], out)
+}
+
+func newFixedDivider(cc *circuits.Compiler, instr Instr,
+	in [][]*circuits.Wire, out []*circuits.Wire) (bool, error) {
+	return true, circuits.NewFixedDivider(cc, int(instr.Out.Type.Frac),
+		in[0], in[1], out)
+}
+
+func newFixedConvert(cc *circuits.Compiler, instr Instr,
+	in [][]*circuits.Wire, out []*circuits.Wire) (bool, error) {
+	return true, circuits.NewFixedConvert(cc, int(instr.In[0].Type.Frac),
+		int(instr.Out.Type.Frac), instr.In[0].Type.Type != types.TUint,
+		in[0], out)
+}
+
 func newIndex(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	out []*circuits.Wire) (bool, error) {
 	offset, err := instr.In[1].ConstInt()
@@ -881,6 +1063,33 @@ func newIndex(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 		in[0][offset:], in[2], out)
 }
 
+func newEq(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
+	out []*circuits.Wire) (bool, error) {
+	if instr.In[0].Type.Type == types.TFloat {
+		return true, circuits.NewFloatEqComparator(cc, in[0], in[1], out)
+	}
+	return true, circuits.NewEqComparator(cc, in[0], in[1], out)
+}
+
+func newNeq(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
+	out []*circuits.Wire) (bool, error) {
+	if instr.In[0].Type.Type == types.TFloat {
+		return true, circuits.NewFloatNeqComparator(cc, in[0], in[1], out)
+	}
+	return true, circuits.NewNeqComparator(cc, in[0], in[1], out)
+}
+
+// NewUnary creates a new unary circuit.
+type NewUnary func(cc *circuits.Compiler, a []*circuits.Wire,
+	out []*circuits.Wire) error
+
+func newUnary(un NewUnary) NewCircuit {
+	return func(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
+		out []*circuits.Wire) (bool, error) {
+		return true, un(cc, in[0], out)
+	}
+}
+
 func newNot(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 	out []*circuits.Wire) (bool, error) {
 	for i := 0; i < len(out); i++ {
@@ -892,25 +1101,39 @@ func newNot(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 var circuitGenerators = map[Operand]NewCircuit{
 	Iadd:  newBinary(circuits.NewAdder),
 	Uadd:  newBinary(circuits.NewAdder),
+	Fadd:  newBinary(circuits.NewFloatAdder),
 	Isub:  newBinary(circuits.NewSubtractor),
 	Usub:  newBinary(circuits.NewSubtractor),
+	Fsub:  newBinary(circuits.NewFloatSubtractor),
 	Imult: newMultiplier,
 	Umult: newMultiplier,
+	Fmult: newBinary(circuits.NewFloatMultiplier),
+	Qmult: newFixedMultiplier,
 	Idiv:  newDivider,
 	Udiv:  newDivider,
+	Fdiv:  newBinary(circuits.NewFloatDivider),
+	Qdiv:  newFixedDivider,
 	Imod:  newModulo,
 	Umod:  newModulo,
 	Index: newIndex,
 	Ilt:   newBinary(circuits.NewLtComparator),
 	Ult:   newBinary(circuits.NewLtComparator),
+	Flt:   newBinary(circuits.NewFloatLtComparator),
+	Qlt:   newBinary(circuits.NewFixedLtComparator),
 	Ile:   newBinary(circuits.NewLeComparator),
 	Ule:   newBinary(circuits.NewLeComparator),
+	Fle:   newBinary(circuits.NewFloatLeComparator),
+	Qle:   newBinary(circuits.NewFixedLeComparator),
 	Igt:   newBinary(circuits.NewGtComparator),
 	Ugt:   newBinary(circuits.NewGtComparator),
+	Fgt:   newBinary(circuits.NewFloatGtComparator),
+	Qgt:   newBinary(circuits.NewFixedGtComparator),
 	Ige:   newBinary(circuits.NewGeComparator),
 	Uge:   newBinary(circuits.NewGeComparator),
-	Eq:    newBinary(circuits.NewEqComparator),
-	Neq:   newBinary(circuits.NewNeqComparator),
+	Fge:   newBinary(circuits.NewFloatGeComparator),
+	Qge:   newBinary(circuits.NewFixedGeComparator),
+	Eq:    newEq,
+	Neq:   newNeq,
 	And:   newBinary(circuits.NewLogicalAND),
 	Or:    newBinary(circuits.NewLogicalOR),
 	Not:   newNot,
@@ -918,6 +1141,14 @@ var circuitGenerators = map[Operand]NewCircuit{
 	Bclr:  newBinary(circuits.NewBinaryClear),
 	Bor:   newBinary(circuits.NewBinaryOR),
 	Bxor:  newBinary(circuits.NewBinaryXOR),
+	Itof:  newUnary(circuits.NewIntToFloat),
+	Utof:  newUnary(circuits.NewUintToFloat),
+	Ftoi:  newUnary(circuits.NewFloatToInt),
+	Ftof:  newUnary(circuits.NewFloatConvert),
+	Itoq:  newFixedConvert,
+	Utoq:  newFixedConvert,
+	Qtoi:  newFixedConvert,
+	Qtoq:  newFixedConvert,
 
 	Builtin: func(cc *circuits.Compiler, instr Instr, in [][]*circuits.Wire,
 		out []*circuits.Wire) (bool, error) {
@@ -0,0 +1,89 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ssa_test
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/ssa"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+const streamTemplateProgram = `
+package main
+func main(a, b uint8) uint8 {
+    var r uint8
+    for i := 0; i < 4; i++ {
+        r = r*a + b
+    }
+    return r
+}
+`
+
+// streamProgram streams the program and returns the program result
+// and the number of bytes the garbler sent.
+func streamProgram(t *testing.T, code string) ([]*big.Int, uint64) {
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	params := utils.NewParams()
+	params.Scheme = circuit.ThreeHalves
+
+	done := make(chan error)
+	go func() {
+		_, _, err := compiler.New(params).StreamInput(gConn, ot.NewCO(),
+			code, func(arg circuit.IOArg) (*big.Int, error) {
+				return big.NewInt(5), nil
+			}, [][]int{{8}, {8}})
+		gConn.Close()
+		done <- err
+	}()
+
+	_, result, err := circuit.StreamEvaluatorInput(eConn, ot.NewCO(),
+		circuit.ThreeHalves, func(arg circuit.IOArg) (*big.Int, error) {
+			return big.NewInt(7), nil
+		}, nil, false)
+	eConn.Close()
+	if gErr := <-done; gErr != nil {
+		t.Fatalf("garbler failed: %v", gErr)
+	}
+	if err != nil {
+		t.Fatalf("evaluator failed: %v", err)
+	}
+	return result, gConn.Stats.Sent.Load()
+}
+
+func TestStreamTemplates(t *testing.T) {
+	defer ssa.SetStreamTemplates(true)
+
+	var expected uint8
+	for i := 0; i < 4; i++ {
+		expected = expected*5 + 7
+	}
+
+	var sent [2]uint64
+	for idx, templates := range []bool{true, false} {
+		ssa.SetStreamTemplates(templates)
+
+		result, n := streamProgram(t, streamTemplateProgram)
+		if len(result) != 1 || result[0].Int64() != int64(expected) {
+			t.Errorf("unexpected result: %v, expected %v", result, expected)
+		}
+		sent[idx] = n
+	}
+	if sent[0] >= sent[1] {
+		t.Errorf("templates did not reduce traffic: sent %d bytes, "+
+			"%d bytes without templates", sent[0], sent[1])
+	}
+}
@@ -9,6 +9,7 @@ package ssa
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/markkurossi/mpc/compiler/mpa"
@@ -278,6 +279,28 @@ func isSet(v interface{}, vt types.Info, bit types.Size) bool {
 		}
 		return val.Bit(int(bit)) != 0
 
+	case float64:
+		switch vt.Type {
+		case types.TFloat:
+			if vt.Bits == 32 {
+				return math.Float32bits(float32(val))&(1<<bit) != 0
+			}
+			return math.Float64bits(val)&(1<<bit) != 0
+
+		case types.TFixed:
+			// Fixed-point values are two's complement integers
+			// scaled by 2^Frac.
+			fixed, _ := new(big.Float).SetFloat64(
+				math.Round(math.Ldexp(val, int(vt.Frac)))).Int(nil)
+			if fixed.Sign() < 0 {
+				fixed.Add(fixed, new(big.Int).Lsh(big.NewInt(1), uint(vt.Bits)))
+			}
+			return fixed.Bit(int(bit)) != 0
+
+		default:
+			panic(fmt.Sprintf("ssa.isSet: invalid float type %v", vt))
+		}
+
 	case string:
 		bytes := []byte(val)
 		idx := bit / types.ByteBits
@@ -289,7 +312,8 @@ func isSet(v interface{}, vt types.Info, bit types.Size) bool {
 
 	case Value:
 		switch val.Type.Type {
-		case types.TBool, types.TInt, types.TUint, types.TFloat, types.TString:
+		case types.TBool, types.TInt, types.TUint, types.TFloat, types.TFixed,
+			types.TString:
 			return isSet(val.ConstValue, val.Type, bit)
 
 		case types.TArray:
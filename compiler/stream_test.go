@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package compiler
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+const streamHashProgram = `
+package main
+func main(a, b uint8) (uint8, bool) {
+    return a*b + 3, a < b
+}
+`
+
+const streamHashOther = `
+package main
+func main(a, b uint8) (uint8, bool) {
+    return a*b + 4, a < b
+}
+`
+
+func streamHash(t *testing.T, code string) []byte {
+	_, _, hash, err := New(utils.NewParams()).streamHash("test.mpcl",
+		strings.NewReader(code), [][]int{{8}, {8}})
+	if err != nil {
+		t.Fatalf("failed to compute program hash: %v", err)
+	}
+	return hash
+}
+
+func streamProgram(t *testing.T, code string, expected []byte) (
+	[]*big.Int, error) {
+
+	gc, ec := net.Pipe()
+	gConn := p2p.NewConn(gc)
+	eConn := p2p.NewConn(ec)
+
+	params := utils.NewParams()
+	params.Scheme = circuit.ThreeHalves
+
+	done := make(chan error)
+	go func() {
+		_, _, err := New(params).stream(gConn, ot.NewCO(),
+			"test.mpcl", strings.NewReader(code), parseInput([]string{"5"}),
+			[][]int{{8}, {8}})
+		gConn.Close()
+		done <- err
+	}()
+
+	_, result, err := circuit.StreamEvaluator(eConn, ot.NewCO(),
+		circuit.ThreeHalves, []string{"7"},
+		func(in1, in2 circuit.IOArg, outputs circuit.IO) ([]byte, error) {
+			return expected, nil
+		}, false)
+	eConn.Close()
+	<-done
+
+	return result, err
+}
+
+func TestStreamHash(t *testing.T) {
+	hash := streamHash(t, streamHashProgram)
+	if !bytes.Equal(hash, streamHash(t, streamHashProgram)) {
+		t.Fatalf("program hash is not deterministic")
+	}
+	if bytes.Equal(hash, streamHash(t, streamHashOther)) {
+		t.Fatalf("different programs have the same hash")
+	}
+
+	result, err := streamProgram(t, streamHashProgram, hash)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(result) != 2 || result[0].Int64() != 38 || result[1].Int64() != 1 {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	_, err = streamProgram(t, streamHashOther, hash)
+	if err == nil {
+		t.Fatalf("evaluator accepted a different program")
+	}
+}
+
+const streamOwnerProgram = `
+package main
+// @Output sum garbler
+// @Output diff evaluator
+func main(a, b uint8) (sum, diff, both uint8) {
+    return a + b, a - b, a * b
+}
+`
+
+func TestStreamOutputOwners(t *testing.T) {
+	result, err := streamProgram(t, streamOwnerProgram,
+		streamHash(t, streamOwnerProgram))
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(result) != 3 || result[0] != nil || result[1] == nil ||
+		result[2] == nil {
+		t.Fatalf("unexpected result: %v", result)
+	}
+	if result[1].Int64() != 254 || result[2].Int64() != 35 {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
@@ -0,0 +1,37 @@
+/* Generated by Yosys 0.38 (git sha1 543faed9c8c, clang 15.0.0 -fPIC -Os) */
+
+module adder4(a, b, s, cout);
+  wire _00_;
+  wire _01_;
+  wire _02_;
+  wire _03_;
+  wire _04_;
+  wire _05_;
+  wire _06_;
+  wire _07_;
+  wire _08_;
+  wire _09_;
+  input [3:0] a;
+  wire [3:0] a;
+  input [3:0] b;
+  wire [3:0] b;
+  output cout;
+  wire cout;
+  output [3:0] s;
+  wire [3:0] s;
+  assign s[0] = b[0] ^ a[0];
+  assign _00_ = b[0] & a[0];
+  assign _01_ = b[1] ^ a[1];
+  assign s[1] = _01_ ^ _00_;
+  assign _02_ = _01_ & _00_;
+  assign _03_ = b[1] & a[1];
+  assign _04_ = _03_ ^ _02_;
+  assign _05_ = b[2] ^ a[2];
+  assign s[2] = _05_ ^ _04_;
+  assign _06_ = _05_ & _04_;
+  assign _07_ = b[2] & a[2];
+  assign _08_ = _07_ ^ _06_;
+  assign _09_ = b[3] ^ a[3];
+  assign s[3] = _09_ ^ _08_;
+  assign cout = (_09_ & _08_) ^ (b[3] & a[3]);
+endmodule
@@ -1,10 +1,10 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
 
-package compiler
+package compiler_test
 
 import (
 	"fmt"
@@ -15,11 +15,13 @@ import (
 	"reflect"
 	"regexp"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/markkurossi/mpc"
 	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler"
 	"github.com/markkurossi/mpc/compiler/utils"
 	"github.com/markkurossi/mpc/types"
 )
@@ -35,7 +37,7 @@ var (
 func TestSuite(t *testing.T) {
 	params := utils.NewParams()
 	params.MPCLCErrorLoc = true
-	compiler := New(params)
+	compiler := compiler.New(params)
 
 	filepath.WalkDir(testsuite,
 		func(path string, d fs.DirEntry, err error) error {
@@ -50,7 +52,7 @@ func TestSuite(t *testing.T) {
 		})
 }
 
-func testFile(t *testing.T, compiler *Compiler, file string) {
+func testFile(t *testing.T, compiler *compiler.Compiler, file string) {
 	if !strings.HasSuffix(file, ".mpcl") {
 		return
 	}
@@ -106,6 +108,8 @@ func testFile(t *testing.T, compiler *Compiler, file string) {
 		var inputValues [][]string
 		var inputs []*big.Int
 		var outputs []*big.Int
+		var inputStrings []string
+		var outputStrings []string
 		var sep bool
 
 		for i := 1; i < len(parts); i++ {
@@ -125,15 +129,24 @@ func testFile(t *testing.T, compiler *Compiler, file string) {
 
 					_, ok := v.SetString(input, 0)
 					if !ok {
-						t.Errorf("%s: invalid argument '%s'", file, input)
-						return
+						// Floating point and fixed-point values are
+						// parsed after compilation with their
+						// argument types.
+						_, err := strconv.ParseFloat(input, 64)
+						if err != nil {
+							t.Errorf("%s: invalid argument '%s'",
+								file, input)
+							return
+						}
 					}
 				}
 				if sep {
 					outputs = append(outputs, v)
+					outputStrings = append(outputStrings, input)
 				} else {
 					iv = append(iv, input)
 					inputs = append(inputs, v)
+					inputStrings = append(inputStrings, input)
 				}
 			}
 			inputValues = append(inputValues, iv)
@@ -153,6 +166,33 @@ func testFile(t *testing.T, compiler *Compiler, file string) {
 			return
 		}
 
+		var args circuit.IO
+		for _, arg := range circ.Inputs {
+			if len(arg.Compound) > 0 {
+				args = append(args, arg.Compound...)
+			} else {
+				args = append(args, arg)
+			}
+		}
+		for idx, arg := range args {
+			if idx < len(inputs) && parsedLater(arg.Type) {
+				inputs[idx], err = arg.Parse(inputStrings[idx : idx+1])
+				if err != nil {
+					t.Errorf("%s: %s", file, err)
+					return
+				}
+			}
+		}
+		for idx, arg := range circ.Outputs {
+			if idx < len(outputs) && parsedLater(arg.Type) {
+				outputs[idx], err = arg.Parse(outputStrings[idx : idx+1])
+				if err != nil {
+					t.Errorf("%s: %s", file, err)
+					return
+				}
+			}
+		}
+
 		results, err := circ.Compute(inputs)
 		if err != nil {
 			t.Errorf("%s: compute failed: %s", file, err)
@@ -189,6 +229,12 @@ func testFile(t *testing.T, compiler *Compiler, file string) {
 	}
 }
 
+// parsedLater tests if the values of the type are parsed with their
+// argument types after compilation.
+func parsedLater(t types.Info) bool {
+	return t.Type == types.TFloat || t.Type == types.TFixed
+}
+
 func reverse(val string) string {
 	var prefix string
 	if strings.HasPrefix(val, "0x") {
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,6 +8,8 @@ package utils
 
 import (
 	"io"
+
+	"github.com/markkurossi/mpc/circuit"
 )
 
 // Params specify compiler parameters.
@@ -38,7 +40,15 @@ type Params struct {
 
 	OptPruneGates bool
 
+	// OptRewriteCuts enables the AND-count minimizing cut rewriting
+	// of the circuits.
+	OptRewriteCuts bool
+
 	BenchmarkCompile bool
+
+	// Scheme specifies the most efficient garbling scheme the
+	// streaming garbler is willing to use.
+	Scheme circuit.Scheme
 }
 
 // NewParams returns new compiler params object, initialized with the
@@ -0,0 +1,550 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/types"
+)
+
+// JSONInput holds input values from a JSON object that maps the
+// main() parameter names to their values. Integers are JSON numbers
+// or hex strings, floating point values are JSON numbers or strings
+// like "NaN" and "+Inf", fixed-point values are JSON numbers or
+// decimal strings, booleans are JSON booleans, strings are JSON
+// strings, arrays are JSON arrays or hex strings, and structs are
+// JSON objects that map the field names to their values. The struct
+// fields must be in their declaration order since the input sizes
+// are computed in the document order.
+type JSONInput struct {
+	values jsonObject
+}
+
+// ParseJSONInput parses the JSON input values from the reader.
+func ParseJSONInput(r io.Reader) (*JSONInput, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	v, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("JSON input must be an object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data after JSON input")
+	}
+	if err := obj.check(); err != nil {
+		return nil, err
+	}
+	return &JSONInput{
+		values: obj,
+	}, nil
+}
+
+// Sizes returns the input sizes in bits. The sizes are used to
+// instantiate the unspecified main() parameter types. Struct values
+// return the sizes of their fields in the document order. Unsized array parameters are
+// sized from hex string values or from JSON arrays with byte-sized
+// elements.
+func (in *JSONInput) Sizes() ([]int, error) {
+	var result []int
+	for _, f := range in.values {
+		sizes, err := jsonSizes(f.Value, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		result = append(result, sizes...)
+	}
+	return result, nil
+}
+
+// Parse returns the value of the input argument. The function
+// returns an error if the input has values for other arguments or if
+// the struct fields are not in their declaration order, as the input
+// sizes would not match the argument.
+func (in *JSONInput) Parse(arg circuit.IOArg) (*big.Int, error) {
+	v, ok := in.values.get(arg.Name)
+	if !ok {
+		return nil, fmt.Errorf("no input value for %s", arg.Name)
+	}
+	if len(in.values) != 1 {
+		return nil, fmt.Errorf("JSON input has values for %d arguments, "+
+			"expected only %s", len(in.values), arg.Name)
+	}
+	var result *big.Int
+	var err error
+	if len(arg.Compound) > 0 && len(arg.Type.Struct) == 0 {
+		result, err = jsonCompound(v, arg.Compound)
+	} else {
+		result, err = jsonValue(v, arg.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", arg.Name, err)
+	}
+	return result, nil
+}
+
+// ResultsJSON returns the result values as a JSON object that maps
+// the output names to their values. Unnamed outputs are named by
+// their index as result0, result1, etc. The nil result values of the
+// outputs the party does not learn are omitted.
+func ResultsJSON(results []*big.Int, outputs circuit.IO) ([]byte, error) {
+	var obj jsonObject
+	for idx, result := range results {
+		if result == nil {
+			continue
+		}
+		var output circuit.IOArg
+		if outputs != nil {
+			output = outputs[idx]
+		} else {
+			output.Type = types.Info{
+				Type:       types.TUint,
+				IsConcrete: true,
+				Bits:       types.Size(result.BitLen()),
+			}
+		}
+		name := output.Name
+		if !isIdentifier(name) {
+			name = fmt.Sprintf("result%d", idx)
+		}
+		obj = append(obj, jsonField{
+			Name:  name,
+			Value: jsonResult(result, output.Type),
+		})
+	}
+	return json.MarshalIndent(obj, "", "  ")
+}
+
+// jsonField defines a JSON object member.
+type jsonField struct {
+	Name  string
+	Value interface{}
+}
+
+// jsonObject defines a JSON object that keeps its members in the
+// document order.
+type jsonObject []jsonField
+
+func (obj jsonObject) get(name string) (interface{}, bool) {
+	for _, f := range obj {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// check verifies that the object and its child objects do not have
+// duplicate members.
+func (obj jsonObject) check() error {
+	seen := make(map[string]bool)
+	for _, f := range obj {
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate JSON member %s", f.Name)
+		}
+		seen[f.Name] = true
+		if child, ok := f.Value.(jsonObject); ok {
+			if err := child.check(); err != nil {
+				return fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// field returns the value of the object member idx and verifies that
+// the member is named name. The members must be in order since
+// jsonSizes returns the member sizes in the document order.
+func (obj jsonObject) field(idx int, name string) (interface{}, error) {
+	if idx >= len(obj) {
+		return nil, fmt.Errorf("no value for %s", name)
+	}
+	if obj[idx].Name != name {
+		if _, ok := obj.get(name); ok {
+			return nil, fmt.Errorf("field %s out of order: expected %s",
+				obj[idx].Name, name)
+		}
+		return nil, fmt.Errorf("no value for %s", name)
+	}
+	return obj[idx].Value, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (obj jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for idx, f := range obj {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte(':')
+		data, err = json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// decodeJSON decodes the next JSON value from the decoder. Objects
+// are decoded as jsonObject values.
+func decodeJSON(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		var obj jsonObject
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{
+				Name:  t.(string),
+				Value: v,
+			})
+		}
+		_, err = dec.Token()
+		return obj, err
+
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+
+	default:
+		return t, nil
+	}
+}
+
+func jsonSizes(v interface{}, result []int) ([]int, error) {
+	switch v := v.(type) {
+	case jsonObject:
+		for _, f := range v {
+			var err error
+			result, err = jsonSizes(f.Value, result)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+		return result, nil
+
+	case []interface{}:
+		var bits int
+		for idx, el := range v {
+			size, err := jsonElementSize(el)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", idx, err)
+			}
+			bits += size
+		}
+		return append(result, bits), nil
+
+	default:
+		size, err := jsonSize(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, size), nil
+	}
+}
+
+func jsonElementSize(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case json.Number:
+		size, err := jsonSize(v)
+		if err != nil {
+			return 0, err
+		}
+		if size < types.ByteBits {
+			return types.ByteBits, nil
+		}
+		return (size + types.ByteBits - 1) / types.ByteBits * types.ByteBits,
+			nil
+
+	case jsonObject, []interface{}:
+		sizes, err := jsonSizes(v, nil)
+		if err != nil {
+			return 0, err
+		}
+		var bits int
+		for _, size := range sizes {
+			bits += size
+		}
+		return bits, nil
+
+	default:
+		return jsonSize(v)
+	}
+}
+
+func jsonSize(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case bool:
+		return 1, nil
+
+	case json.Number:
+		val, err := jsonInt(v)
+		if err != nil {
+			if _, ferr := v.Float64(); ferr == nil {
+				// Floating point values are float64.
+				return 64, nil
+			}
+			return 0, err
+		}
+		return val.BitLen(), nil
+
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			return (len(v) - 2) * 4, nil
+		}
+		return len(v) * types.ByteBits, nil
+
+	default:
+		return 0, fmt.Errorf("invalid input value %v", v)
+	}
+}
+
+func jsonInt(n json.Number) (*big.Int, error) {
+	val, ok := new(big.Int).SetString(n.String(), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %s", n)
+	}
+	return val, nil
+}
+
+// jsonCompound returns the value of the JSON object that maps the
+// compound argument names to their values.
+func jsonCompound(v interface{}, compound circuit.IO) (*big.Int, error) {
+	obj, ok := v.(jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("can't parse %v into %s", v, compound)
+	}
+	result := new(big.Int)
+	var offset int
+	if len(obj) != len(compound) {
+		return nil, fmt.Errorf("can't parse %d fields into %s",
+			len(obj), compound)
+	}
+	for idx, arg := range compound {
+		el, err := obj.field(idx, arg.Name)
+		if err != nil {
+			return nil, err
+		}
+		val, err := jsonValue(el, arg.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arg.Name, err)
+		}
+		result.Or(result, val.Lsh(val, uint(offset)))
+		offset += int(arg.Type.Bits)
+	}
+	return result, nil
+}
+
+func jsonValue(v interface{}, t types.Info) (*big.Int, error) {
+	switch t.Type {
+	case types.TStruct:
+		obj, ok := v.(jsonObject)
+		if !ok {
+			return nil, fmt.Errorf("can't parse %v into %s", v, t)
+		}
+		if len(obj) != len(t.Struct) {
+			return nil, fmt.Errorf("can't parse %d fields into %s",
+				len(obj), t)
+		}
+		result := new(big.Int)
+		var offset int
+		for idx, field := range t.Struct {
+			el, err := obj.field(idx, field.Name)
+			if err != nil {
+				return nil, err
+			}
+			val, err := jsonValue(el, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", field.Name, err)
+			}
+			result.Or(result, val.Lsh(val, uint(offset)))
+			offset += int(field.Type.Bits)
+		}
+		return result, nil
+
+	case types.TArray:
+		switch arr := v.(type) {
+		case string:
+			if !strings.HasPrefix(arr, "0x") {
+				return nil, fmt.Errorf("can't parse %q into %s", arr, t)
+			}
+			return circuit.IOArg{Type: t}.Parse([]string{arr})
+
+		case []interface{}:
+			if len(arr) != int(t.ArraySize) {
+				return nil, fmt.Errorf("can't parse %d elements into %s",
+					len(arr), t)
+			}
+			result := new(big.Int)
+			elBits := int(t.ElementType.Bits)
+			for i, el := range arr {
+				val, err := jsonValue(el, *t.ElementType)
+				if err != nil {
+					return nil, fmt.Errorf("[%d]: %v", i, err)
+				}
+				result.Or(result, val.Lsh(val, uint(i*elBits)))
+			}
+			return result, nil
+
+		default:
+			return nil, fmt.Errorf("can't parse %v into %s", v, t)
+		}
+
+	case types.TFloat, types.TFixed:
+		switch f := v.(type) {
+		case json.Number:
+			return circuit.IOArg{Type: t}.Parse([]string{f.String()})
+		case string:
+			return circuit.IOArg{Type: t}.Parse([]string{f})
+		default:
+			return nil, fmt.Errorf("can't parse %v into %s", v, t)
+		}
+	}
+
+	var val interface{}
+	switch v := v.(type) {
+	case bool:
+		val = v
+
+	case json.Number:
+		i, err := jsonInt(v)
+		if err != nil {
+			return nil, err
+		}
+		val = i
+
+	case string:
+		val = v
+		if t.Type == types.TInt || t.Type == types.TUint {
+			i, ok := new(big.Int).SetString(v, 0)
+			if !ok || !strings.HasPrefix(v, "0x") {
+				return nil, fmt.Errorf("invalid integer %q", v)
+			}
+			val = i
+		}
+
+	default:
+		return nil, fmt.Errorf("can't parse %v into %s", v, t)
+	}
+	return marshalValue(reflect.ValueOf(val), t)
+}
+
+// jsonResult converts the result value to a JSON value.
+func jsonResult(val *big.Int, t types.Info) interface{} {
+	switch t.Type {
+	case types.TBool:
+		return val.Bit(0) == 1
+
+	case types.TInt, types.TUint:
+		return json.Number(intResult(val, t).String())
+
+	case types.TFloat:
+		var f float64
+		if t.Bits == 32 {
+			f = float64(math.Float32frombits(uint32(val.Uint64())))
+		} else {
+			f = math.Float64frombits(val.Uint64())
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			// JSON numbers can't hold NaN and infinity values.
+			return fmt.Sprintf("%v", f)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, int(t.Bits)))
+
+	case types.TFixed:
+		return json.Number(fixedResult(val, t))
+
+	case types.TString:
+		var str []byte
+		for i := 0; i < int(t.Bits)/types.ByteBits; i++ {
+			str = append(str,
+				byte(extract(val, i*types.ByteBits, types.ByteBits).Uint64()))
+		}
+		for len(str) > 0 && str[len(str)-1] == 0 {
+			str = str[:len(str)-1]
+		}
+		return string(str)
+
+	case types.TArray:
+		result := []interface{}{}
+		elBits := int(t.ElementType.Bits)
+		for i := 0; i < int(t.ArraySize); i++ {
+			result = append(result,
+				jsonResult(extract(val, i*elBits, elBits), *t.ElementType))
+		}
+		return result
+
+	case types.TStruct:
+		if len(t.Struct) > 0 {
+			var result jsonObject
+			var offset int
+			for _, field := range t.Struct {
+				bits := int(field.Type.Bits)
+				result = append(result, jsonField{
+					Name:  field.Name,
+					Value: jsonResult(extract(val, offset, bits), field.Type),
+				})
+				offset += bits
+			}
+			return result
+		}
+	}
+	return json.Number(val.String())
+}
+
+func isIdentifier(name string) bool {
+	for idx, r := range name {
+		if r != '_' && !unicode.IsLetter(r) &&
+			(idx == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return len(name) > 0
+}
@@ -0,0 +1,311 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+const jsonShape = `{
+  "s": {
+    "visible": true,
+    "origin": {"x": -100, "y": 200},
+    "pts": [{"x": 1, "y": -1}, {"x": -32768, "y": 32767},
+            {"x": 0, "y": -7}],
+    "tag": "0x74616721"
+  }
+}`
+
+const jsonProgram = `
+package main
+
+func main(a uint, b []byte) (sum uint, first, last byte) {
+    sum = a + 1
+    first = b[0]
+    last = b[len(b)-1]
+    return
+}
+`
+
+func TestJSONInput(t *testing.T) {
+	circ, _, err := compiler.New(utils.NewParams()).Compile(marshalProgram,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := ParseJSONInput(strings.NewReader(jsonShape))
+	if err != nil {
+		t.Fatalf("ParseJSONInput: %v", err)
+	}
+	sizes, err := in.Sizes()
+	if err != nil {
+		t.Fatalf("Sizes: %v", err)
+	}
+	expectedSizes := []int{1, 7, 8, 36, 32}
+	if !reflect.DeepEqual(sizes, expectedSizes) {
+		t.Errorf("Sizes: got %v, expected %v", sizes, expectedSizes)
+	}
+	value, err := in.Parse(circ.Inputs[0])
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	expected, err := Marshal(shape{
+		Visible: true,
+		Origin:  point{X: -100, Y: 200},
+		Pts:     [3]point{{1, -1}, {-32768, 32767}, {0, -7}},
+		Tag:     []byte("tag!"),
+	}, circ.Inputs[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if value.Cmp(expected) != 0 {
+		t.Errorf("Parse: got %x, expected %x", value, expected)
+	}
+
+	// Parsed circuits have flat compound arguments.
+	arg := circ.Inputs[0]
+	arg.Type.Struct = nil
+	if _, err = in.Parse(arg); err == nil {
+		t.Errorf("Parse accepted nested values for flat compound")
+	}
+	flat, err := ParseJSONInput(strings.NewReader(`{"s": {
+  "visible": true, "x": -100, "y": 200,
+  "pts": [{"x": 1, "y": -1}, {"x": -32768, "y": 32767}, {"x": 0, "y": -7}],
+  "tag": "0x74616721"}}`))
+	if err != nil {
+		t.Fatalf("ParseJSONInput: %v", err)
+	}
+	value, err = flat.Parse(arg)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if value.Cmp(expected) != 0 {
+		t.Errorf("Parse: got %x, expected %x", value, expected)
+	}
+
+	in, err = ParseJSONInput(strings.NewReader(`{"d": [-5, -128, 127, 0]}`))
+	if err != nil {
+		t.Fatalf("ParseJSONInput: %v", err)
+	}
+	value, err = in.Parse(circ.Inputs[1])
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	expected, err = Marshal([]int8{-5, -128, 127, 0}, circ.Inputs[1])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if value.Cmp(expected) != 0 {
+		t.Errorf("Parse: got %x, expected %x", value, expected)
+	}
+}
+
+func TestJSONInputErrors(t *testing.T) {
+	circ, _, err := compiler.New(utils.NewParams()).Compile(marshalProgram,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{
+		`[1, 2]`,
+		`{"d": [1, 2, 3, 4]} {}`,
+		`{"d": [1, 2, 3, 4], "d": [1, 2, 3, 4]}`,
+	} {
+		_, err := ParseJSONInput(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("ParseJSONInput accepted %s", input)
+		}
+	}
+	for _, input := range []string{
+		`{"a": [1, 2, 3, 4]}`,
+		`{"d": [1, 2, 3]}`,
+		`{"d": [1, 2, 3, 128]}`,
+		`{"d": [1, 2, 3, 4.5]}`,
+		`{"d": [1, 2, 3, true]}`,
+		`{"d": "hello"}`,
+		`{"d": [1, 2, 3, 4], "s": {}}`,
+	} {
+		in, err := ParseJSONInput(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ParseJSONInput: %v", err)
+		}
+		_, err = in.Parse(circ.Inputs[1])
+		if err == nil {
+			t.Errorf("Parse accepted %s", input)
+		}
+	}
+}
+
+// The input sizes are in the document order so reordered struct
+// fields would instantiate the fields with wrong sizes.
+func TestJSONInputFieldOrder(t *testing.T) {
+	circ, _, err := compiler.New(utils.NewParams()).Compile(marshalProgram,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{
+		`{"s": {
+  "origin": {"x": -100, "y": 200},
+  "visible": true,
+  "pts": [{"x": 1, "y": -1}, {"x": -32768, "y": 32767}, {"x": 0, "y": -7}],
+  "tag": "0x74616721"}}`,
+		`{"s": {
+  "visible": true,
+  "origin": {"y": 200, "x": -100},
+  "pts": [{"x": 1, "y": -1}, {"x": -32768, "y": 32767}, {"x": 0, "y": -7}],
+  "tag": "0x74616721"}}`,
+		`{"s": {
+  "visible": true,
+  "origin": {"x": -100, "y": 200},
+  "pts": [{"x": 1, "y": -1}, {"y": 32767, "x": -32768}, {"x": 0, "y": -7}],
+  "tag": "0x74616721"}}`,
+	} {
+		in, err := ParseJSONInput(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ParseJSONInput: %v", err)
+		}
+		_, err = in.Parse(circ.Inputs[0])
+		if err == nil {
+			t.Errorf("Parse accepted reordered fields %s", input)
+		}
+	}
+
+	arg := circ.Inputs[0]
+	arg.Type.Struct = nil
+	in, err := ParseJSONInput(strings.NewReader(`{"s": {
+  "visible": true, "y": 200, "x": -100,
+  "pts": [{"x": 1, "y": -1}, {"x": -32768, "y": 32767}, {"x": 0, "y": -7}],
+  "tag": "0x74616721"}}`))
+	if err != nil {
+		t.Fatalf("ParseJSONInput: %v", err)
+	}
+	if _, err = in.Parse(arg); err == nil {
+		t.Errorf("Parse accepted reordered compound values")
+	}
+}
+
+func TestResultsJSON(t *testing.T) {
+	a, err := ParseJSONInput(strings.NewReader(`{"a": 41}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseJSONInput(strings.NewReader(`{"b": [1, 2, 255]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aSizes, err := a.Sizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSizes, err := b.Sizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	circ, _, err := compiler.New(utils.NewParams()).Compile(jsonProgram,
+		[][]int{aSizes, bSizes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	av, err := a.Parse(circ.Inputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := b.Parse(circ.Inputs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := circ.Compute([]*big.Int{av, bv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ResultsJSON(results, circ.Outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	expected := map[string]interface{}{
+		"sum":   float64(42),
+		"first": float64(1),
+		"last":  float64(255),
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %s, expected %v", data, expected)
+	}
+
+	// Structs, arrays, strings, and unnamed results.
+	circ, _, err = compiler.New(utils.NewParams()).Compile(marshalProgram,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := Marshal(shape{
+		Origin: point{X: 1, Y: 2},
+		Tag:    []byte("abcd"),
+	}, circ.Inputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dv, err := Marshal([]int8{5, 6, 7, 8}, circ.Inputs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = []*big.Int{sv, dv, big.NewInt(0x6968)}
+	data, err = ResultsJSON(results, circ.Outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON := `{
+  "result0": {
+    "visible": false,
+    "origin": {
+      "x": 1,
+      "y": 2
+    },
+    "pts": [
+      {
+        "x": 0,
+        "y": 0
+      },
+      {
+        "x": 0,
+        "y": 0
+      },
+      {
+        "x": 0,
+        "y": 0
+      }
+    ],
+    "tag": [
+      97,
+      98,
+      99,
+      100
+    ]
+  },
+  "result1": [
+    5,
+    6,
+    7,
+    8
+  ],
+  "result2": "hi"
+}`
+	if string(data) != expectedJSON {
+		t.Errorf("got %s, expected %s", data, expectedJSON)
+	}
+}
@@ -0,0 +1,493 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/types"
+)
+
+var (
+	bigIntType    = reflect.TypeOf(big.Int{})
+	bigIntPtrType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// Marshal encodes the Go value into the circuit value of the
+// argument. The Go value must match the argument type:
+//
+//   - bool for bool
+//   - signed and unsigned integers, and *big.Int for int and uint;
+//     *big.Int requires a sized int or uint argument type
+//   - float32 and float64 for float32 and float64
+//   - float32, float64, and decimal strings for fixed-point types
+//   - string for string
+//   - arrays and slices, including []byte, for arrays
+//   - structs for structs; the struct's exported fields are matched
+//     with the MPCL struct fields in their declaration order
+//
+// If the argument is a compound argument, the Go value can also be a
+// slice or an array holding the values of the compound arguments.
+func Marshal(v interface{}, arg circuit.IOArg) (*big.Int, error) {
+	value := reflect.ValueOf(v)
+	if len(arg.Compound) > 0 {
+		return marshalCompound(value, arg.Compound)
+	}
+	return marshalValue(value, arg.Type)
+}
+
+// Unmarshal decodes the circuit value of the argument into the Go
+// value pointed by ptr. The Go value must match the argument type as
+// in Marshal. If the pointed value is an empty interface, Unmarshal
+// stores the value returned by Result into it.
+func Unmarshal(val *big.Int, arg circuit.IOArg, ptr interface{}) error {
+	value := reflect.ValueOf(ptr)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return fmt.Errorf("non-pointer or nil %T", ptr)
+	}
+	if len(arg.Compound) > 0 {
+		return unmarshalCompound(val, arg.Compound, value.Elem())
+	}
+	return unmarshalValue(val, arg.Type, value.Elem())
+}
+
+func marshalCompound(v reflect.Value, compound circuit.IO) (
+	*big.Int, error) {
+
+	v = indirect(v)
+
+	var leaves []reflect.Value
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			leaves = append(leaves, v.Index(i))
+		}
+	case reflect.Struct:
+		leaves = flattenValue(v, nil)
+	default:
+		return nil, fmt.Errorf("can't marshal %s into %s", v.Type(), compound)
+	}
+	if len(leaves) != len(compound) {
+		return nil, fmt.Errorf("can't marshal %s into %s: got %d values, "+
+			"expected %d", v.Type(), compound, len(leaves), len(compound))
+	}
+
+	result := new(big.Int)
+	var offset int
+	for idx, arg := range compound {
+		val, err := marshalValue(leaves[idx], arg.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arg.Name, err)
+		}
+		val.Lsh(val, uint(offset))
+		result.Or(result, val)
+		offset += int(arg.Type.Bits)
+	}
+	return result, nil
+}
+
+func marshalValue(v reflect.Value, t types.Info) (*big.Int, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("can't marshal nil into %s", t)
+	}
+	result := new(big.Int)
+
+	switch t.Type {
+	case types.TBool:
+		if v.Kind() != reflect.Bool {
+			return nil, marshalError(v, t)
+		}
+		if v.Bool() {
+			result.SetInt64(1)
+		}
+
+	case types.TInt, types.TUint:
+		val, ok := intValue(v)
+		if !ok {
+			return nil, marshalError(v, t)
+		}
+		if t.Bits == 0 {
+			return nil, fmt.Errorf("can't marshal %s into unsized %s",
+				v.Type(), t)
+		}
+		bits := uint(t.Bits)
+		if t.Type == types.TUint {
+			if val.Sign() < 0 || val.BitLen() > int(bits) {
+				return nil, fmt.Errorf("value %v overflows %s", val, t)
+			}
+			return val, nil
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		if val.Cmp(limit) >= 0 || val.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, fmt.Errorf("value %v overflows %s", val, t)
+		}
+		if val.Sign() < 0 {
+			val.Add(val, limit.Lsh(limit, 1))
+		}
+		return val, nil
+
+	case types.TFloat:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return nil, marshalError(v, t)
+		}
+		switch t.Bits {
+		case 32:
+			result.SetUint64(uint64(math.Float32bits(float32(v.Float()))))
+		case 64:
+			result.SetUint64(math.Float64bits(v.Float()))
+		default:
+			return nil, marshalError(v, t)
+		}
+
+	case types.TFixed:
+		var str string
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			str = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+		case reflect.String:
+			str = v.String()
+		default:
+			return nil, marshalError(v, t)
+		}
+		return circuit.IOArg{Type: t}.Parse([]string{str})
+
+	case types.TString:
+		if v.Kind() != reflect.String {
+			return nil, marshalError(v, t)
+		}
+		str := v.String()
+		if len(str)*types.ByteBits > int(t.Bits) {
+			return nil, fmt.Errorf("string %q overflows %s", str, t)
+		}
+		for i := 0; i < len(str); i++ {
+			b := new(big.Int).SetInt64(int64(str[i]))
+			result.Or(result, b.Lsh(b, uint(i*types.ByteBits)))
+		}
+
+	case types.TArray:
+		if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+			return nil, marshalError(v, t)
+		}
+		if v.Len() != int(t.ArraySize) {
+			return nil, fmt.Errorf("can't marshal %d elements into %s",
+				v.Len(), t)
+		}
+		elBits := int(t.ElementType.Bits)
+		for i := 0; i < v.Len(); i++ {
+			el, err := marshalValue(v.Index(i), *t.ElementType)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			result.Or(result, el.Lsh(el, uint(i*elBits)))
+		}
+
+	case types.TStruct:
+		if v.Kind() != reflect.Struct {
+			return nil, marshalError(v, t)
+		}
+		fields := exportedFields(v.Type())
+		if len(fields) != len(t.Struct) {
+			return nil, fmt.Errorf("can't marshal %s into %s: got %d fields, "+
+				"expected %d", v.Type(), t, len(fields), len(t.Struct))
+		}
+		var offset int
+		for idx, field := range t.Struct {
+			val, err := marshalValue(v.Field(fields[idx]), field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", field.Name, err)
+			}
+			result.Or(result, val.Lsh(val, uint(offset)))
+			offset += int(field.Type.Bits)
+		}
+
+	default:
+		return nil, fmt.Errorf("can't marshal into unsupported type %s", t)
+	}
+
+	return result, nil
+}
+
+func unmarshalCompound(val *big.Int, compound circuit.IO,
+	v reflect.Value) error {
+
+	var leaves []reflect.Value
+
+	v = allocate(v)
+	switch v.Kind() {
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			leaves = append(leaves, v.Index(i))
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), len(compound), len(compound)))
+		for i := 0; i < v.Len(); i++ {
+			leaves = append(leaves, v.Index(i))
+		}
+	case reflect.Struct:
+		leaves = flattenValue(v, nil)
+	default:
+		return fmt.Errorf("can't unmarshal %s into %s", compound, v.Type())
+	}
+	if len(leaves) != len(compound) {
+		return fmt.Errorf("can't unmarshal %s into %s: got %d values, "+
+			"expected %d", compound, v.Type(), len(compound), len(leaves))
+	}
+
+	var offset int
+	for idx, arg := range compound {
+		bits := int(arg.Type.Bits)
+		err := unmarshalValue(extract(val, offset, bits), arg.Type,
+			leaves[idx])
+		if err != nil {
+			return fmt.Errorf("%s: %v", arg.Name, err)
+		}
+		offset += bits
+	}
+	return nil
+}
+
+func unmarshalValue(val *big.Int, t types.Info, v reflect.Value) error {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(Result(new(big.Int).Set(val), circuit.IOArg{
+			Type: t,
+		})))
+		return nil
+	}
+	if v.Type() == bigIntPtrType {
+		if t.Type != types.TInt && t.Type != types.TUint {
+			return unmarshalError(v, t)
+		}
+		v.Set(reflect.ValueOf(intResult(val, t)))
+		return nil
+	}
+	v = allocate(v)
+
+	switch t.Type {
+	case types.TBool:
+		if v.Kind() != reflect.Bool {
+			return unmarshalError(v, t)
+		}
+		v.SetBool(val.Bit(0) == 1)
+
+	case types.TInt, types.TUint:
+		x := intResult(val, t)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+			reflect.Int64:
+			if !x.IsInt64() || v.OverflowInt(x.Int64()) {
+				return fmt.Errorf("value %v overflows %s", x, v.Type())
+			}
+			v.SetInt(x.Int64())
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+			reflect.Uint64, reflect.Uintptr:
+			if !x.IsUint64() || v.OverflowUint(x.Uint64()) {
+				return fmt.Errorf("value %v overflows %s", x, v.Type())
+			}
+			v.SetUint(x.Uint64())
+
+		default:
+			if v.Type() != bigIntType || !v.CanAddr() {
+				return unmarshalError(v, t)
+			}
+			v.Addr().Interface().(*big.Int).Set(x)
+		}
+
+	case types.TFloat:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return unmarshalError(v, t)
+		}
+		switch t.Bits {
+		case 32:
+			v.SetFloat(float64(math.Float32frombits(uint32(val.Uint64()))))
+		case 64:
+			v.SetFloat(math.Float64frombits(val.Uint64()))
+		default:
+			return unmarshalError(v, t)
+		}
+
+	case types.TFixed:
+		str := fixedResult(val, t)
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(str, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetFloat(f)
+		case reflect.String:
+			v.SetString(str)
+		default:
+			return unmarshalError(v, t)
+		}
+
+	case types.TString:
+		if v.Kind() != reflect.String {
+			return unmarshalError(v, t)
+		}
+		var str []byte
+		for i := 0; i < int(t.Bits)/types.ByteBits; i++ {
+			str = append(str,
+				byte(extract(val, i*types.ByteBits, types.ByteBits).Uint64()))
+		}
+		for len(str) > 0 && str[len(str)-1] == 0 {
+			str = str[:len(str)-1]
+		}
+		v.SetString(string(str))
+
+	case types.TArray:
+		count := int(t.ArraySize)
+		switch v.Kind() {
+		case reflect.Array:
+			if v.Len() != count {
+				return fmt.Errorf("can't unmarshal %s into %s", t, v.Type())
+			}
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), count, count))
+		default:
+			return unmarshalError(v, t)
+		}
+		elBits := int(t.ElementType.Bits)
+		for i := 0; i < count; i++ {
+			err := unmarshalValue(extract(val, i*elBits, elBits),
+				*t.ElementType, v.Index(i))
+			if err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+
+	case types.TStruct:
+		if v.Kind() != reflect.Struct {
+			return unmarshalError(v, t)
+		}
+		fields := exportedFields(v.Type())
+		if len(fields) != len(t.Struct) {
+			return fmt.Errorf("can't unmarshal %s into %s: got %d fields, "+
+				"expected %d", t, v.Type(), len(t.Struct), len(fields))
+		}
+		var offset int
+		for idx, field := range t.Struct {
+			bits := int(field.Type.Bits)
+			err := unmarshalValue(extract(val, offset, bits), field.Type,
+				v.Field(fields[idx]))
+			if err != nil {
+				return fmt.Errorf("%s: %v", field.Name, err)
+			}
+			offset += bits
+		}
+
+	default:
+		return fmt.Errorf("can't unmarshal unsupported type %s", t)
+	}
+
+	return nil
+}
+
+// indirect follows pointers and interfaces to the underlying value.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer ||
+		v.Kind() == reflect.Interface) {
+		if v.Type() == bigIntPtrType || v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// allocate follows pointers to the underlying value, allocating nil
+// pointers.
+func allocate(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer && v.Type() != bigIntPtrType {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// flattenValue flattens the struct value into its leaf fields. Nested
+// structs are flattened like ast.flattenStruct flattens MPCL structs.
+func flattenValue(v reflect.Value, result []reflect.Value) []reflect.Value {
+	for _, idx := range exportedFields(v.Type()) {
+		f := v.Field(idx)
+		if f.Kind() == reflect.Struct && f.Type() != bigIntType {
+			result = flattenValue(f, result)
+		} else {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func exportedFields(t reflect.Type) []int {
+	var result []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func intValue(v reflect.Value) (*big.Int, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return big.NewInt(v.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(v.Uint()), true
+
+	case reflect.Pointer:
+		if v.Type() == bigIntPtrType && !v.IsNil() {
+			return new(big.Int).Set(v.Interface().(*big.Int)), true
+		}
+
+	case reflect.Struct:
+		if v.Type() == bigIntType && v.CanAddr() {
+			return new(big.Int).Set(v.Addr().Interface().(*big.Int)), true
+		}
+	}
+	return nil, false
+}
+
+// intResult returns the integer value of the circuit value. Signed
+// values are sign-extended.
+func intResult(val *big.Int, t types.Info) *big.Int {
+	bits := int(t.Bits)
+	x := extract(val, 0, bits)
+	signed := t.Type == types.TInt || t.Type == types.TFixed
+	if signed && bits > 0 && x.Bit(bits-1) == 1 {
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	}
+	return x
+}
+
+// extract returns bits [offset:offset+bits] of the value.
+func extract(val *big.Int, offset, bits int) *big.Int {
+	result := new(big.Int).Rsh(val, uint(offset))
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	mask.Sub(mask, big.NewInt(1))
+	return result.And(result, mask)
+}
+
+func marshalError(v reflect.Value, t types.Info) error {
+	return fmt.Errorf("can't marshal %s into %s", v.Type(), t)
+}
+
+func unmarshalError(v reflect.Value, t types.Info) error {
+	return fmt.Errorf("can't unmarshal %s into %s", t, v.Type())
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/types"
+)
+
+const marshalProgram = `
+package main
+
+type Point struct {
+	x int16
+	y int16
+}
+
+type Shape struct {
+	visible bool
+	origin  Point
+	pts     [3]Point
+	tag     [4]byte
+}
+
+func main(s Shape, d [4]int8) (Shape, [4]int8, string) {
+	o := s.origin
+	o.x = o.x + int16(d[0])
+	s.origin = o
+	d[1] = -d[1]
+	return s, d, "hi"
+}
+`
+
+type point struct {
+	X int16
+	Y int16
+}
+
+type shape struct {
+	Visible bool
+	Origin  point
+	Pts     [3]point
+	Tag     []byte
+	private int
+}
+
+func TestMarshal(t *testing.T) {
+	circ, _, err := compiler.New(utils.NewParams()).Compile(marshalProgram,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := shape{
+		Visible: true,
+		Origin:  point{X: -100, Y: 200},
+		Pts:     [3]point{{1, -1}, {-32768, 32767}, {0, -7}},
+		Tag:     []byte("tag!"),
+	}
+	d := []int8{-5, -128, 127, 0}
+
+	// Round trip.
+	sv, err := Marshal(s, circ.Inputs[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var s2 shape
+	if err := Unmarshal(sv, circ.Inputs[0], &s2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(s, s2) {
+		t.Errorf("round trip: got %v, expected %v", s2, s)
+	}
+	dv, err := Marshal(d, circ.Inputs[1])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var d2 []int8
+	if err := Unmarshal(dv, circ.Inputs[1], &d2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Errorf("round trip: got %v, expected %v", d2, d)
+	}
+
+	// Compound argument from flattened values.
+	cv, err := Marshal([]interface{}{
+		true, int16(-100), int16(200), s.Pts, s.Tag,
+	}, circ.Inputs[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if cv.Cmp(sv) != 0 {
+		t.Errorf("compound: got %x, expected %x", cv, sv)
+	}
+
+	// Compute.
+	var inputs []*big.Int
+	var offset int
+	for _, arg := range circ.Inputs[0].Compound {
+		inputs = append(inputs, extract(sv, offset, int(arg.Type.Bits)))
+		offset += int(arg.Type.Bits)
+	}
+	results, err := circ.Compute(append(inputs, dv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs *shape
+	var rd [4]int8
+	var str interface{}
+	for idx, ptr := range []interface{}{&rs, &rd, &str} {
+		if err := Unmarshal(results[idx], circ.Outputs[idx], ptr); err != nil {
+			t.Fatalf("Unmarshal result %d: %v", idx, err)
+		}
+	}
+	s.Origin.X += int16(d[0])
+	if !reflect.DeepEqual(*rs, s) {
+		t.Errorf("result 0: got %v, expected %v", *rs, s)
+	}
+	if rd != [4]int8{-5, -128, 127, 0} {
+		t.Errorf("result 1: got %v", rd)
+	}
+	if str != "hi" {
+		t.Errorf("result 2: got %v", str)
+	}
+}
+
+var marshalErrorTests = []struct {
+	value interface{}
+	typ   types.Info
+}{
+	{int64(128), types.Info{Type: types.TInt, Bits: 8}},
+	{int64(-129), types.Info{Type: types.TInt, Bits: 8}},
+	{int64(-1), types.Info{Type: types.TUint, Bits: 8}},
+	{uint16(256), types.Info{Type: types.TUint, Bits: 8}},
+	{"abc", types.Info{Type: types.TString, Bits: 16}},
+	{true, types.Info{Type: types.TUint, Bits: 8}},
+	{[]byte{1, 2}, types.Info{
+		Type:        types.TArray,
+		Bits:        24,
+		ArraySize:   3,
+		ElementType: &types.Byte,
+	}},
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for idx, test := range marshalErrorTests {
+		_, err := Marshal(test.value, circuit.IOArg{Type: test.typ})
+		if err == nil {
+			t.Errorf("t%d: Marshal(%v, %s) succeeded", idx, test.value,
+				test.typ)
+		}
+	}
+
+	var i8 int8
+	err := Unmarshal(big.NewInt(0x7fff), circuit.IOArg{
+		Type: types.Info{Type: types.TInt, Bits: 16},
+	}, &i8)
+	if err == nil {
+		t.Errorf("Unmarshal overflow succeeded: %v", i8)
+	}
+	if err := Unmarshal(big.NewInt(0), circuit.IOArg{}, i8); err == nil {
+		t.Errorf("Unmarshal into non-pointer succeeded")
+	}
+}
+
+func TestMarshalBig(t *testing.T) {
+	arg := circuit.IOArg{
+		Type: types.Info{Type: types.TInt, Bits: 128},
+	}
+	val, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	v, err := Marshal(val, arg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result *big.Int
+	if err := Unmarshal(v, arg, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Cmp(val) != 0 {
+		t.Errorf("got %v, expected %v", result, val)
+	}
+}
+
+func TestMarshalFloat(t *testing.T) {
+	for _, arg := range []circuit.IOArg{
+		{Type: types.Float32},
+		{Type: types.Float64},
+	} {
+		v, err := Marshal(-2.75, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f32 float32
+		if err := Unmarshal(v, arg, &f32); err != nil {
+			t.Fatal(err)
+		}
+		var f64 float64
+		if err := Unmarshal(v, arg, &f64); err != nil {
+			t.Fatal(err)
+		}
+		if f32 != -2.75 || f64 != -2.75 {
+			t.Errorf("%s: got %v and %v, expected -2.75", arg.Type, f32, f64)
+		}
+	}
+	_, err := Marshal(int32(1), circuit.IOArg{Type: types.Float32})
+	if err == nil {
+		t.Errorf("Marshal(int32, float32) succeeded")
+	}
+}
+
+func TestMarshalFixed(t *testing.T) {
+	arg := circuit.IOArg{
+		Type: types.Info{
+			Type:       types.TFixed,
+			IsConcrete: true,
+			Bits:       32,
+			Frac:       8,
+		},
+	}
+	for _, v := range []interface{}{-2.75, "-2.75", float32(-2.75)} {
+		val, err := Marshal(v, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f float64
+		if err := Unmarshal(val, arg, &f); err != nil {
+			t.Fatal(err)
+		}
+		var str string
+		if err := Unmarshal(val, arg, &str); err != nil {
+			t.Fatal(err)
+		}
+		if f != -2.75 || str != "-2.75" {
+			t.Errorf("%v: got %v and %v, expected -2.75", v, f, str)
+		}
+		if r := Result(val, arg); r != "-2.75" {
+			t.Errorf("%v: Result=%v, expected -2.75", v, r)
+		}
+	}
+	_, err := Marshal(int32(1), arg)
+	if err == nil {
+		t.Errorf("Marshal(int32, fixed32.8) succeeded")
+	}
+}
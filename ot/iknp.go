@@ -0,0 +1,338 @@
+//
+// iknp.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+// IKNP OT extension - Extending Oblivious Transfers Efficiently.
+//  - https://www.iacr.org/archive/crypto2003/27290145/27290145.pdf
+
+package ot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+const (
+	// IKNPK defines the number of base OTs the IKNP extension runs
+	// i.e. the computational security parameter of the extension.
+	IKNPK = 128
+
+	// iknpBatchSize defines how many transfers are extended in one
+	// protocol round. The batch size bounds the size of the data
+	// messages exchanged in the protocol.
+	iknpBatchSize = 1024
+)
+
+var (
+	_ OT = &IKNP{}
+)
+
+// IKNP implements the IKNP OT extension as the OT interface. The
+// extension runs IKNPK base OTs with the base OT protocol and then
+// extends them to an arbitrary number of transfers with an AES-CTR
+// PRG and SHA-256 as the correlation robust hash function.
+type IKNP struct {
+	base   OT
+	io     IO
+	s      Label
+	prg0   [IKNPK]cipher.Stream
+	prg1   [IKNPK]cipher.Stream
+	hash   hash.Hash
+	digest []byte
+	id     uint64
+}
+
+// NewIKNP creates a new IKNP OT extension that uses the argument OT
+// for its base OTs.
+func NewIKNP(base OT) *IKNP {
+	return &IKNP{
+		base:   base,
+		hash:   sha256.New(),
+		digest: make([]byte, sha256.Size),
+	}
+}
+
+// InitSender initializes the OT sender. The extension sender acts as
+// the receiver of the base OTs.
+func (iknp *IKNP) InitSender(io IO) error {
+	iknp.io = io
+
+	s, err := NewLabel(rand.Reader)
+	if err != nil {
+		return err
+	}
+	iknp.s = s
+
+	flags := make([]bool, IKNPK)
+	for i := 0; i < IKNPK; i++ {
+		flags[i] = labelBit(s, i) == 1
+	}
+	seeds := make([]Label, IKNPK)
+
+	// The base OT roles are reversed so make sure any pending data
+	// is flushed to the peer before we start waiting for it.
+	if err := io.Flush(); err != nil {
+		return err
+	}
+	if err := iknp.base.InitReceiver(io); err != nil {
+		return err
+	}
+	if err := iknp.base.Receive(flags, seeds); err != nil {
+		return err
+	}
+	for i := 0; i < IKNPK; i++ {
+		iknp.prg0[i], err = newPRG(seeds[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitReceiver initializes the OT receiver. The extension receiver
+// acts as the sender of the base OTs.
+func (iknp *IKNP) InitReceiver(io IO) error {
+	iknp.io = io
+
+	seeds := make([]Wire, IKNPK)
+	for i := 0; i < IKNPK; i++ {
+		l0, err := NewLabel(rand.Reader)
+		if err != nil {
+			return err
+		}
+		l1, err := NewLabel(rand.Reader)
+		if err != nil {
+			return err
+		}
+		seeds[i] = Wire{
+			L0: l0,
+			L1: l1,
+		}
+		iknp.prg0[i], err = newPRG(l0)
+		if err != nil {
+			return err
+		}
+		iknp.prg1[i], err = newPRG(l1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := iknp.base.InitSender(io); err != nil {
+		return err
+	}
+	return iknp.base.Send(seeds)
+}
+
+// Send sends the wire labels with OT.
+func (iknp *IKNP) Send(wires []Wire) error {
+	var cols [IKNPK][]byte
+	rows := make([]Label, iknpBatchSize)
+	data := make([]byte, iknpBatchSize*2*len(LabelData{}))
+	var labelData LabelData
+
+	for start := 0; start < len(wires); start += iknpBatchSize {
+		end := start + iknpBatchSize
+		if end > len(wires) {
+			end = len(wires)
+		}
+		n := end - start
+		nb := (n + 7) / 8
+
+		// Receive the receiver's matrix U and compute our matrix Q
+		// column by column: q^i = G(k^{s_i}) ^ s_i*u^i.
+		for i := 0; i < IKNPK; i++ {
+			u, err := iknp.io.ReceiveData()
+			if err != nil {
+				return err
+			}
+			if len(u) != nb {
+				return fmt.Errorf("iknp: invalid column %d length %d, "+
+					"expected %d", i, len(u), nb)
+			}
+			col := prgBytes(iknp.prg0[i], cols[i], nb)
+			if labelBit(iknp.s, i) == 1 {
+				xor(col, u)
+			}
+			cols[i] = col
+		}
+
+		transpose(cols[:], rows[:n])
+
+		for j := 0; j < n; j++ {
+			q := rows[j]
+			h := iknp.h(iknp.id+uint64(j), q)
+			wires[start+j].L0.GetData(&labelData)
+			copy(data[j*32:], xor(h, labelData[:]))
+
+			q.Xor(iknp.s)
+			h = iknp.h(iknp.id+uint64(j), q)
+			wires[start+j].L1.GetData(&labelData)
+			copy(data[j*32+16:], xor(h, labelData[:]))
+		}
+		iknp.id += uint64(n)
+
+		if err := iknp.io.SendData(data[:n*32]); err != nil {
+			return err
+		}
+		if err := iknp.io.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive receives the wire labels with OT based on the flag values.
+func (iknp *IKNP) Receive(flags []bool, result []Label) error {
+	var cols [IKNPK][]byte
+	rows := make([]Label, iknpBatchSize)
+	r := make([]byte, iknpBatchSize/8)
+	u := make([]byte, iknpBatchSize/8)
+
+	for start := 0; start < len(flags); start += iknpBatchSize {
+		end := start + iknpBatchSize
+		if end > len(flags) {
+			end = len(flags)
+		}
+		n := end - start
+		nb := (n + 7) / 8
+
+		packBits(flags[start:end], r[:nb])
+
+		// Compute our matrix T column by column and send the matrix
+		// U to the sender: u^i = t^i ^ G(k_i^1) ^ r.
+		for i := 0; i < IKNPK; i++ {
+			col := prgBytes(iknp.prg0[i], cols[i], nb)
+			cols[i] = col
+
+			prgBytes(iknp.prg1[i], u, nb)
+			xor(u[:nb], col)
+			xor(u[:nb], r[:nb])
+			if err := iknp.io.SendData(u[:nb]); err != nil {
+				return err
+			}
+		}
+		if err := iknp.io.Flush(); err != nil {
+			return err
+		}
+
+		transpose(cols[:], rows[:n])
+
+		data, err := iknp.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if len(data) != n*32 {
+			return fmt.Errorf("iknp: invalid data length %d, expected %d",
+				len(data), n*32)
+		}
+		for j := 0; j < n; j++ {
+			h := iknp.h(iknp.id+uint64(j), rows[j])
+			var y []byte
+			if flags[start+j] {
+				y = data[j*32+16 : j*32+32]
+			} else {
+				y = data[j*32 : j*32+16]
+			}
+			result[start+j].SetBytes(xor(h, y))
+		}
+		iknp.id += uint64(n)
+	}
+	return nil
+}
+
+// h implements the correlation robust hash function H(j, q).
+func (iknp *IKNP) h(id uint64, q Label) []byte {
+	var labelData LabelData
+	var tmp [8]byte
+
+	iknp.hash.Reset()
+	bo.PutUint64(tmp[:], id)
+	iknp.hash.Write(tmp[:])
+	iknp.hash.Write(q.Bytes(&labelData))
+
+	return iknp.hash.Sum(iknp.digest[:0])[:16]
+}
+
+// newPRG creates a new AES-CTR pseudo-random generator from the seed
+// label.
+func newPRG(seed Label) (cipher.Stream, error) {
+	var key LabelData
+	seed.GetData(&key)
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	var iv [aes.BlockSize]byte
+	return cipher.NewCTR(block, iv[:]), nil
+}
+
+// prgBytes generates n bytes from the PRG. The function uses buf for
+// the result if it has enough capacity.
+func prgBytes(prg cipher.Stream, buf []byte, n int) []byte {
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	for i := range buf {
+		buf[i] = 0
+	}
+	prg.XORKeyStream(buf, buf)
+	return buf
+}
+
+// labelBit returns the bit i of the label. The bits 0-63 are stored
+// in D1 and bits 64-127 in D0.
+func labelBit(l Label, i int) uint {
+	if i < 64 {
+		return uint(l.D1>>i) & 1
+	}
+	return uint(l.D0>>(i-64)) & 1
+}
+
+// packBits packs the boolean flags into the byte array so that flag j
+// is stored in the bit j%8 of the byte j/8.
+func packBits(flags []bool, buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	for j, f := range flags {
+		if f {
+			buf[j/8] |= 1 << (j % 8)
+		}
+	}
+}
+
+// transpose transposes the IKNPK column bit vectors into row labels
+// so that the bit j of the column i is the bit i of the row j.
+func transpose(cols [][]byte, rows []Label) {
+	for j := range rows {
+		rows[j] = Label{}
+	}
+	for i := 0; i < IKNPK; i++ {
+		col := cols[i]
+		if i < 64 {
+			bit := uint64(1) << i
+			for j := range rows {
+				if col[j/8]&(1<<(j%8)) != 0 {
+					rows[j].D1 |= bit
+				}
+			}
+		} else {
+			bit := uint64(1) << (i - 64)
+			for j := range rows {
+				if col[j/8]&(1<<(j%8)) != 0 {
+					rows[j].D0 |= bit
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+//
+// kos.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+// KOS OT extension - Actively Secure OT Extension with Optimal Overhead.
+//  - https://eprint.iacr.org/2015/546.pdf
+
+package ot
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	// kosExtra defines the number of additional random transfers that
+	// are extended in each batch for the consistency check: the
+	// computational security parameter IKNPK plus the statistical
+	// security parameter 64.
+	kosExtra = IKNPK + 64
+)
+
+var (
+	_ OT = &KOS{}
+
+	// ErrConsistencyCheck is returned from the KOS Send and Receive
+	// when the OT extension consistency check fails, indicating that
+	// the receiver did not use consistent choice bits.
+	ErrConsistencyCheck = errors.New("ot: consistency check failed")
+)
+
+// KOS implements the KOS OT extension as the OT interface. The KOS
+// protocol extends the IKNP protocol with a correlation check that
+// makes the extension secure against a malicious receiver.
+type KOS struct {
+	IKNP
+}
+
+// NewKOS creates a new KOS OT extension that uses the argument OT for
+// its base OTs.
+func NewKOS(base OT) *KOS {
+	return &KOS{
+		IKNP: *NewIKNP(base),
+	}
+}
+
+// Send sends the wire labels with OT. The function returns
+// ErrConsistencyCheck if the receiver fails the consistency check.
+func (kos *KOS) Send(wires []Wire) error {
+	var cols [IKNPK][]byte
+	rows := make([]Label, iknpBatchSize+kosExtra)
+	chis := make([]Label, iknpBatchSize+kosExtra)
+	data := make([]byte, iknpBatchSize*2*len(LabelData{}))
+	var labelData LabelData
+
+	for start := 0; start < len(wires); start += iknpBatchSize {
+		end := start + iknpBatchSize
+		if end > len(wires) {
+			end = len(wires)
+		}
+		n := end - start
+		l := n + kosExtra
+		nb := (l + 7) / 8
+
+		// Receive the receiver's matrix U and compute our matrix Q.
+		for i := 0; i < IKNPK; i++ {
+			u, err := kos.io.ReceiveData()
+			if err != nil {
+				return err
+			}
+			if len(u) != nb {
+				return fmt.Errorf("kos: invalid column %d length %d, "+
+					"expected %d", i, len(u), nb)
+			}
+			col := prgBytes(kos.prg0[i], cols[i], nb)
+			if labelBit(kos.s, i) == 1 {
+				xor(col, u)
+			}
+			cols[i] = col
+		}
+		transpose(cols[:], rows[:l])
+
+		// Send the random challenge.
+		seed, err := NewLabel(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := kos.io.SendData(seed.Bytes(&labelData)); err != nil {
+			return err
+		}
+		if err := kos.io.Flush(); err != nil {
+			return err
+		}
+		if err := kosChallenge(seed, chis[:l]); err != nil {
+			return err
+		}
+
+		// Receive the receiver's response and verify that
+		// t = q ^ x*s.
+		resp, err := kos.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if len(resp) != 32 {
+			return fmt.Errorf("kos: invalid response length %d", len(resp))
+		}
+		var x, t Label
+		x.SetBytes(resp[0:16])
+		t.SetBytes(resp[16:32])
+
+		var q Label
+		for j := 0; j < l; j++ {
+			q.Xor(gfMul(chis[j], rows[j]))
+		}
+		q.Xor(gfMul(x, kos.s))
+		if !q.Equal(t) {
+			if err := kos.io.SendByte(0); err != nil {
+				return err
+			}
+			if err := kos.io.Flush(); err != nil {
+				return err
+			}
+			return ErrConsistencyCheck
+		}
+		if err := kos.io.SendByte(1); err != nil {
+			return err
+		}
+
+		for j := 0; j < n; j++ {
+			q := rows[j]
+			h := kos.h(kos.id+uint64(j), q)
+			wires[start+j].L0.GetData(&labelData)
+			copy(data[j*32:], xor(h, labelData[:]))
+
+			q.Xor(kos.s)
+			h = kos.h(kos.id+uint64(j), q)
+			wires[start+j].L1.GetData(&labelData)
+			copy(data[j*32+16:], xor(h, labelData[:]))
+		}
+		kos.id += uint64(n)
+
+		if err := kos.io.SendData(data[:n*32]); err != nil {
+			return err
+		}
+		if err := kos.io.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive receives the wire labels with OT based on the flag
+// values. The function returns ErrConsistencyCheck if the sender
+// reports a failed consistency check.
+func (kos *KOS) Receive(flags []bool, result []Label) error {
+	var cols [IKNPK][]byte
+	rows := make([]Label, iknpBatchSize+kosExtra)
+	chis := make([]Label, iknpBatchSize+kosExtra)
+	r := make([]byte, (iknpBatchSize+kosExtra)/8)
+	u := make([]byte, (iknpBatchSize+kosExtra)/8)
+	var labelData LabelData
+
+	for start := 0; start < len(flags); start += iknpBatchSize {
+		end := start + iknpBatchSize
+		if end > len(flags) {
+			end = len(flags)
+		}
+		n := end - start
+		l := n + kosExtra
+		nb := (l + 7) / 8
+
+		// Our choice bits followed by kosExtra random bits.
+		if _, err := rand.Read(r[:nb]); err != nil {
+			return err
+		}
+		for j := 0; j < n; j++ {
+			if flags[start+j] {
+				r[j/8] |= 1 << (j % 8)
+			} else {
+				r[j/8] &^= 1 << (j % 8)
+			}
+		}
+
+		// Compute our matrix T and send the matrix U to the sender.
+		for i := 0; i < IKNPK; i++ {
+			col := prgBytes(kos.prg0[i], cols[i], nb)
+			cols[i] = col
+
+			prgBytes(kos.prg1[i], u, nb)
+			xor(u[:nb], col)
+			xor(u[:nb], r[:nb])
+			if err := kos.io.SendData(u[:nb]); err != nil {
+				return err
+			}
+		}
+		if err := kos.io.Flush(); err != nil {
+			return err
+		}
+		transpose(cols[:], rows[:l])
+
+		// Receive challenge and compute our response.
+		data, err := kos.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if len(data) != 16 {
+			return fmt.Errorf("kos: invalid challenge length %d", len(data))
+		}
+		var seed Label
+		seed.SetBytes(data)
+		if err := kosChallenge(seed, chis[:l]); err != nil {
+			return err
+		}
+		var x, t Label
+		for j := 0; j < l; j++ {
+			if r[j/8]&(1<<(j%8)) != 0 {
+				x.Xor(chis[j])
+			}
+			t.Xor(gfMul(chis[j], rows[j]))
+		}
+		var resp [32]byte
+		copy(resp[0:16], x.Bytes(&labelData))
+		copy(resp[16:32], t.Bytes(&labelData))
+		if err := kos.io.SendData(resp[:]); err != nil {
+			return err
+		}
+		if err := kos.io.Flush(); err != nil {
+			return err
+		}
+
+		status, err := kos.io.ReceiveByte()
+		if err != nil {
+			return err
+		}
+		if status != 1 {
+			return ErrConsistencyCheck
+		}
+
+		data, err = kos.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if len(data) != n*32 {
+			return fmt.Errorf("kos: invalid data length %d, expected %d",
+				len(data), n*32)
+		}
+		for j := 0; j < n; j++ {
+			h := kos.h(kos.id+uint64(j), rows[j])
+			var y []byte
+			if flags[start+j] {
+				y = data[j*32+16 : j*32+32]
+			} else {
+				y = data[j*32 : j*32+16]
+			}
+			result[start+j].SetBytes(xor(h, y))
+		}
+		kos.id += uint64(n)
+	}
+	return nil
+}
+
+// kosChallenge expands the challenge seed into the challenge values
+// chis.
+func kosChallenge(seed Label, chis []Label) error {
+	prg, err := newPRG(seed)
+	if err != nil {
+		return err
+	}
+	buf := prgBytes(prg, nil, len(chis)*16)
+	for j := range chis {
+		chis[j].SetBytes(buf[j*16:])
+	}
+	return nil
+}
+
+// gfMul multiplies the labels in GF(2^128) with the reduction
+// polynomial x^128 + x^7 + x^2 + x + 1. The label bits are
+// interpreted as with labelBit.
+func gfMul(a, b Label) Label {
+	var result Label
+
+	for i := 0; i < 128; i++ {
+		if labelBit(a, i) == 1 {
+			result.Xor(b)
+		}
+		carry := b.D0 >> 63
+		b.D0 = b.D0<<1 | b.D1>>63
+		b.D1 <<= 1
+		if carry != 0 {
+			b.D1 ^= 0x87
+		}
+	}
+	return result
+}
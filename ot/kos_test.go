@@ -0,0 +1,130 @@
+//
+// kos_test.go
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package ot
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestKOS(t *testing.T) {
+	testOT(NewKOS(NewCO()), NewKOS(NewCO()), t)
+}
+
+func TestKOSBatches(t *testing.T) {
+	testOTSize(NewKOS(NewCO()), NewKOS(NewCO()), 2*iknpBatchSize+5, t)
+}
+
+func TestGFMul(t *testing.T) {
+	one := Label{D1: 1}
+	for i := 0; i < 16; i++ {
+		a, err := NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !gfMul(a, one).Equal(a) {
+			t.Errorf("a*1 != a")
+		}
+		if !gfMul(a, b).Equal(gfMul(b, a)) {
+			t.Errorf("a*b != b*a")
+		}
+		bc := b
+		bc.Xor(c)
+		ab := gfMul(a, b)
+		ab.Xor(gfMul(a, c))
+		if !gfMul(a, bc).Equal(ab) {
+			t.Errorf("a*(b+c) != a*b+a*c")
+		}
+	}
+}
+
+// cheatingIO flips one bit of the even columns of the receiver's
+// matrix U. This corresponds to a receiver using inconsistent choice
+// bits in order to learn the sender's secret s.
+type cheatingIO struct {
+	IO
+	active bool
+	column int
+}
+
+func (c *cheatingIO) SendData(val []byte) error {
+	if c.active && c.column < IKNPK {
+		if c.column%2 == 0 {
+			tampered := make([]byte, len(val))
+			copy(tampered, val)
+			tampered[0] ^= 1
+			val = tampered
+		}
+		c.column++
+	}
+	return c.IO.SendData(val)
+}
+
+func TestKOSMaliciousReceiver(t *testing.T) {
+	sender := NewKOS(NewCO())
+	receiver := NewKOS(NewCO())
+
+	wires := make([]Wire, 64)
+	for i := 0; i < len(wires); i++ {
+		l0, err := NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l1, err := NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wires[i].L0 = l0
+		wires[i].L1 = l1
+	}
+	flags := make([]bool, len(wires))
+	labels := make([]Label, len(wires))
+
+	pipe, rPipe := NewPipe()
+	cheater := &cheatingIO{
+		IO: rPipe,
+	}
+	done := make(chan error)
+
+	go func() {
+		err := receiver.InitReceiver(cheater)
+		if err != nil {
+			done <- err
+			return
+		}
+		cheater.active = true
+		done <- receiver.Receive(flags, labels)
+	}()
+
+	err := sender.InitSender(pipe)
+	if err != nil {
+		t.Fatalf("InitSender: %v", err)
+	}
+	err = sender.Send(wires)
+	if !errors.Is(err, ErrConsistencyCheck) {
+		t.Errorf("Send: expected ErrConsistencyCheck, got %v", err)
+	}
+	err = <-done
+	if !errors.Is(err, ErrConsistencyCheck) {
+		t.Errorf("Receive: expected ErrConsistencyCheck, got %v", err)
+	}
+}
+
+func BenchmarkOTKOS_1024(b *testing.B) {
+	benchmarkOT(NewKOS(NewCO()), NewKOS(NewCO()), 1024, b)
+}
@@ -1,12 +1,17 @@
 //
 // ot.go
 //
-// Copyright (c) 2023 Markku Rossi
+// Copyright (c) 2023-2024 Markku Rossi
 //
 // All rights reserved.
 
 package ot
 
+import (
+	"fmt"
+	"strings"
+)
+
 // OT defines Oblivious Transfer protocol.
 type OT interface {
 	// InitSender initializes the OT sender.
@@ -21,3 +26,59 @@ type OT interface {
 	// Receive receives the wire labels with OT based on the flag values.
 	Receive(flags []bool, result []Label) error
 }
+
+// Name returns the name of the OT algorithm. The names of the OT
+// extensions include the name of their base OT.
+func Name(o OT) string {
+	switch o := o.(type) {
+	case *CO:
+		return "co"
+	case *RSA:
+		return strings.ToLower(o.name)
+	case *IKNP:
+		return fmt.Sprintf("iknp(%s)", Name(o.base))
+	case *KOS:
+		return fmt.Sprintf("kos(%s)", Name(o.base))
+	default:
+		return fmt.Sprintf("%T", o)
+	}
+}
+
+// Negotiate verifies that the peer uses the same OT algorithm. Both
+// parties announce their algorithm names and the function returns an
+// error if the names differ. The OT sender announces its algorithm
+// first.
+func Negotiate(io IO, o OT, sender bool) error {
+	name := Name(o)
+	var peer []byte
+	var err error
+
+	if sender {
+		if err = io.SendData([]byte(name)); err != nil {
+			return err
+		}
+		if err = io.Flush(); err != nil {
+			return err
+		}
+		peer, err = io.ReceiveData()
+		if err != nil {
+			return err
+		}
+	} else {
+		peer, err = io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		if err = io.SendData([]byte(name)); err != nil {
+			return err
+		}
+		if err = io.Flush(); err != nil {
+			return err
+		}
+	}
+	if string(peer) != name {
+		return fmt.Errorf("OT algorithm mismatch: %s, peer uses %s",
+			name, peer)
+	}
+	return nil
+}
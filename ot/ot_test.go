@@ -15,8 +15,10 @@ import (
 )
 
 func testOT(sender, receiver OT, t *testing.T) {
-	const size int = 64
+	testOTSize(sender, receiver, 64, t)
+}
 
+func testOTSize(sender, receiver OT, size int, t *testing.T) {
 	wires := make([]Wire, size)
 	flags := make([]bool, size)
 	labels := make([]Label, size)
@@ -99,6 +101,14 @@ func TestOTRSA(t *testing.T) {
 	testOT(NewRSA(2048), NewRSA(2048), t)
 }
 
+func TestOTIKNP(t *testing.T) {
+	testOT(NewIKNP(NewCO()), NewIKNP(NewCO()), t)
+}
+
+func TestOTIKNPBatches(t *testing.T) {
+	testOTSize(NewIKNP(NewCO()), NewIKNP(NewCO()), 3*iknpBatchSize+17, t)
+}
+
 func benchmarkOT(sender, receiver OT, batchSize int, b *testing.B) {
 	wires := make([]Wire, batchSize)
 	flags := make([]bool, batchSize)
@@ -198,6 +208,18 @@ func BenchmarkOTCO_64(b *testing.B) {
 	benchmarkOT(NewCO(), NewCO(), 64, b)
 }
 
+func BenchmarkOTIKNP_64(b *testing.B) {
+	benchmarkOT(NewIKNP(NewCO()), NewIKNP(NewCO()), 64, b)
+}
+
+func BenchmarkOTIKNP_1024(b *testing.B) {
+	benchmarkOT(NewIKNP(NewCO()), NewIKNP(NewCO()), 1024, b)
+}
+
+func BenchmarkOTIKNP_8192(b *testing.B) {
+	benchmarkOT(NewIKNP(NewCO()), NewIKNP(NewCO()), 8192, b)
+}
+
 func benchmarkOTRSA(keySize, batchSize int, b *testing.B) {
 	benchmarkOT(NewRSA(keySize), NewRSA(keySize), batchSize, b)
 }
@@ -213,3 +235,35 @@ func BenchmarkOTRSA_2048_8(b *testing.B) {
 func BenchmarkOTRSA_2048_64(b *testing.B) {
 	benchmarkOTRSA(2048, 64, b)
 }
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		sender   OT
+		receiver OT
+		ok       bool
+	}{
+		{NewCO(), NewCO(), true},
+		{NewIKNP(NewCO()), NewIKNP(NewCO()), true},
+		{NewKOS(NewCO()), NewKOS(NewCO()), true},
+		{NewIKNP(NewCO()), NewKOS(NewCO()), false},
+		{NewCO(), NewIKNP(NewCO()), false},
+		{NewRSA(2048), NewRSA(1024), false},
+	}
+	for idx, test := range tests {
+		pipe, rPipe := NewPipe()
+		done := make(chan error)
+		go func() {
+			done <- Negotiate(rPipe, test.receiver, false)
+		}()
+		err := Negotiate(pipe, test.sender, true)
+		rErr := <-done
+		if test.ok && (err != nil || rErr != nil) {
+			t.Errorf("test %d: %s and %s: %v, %v", idx, Name(test.sender),
+				Name(test.receiver), err, rErr)
+		}
+		if !test.ok && (err == nil || rErr == nil) {
+			t.Errorf("test %d: %s and %s accepted", idx, Name(test.sender),
+				Name(test.receiver))
+		}
+	}
+}
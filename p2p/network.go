@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -22,6 +22,7 @@ import (
 type Network struct {
 	ID       int
 	m        sync.Mutex
+	c        *sync.Cond
 	Peers    map[int]*Peer
 	addr     string
 	listener net.Listener
@@ -39,27 +40,46 @@ func NewNetwork(addr string, id int) (*Network, error) {
 		addr:     addr,
 		listener: listener,
 	}
+	nw.c = sync.NewCond(&nw.m)
 	go nw.acceptLoop()
 	return nw, nil
 }
 
-// Close closes the network.
+// Close closes the network and all peer connections. Any pending
+// data is flushed to the peers before the connections are closed.
 func (nw *Network) Close() error {
-	return nw.listener.Close()
+	err := nw.listener.Close()
+
+	nw.m.Lock()
+	defer nw.m.Unlock()
+	for _, peer := range nw.Peers {
+		if cerr := peer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Addr returns the network's listener address.
+func (nw *Network) Addr() net.Addr {
+	return nw.listener.Addr()
 }
 
-// AddPeer adds a peer to the network.
+// AddPeer adds a peer to the network. The peers with smaller IDs are
+// connected and the function waits until the peers with bigger IDs
+// have connected us.
 func (nw *Network) AddPeer(addr string, id int) error {
-	// Try to connect to peer.
-	for {
-		// Check if we have already accepted peer `id`.
+	if id > nw.ID {
 		nw.m.Lock()
-		_, ok := nw.Peers[id]
-		nw.m.Unlock()
-		if ok {
-			return nil
+		for nw.Peers[id] == nil {
+			nw.c.Wait()
 		}
+		nw.m.Unlock()
+		return nil
+	}
 
+	// Try to connect to peer.
+	for {
 		log.Printf("NW %d: Connecting to peer %d...\n", nw.ID, id)
 		nc, err := net.Dial("tcp", addr)
 		if err != nil {
@@ -80,9 +100,7 @@ func (nw *Network) AddPeer(addr string, id int) error {
 			conn.Close()
 			return err
 		}
-		if err := nw.newPeer(true, conn, id); err != nil {
-			fmt.Printf("Failed to add peer: %s\n", err)
-		}
+		return nw.newPeer(true, conn, id)
 	}
 }
 
@@ -95,7 +113,7 @@ func (nw *Network) Ping() {
 
 // Stats returns the I/O stats from the network.
 func (nw *Network) Stats() IOStats {
-	var result IOStats
+	result := NewIOStats()
 	for _, peer := range nw.Peers {
 		result = result.Add(peer.conn.Stats)
 	}
@@ -128,30 +146,46 @@ func (nw *Network) acceptLoop() {
 
 func (nw *Network) newPeer(client bool, conn *Conn, id int) error {
 	nw.m.Lock()
-	peer, ok := nw.Peers[id]
+	_, ok := nw.Peers[id]
+	nw.m.Unlock()
 	if ok {
-		nw.m.Unlock()
 		log.Printf("NW %d: peer %d already connected\n", nw.ID, id)
 		return conn.Close()
 	}
-	peer = &Peer{
-		id:     id,
-		conn:   conn,
-		client: client,
+	peer := &Peer{
+		id:          id,
+		conn:        conn,
+		client:      client,
+		extSender:   ot.NewIKNP(ot.NewCO()),
+		extReceiver: ot.NewIKNP(ot.NewCO()),
 	}
+	if err := peer.init(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	nw.m.Lock()
 	nw.Peers[id] = peer
+	nw.c.Broadcast()
 	nw.m.Unlock()
 
-	return peer.init()
+	return nil
 }
 
 // Peer implements a peer in the peer-to-peer network.
 type Peer struct {
-	id         int
-	conn       *Conn
-	client     bool
-	otSender   *ot.Sender
-	otReceiver *ot.Receiver
+	id          int
+	conn        *Conn
+	client      bool
+	otSender    *ot.Sender
+	otReceiver  *ot.Receiver
+	extSender   ot.OT
+	extReceiver ot.OT
+}
+
+// ID returns the peer ID.
+func (peer *Peer) ID() int {
+	return peer.id
 }
 
 // Close closes the peer connection.
@@ -167,7 +201,16 @@ func (peer *Peer) Ping() error {
 	return peer.conn.Flush()
 }
 
+// init initializes the RSA oblivious transfer for OTLambda and OTR,
+// and the OT extension for OT.
 func (peer *Peer) init() error {
+	if err := peer.initRSA(); err != nil {
+		return err
+	}
+	return peer.initOT()
+}
+
+func (peer *Peer) initRSA() error {
 	fmt.Printf("peer %d: init\n", peer.id)
 
 	// Read peer public key.
@@ -223,6 +266,37 @@ func (peer *Peer) init() error {
 	return <-finished
 }
 
+// initOT initializes the OT extension in both directions. The client
+// initializes its sender first and the server its receiver.
+func (peer *Peer) initOT() error {
+	if peer.client {
+		if err := peer.extSender.InitSender(peer.conn); err != nil {
+			return err
+		}
+		return peer.extReceiver.InitReceiver(peer.conn)
+	}
+	if err := peer.extReceiver.InitReceiver(peer.conn); err != nil {
+		return err
+	}
+	return peer.extSender.InitSender(peer.conn)
+}
+
+// OT runs oblivious transfers in both directions with the peer. The
+// function sends the wires to the peer and receives the result
+// labels based on the flag values.
+func (peer *Peer) OT(wires []ot.Wire, flags []bool, result []ot.Label) error {
+	if peer.client {
+		if err := peer.extSender.Send(wires); err != nil {
+			return err
+		}
+		return peer.extReceiver.Receive(flags, result)
+	}
+	if err := peer.extReceiver.Receive(flags, result); err != nil {
+		return err
+	}
+	return peer.extSender.Send(wires)
+}
+
 // OTLambda runs the lambda oblivious transfers with peers.
 func (peer *Peer) OTLambda(count int, choices, x1, x2 *big.Int) (
 	result *big.Int, err error) {
@@ -638,3 +712,99 @@ func (peer *Peer) exchangeReceiveArr() ([]ot.Label, error) {
 	}
 	return result, nil
 }
+
+// ExchangeLabels sends the labels to the peer and returns the labels
+// the peer sent.
+func (peer *Peer) ExchangeLabels(labels []ot.Label) ([]ot.Label, error) {
+	if peer.client {
+		if err := peer.sendLabels(labels); err != nil {
+			return nil, err
+		}
+		return peer.receiveLabels()
+	}
+	result, err := peer.receiveLabels()
+	if err != nil {
+		return nil, err
+	}
+	return result, peer.sendLabels(labels)
+}
+
+func (peer *Peer) sendLabels(labels []ot.Label) error {
+	if err := peer.conn.SendUint32(len(labels)); err != nil {
+		return err
+	}
+	var data ot.LabelData
+	for _, label := range labels {
+		if err := peer.conn.SendLabel(label, &data); err != nil {
+			return err
+		}
+	}
+	return peer.conn.Flush()
+}
+
+func (peer *Peer) receiveLabels() ([]ot.Label, error) {
+	count, err := peer.conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ot.Label, count)
+	var data ot.LabelData
+	for i := 0; i < count; i++ {
+		if err := peer.conn.ReceiveLabel(&result[i], &data); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ExchangeBits sends the bits to the peer and returns the bits the
+// peer sent.
+func (peer *Peer) ExchangeBits(bits []bool) ([]bool, error) {
+	if peer.client {
+		if err := peer.sendBits(bits); err != nil {
+			return nil, err
+		}
+		return peer.receiveBits()
+	}
+	result, err := peer.receiveBits()
+	if err != nil {
+		return nil, err
+	}
+	return result, peer.sendBits(bits)
+}
+
+func (peer *Peer) sendBits(bits []bool) error {
+	if err := peer.conn.SendUint32(len(bits)); err != nil {
+		return err
+	}
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				b |= 1 << j
+			}
+		}
+		if err := peer.conn.SendByte(b); err != nil {
+			return err
+		}
+	}
+	return peer.conn.Flush()
+}
+
+func (peer *Peer) receiveBits() ([]bool, error) {
+	count, err := peer.conn.ReceiveUint32()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bool, count)
+	for i := 0; i < count; i += 8 {
+		b, err := peer.conn.ReceiveByte()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < 8 && i+j < count; j++ {
+			result[i+j] = b&(1<<j) != 0
+		}
+	}
+	return result, nil
+}
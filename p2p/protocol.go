@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,6 +7,7 @@
 package p2p
 
 import (
+	"encoding/binary"
 	"io"
 	"sync/atomic"
 
@@ -165,7 +166,7 @@ func (c *Conn) Close() error {
 	}
 	// Wait that flush completes.
 	close(c.toWriter)
-	for range <-c.fromWriter {
+	for range c.fromWriter {
 	}
 	if c.writerErr != nil {
 		return c.writerErr
@@ -217,6 +218,18 @@ func (c *Conn) SendUint32(val int) error {
 	return nil
 }
 
+// SendUint64 sends an uint64 value.
+func (c *Conn) SendUint64(val uint64) error {
+	if c.WritePos+8 > len(c.WriteBuf) {
+		if err := c.Flush(); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint64(c.WriteBuf[c.WritePos:], val)
+	c.WritePos += 8
+	return nil
+}
+
 // SendData sends binary data.
 func (c *Conn) SendData(val []byte) error {
 	if c.WritePos+4+len(val) > len(c.WriteBuf) {
@@ -311,6 +324,19 @@ func (c *Conn) ReceiveUint32() (int, error) {
 	return int(val), nil
 }
 
+// ReceiveUint64 receives an uint64 value.
+func (c *Conn) ReceiveUint64() (uint64, error) {
+	if c.ReadStart+8 > c.ReadEnd {
+		if err := c.Fill(8); err != nil {
+			return 0, err
+		}
+	}
+	val := binary.BigEndian.Uint64(c.ReadBuf[c.ReadStart:])
+	c.ReadStart += 8
+
+	return val, nil
+}
+
 // ReceiveData receives binary data.
 func (c *Conn) ReceiveData() ([]byte, error) {
 	len, err := c.ReceiveUint32()
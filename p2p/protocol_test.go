@@ -1,7 +1,7 @@
 //
 // protocol_test.go
 //
-// Copyright (c) 2023 Markku Rossi
+// Copyright (c) 2023-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"testing"
+	"time"
 )
 
 type pipe struct {
@@ -47,6 +48,7 @@ var tests = []interface{}{
 	byte(42),
 	uint16(43),
 	uint32(44),
+	uint64(0x0123456789abcdef),
 	"Hello, world!",
 }
 
@@ -68,6 +70,11 @@ func writer(c *Conn) {
 				fmt.Printf("SendUint32: %v\n", err)
 			}
 
+		case uint64:
+			if err := c.SendUint64(d); err != nil {
+				fmt.Printf("SendUint64: %v\n", err)
+			}
+
 		case string:
 			if err := c.SendString(d); err != nil {
 				fmt.Printf("SendString: %v\n", err)
@@ -118,6 +125,15 @@ func TestProtocol(t *testing.T) {
 				t.Errorf("ReceiveUint32: got %v, expected %v", v, d)
 			}
 
+		case uint64:
+			v, err := c.ReceiveUint64()
+			if err != nil {
+				t.Fatalf("ReceiveUint64: %v", err)
+			}
+			if v != d {
+				t.Errorf("ReceiveUint64: got %v, expected %v", v, d)
+			}
+
 		case string:
 			v, err := c.ReceiveString()
 			if err != nil {
@@ -135,3 +151,46 @@ func TestProtocol(t *testing.T) {
 		t.Errorf("Close: %v", err)
 	}
 }
+
+type slowWriter struct {
+	written int
+	closed  bool
+}
+
+func (w *slowWriter) Read(data []byte) (n int, err error) {
+	return 0, io.EOF
+}
+
+func (w *slowWriter) Write(data []byte) (n int, err error) {
+	time.Sleep(50 * time.Millisecond)
+	w.written += len(data)
+	return len(data), nil
+}
+
+func (w *slowWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestCloseDrainsWriter(t *testing.T) {
+	w := new(slowWriter)
+	c := NewConn(w)
+
+	const count = 256
+	data := make([]byte, 1024)
+	for i := 0; i < count; i++ {
+		if err := c.SendData(data); err != nil {
+			t.Fatalf("SendData failed: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !w.closed {
+		t.Errorf("connection not closed")
+	}
+	if w.written != count*(len(data)+4) {
+		t.Errorf("Close returned before writer completed: written=%d, "+
+			"expected %d", w.written, count*(len(data)+4))
+	}
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// NewTLSConfig creates a mutual-TLS configuration for the
+// garbler-evaluator protocol. The certFile and keyFile specify our
+// certificate and private key and the peerCertFile specifies the
+// pinned certificate of the peer. The peer is authenticated by
+// comparing its certificate with the pinned certificate so the
+// certificates can be self-signed. The same configuration can be used
+// both for listening and for dialing.
+func NewTLSConfig(certFile, keyFile, peerCertFile string) (
+	*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	peerCert, err := loadCertificate(peerCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS13,
+		// The peer certificate is verified against the pinned
+		// certificate in VerifyPeerCertificate.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte,
+			_ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("peer did not present a certificate")
+			}
+			if !bytes.Equal(rawCerts[0], peerCert.Raw) {
+				return errors.New("peer certificate does not match " +
+					"pinned certificate")
+			}
+			return nil
+		},
+	}, nil
+}
+
+func loadCertificate(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no certificate found", file)
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// Listen creates a TCP listener for the address. If the config is
+// not nil, the accepted connections are wrapped in TLS.
+func Listen(addr string, config *tls.Config) (net.Listener, error) {
+	if config != nil {
+		return tls.Listen("tcp", addr, config)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Dial connects to the address. If the config is not nil, the
+// connection is wrapped in TLS and the TLS handshake is completed
+// before the function returns.
+func Dial(addr string, config *tls.Config) (net.Conn, error) {
+	if config != nil {
+		return tls.Dial("tcp", addr, config)
+	}
+	return net.Dial("tcp", addr)
+}
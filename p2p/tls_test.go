@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert string
+	key  string
+}
+
+func newTestCert(t *testing.T, dir, name string) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := testCert{
+		cert: filepath.Join(dir, name+".crt"),
+		key:  filepath.Join(dir, name+".key"),
+	}
+	err = os.WriteFile(result.cert, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: der,
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(result.key, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: keyDer,
+	}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func tlsExchange(t *testing.T, server, client *tls.Config) error {
+	ln, err := Listen("127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error)
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		if err := nc.(*tls.Conn).Handshake(); err != nil {
+			nc.Close()
+			done <- err
+			return
+		}
+		conn := NewConn(nc)
+		if err := conn.SendString("Hello, client!"); err != nil {
+			conn.Close()
+			done <- err
+			return
+		}
+		done <- conn.Close()
+	}()
+
+	nc, err := Dial(ln.Addr().String(), client)
+	if err != nil {
+		<-done
+		return err
+	}
+	conn := NewConn(nc)
+	defer conn.Close()
+
+	msg, err := conn.ReceiveString()
+	if err != nil {
+		<-done
+		return err
+	}
+	if msg != "Hello, client!" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	return <-done
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	evaluator := newTestCert(t, dir, "evaluator")
+	garbler := newTestCert(t, dir, "garbler")
+
+	server, err := NewTLSConfig(evaluator.cert, evaluator.key, garbler.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewTLSConfig(garbler.cert, garbler.key, evaluator.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlsExchange(t, server, client); err != nil {
+		t.Fatalf("TLS exchange failed: %v", err)
+	}
+}
+
+func TestTLSPinnedMismatch(t *testing.T) {
+	dir := t.TempDir()
+	evaluator := newTestCert(t, dir, "evaluator")
+	garbler := newTestCert(t, dir, "garbler")
+	attacker := newTestCert(t, dir, "attacker")
+
+	server, err := NewTLSConfig(evaluator.cert, evaluator.key, garbler.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewTLSConfig(attacker.cert, attacker.key, evaluator.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlsExchange(t, server, client); err == nil {
+		t.Fatalf("TLS exchange succeeded with unpinned client certificate")
+	}
+
+	// Client pinning the wrong server certificate.
+	client, err = NewTLSConfig(garbler.cert, garbler.key, attacker.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlsExchange(t, server, client); err == nil {
+		t.Fatalf("TLS exchange succeeded with unpinned server certificate")
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2019-2023 Markku Rossi
+// Copyright (c) 2019-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,17 +8,23 @@ package mpc
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"reflect"
+	"strings"
 	"unicode"
 
 	"github.com/markkurossi/mpc/circuit"
 	"github.com/markkurossi/mpc/types"
 )
 
-// PrintResults prints the result values.
+// PrintResults prints the result values. The nil result values of
+// the outputs the party does not learn are not printed.
 func PrintResults(results []*big.Int, outputs circuit.IO) {
 	for idx, value := range Results(results, outputs) {
+		if value == nil {
+			continue
+		}
 		fmt.Printf("Result[%d]: ", idx)
 		switch v := value.(type) {
 		case []byte:
@@ -29,11 +35,17 @@ func PrintResults(results []*big.Int, outputs circuit.IO) {
 	}
 }
 
-// Results return the result values as an array of Go values.
+// Results return the result values as an array of Go values. The nil
+// result values are returned as nil values.
 func Results(results []*big.Int, outputs circuit.IO) []interface{} {
 	var ret []interface{}
 
 	for idx, result := range results {
+		if result == nil {
+			// The output is not revealed to this party.
+			ret = append(ret, nil)
+			continue
+		}
 		var r interface{}
 		if outputs == nil {
 			r = Result(result, circuit.IOArg{
@@ -106,6 +118,19 @@ func Result(result *big.Int, output circuit.IOArg) interface{} {
 	case types.TBool:
 		return result.Uint64() != 0
 
+	case types.TFloat:
+		switch output.Type.Bits {
+		case 32:
+			return math.Float32frombits(uint32(result.Uint64()))
+		case 64:
+			return math.Float64frombits(result.Uint64())
+		default:
+			return fmt.Sprintf("%v (%s)", result, output.Type)
+		}
+
+	case types.TFixed:
+		return fixedResult(result, output.Type)
+
 	case types.TArray:
 		count := int(output.Type.ArraySize)
 		elSize := int(output.Type.ElementType.Bits)
@@ -151,6 +176,16 @@ func Result(result *big.Int, output circuit.IOArg) interface{} {
 		case types.TBool:
 			elementType = reflect.TypeOf(true)
 
+		case types.TFixed:
+			elementType = reflect.TypeOf("")
+
+		case types.TFloat:
+			if elSize == 32 {
+				elementType = reflect.TypeOf(float32(0))
+			} else {
+				elementType = reflect.TypeOf(float64(0))
+			}
+
 		default:
 			elementType = reflect.TypeOf(nil)
 		}
@@ -173,3 +208,16 @@ func Result(result *big.Int, output circuit.IOArg) interface{} {
 		return fmt.Sprintf("%v (%s)", result, output.Type)
 	}
 }
+
+// fixedResult returns the fixed-point value as an exact decimal
+// string.
+func fixedResult(val *big.Int, t types.Info) string {
+	r := new(big.Rat).SetFrac(intResult(val, t),
+		new(big.Int).Lsh(big.NewInt(1), uint(t.Frac)))
+	str := r.FloatString(int(t.Frac))
+	if strings.IndexByte(str, '.') >= 0 {
+		str = strings.TrimRight(str, "0")
+		str = strings.TrimSuffix(str, ".")
+	}
+	return str
+}
@@ -0,0 +1,401 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler"
+	"github.com/markkurossi/mpc/compiler/utils"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+	"github.com/markkurossi/mpc/types"
+)
+
+// Role specifies the party's role in a two-party computation.
+type Role int
+
+// Two-party computation roles.
+const (
+	Garbler   Role = Role(circuit.IDGarbler)
+	Evaluator Role = Role(circuit.IDEvaluator)
+)
+
+func (r Role) String() string {
+	switch r {
+	case Garbler:
+		return "garbler"
+	case Evaluator:
+		return "evaluator"
+	default:
+		return fmt.Sprintf("{Role %d}", int(r))
+	}
+}
+
+// Program specifies a two-party computation program. The program is
+// either a compiled circuit or an MPCL program that is compiled for
+// the parties' input sizes.
+type Program struct {
+	circ   *circuit.Circuit
+	file   string
+	source string
+}
+
+// NewCircuitProgram creates a program from the compiled circuit.
+func NewCircuitProgram(circ *circuit.Circuit) *Program {
+	return &Program{
+		circ: circ,
+	}
+}
+
+// NewFileProgram creates a program from the MPCL or circuit file.
+func NewFileProgram(file string) *Program {
+	return &Program{
+		file: file,
+	}
+}
+
+// NewSourceProgram creates a program from the MPCL source code.
+func NewSourceProgram(source string) *Program {
+	return &Program{
+		source: source,
+	}
+}
+
+func (p *Program) circuit(params *utils.Params, inputSizes [][]int) (
+	*circuit.Circuit, error) {
+
+	if p.circ != nil {
+		return p.circ, nil
+	}
+	if len(p.file) > 0 {
+		if circuit.IsFilename(p.file) {
+			return circuit.Parse(p.file)
+		}
+		circ, _, err := compiler.New(params).CompileFile(p.file, inputSizes)
+		return circ, err
+	}
+	circ, _, err := compiler.New(params).Compile(p.source, inputSizes)
+	return circ, err
+}
+
+// Session implements a two-party computation session over a
+// connection to the peer.
+type Session struct {
+	// Params specify the compiler parameters for MPCL programs.
+	Params *utils.Params
+
+	// OT specifies the oblivious transfer algorithm. Both parties
+	// must use the same algorithm or the session fails with an
+	// error.
+	OT ot.OT
+
+	// Scheme specifies the most efficient garbling scheme the party
+	// is willing to use. The parties use the less efficient of their
+	// schemes.
+	Scheme circuit.Scheme
+
+	// Verbose enables verbose protocol output.
+	Verbose bool
+
+	role Role
+	conn *p2p.Conn
+}
+
+// NewSession creates a new session with the role over the connection
+// to the peer. The session uses the CO oblivious transfer and the
+// half-gates garbling scheme by default.
+func NewSession(conn io.ReadWriter, role Role) *Session {
+	return &Session{
+		Params: utils.NewParams(),
+		OT:     ot.NewCO(),
+		Scheme: circuit.HalfGates,
+		role:   role,
+		conn:   p2p.NewConn(conn),
+	}
+}
+
+// Role returns the session's role.
+func (s *Session) Role() Role {
+	return s.role
+}
+
+// Stats returns the session's I/O statistics.
+func (s *Session) Stats() p2p.IOStats {
+	return s.conn.Stats
+}
+
+// Close flushes any pending data and closes the session's
+// connection.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Run runs the program with the inputs. The function negotiates the
+// input sizes with the peer, compiles the program if needed, and
+// garbles or evaluates the circuit based on the session's role. The
+// inputs are Go values that are encoded with Marshal. If the program
+// argument is a struct, the inputs can be either the struct value or
+// the values of the struct fields. The *big.Int inputs do not reveal
+// their sizes to the peer so their arguments must have sized types.
+// The function returns the program's results as Go values.
+func (s *Session) Run(prog *Program, inputs ...interface{}) (
+	[]interface{}, error) {
+
+	sizes, err := inputBits(inputs)
+	if err != nil {
+		return nil, err
+	}
+	peerSizes, err := s.exchangeInputSizes(sizes)
+	if err != nil {
+		return nil, err
+	}
+	inputSizes := make([][]int, 2)
+	inputSizes[s.role] = sizes
+	inputSizes[1-s.role] = peerSizes
+
+	circ, err := prog.circuit(s.Params, inputSizes)
+	if err != nil {
+		return nil, err
+	}
+	if len(circ.Inputs) != 2 {
+		return nil, fmt.Errorf("invalid circuit for 2-party MPC: %d parties",
+			len(circ.Inputs))
+	}
+	input, err := marshalInputs(inputs, circ.Inputs[s.role])
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*big.Int
+	if s.role == Garbler {
+		result, err = circuit.Garbler(s.conn, s.OT, circ, input, s.Scheme,
+			s.Verbose)
+	} else {
+		result, err = circuit.Evaluator(s.conn, s.OT, circ, input, s.Scheme,
+			s.Verbose)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Results(result, circ.Outputs), nil
+}
+
+// Stream runs the program with the inputs in the streaming mode. The
+// garbler compiles the MPCL program and streams the garbled circuits
+// to the evaluator. The evaluator receives the program from the
+// garbler. If the evaluator's program is not nil, the evaluator
+// compiles the MPCL program and verifies that the garbler streams
+// the same program. The inputs are encoded with Marshal as in Run.
+func (s *Session) Stream(prog *Program, inputs ...interface{}) (
+	[]interface{}, error) {
+
+	sizes, err := inputBits(inputs)
+	if err != nil {
+		return nil, err
+	}
+	input := func(arg circuit.IOArg) (*big.Int, error) {
+		return marshalInputs(inputs, arg)
+	}
+
+	if s.role == Evaluator {
+		if err := s.conn.SendInputSizes(sizes); err != nil {
+			return nil, err
+		}
+		if err := s.conn.Flush(); err != nil {
+			return nil, err
+		}
+		var verifier circuit.StreamVerifier
+		if prog != nil {
+			verifier, err = s.streamVerifier(prog, sizes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		outputs, result, err := circuit.StreamEvaluatorInput(s.conn, s.OT,
+			s.Scheme, input, verifier, s.Verbose)
+		if err != nil {
+			return nil, err
+		}
+		return Results(result, outputs), nil
+	}
+
+	if prog == nil || prog.circ != nil {
+		return nil, fmt.Errorf("streaming mode requires MPCL program")
+	}
+	peerSizes, err := s.conn.ReceiveInputSizes()
+	if err != nil {
+		return nil, err
+	}
+	inputSizes := [][]int{sizes, peerSizes}
+
+	params := *s.Params
+	params.Scheme = s.Scheme
+
+	var outputs circuit.IO
+	var result []*big.Int
+	if len(prog.file) > 0 {
+		outputs, result, err = compiler.New(&params).StreamFileInput(s.conn,
+			s.OT, prog.file, input, inputSizes)
+	} else {
+		outputs, result, err = compiler.New(&params).StreamInput(s.conn,
+			s.OT, prog.source, input, inputSizes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Results(result, outputs), nil
+}
+
+func (s *Session) streamVerifier(prog *Program, sizes []int) (
+	circuit.StreamVerifier, error) {
+
+	if prog.circ != nil {
+		return nil, fmt.Errorf("streaming mode requires MPCL program")
+	}
+	return func(in1, in2 circuit.IOArg, outputs circuit.IO) ([]byte, error) {
+		var peerSizes []int
+		if len(in1.Compound) > 0 {
+			for _, arg := range in1.Compound {
+				peerSizes = append(peerSizes, int(arg.Type.Bits))
+			}
+		} else {
+			peerSizes = append(peerSizes, int(in1.Type.Bits))
+		}
+		inputSizes := [][]int{peerSizes, sizes}
+
+		var in, out circuit.IO
+		var hash []byte
+		var err error
+		if len(prog.file) > 0 {
+			in, out, hash, err = compiler.New(s.Params).StreamHashFile(
+				prog.file, inputSizes)
+		} else {
+			in, out, hash, err = compiler.New(s.Params).StreamHash(
+				prog.source, inputSizes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if in[0].String() != in1.String() || in[1].String() != in2.String() {
+			return nil, fmt.Errorf("program inputs mismatch: got %s, "+
+				"expected %s", circuit.IO{in1, in2}, in)
+		}
+		if out.String() != outputs.String() {
+			return nil, fmt.Errorf("program outputs mismatch: got %s, "+
+				"expected %s", outputs, out)
+		}
+		return hash, nil
+	}, nil
+}
+
+// exchangeInputSizes sends our input sizes to the peer and returns
+// the peer's input sizes. The evaluator sends its sizes first.
+func (s *Session) exchangeInputSizes(sizes []int) ([]int, error) {
+	if s.role == Evaluator {
+		if err := s.conn.SendInputSizes(sizes); err != nil {
+			return nil, err
+		}
+		if err := s.conn.Flush(); err != nil {
+			return nil, err
+		}
+		return s.conn.ReceiveInputSizes()
+	}
+	peerSizes, err := s.conn.ReceiveInputSizes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.conn.SendInputSizes(sizes); err != nil {
+		return nil, err
+	}
+	if err := s.conn.Flush(); err != nil {
+		return nil, err
+	}
+	return peerSizes, nil
+}
+
+// marshalInputs encodes the Go input values into the circuit value of
+// the argument. A single input is encoded as the argument's value and
+// multiple inputs as the values of the compound argument.
+func marshalInputs(inputs []interface{}, arg circuit.IOArg) (*big.Int, error) {
+	if len(inputs) == 1 {
+		return Marshal(inputs[0], arg)
+	}
+	return Marshal(inputs, arg)
+}
+
+// inputBits returns the sizes of the Go input values in bits. The
+// sizes are sent to the peer so they must not depend on the input
+// values. The big integers have size 0 and they take their width from
+// the program's argument type.
+func inputBits(inputs []interface{}) ([]int, error) {
+	var result []int
+	for idx, input := range inputs {
+		bits, ok := valueBits(reflect.ValueOf(input))
+		if !ok {
+			return nil, fmt.Errorf("input %d: unsupported type %T",
+				idx, input)
+		}
+		result = append(result, bits)
+	}
+	return result, nil
+}
+
+func valueBits(v reflect.Value) (int, bool) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return 0, false
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return 1, true
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32,
+		reflect.Float64:
+		return v.Type().Bits(), true
+
+	case reflect.String:
+		return v.Len() * types.ByteBits, true
+
+	case reflect.Pointer:
+		if v.Type() == bigIntPtrType && !v.IsNil() {
+			return 0, true
+		}
+
+	case reflect.Array, reflect.Slice:
+		var result int
+		for i := 0; i < v.Len(); i++ {
+			bits, ok := valueBits(v.Index(i))
+			if !ok {
+				return 0, false
+			}
+			result += bits
+		}
+		return result, true
+
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			return 0, true
+		}
+		var result int
+		for _, idx := range exportedFields(v.Type()) {
+			bits, ok := valueBits(v.Field(idx))
+			if !ok {
+				return 0, false
+			}
+			result += bits
+		}
+		return result, true
+	}
+	return 0, false
+}
@@ -0,0 +1,178 @@
+//
+// Copyright (c) 2024 Markku Rossi
+//
+// All rights reserved.
+//
+
+package mpc
+
+import (
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/markkurossi/mpc/circuit"
+	"github.com/markkurossi/mpc/compiler/utils"
+)
+
+const sessionProgram = `
+package main
+
+func main(a, b int32) (int32, bool) {
+    return a*b - 3, a < b
+}
+`
+
+type sessionFunc func(s *Session, prog *Program, inputs ...interface{}) (
+	[]interface{}, error)
+
+func runSession(t *testing.T, run sessionFunc, garbler, evaluator *Program,
+	gInput, eInput interface{}) ([]interface{}, []interface{}) {
+
+	gc, ec := net.Pipe()
+
+	type result struct {
+		values []interface{}
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		s := NewSession(gc, Garbler)
+		values, err := run(s, garbler, gInput)
+		s.Close()
+		done <- result{
+			values: values,
+			err:    err,
+		}
+	}()
+
+	s := NewSession(ec, Evaluator)
+	eValues, err := run(s, evaluator, eInput)
+	s.Close()
+	g := <-done
+	if g.err != nil {
+		t.Fatalf("garbler failed: %v", g.err)
+	}
+	if err != nil {
+		t.Fatalf("evaluator failed: %v", err)
+	}
+	return g.values, eValues
+}
+
+func TestSessionDefaults(t *testing.T) {
+	gc, _ := net.Pipe()
+	s := NewSession(gc, Garbler)
+	defer gc.Close()
+
+	if s.Scheme != circuit.HalfGates {
+		t.Errorf("default scheme %s, expected %s", s.Scheme,
+			circuit.HalfGates)
+	}
+	if s.Scheme != utils.NewParams().Scheme {
+		t.Errorf("session scheme %s differs from compiler default %s",
+			s.Scheme, utils.NewParams().Scheme)
+	}
+}
+
+func TestSessionRun(t *testing.T) {
+	prog := NewSourceProgram(sessionProgram)
+	expected := []interface{}{int32(39), true}
+
+	g, e := runSession(t, (*Session).Run, prog, prog, int32(6), int32(7))
+	if !reflect.DeepEqual(g, expected) {
+		t.Errorf("garbler: got %v, expected %v", g, expected)
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("evaluator: got %v, expected %v", e, expected)
+	}
+
+	// Compiled circuit.
+	circ, err := prog.circuit(utils.NewParams(), [][]int{{32}, {32}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cprog := NewCircuitProgram(circ)
+	g, e = runSession(t, (*Session).Run, cprog, cprog, int32(6), int32(7))
+	if !reflect.DeepEqual(g, expected) || !reflect.DeepEqual(e, expected) {
+		t.Errorf("circuit: got %v and %v, expected %v", g, e, expected)
+	}
+}
+
+func TestSessionStream(t *testing.T) {
+	prog := NewSourceProgram(sessionProgram)
+	expected := []interface{}{int32(39), false}
+
+	g, e := runSession(t, (*Session).Stream, prog, nil, int32(7), int32(6))
+	if !reflect.DeepEqual(g, expected) {
+		t.Errorf("garbler: got %v, expected %v", g, expected)
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("evaluator: got %v, expected %v", e, expected)
+	}
+
+	// Evaluator verifies the streamed program.
+	g, e = runSession(t, (*Session).Stream, prog, prog, int32(7), int32(6))
+	if !reflect.DeepEqual(g, expected) || !reflect.DeepEqual(e, expected) {
+		t.Errorf("verified: got %v and %v, expected %v", g, e, expected)
+	}
+}
+
+func TestSessionStruct(t *testing.T) {
+	prog := NewSourceProgram(marshalProgram)
+	s := shape{
+		Origin: point{X: 10, Y: 20},
+		Tag:    []byte{1, 2, 3, 4},
+	}
+	expected := []int8{-3, 4, 5, -6}
+
+	for _, run := range []sessionFunc{(*Session).Run, (*Session).Stream} {
+		g, e := runSession(t, run, prog, prog, s, []int8{-3, -4, 5, -6})
+		for _, r := range [][]interface{}{g, e} {
+			if !reflect.DeepEqual(r[1], expected) {
+				t.Errorf("got %v, expected %v", r[1], expected)
+			}
+		}
+	}
+}
+
+const sessionBigProgram = `
+package main
+
+func main(a, b uint128) uint128 {
+    return a + b
+}
+`
+
+func TestSessionBigInt(t *testing.T) {
+	a, _ := new(big.Int).SetString("0xffffffffffffffffffffffff", 0)
+	b := big.NewInt(0)
+	expected := new(big.Int).Add(a, b)
+
+	prog := NewSourceProgram(sessionBigProgram)
+	g, e := runSession(t, (*Session).Run, prog, prog, a, b)
+	for _, r := range [][]interface{}{g, e} {
+		if r[0].(*big.Int).Cmp(expected) != 0 {
+			t.Errorf("got %v, expected %v", r[0], expected)
+		}
+	}
+
+	// The big integers require sized argument types.
+	sizes, err := inputBits([]interface{}{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sizes, []int{0, 0}) {
+		t.Errorf("big.Int sizes %v revealed", sizes)
+	}
+	circ, err := NewSourceProgram(sessionProgram).circuit(utils.NewParams(),
+		[][]int{{32}, {32}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arg := circ.Inputs[0]
+	arg.Type.Bits = 0
+	if _, err := Marshal(b, arg); err == nil {
+		t.Errorf("Marshal into unsized %s succeeded", arg.Type)
+	}
+}
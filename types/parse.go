@@ -1,7 +1,7 @@
 //
 // parse.go
 //
-// Copyright (c) 2021-2023 Markku Rossi
+// Copyright (c) 2021-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -17,6 +17,8 @@ import (
 var (
 	reArr   = regexp.MustCompilePOSIX(`^\[([[:digit:]]+)\](.+)$`)
 	reSized = regexp.MustCompilePOSIX(`^([[:^digit:]]+)([[:digit:]]*)$`)
+	reFixed = regexp.MustCompilePOSIX(
+		`^(fx|fixed)([[:digit:]]+)\.([[:digit:]]+)$`)
 )
 
 // Parse parses type definition and returns its type information.
@@ -37,7 +39,30 @@ func Parse(val string) (info Info, err error) {
 		return
 	}
 
-	m := reSized.FindStringSubmatch(val)
+	m := reFixed.FindStringSubmatch(val)
+	if m != nil {
+		var bits, frac int64
+		bits, err = strconv.ParseInt(m[2], 10, 32)
+		if err != nil {
+			return
+		}
+		frac, err = strconv.ParseInt(m[3], 10, 32)
+		if err != nil {
+			return
+		}
+		if bits < 2 || frac >= bits {
+			return info, fmt.Errorf("types.Parse: invalid fixed type: %s",
+				val)
+		}
+		info.Type = TFixed
+		info.IsConcrete = true
+		info.Bits = Size(bits)
+		info.MinBits = info.Bits
+		info.Frac = Size(frac)
+		return
+	}
+
+	m = reSized.FindStringSubmatch(val)
 	if m != nil {
 		switch m[1] {
 		case "b", "bool":
@@ -49,6 +74,9 @@ func Parse(val string) (info Info, err error) {
 		case "u", "uint":
 			info.Type = TUint
 
+		case "f", "float":
+			info.Type = TFloat
+
 		case "s", "string":
 			info.Type = TString
 
@@ -66,6 +94,10 @@ func Parse(val string) (info Info, err error) {
 			}
 			info.IsConcrete = true
 		}
+		if info.Type == TFloat && bits != 0 && bits != 32 && bits != 64 {
+			return info, fmt.Errorf("types.Parse: unsupported float size: %s",
+				val)
+		}
 		info.Bits = Size(bits)
 		info.MinBits = info.Bits
 		return
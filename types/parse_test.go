@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2021-2023 Markku Rossi
+// Copyright (c) 2021-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -54,6 +54,34 @@ var parseTests = []struct {
 		input: "int32",
 		info:  Int32,
 	},
+	{
+		input: "f32",
+		info:  Float32,
+	},
+	{
+		input: "float64",
+		info:  Float64,
+	},
+	{
+		input: "fixed64.16",
+		info: Info{
+			Type:       TFixed,
+			IsConcrete: true,
+			Bits:       64,
+			MinBits:    64,
+			Frac:       16,
+		},
+	},
+	{
+		input: "fx32.8",
+		info: Info{
+			Type:       TFixed,
+			IsConcrete: true,
+			Bits:       32,
+			MinBits:    32,
+			Frac:       8,
+		},
+	},
 	{
 		input: "string8",
 		info: Info{
@@ -92,4 +120,21 @@ func TestParse(t *testing.T) {
 			t.Errorf("%v != %v", info, test.info)
 		}
 	}
+	if _, err := Parse("float16"); err == nil {
+		t.Errorf("Parse accepted unsupported float size")
+	}
+	for _, input := range []string{"fixed8.8", "fixed1.0", "fixed"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse accepted invalid fixed type %s", input)
+		}
+	}
+	info, err := Parse(Info{
+		Type:       TFixed,
+		IsConcrete: true,
+		Bits:       48,
+		Frac:       12,
+	}.String())
+	if err != nil || info.Bits != 48 || info.Frac != 12 {
+		t.Errorf("fixed type string round trip failed: %v, %v", info, err)
+	}
 }
@@ -1,7 +1,7 @@
 //
 // types.go
 //
-// Copyright (c) 2020-2023 Markku Rossi
+// Copyright (c) 2020-2024 Markku Rossi
 //
 // All rights reserved.
 //
@@ -49,6 +49,7 @@ const (
 	TInt
 	TUint
 	TFloat
+	TFixed
 	TString
 	TStruct
 	TArray
@@ -63,6 +64,7 @@ var Types = map[string]Type{
 	"int":         TInt,
 	"uint":        TUint,
 	"float":       TFloat,
+	"fixed":       TFixed,
 	"string":      TString,
 	"struct":      TStruct,
 	"array":       TArray,
@@ -76,6 +78,7 @@ var shortTypes = map[Type]string{
 	TInt:       "i",
 	TUint:      "u",
 	TFloat:     "f",
+	TFixed:     "fx",
 	TString:    "str",
 	TStruct:    "struct",
 	TArray:     "arr",
@@ -94,6 +97,7 @@ type Info struct {
 	ElementType *Info
 	ArraySize   Size
 	Offset      Size
+	Frac        Size
 }
 
 // Undefined defines type info for undefined types.
@@ -156,6 +160,22 @@ var Uint64 = Info{
 	MinBits:    64,
 }
 
+// Float32 defines type info for 32bit floating point values.
+var Float32 = Info{
+	Type:       TFloat,
+	IsConcrete: true,
+	Bits:       32,
+	MinBits:    32,
+}
+
+// Float64 defines type info for 64bit floating point values.
+var Float64 = Info{
+	Type:       TFloat,
+	IsConcrete: true,
+	Bits:       64,
+	MinBits:    64,
+}
+
 // StructField defines a structure field name and type.
 type StructField struct {
 	Name string
@@ -175,6 +195,9 @@ func (i Info) String() string {
 	case TPtr:
 		return fmt.Sprintf("*%s", i.ElementType)
 
+	case TFixed:
+		return fmt.Sprintf("%s%d.%d", i.Type, i.Bits, i.Frac)
+
 	default:
 		if !i.Concrete() {
 			return i.Type.String()
@@ -191,6 +214,9 @@ func (i Info) ShortString() string {
 	if i.Type == TPtr {
 		return fmt.Sprintf("*%s", i.ElementType.ShortString())
 	}
+	if i.Type == TFixed {
+		return fmt.Sprintf("%s%d.%d", i.Type.ShortString(), i.Bits, i.Frac)
+	}
 	return fmt.Sprintf("%s%d", i.Type.ShortString(), i.Bits)
 }
 
@@ -305,7 +331,7 @@ func (i *Info) InstantiateWithSizes(sizes []int) error {
 	switch i.Type {
 	case TBool:
 
-	case TInt, TUint, TFloat:
+	case TInt, TUint, TFloat, TFixed:
 		if !i.Concrete() {
 			i.Bits = Size(sizes[0])
 		}
@@ -354,6 +380,9 @@ func (i Info) Equal(o Info) bool {
 	case TUndefined, TBool, TInt, TUint, TFloat, TString:
 		return i.Bits == o.Bits
 
+	case TFixed:
+		return i.Bits == o.Bits && i.Frac == o.Frac
+
 	case TStruct:
 		if len(i.Struct) != len(o.Struct) || i.Bits != o.Bits {
 			return false
@@ -389,6 +418,9 @@ func (i Info) Specializable(o Info) bool {
 	case TUndefined, TBool, TInt, TUint, TFloat, TString:
 		return !i.Concrete() || i.Bits == o.Bits
 
+	case TFixed:
+		return i.Bits == o.Bits && i.Frac == o.Frac
+
 	case TStruct:
 		if len(i.Struct) != len(o.Struct) ||
 			(i.Concrete() && i.Bits != o.Bits) {